@@ -15,28 +15,28 @@
 package main
 
 import (
-	"time"
+	"context"
 
 	log "github.com/inconshreveable/log15"
 
+	"github.com/scionproto/scion/go/cert_srv/metrics"
 	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/crypto/cert"
 	"github.com/scionproto/scion/go/lib/ctrl"
 	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/infra/dedupe"
 	"github.com/scionproto/scion/go/lib/snet"
 )
 
-var (
-	// chainReqCache is an expiring cache for pending requests of certificate chains.
-	chainReqCache = NewReqCache(30*time.Second, 10*time.Minute, 1*time.Second)
-)
-
 type ChainHandler struct {
 	conn *snet.Conn
+	// pending are the pending requests for certificate chains, by key.
+	pending *dedupe.Deduper
 }
 
 func NewChainHandler(conn *snet.Conn) *ChainHandler {
-	return &ChainHandler{conn: conn}
+	return &ChainHandler{conn: conn, pending: newPendingReqs("chain")}
 }
 
 // HandleReq handles certificate chain requests. If the certificate chain is not already cached
@@ -49,6 +49,13 @@ func (h *ChainHandler) HandleReq(addr *snet.Addr, req *cert_mgmt.ChainReq) {
 	} else {
 		chain = config.Store.GetChain(req.IA(), req.Version)
 	}
+	if chain != nil {
+		if err := config.Store.CheckRevoked(chain); err != nil {
+			log.Info("Dropping certificate chain request", "addr", addr, "req", req,
+				"err", err)
+			return
+		}
+	}
 	srcLocal := config.PublicAddr.IA.Eq(addr.IA)
 	if chain != nil {
 		if err := h.sendChainRep(addr, chain); err != nil {
@@ -81,8 +88,9 @@ func (h *ChainHandler) sendChainRep(addr *snet.Addr, chain *cert.Chain) error {
 
 // fetchChain fetches certificate chain from the remote AS.
 func (h *ChainHandler) fetchChain(addr *snet.Addr, req *cert_mgmt.ChainReq) error {
-	key := cert.NewKey(req.IA(), req.Version).String()
-	sendReq := chainReqCache.Put(key, addr)
+	key := cert.NewKey(req.IA(), req.Version)
+	sendReq := h.pending.Add(context.Background(), *key, addr.String(),
+		replyFunc(h.conn, addr.Copy(), "certificate chain", key))
 	if sendReq { // rate limit
 		return h.sendChainReq(req)
 	}
@@ -108,37 +116,23 @@ func (h *ChainHandler) HandleRep(addr *snet.Addr, rep *cert_mgmt.Chain) {
 	chain, err := rep.Chain()
 	if err != nil {
 		log.Error("Unable to parse certificate reply", "err", err)
-	}
-	if err = config.Store.AddChain(chain, true); err != nil {
-		log.Error("Unable to store certificate chain", "key", chain.Key(), "err", err)
 		return
 	}
-	key := chain.Key()
-	reqVer := chainReqCache.Pop(key.String())
-	key.Ver = cert_mgmt.NewestVersion
-	reqNew := chainReqCache.Pop(key.String())
-	key.Ver = chain.Leaf.Version
-	if reqVer == nil && reqNew == nil { // No pending requests
+	if err = config.Store.AddChainVerified(chain, true); err != nil {
+		// FIXME(roosd): fetch the missing TRC, if the chain is rejected with
+		// trust.ErrMissingTRC.
+		metrics.ChainsRejected.WithLabelValues(common.GetErrorMsg(err)).Inc()
+		log.Error("Unable to store certificate chain", "key", chain.Key(), "err", err)
 		return
 	}
 	cpld, err := ctrl.NewCertMgmtPld(rep, nil, nil)
 	if err != nil {
-		log.Error("Unable to create certificate chain reply", "key", key, "err", err)
-		return
-	}
-	h.answerReqs(reqVer, cpld, key)
-	h.answerReqs(reqNew, cpld, key)
-}
-
-// answerReqs responds to pending requests.
-func (h *ChainHandler) answerReqs(reqs *AddrSet, cpld *ctrl.Pld, key *cert.Key) {
-	if reqs == nil {
+		log.Error("Unable to create certificate chain reply", "key", chain.Key(), "err", err)
 		return
 	}
-	for _, dst := range reqs.Addrs {
-		if err := SendPayload(h.conn, cpld, dst); err != nil {
-			log.Error("Unable to write certificate chain reply", "key", key, "err", err)
-			continue
-		}
-	}
+	// Answer the pending requests for this version and for the newest version.
+	key := chain.Key()
+	h.pending.Resolve(*key, dedupe.Response{Data: cpld})
+	key.Ver = cert_mgmt.NewestVersion
+	h.pending.Resolve(*key, dedupe.Response{Data: cpld})
 }
@@ -0,0 +1,207 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/cert_srv/metrics"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/proto"
+)
+
+const (
+	ErrNotCore        = "Not a core AS"
+	ErrInvalidSubject = "Subject does not match requester"
+	ErrNotSigned      = "Request not signed"
+	ErrInvalidSigSrc  = "Signature source does not match requester"
+	ErrNoIssuerChain  = "Issuer certificate chain not found"
+	ErrInvalidIssuer  = "Issuer does not match local AS"
+	ErrInvalidPeriod  = "Invalid validity period"
+)
+
+type ChainIssHandler struct {
+	conn *snet.Conn
+}
+
+func NewChainIssHandler(conn *snet.Conn) *ChainIssHandler {
+	return &ChainIssHandler{conn: conn}
+}
+
+// HandleReq handles certificate chain issuance requests from customer ASes. The request must be
+// signed with the current verifying key of the customer. The requested certificate must be issued
+// by the local AS, and its validity period must not have ended and must not exceed
+// cert.DefaultLeafCertValidity. On success, the verifying key of the
+// customer is replaced by the signing key of the new certificate, and the new certificate chain is
+// stored and sent to the requester. If the reply is lost, the requester retries with the same
+// signing key and signs with the replaced verifying key. Such a request is answered with the
+// already issued certificate chain.
+func (h *ChainIssHandler) HandleReq(addr *snet.Addr, req *cert_mgmt.ChainIssReq,
+	signed *ctrl.SignedPld) {
+
+	log.Info("Received certificate chain issuance request", "addr", addr, "req", req)
+	chain, err := h.issue(addr, req, signed)
+	if err != nil {
+		metrics.IssReqsRejected.WithLabelValues(common.GetErrorMsg(err)).Inc()
+		log.Error("Unable to issue certificate chain", "addr", addr, "req", req, "err", err)
+		return
+	}
+	metrics.ChainsIssued.Inc()
+	log.Info("Issued certificate chain", "chain", chain)
+	if err = h.sendChainIssRep(addr, chain); err != nil {
+		log.Error("Unable to send certificate chain issuance reply", "addr", addr,
+			"chain", chain, "err", err)
+	}
+}
+
+// issue verifies the request and issues a new certificate chain for the requester.
+func (h *ChainIssHandler) issue(addr *snet.Addr, req *cert_mgmt.ChainIssReq,
+	signed *ctrl.SignedPld) (*cert.Chain, error) {
+
+	if !config.Topo.Core {
+		return nil, common.NewBasicError(ErrNotCore, nil)
+	}
+	crt, err := req.Cert()
+	if err != nil {
+		return nil, err
+	}
+	if !crt.Subject.Eq(addr.IA) {
+		return nil, common.NewBasicError(ErrInvalidSubject, nil,
+			"subject", crt.Subject, "requester", addr.IA)
+	}
+	if crt.Issuer == nil || !crt.Issuer.Eq(config.PublicAddr.IA) {
+		return nil, common.NewBasicError(ErrInvalidIssuer, nil,
+			"issuer", crt.Issuer, "local", config.PublicAddr.IA)
+	}
+	now := uint64(time.Now().Unix())
+	if crt.ExpirationTime <= now || crt.ExpirationTime <= crt.IssuingTime ||
+		crt.ExpirationTime-crt.IssuingTime > cert.DefaultLeafCertValidity {
+		return nil, common.NewBasicError(ErrInvalidPeriod, nil, "issuingTime",
+			crt.IssuingTime, "expirationTime", crt.ExpirationTime, "now", now)
+	}
+	verifyKey, err := config.GetVerifyingKey(addr.IA)
+	if err != nil {
+		return nil, err
+	}
+	// A request for the current verifying key is a retry of a request that has already been
+	// granted. The requester has not received the reply, and still signs with the replaced key.
+	retry := bytes.Equal(crt.SubjectSignKey, verifyKey)
+	sigKey := verifyKey
+	if retry {
+		if sigKey, err = config.GetPrevVerifyingKey(addr.IA); err != nil {
+			return nil, err
+		}
+	}
+	if err = verifyIssReq(addr, signed, sigKey); err != nil {
+		return nil, err
+	}
+	if retry {
+		prev := config.Store.GetNewestChain(addr.IA)
+		if prev != nil && bytes.Equal(prev.Leaf.SubjectSignKey, crt.SubjectSignKey) {
+			return prev, nil
+		}
+	}
+	issuer := config.Store.GetNewestChain(config.PublicAddr.IA)
+	if issuer == nil {
+		return nil, common.NewBasicError(ErrNoIssuerChain, nil, "ia", config.PublicAddr.IA)
+	}
+	leaf := newLeafCert(crt, issuer)
+	if err = leaf.SignWith(config.GetCoreSigner(), issuer.Core.SignAlgorithm); err != nil {
+		return nil, err
+	}
+	chain := &cert.Chain{Leaf: leaf, Core: issuer.Core.Copy()}
+	if err = config.Store.VerifyChain(chain); err != nil {
+		return nil, err
+	}
+	// Replace the verifying key first. This fails, if a concurrent request has already done so.
+	// On a retry, the key has already been replaced.
+	if !retry {
+		err = config.SetVerifyingKey(addr.IA, leaf.Version, leaf.SubjectSignKey, verifyKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = config.Store.AddChain(chain, true); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// verifyIssReq verifies the signature of the issuance request with the verifying key of the
+// requester.
+func verifyIssReq(addr *snet.Addr, signed *ctrl.SignedPld, verifyKey common.RawBytes) error {
+	if signed.Sign == nil || signed.Sign.Type == proto.SignType_none {
+		return common.NewBasicError(ErrNotSigned, nil)
+	}
+	src, err := ctrl.NewSignSrcDefFromRaw(signed.Sign.Src)
+	if err != nil {
+		return err
+	}
+	if !src.IA.Eq(addr.IA) {
+		return common.NewBasicError(ErrInvalidSigSrc, nil, "src", src, "requester", addr.IA)
+	}
+	return signed.Sign.Verify(verifyKey, signed.Blob)
+}
+
+// newLeafCert creates a new, unsigned leaf certificate for the subject of the requested
+// certificate crt, issued by the core certificate of the issuer chain. The subject's keys and
+// algorithms, and the expiration time are taken from crt, all other values are determined by the
+// issuer. The expiration time is capped at the expiration time of the issuer's core certificate.
+func newLeafCert(crt *cert.Certificate, issuer *cert.Chain) *cert.Certificate {
+	now := uint64(time.Now().Unix())
+	exp := crt.ExpirationTime
+	if exp > issuer.Core.ExpirationTime {
+		exp = issuer.Core.ExpirationTime
+	}
+	ver := crt.Version
+	if prev := config.Store.GetNewestChain(crt.Subject); prev != nil && prev.Leaf.Version >= ver {
+		ver = prev.Leaf.Version + 1
+	}
+	return &cert.Certificate{
+		CanIssue:       false,
+		Comment:        crt.Comment,
+		EncAlgorithm:   crt.EncAlgorithm,
+		ExpirationTime: exp,
+		Issuer:         issuer.Core.Subject.Copy(),
+		IssuingTime:    now,
+		SignAlgorithm:  crt.SignAlgorithm,
+		Subject:        crt.Subject.Copy(),
+		SubjectEncKey:  append(common.RawBytes(nil), crt.SubjectEncKey...),
+		SubjectSignKey: append(common.RawBytes(nil), crt.SubjectSignKey...),
+		TRCVersion:     issuer.Core.TRCVersion,
+		Version:        ver,
+	}
+}
+
+// sendChainIssRep sends the issued certificate chain to the requester.
+func (h *ChainIssHandler) sendChainIssRep(addr *snet.Addr, chain *cert.Chain) error {
+	raw, err := chain.Compress()
+	if err != nil {
+		return err
+	}
+	cpld, err := ctrl.NewCertMgmtPld(&cert_mgmt.ChainIssRep{RawChain: raw}, nil, nil)
+	if err != nil {
+		return err
+	}
+	log.Debug("Send certificate chain issuance reply", "chain", chain, "addr", addr)
+	return SendPayload(h.conn, cpld, addr)
+}
@@ -0,0 +1,342 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/cert_srv/conf"
+	"github.com/scionproto/scion/go/cert_srv/metrics"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/topology"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/lib/trust/issue"
+)
+
+var (
+	fnChain = "../lib/crypto/cert/testdata/ISD1-AS10-V1.crt"
+	fnTRC   = "../lib/crypto/cert/testdata/ISD1-V2.trc"
+
+	coreIA  = &addr.ISD_AS{I: 1, A: 13}
+	custIA  = &addr.ISD_AS{I: 1, A: 10}
+	otherIA = &addr.ISD_AS{I: 1, A: 11}
+)
+
+// testKeys contains the private keys of a test configuration.
+type testKeys struct {
+	// trc is the online root key of core AS 1-13.
+	trc common.RawBytes
+	// core is the core signing key of core AS 1-13.
+	core common.RawBytes
+	// as is the signing key of the configured AS.
+	as common.RawBytes
+	// cust is the signing key of customer AS 1-10, if the configured AS is 1-13.
+	cust common.RawBytes
+}
+
+// loadTestConf sets config to a new configuration of ia in a temporary directory. The
+// configuration contains the test TRC of ISD 1, with core AS 1-13, and a certificate chain for ia
+// issued by 1-13. If ia is 1-13, it is configured as core AS, with customer 1-10.
+func loadTestConf(t *testing.T, ia *addr.ISD_AS) (*testKeys, func()) {
+	dir, err := ioutil.TempDir("", "cert_srv_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	confDir := filepath.Join(dir, "conf")
+	cacheDir := filepath.Join(dir, "cache")
+	stateDir := filepath.Join(dir, "state")
+	for _, d := range []string{filepath.Join(confDir, "certs"), filepath.Join(confDir, "keys"),
+		cacheDir, filepath.Join(stateDir, conf.CustomersDir)} {
+		if err = os.MkdirAll(d, 0755); err != nil {
+			cleanup()
+			t.Fatalf("Unable to create dir: %v", err)
+		}
+	}
+	core := ia.Eq(coreIA)
+	keys := &testKeys{}
+	trcPub, trcPriv := genKeyPair(t)
+	corePub, corePriv := genKeyPair(t)
+	asPub, asPriv := genKeyPair(t)
+	keys.trc, keys.core, keys.as = trcPriv, corePriv, asPriv
+	now := uint64(time.Now().Unix())
+
+	t_ := loadTRC(t)
+	t_.CoreASes[*coreIA].OnlineKey = trcPub
+	t_.CoreASes[*coreIA].OnlineKeyAlg = crypto.Ed25519
+	t_.CreationTime = now - 1<<10
+	t_.ExpirationTime = now + 1<<20
+	t_.GracePeriod = 0
+	writeJSON(t, filepath.Join(confDir, "certs", "ISD1-V2.trc"), t_)
+
+	chain := loadChain(t)
+	chain.Core.SubjectSignKey = corePub
+	chain.Core.IssuingTime = now
+	chain.Core.ExpirationTime = now + 1<<20
+	chain.Core.Sign(trcPriv, crypto.Ed25519)
+	if core {
+		chain.Leaf = chain.Core.Copy()
+		chain.Leaf.CanIssue = false
+	}
+	chain.Leaf.Subject = ia.Copy()
+	chain.Leaf.SubjectSignKey = asPub
+	chain.Leaf.IssuingTime = now
+	chain.Leaf.ExpirationTime = now + cert.DefaultLeafCertValidity
+	chain.Leaf.Sign(corePriv, crypto.Ed25519)
+	writeJSON(t, filepath.Join(confDir, "certs",
+		fmt.Sprintf("ISD%d-AS%d-V%d.crt", ia.I, ia.A, chain.Leaf.Version)), chain)
+
+	writeKey(t, filepath.Join(confDir, "keys", trust.SigKeyFile), asPriv)
+	writeKey(t, filepath.Join(confDir, "keys", trust.DecKeyFile), make(common.RawBytes, 32))
+	if core {
+		writeKey(t, filepath.Join(confDir, "keys", trust.CoreSigKeyFile), corePriv)
+		writeKey(t, filepath.Join(confDir, "keys", trust.OnKeyFile), trcPriv)
+		var custPub common.RawBytes
+		custPub, keys.cust = genKeyPair(t)
+		writeKey(t, filepath.Join(stateDir, conf.CustomersDir,
+			fmt.Sprintf("ISD%d-AS%d-V1.key", custIA.I, custIA.A)), custPub)
+	}
+	eName := fmt.Sprintf("cs%s-1", ia)
+	topo := fmt.Sprintf(`{"ISD_AS": "%s", "Core": %t, "Overlay": "UDP/IPv4", "MTU": 1472,
+		"CertificateService": {"%s": {"Public": [{"Addr": "127.0.0.1", "L4Port": 30081}]}}}`,
+		ia, core, eName)
+	if err = ioutil.WriteFile(filepath.Join(confDir, topology.CfgName), []byte(topo),
+		0644); err != nil {
+		cleanup()
+		t.Fatalf("Unable to write topology: %v", err)
+	}
+	if config, err = conf.Load(eName, confDir, cacheDir, stateDir, nil); err != nil {
+		cleanup()
+		t.Fatalf("Unable to load config: %v", err)
+	}
+	return keys, func() {
+		config.Store.Close()
+		cleanup()
+	}
+}
+
+func genKeyPair(t *testing.T) (common.RawBytes, common.RawBytes) {
+	pub, priv, err := crypto.GenKeyPair(crypto.Ed25519)
+	if err != nil {
+		t.Fatalf("Unable to generate key pair: %v", err)
+	}
+	return pub, priv
+}
+
+func writeJSON(t *testing.T, path string, j trust.JSON) {
+	raw, err := j.JSON(true)
+	if err != nil {
+		t.Fatalf("Unable to pack object: %v", err)
+	}
+	if err = ioutil.WriteFile(path, raw, 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+}
+
+func writeKey(t *testing.T, path string, key common.RawBytes) {
+	if err := ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)),
+		0600); err != nil {
+		t.Fatalf("Unable to write key: %v", err)
+	}
+}
+
+func loadChain(t *testing.T) *cert.Chain {
+	raw, err := ioutil.ReadFile(fnChain)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", fnChain, err)
+	}
+	chain, err := cert.ChainFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading Certificate Chain from '%s': %v", fnChain, err)
+	}
+	return chain
+}
+
+func loadTRC(t *testing.T) *trc.TRC {
+	raw, err := ioutil.ReadFile(fnTRC)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", fnTRC, err)
+	}
+	t_, err := trc.TRCFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading TRC from '%s': %v", fnTRC, err)
+	}
+	return t_
+}
+
+// newReqCert returns the certificate requested by subject from core AS 1-13, with a new
+// signing key.
+func newReqCert(t *testing.T, subject *addr.ISD_AS) *cert.Certificate {
+	pub, _ := genKeyPair(t)
+	now := uint64(time.Now().Unix())
+	return &cert.Certificate{
+		EncAlgorithm:   crypto.Curve25519xSalsa20Poly1305,
+		ExpirationTime: now + cert.DefaultLeafCertValidity,
+		Issuer:         coreIA.Copy(),
+		IssuingTime:    now,
+		SignAlgorithm:  crypto.Ed25519,
+		Subject:        subject.Copy(),
+		SubjectEncKey:  make(common.RawBytes, 32),
+		SubjectSignKey: pub,
+		TRCVersion:     2,
+		Version:        2,
+	}
+}
+
+// doIss lets the handler process a request for crt from AS from. The request is signed with
+// signKey, and the signature source is set to src.
+func doIss(t *testing.T, crt *cert.Certificate, from, src *addr.ISD_AS,
+	signKey common.RawBytes) (*cert.Chain, error) {
+
+	signSrc := &ctrl.SignSrcDef{IA: src, ChainVer: 1, TRCVer: 2}
+	signed, err := issue.NewReq(crt, signSrc, crypto.NewKeySigner(signKey), crypto.Ed25519)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+	raw, err := crt.JSON(false)
+	if err != nil {
+		t.Fatalf("Unable to pack certificate: %v", err)
+	}
+	fromAddr := &snet.Addr{IA: from, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 2))}
+	return NewChainIssHandler(nil).issue(fromAddr, &cert_mgmt.ChainIssReq{RawCert: raw}, signed)
+}
+
+func TestChainIssHandler(t *testing.T) {
+	Convey("Given a core AS with a customer", t, func() {
+		keys, cleanup := loadTestConf(t, coreIA)
+		defer cleanup()
+		Convey("A valid request is granted", func() {
+			crt := newReqCert(t, custIA)
+			chain, err := doIss(t, crt, custIA, custIA, keys.cust)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("subject", chain.Leaf.Subject, ShouldResemble, custIA)
+			SoMsg("issuer", chain.Leaf.Issuer, ShouldResemble, coreIA)
+			SoMsg("sign key", chain.Leaf.SubjectSignKey, ShouldResemble, crt.SubjectSignKey)
+			SoMsg("expiration", chain.Leaf.ExpirationTime, ShouldEqual, crt.ExpirationTime)
+			SoMsg("verify", config.Store.VerifyChain(chain), ShouldBeNil)
+			SoMsg("stored", config.Store.GetNewestChain(custIA), ShouldResemble, chain)
+			key, err := config.GetVerifyingKey(custIA)
+			SoMsg("key err", err, ShouldBeNil)
+			SoMsg("verifying key", key, ShouldResemble, crt.SubjectSignKey)
+		})
+		Convey("A retried request is answered with the issued chain", func() {
+			crt := newReqCert(t, custIA)
+			chain, err := doIss(t, crt, custIA, custIA, keys.cust)
+			SoMsg("err", err, ShouldBeNil)
+			retried, err := doIss(t, crt, custIA, custIA, keys.cust)
+			SoMsg("retry err", err, ShouldBeNil)
+			SoMsg("retried chain", retried, ShouldResemble, chain)
+			SoMsg("reload", config.ReloadCustomers(), ShouldBeNil)
+			retried, err = doIss(t, crt, custIA, custIA, keys.cust)
+			SoMsg("retry after reload err", err, ShouldBeNil)
+			SoMsg("retried chain after reload", retried, ShouldResemble, chain)
+			key, _ := config.GetVerifyingKey(custIA)
+			SoMsg("verifying key", key, ShouldResemble, crt.SubjectSignKey)
+			Convey("A retry not signed with the replaced key is rejected", func() {
+				retried, err := doIss(t, crt, custIA, custIA, keys.as)
+				SoMsg("chain", retried, ShouldBeNil)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, crypto.InvalidSignature)
+			})
+		})
+		Convey("A request for the initial verifying key is rejected", func() {
+			crt := newReqCert(t, custIA)
+			crt.SubjectSignKey, _ = config.GetVerifyingKey(custIA)
+			chain, err := doIss(t, crt, custIA, custIA, keys.cust)
+			SoMsg("chain", chain, ShouldBeNil)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, conf.NoPrevKey)
+		})
+		Convey("Invalid requests are rejected", func() {
+			now := uint64(time.Now().Unix())
+			tests := []struct {
+				desc   string
+				setup  func(crt *cert.Certificate)
+				from   *addr.ISD_AS
+				src    *addr.ISD_AS
+				key    common.RawBytes
+				errMsg string
+			}{
+				{"Local AS is not core",
+					func(*cert.Certificate) { config.Topo.Core = false },
+					custIA, custIA, keys.cust, ErrNotCore},
+				{"Subject is not the requester",
+					func(crt *cert.Certificate) { crt.Subject = otherIA.Copy() },
+					custIA, custIA, keys.cust, ErrInvalidSubject},
+				{"Requester is not a customer",
+					func(crt *cert.Certificate) { crt.Subject = otherIA.Copy() },
+					otherIA, otherIA, keys.cust, conf.NotACustomer},
+				{"Issuer is not the local AS",
+					func(crt *cert.Certificate) { crt.Issuer = otherIA.Copy() },
+					custIA, custIA, keys.cust, ErrInvalidIssuer},
+				{"Certificate is expired",
+					func(crt *cert.Certificate) {
+						crt.IssuingTime = now - 2*cert.DefaultLeafCertValidity
+						crt.ExpirationTime = now - cert.DefaultLeafCertValidity
+					},
+					custIA, custIA, keys.cust, ErrInvalidPeriod},
+				{"Validity period is too long",
+					func(crt *cert.Certificate) {
+						crt.ExpirationTime = crt.IssuingTime + cert.DefaultLeafCertValidity + 1
+					},
+					custIA, custIA, keys.cust, ErrInvalidPeriod},
+				{"Validity period is empty",
+					func(crt *cert.Certificate) { crt.IssuingTime = crt.ExpirationTime },
+					custIA, custIA, keys.cust, ErrInvalidPeriod},
+				{"Signature source is not the requester",
+					func(*cert.Certificate) {},
+					custIA, otherIA, keys.cust, ErrInvalidSigSrc},
+				{"Signature is not made with the verifying key",
+					func(*cert.Certificate) {},
+					custIA, custIA, keys.as, crypto.InvalidSignature},
+			}
+			for _, test := range tests {
+				Convey(test.desc, func() {
+					crt := newReqCert(t, test.from)
+					test.setup(crt)
+					oldKey, _ := config.GetVerifyingKey(custIA)
+					chain, err := doIss(t, crt, test.from, test.src, test.key)
+					SoMsg("chain", chain, ShouldBeNil)
+					SoMsg("err", common.GetErrorMsg(err), ShouldEqual, test.errMsg)
+					key, _ := config.GetVerifyingKey(custIA)
+					SoMsg("verifying key", key, ShouldResemble, oldKey)
+					SoMsg("stored", config.Store.GetNewestChain(crt.Subject), ShouldBeNil)
+				})
+			}
+		})
+	})
+}
+
+func TestMain(m *testing.M) {
+	l := log.Root()
+	l.SetHandler(log.DiscardHandler())
+	metrics.Init("test")
+	os.Exit(m.Run())
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/lib/topology"
 	"github.com/scionproto/scion/go/lib/trust"
@@ -47,6 +48,8 @@ type Conf struct {
 	keyConf *trust.KeyConf
 	// keyConfLock guards KeyConf, CertVer and TRCVer.
 	keyConfLock sync.RWMutex
+	// keyPass is the password of encrypted key files. It is nil, if the keys are not encrypted.
+	keyPass []byte
 	// customers is a mapping from non-core ASes assigned to this core AS to their public
 	// verifying key.
 	customers Customers
@@ -60,13 +63,17 @@ type Conf struct {
 	StateDir string
 }
 
-// Load initializes the configuration by loading it from confDir.
-func Load(id string, confDir string, cacheDir string, stateDir string) (*Conf, error) {
+// Load initializes the configuration by loading it from confDir. keyPass is the password of
+// encrypted key files, or nil.
+func Load(id string, confDir string, cacheDir string, stateDir string,
+	keyPass []byte) (*Conf, error) {
+
 	var err error
 	conf := &Conf{
 		ConfDir:  confDir,
 		CacheDir: cacheDir,
 		StateDir: stateDir,
+		keyPass:  keyPass,
 	}
 	// load topology
 	path := filepath.Join(confDir, topology.CfgName)
@@ -119,15 +126,23 @@ func (c *Conf) ReloadCustomers() error {
 
 // loadKeyConf loads key configuration.
 func (c *Conf) loadKeyConf() (*trust.KeyConf, error) {
-	return trust.LoadKeyConf(filepath.Join(c.ConfDir, "keys"), c.Topo.Core,
+	return trust.LoadKeyConf(filepath.Join(c.ConfDir, "keys"), c.keyPass, c.Topo.Core,
 		c.Topo.Core, false)
 }
 
-// GetSigningKey returns the signing key of the current key configuration.
-func (c *Conf) GetSigningKey() common.RawBytes {
+// GetSigner returns the signer of the AS signing key of the current key configuration.
+func (c *Conf) GetSigner() crypto.Signer {
+	c.keyConfLock.RLock()
+	defer c.keyConfLock.RUnlock()
+	return c.keyConf.Signer
+}
+
+// GetCoreSigner returns the signer of the core signing key of the current key configuration. It
+// is nil, if the AS is not a core AS.
+func (c *Conf) GetCoreSigner() crypto.Signer {
 	c.keyConfLock.RLock()
 	defer c.keyConfLock.RUnlock()
-	return c.keyConf.SignKey
+	return c.keyConf.CoreSigner
 }
 
 // GetDecryptKey returns the decryption key of the current key configuration.
@@ -137,9 +152,9 @@ func (c *Conf) GetDecryptKey() common.RawBytes {
 	return c.keyConf.DecryptKey
 }
 
-// GetOnRootKey returns the online root key of the current key configuration.
-func (c *Conf) GetOnRootKey() common.RawBytes {
+// GetOnRootSigner returns the signer of the online root key of the current key configuration.
+func (c *Conf) GetOnRootSigner() crypto.Signer {
 	c.keyConfLock.RLock()
 	defer c.keyConfLock.RUnlock()
-	return c.keyConf.OnRootKey
+	return c.keyConf.OnRootSigner
 }
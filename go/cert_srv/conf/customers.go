@@ -32,12 +32,20 @@ import (
 const (
 	KeyChanged   = "Verifying key has changed in the meantime"
 	NotACustomer = "ISD-AS not in custommer mapping"
+	NoPrevKey    = "No previous verifying key"
 	CustomersDir = "customers"
 )
 
-type Customers map[addr.ISD_AS]common.RawBytes
+type Customers map[addr.ISD_AS]*custKeys
+
+// custKeys holds the current verifying key of a customer, and the key it has replaced, if any.
+type custKeys struct {
+	curr common.RawBytes
+	prev common.RawBytes
+}
 
 // LoadCustomers populates the mapping from assigned non-core ASes to their respective verifying key.
+// The key with the second highest version is kept as the previous verifying key.
 func (c *Conf) LoadCustomers() (Customers, error) {
 	path := filepath.Join(c.StateDir, CustomersDir)
 	files, err := filepath.Glob(fmt.Sprintf("%s/ISD*-AS*-V*.key", path))
@@ -46,6 +54,8 @@ func (c *Conf) LoadCustomers() (Customers, error) {
 	}
 	activeKeys := make(map[addr.ISD_AS]string)
 	activeVers := make(map[addr.ISD_AS]uint64)
+	prevKeys := make(map[addr.ISD_AS]string)
+	prevVers := make(map[addr.ISD_AS]uint64)
 	for _, file := range files {
 		re := regexp.MustCompile(`ISD(\d+)-AS(\d+)-V(\d+)\.key$`)
 		s := re.FindStringSubmatch(file)
@@ -57,18 +67,32 @@ func (c *Conf) LoadCustomers() (Customers, error) {
 		if err != nil {
 			return nil, common.NewBasicError("Unable to parse Version", err, "file", file)
 		}
-		if uint64(ver) >= activeVers[*ia] {
+		if _, ok := activeKeys[*ia]; !ok || ver >= activeVers[*ia] {
+			if ok {
+				prevKeys[*ia] = activeKeys[*ia]
+				prevVers[*ia] = activeVers[*ia]
+			}
 			activeKeys[*ia] = file
-			activeVers[*ia] = uint64(ver)
+			activeVers[*ia] = ver
+		} else if _, ok := prevKeys[*ia]; !ok || ver >= prevVers[*ia] {
+			prevKeys[*ia] = file
+			prevVers[*ia] = ver
 		}
 	}
-	customers := make(map[addr.ISD_AS]common.RawBytes)
+	customers := make(Customers)
 	for ia, file := range activeKeys {
 		key, err := trust.LoadKey(file)
 		if err != nil {
 			return nil, common.NewBasicError("Unable to load key", err, "file", file)
 		}
-		customers[ia] = key
+		customers[ia] = &custKeys{curr: key}
+	}
+	for ia, file := range prevKeys {
+		key, err := trust.LoadKey(file)
+		if err != nil {
+			return nil, common.NewBasicError("Unable to load key", err, "file", file)
+		}
+		customers[ia].prev = key
 	}
 	return customers, nil
 }
@@ -78,27 +102,44 @@ func (c *Conf) LoadCustomers() (Customers, error) {
 func (c *Conf) GetVerifyingKey(ia *addr.ISD_AS) (common.RawBytes, error) {
 	c.customersLock.RLock()
 	defer c.customersLock.RUnlock()
-	b, ok := c.customers[*ia]
+	keys, ok := c.customers[*ia]
 	if !ok {
 		return nil, common.NewBasicError(NotACustomer, nil)
 	}
-	return b, nil
+	return keys.curr, nil
+}
+
+// GetPrevVerifyingKey returns the verifying key of the requested AS that has been replaced by the
+// current one. It returns an error, if the AS is not in the mapping or the key has never been
+// replaced.
+func (c *Conf) GetPrevVerifyingKey(ia *addr.ISD_AS) (common.RawBytes, error) {
+	c.customersLock.RLock()
+	defer c.customersLock.RUnlock()
+	keys, ok := c.customers[*ia]
+	if !ok {
+		return nil, common.NewBasicError(NotACustomer, nil)
+	}
+	if keys.prev == nil {
+		return nil, common.NewBasicError(NoPrevKey, nil, "ISD-AS", ia)
+	}
+	return keys.prev, nil
 }
 
-// SetVerifyingKey sets the verifying key for a specified AS. The key is written to the file system.
+// SetVerifyingKey sets the verifying key for a specified AS. The key is written to the file system,
+// and the replaced key is kept as the previous verifying key.
 func (c *Conf) SetVerifyingKey(ia *addr.ISD_AS, ver uint64, newKey, oldKey common.RawBytes) error {
 	c.customersLock.Lock()
 	defer c.customersLock.Unlock()
-	currKey, ok := c.customers[*ia]
+	keys, ok := c.customers[*ia]
 	if !ok {
 		return common.NewBasicError(NotACustomer, nil, "ISD-AS", ia)
 	}
 	// Check that the key in the mapping has not changed in the mean time
-	if !bytes.Equal(currKey, oldKey) {
+	if !bytes.Equal(keys.curr, oldKey) {
 		return common.NewBasicError(KeyChanged, nil, "ISD-AS", ia)
 	}
 	// Key has to be written to file system, only if it has changed
-	if !bytes.Equal(newKey, currKey) {
+	if !bytes.Equal(newKey, keys.curr) {
 		var err error
 		name := fmt.Sprintf("ISD%d-AS%d-V%d.key", ia.I, ia.A, ver)
 		path := filepath.Join(c.StateDir, CustomersDir, name)
@@ -110,8 +151,8 @@ func (c *Conf) SetVerifyingKey(ia *addr.ISD_AS, ver uint64, newKey, oldKey commo
 		if err = ioutil.WriteFile(path, buf, 0644); err != nil {
 			return err
 		}
-		c.customers[*ia] = make(common.RawBytes, len(newKey))
-		copy(c.customers[*ia], newKey)
+		keys.prev = keys.curr
+		keys.curr = append(common.RawBytes(nil), newKey...)
 		return nil
 	}
 	return nil
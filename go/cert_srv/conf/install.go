@@ -0,0 +1,203 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+const (
+	ErrorInstall   = "Unable to install certificate chain"
+	ErrorPending   = "Unable to access pending signing key"
+	ErrorNoKeyFile = "Signing key is not stored in a key file"
+
+	// PendingSigKeyFile and PendingVerKeyFile are the files in the state directory holding the key
+	// pair of a pending renewal, until the renewed chain is installed.
+	PendingSigKeyFile = "pending-as-sig.key"
+	PendingVerKeyFile = "pending-as-ver.key"
+)
+
+// InstallChain installs a renewed certificate chain together with the corresponding signing key.
+// Both are written to the configuration directory, such that they are loaded on restart, and the
+// chain is added to the trust store. If the key files are encrypted, the new key is encrypted with
+// the same password. The chain and the key are installed as a pair: both are written to temporary
+// files first, which are only renamed once both have been written successfully. If the key cannot
+// be renamed, the chain is removed again, so that the newest chain on disk matches the signing key.
+// Once installed, the pending key pair is removed. Chains can only be installed, if the current
+// signing key is stored in a key file, since the key would otherwise be moved out of its backend,
+// e.g., a PKCS#11 token.
+func (c *Conf) InstallChain(chain *cert.Chain, signKey common.RawBytes) error {
+	c.keyConfLock.Lock()
+	defer c.keyConfLock.Unlock()
+	if !c.keyFileSigner() {
+		return common.NewBasicError(ErrorNoKeyFile, nil, "signer", c.keyConf.Signer)
+	}
+	ia, ver := chain.IAVer()
+	raw, err := chain.JSON(true)
+	if err != nil {
+		return common.NewBasicError(ErrorInstall, err)
+	}
+	buf, err := c.encodeKey(signKey)
+	if err != nil {
+		return common.NewBasicError(ErrorInstall, err)
+	}
+	chainPath := filepath.Join(c.ConfDir, "certs",
+		fmt.Sprintf("ISD%d-AS%d-V%d.crt", ia.I, ia.A, ver))
+	chainTmp, err := writeTempFile(chainPath, raw, 0644)
+	if err != nil {
+		return common.NewBasicError(ErrorInstall, err, "file", chainPath)
+	}
+	keyPath := filepath.Join(c.ConfDir, "keys", trust.SigKeyFile)
+	keyTmp, err := writeTempFile(keyPath, buf, 0600)
+	if err != nil {
+		os.Remove(chainTmp)
+		return common.NewBasicError(ErrorInstall, err, "file", keyPath)
+	}
+	if err = os.Rename(chainTmp, chainPath); err != nil {
+		os.Remove(chainTmp)
+		os.Remove(keyTmp)
+		return common.NewBasicError(ErrorInstall, err, "file", chainPath)
+	}
+	if err = os.Rename(keyTmp, keyPath); err != nil {
+		os.Remove(chainPath)
+		os.Remove(keyTmp)
+		return common.NewBasicError(ErrorInstall, err, "file", keyPath)
+	}
+	c.keyConf.Signer = crypto.NewKeySigner(append(common.RawBytes(nil), signKey...))
+	// A left over pending key pair matches the installed key, and is discarded by the next
+	// renewal.
+	pubPath, privPath := c.pendingKeyPaths()
+	os.Remove(pubPath)
+	os.Remove(privPath)
+	return c.Store.AddChain(chain, false)
+}
+
+// KeyFileSigner returns whether the signing key is stored in a key file. Otherwise, the
+// certificate chain cannot be renewed automatically.
+func (c *Conf) KeyFileSigner() bool {
+	c.keyConfLock.RLock()
+	defer c.keyConfLock.RUnlock()
+	return c.keyFileSigner()
+}
+
+func (c *Conf) keyFileSigner() bool {
+	_, ok := c.keyConf.Signer.(*crypto.KeySigner)
+	return ok
+}
+
+// PendingKeys returns the public and the private key of the pending renewal. Both are nil, if no
+// renewal is pending.
+func (c *Conf) PendingKeys() (common.RawBytes, common.RawBytes, error) {
+	c.keyConfLock.RLock()
+	defer c.keyConfLock.RUnlock()
+	pubPath, privPath := c.pendingKeyPaths()
+	if _, err := os.Stat(pubPath); os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	pub, err := trust.LoadKey(pubPath)
+	if err != nil {
+		return nil, nil, common.NewBasicError(ErrorPending, err)
+	}
+	priv, err := trust.LoadKeyWithPassword(privPath, c.keyPass)
+	if err != nil {
+		return nil, nil, common.NewBasicError(ErrorPending, err)
+	}
+	return pub, priv, nil
+}
+
+// SetPendingKeys stores the key pair of a pending renewal in the state directory, such that the
+// renewal can be retried with the same key pair, e.g., after the reply of the issuer got lost. The
+// private key is encrypted, if a key password is configured. The public key is written last, so
+// that it only exists together with the private key.
+func (c *Conf) SetPendingKeys(pub, priv common.RawBytes) error {
+	c.keyConfLock.Lock()
+	defer c.keyConfLock.Unlock()
+	privBuf, err := c.encodeKey(priv)
+	if err != nil {
+		return common.NewBasicError(ErrorPending, err)
+	}
+	pubBuf := make([]byte, base64.StdEncoding.EncodedLen(len(pub)))
+	base64.StdEncoding.Encode(pubBuf, pub)
+	pubPath, privPath := c.pendingKeyPaths()
+	os.Remove(pubPath)
+	privTmp, err := writeTempFile(privPath, privBuf, 0600)
+	if err != nil {
+		return common.NewBasicError(ErrorPending, err, "file", privPath)
+	}
+	if err = os.Rename(privTmp, privPath); err != nil {
+		os.Remove(privTmp)
+		return common.NewBasicError(ErrorPending, err, "file", privPath)
+	}
+	pubTmp, err := writeTempFile(pubPath, pubBuf, 0644)
+	if err != nil {
+		return common.NewBasicError(ErrorPending, err, "file", pubPath)
+	}
+	if err = os.Rename(pubTmp, pubPath); err != nil {
+		os.Remove(pubTmp)
+		return common.NewBasicError(ErrorPending, err, "file", pubPath)
+	}
+	return nil
+}
+
+// pendingKeyPaths returns the paths of the public and the private key of a pending renewal.
+func (c *Conf) pendingKeyPaths() (string, string) {
+	return filepath.Join(c.StateDir, PendingVerKeyFile), filepath.Join(c.StateDir,
+		PendingSigKeyFile)
+}
+
+// encodeKey returns the key file content for key. The key is encrypted, if a key password is
+// configured, and base64 encoded otherwise.
+func (c *Conf) encodeKey(key common.RawBytes) (common.RawBytes, error) {
+	if c.keyPass != nil {
+		return crypto.EncryptKey(key, c.keyPass)
+	}
+	buf := make([]byte, base64.StdEncoding.EncodedLen(len(key)))
+	base64.StdEncoding.Encode(buf, key)
+	return buf, nil
+}
+
+// writeTempFile writes data to a new temporary file in the directory of path, and returns the
+// name of the temporary file. The file is synced to disk, such that it can be renamed to path
+// afterwards.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
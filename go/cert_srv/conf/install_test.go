@@ -0,0 +1,219 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+var fnChain = "../../lib/crypto/cert/testdata/ISD1-AS10-V1.crt"
+
+// newTestConf returns a configuration with empty certs, keys and state directories in a temporary
+// directory, and an old signing key.
+func newTestConf(t *testing.T) (*Conf, func()) {
+	dir, err := ioutil.TempDir("", "conf_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	for _, d := range []string{"certs", "keys", "cache", "state"} {
+		if err = os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("Unable to create dir: %v", err)
+		}
+	}
+	store, err := trust.NewStore(filepath.Join(dir, "certs"), filepath.Join(dir, "cache"),
+		"cs1-10-1")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Unable to create store: %v", err)
+	}
+	_, oldKey, _ := crypto.GenKeyPair(crypto.Ed25519)
+	c := &Conf{
+		Store:    store,
+		ConfDir:  dir,
+		StateDir: filepath.Join(dir, "state"),
+		keyConf:  &trust.KeyConf{Signer: crypto.NewKeySigner(oldKey)},
+	}
+	return c, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func loadChain(t *testing.T) *cert.Chain {
+	raw, err := ioutil.ReadFile(fnChain)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", fnChain, err)
+	}
+	chain, err := cert.ChainFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading Certificate Chain from '%s': %v", fnChain, err)
+	}
+	chain.Leaf.Version = 2
+	return chain
+}
+
+// tokenSigner is a signer whose key is not stored in a key file.
+type tokenSigner struct{}
+
+func (s *tokenSigner) Sign(sigInput common.RawBytes, signAlgo string) (common.RawBytes, error) {
+	return nil, nil
+}
+
+// listDir returns the names of the files in dir.
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Unable to read dir: %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestInstallChain(t *testing.T) {
+	Convey("Given a configuration", t, func() {
+		c, cleanup := newTestConf(t)
+		defer cleanup()
+		chain := loadChain(t)
+		ia, ver := chain.IAVer()
+		pub, priv, _ := crypto.GenKeyPair(crypto.Ed25519)
+		certsDir := filepath.Join(c.ConfDir, "certs")
+		keysDir := filepath.Join(c.ConfDir, "keys")
+		Convey("The chain and the key are installed", func() {
+			SoMsg("err", c.InstallChain(chain, priv), ShouldBeNil)
+			SoMsg("certs", listDir(t, certsDir), ShouldResemble, []string{"ISD1-AS10-V2.crt"})
+			SoMsg("keys", listDir(t, keysDir), ShouldResemble, []string{trust.SigKeyFile})
+			key, err := trust.LoadKey(filepath.Join(keysDir, trust.SigKeyFile))
+			SoMsg("load key", err, ShouldBeNil)
+			SoMsg("key", key, ShouldResemble, priv)
+			fi, err := os.Stat(filepath.Join(keysDir, trust.SigKeyFile))
+			SoMsg("stat", err, ShouldBeNil)
+			SoMsg("key perm", fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+			raw, err := ioutil.ReadFile(filepath.Join(certsDir, "ISD1-AS10-V2.crt"))
+			SoMsg("read chain", err, ShouldBeNil)
+			written, err := cert.ChainFromRaw(raw, false)
+			SoMsg("parse chain", err, ShouldBeNil)
+			SoMsg("chain", written.Eq(chain), ShouldBeTrue)
+			SoMsg("store", c.Store.GetChain(ia, ver), ShouldNotBeNil)
+			sig, err := c.GetSigner().Sign([]byte("msg"), crypto.Ed25519)
+			SoMsg("sign", err, ShouldBeNil)
+			SoMsg("signer", crypto.Verify([]byte("msg"), sig, pub, crypto.Ed25519), ShouldBeNil)
+		})
+		Convey("The key is encrypted, if a key password is configured", func() {
+			c.keyPass = []byte("password")
+			SoMsg("err", c.InstallChain(chain, priv), ShouldBeNil)
+			raw, err := ioutil.ReadFile(filepath.Join(keysDir, trust.SigKeyFile))
+			SoMsg("read key", err, ShouldBeNil)
+			_, err = crypto.DecodeKey(raw, nil)
+			SoMsg("no password", err, ShouldNotBeNil)
+			key, err := crypto.DecodeKey(raw, c.keyPass)
+			SoMsg("decode", err, ShouldBeNil)
+			SoMsg("key", key, ShouldResemble, priv)
+		})
+		Convey("Nothing is installed, if the key cannot be written", func() {
+			oldSigner := c.GetSigner()
+			SoMsg("rm keys", os.Remove(keysDir), ShouldBeNil)
+			err := c.InstallChain(chain, priv)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorInstall)
+			SoMsg("certs", listDir(t, certsDir), ShouldBeEmpty)
+			SoMsg("store", c.Store.GetChain(ia, ver), ShouldBeNil)
+			SoMsg("signer", c.GetSigner(), ShouldEqual, oldSigner)
+		})
+		Convey("Nothing is installed, if the key cannot be replaced", func() {
+			// A directory in place of the key file makes the rename fail.
+			SoMsg("mkdir", os.Mkdir(filepath.Join(keysDir, trust.SigKeyFile), 0755),
+				ShouldBeNil)
+			err := c.InstallChain(chain, priv)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorInstall)
+			SoMsg("certs", listDir(t, certsDir), ShouldBeEmpty)
+			SoMsg("keys", listDir(t, keysDir), ShouldResemble, []string{trust.SigKeyFile})
+			SoMsg("store", c.Store.GetChain(ia, ver), ShouldBeNil)
+		})
+		Convey("Nothing is installed, if the signing key is not stored in a key file", func() {
+			signer := &tokenSigner{}
+			c.keyConf.Signer = signer
+			SoMsg("key file", c.KeyFileSigner(), ShouldBeFalse)
+			err := c.InstallChain(chain, priv)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorNoKeyFile)
+			SoMsg("certs", listDir(t, certsDir), ShouldBeEmpty)
+			SoMsg("keys", listDir(t, keysDir), ShouldBeEmpty)
+			SoMsg("signer", c.GetSigner(), ShouldEqual, signer)
+		})
+		Convey("The pending key pair is removed", func() {
+			SoMsg("set", c.SetPendingKeys(pub, priv), ShouldBeNil)
+			SoMsg("err", c.InstallChain(chain, priv), ShouldBeNil)
+			SoMsg("state", listDir(t, c.StateDir), ShouldBeEmpty)
+			pPub, pPriv, err := c.PendingKeys()
+			SoMsg("pending err", err, ShouldBeNil)
+			SoMsg("pending pub", pPub, ShouldBeNil)
+			SoMsg("pending priv", pPriv, ShouldBeNil)
+		})
+	})
+}
+
+func TestPendingKeys(t *testing.T) {
+	Convey("Given a configuration", t, func() {
+		c, cleanup := newTestConf(t)
+		defer cleanup()
+		pub, priv, _ := crypto.GenKeyPair(crypto.Ed25519)
+		Convey("No key pair is pending initially", func() {
+			pPub, pPriv, err := c.PendingKeys()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("pub", pPub, ShouldBeNil)
+			SoMsg("priv", pPriv, ShouldBeNil)
+		})
+		Convey("The pending key pair is persisted", func() {
+			SoMsg("set", c.SetPendingKeys(pub, priv), ShouldBeNil)
+			pPub, pPriv, err := c.PendingKeys()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("pub", pPub, ShouldResemble, pub)
+			SoMsg("priv", pPriv, ShouldResemble, priv)
+			fi, err := os.Stat(filepath.Join(c.StateDir, PendingSigKeyFile))
+			SoMsg("stat", err, ShouldBeNil)
+			SoMsg("key perm", fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		})
+		Convey("The pending private key is encrypted, if a key password is configured", func() {
+			c.keyPass = []byte("password")
+			SoMsg("set", c.SetPendingKeys(pub, priv), ShouldBeNil)
+			raw, err := ioutil.ReadFile(filepath.Join(c.StateDir, PendingSigKeyFile))
+			SoMsg("read key", err, ShouldBeNil)
+			_, err = crypto.DecodeKey(raw, nil)
+			SoMsg("no password", err, ShouldNotBeNil)
+			_, pPriv, err := c.PendingKeys()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("priv", pPriv, ShouldResemble, priv)
+		})
+		Convey("A private key without public key is not pending", func() {
+			SoMsg("set", c.SetPendingKeys(pub, priv), ShouldBeNil)
+			SoMsg("rm", os.Remove(filepath.Join(c.StateDir, PendingVerKeyFile)), ShouldBeNil)
+			pPub, _, err := c.PendingKeys()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("pub", pPub, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/cert_srv/metrics"
+	liblog "github.com/scionproto/scion/go/lib/log"
+)
+
+// trustEvictInterval is the interval in which expired trust objects are evicted from the trust
+// store.
+const trustEvictInterval = time.Hour
+
+// evictTrust periodically evicts expired certificate chains and TRCs, as well as superseded
+// revocation lists, from the trust store.
+func evictTrust() {
+	defer liblog.LogPanicAndExit()
+	ticker := time.NewTicker(trustEvictInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		n, err := config.Store.EvictExpired(now)
+		if err != nil {
+			log.Error("Unable to evict expired trust objects", "err", err)
+		}
+		if n > 0 {
+			metrics.TrustObjectsEvicted.Add(float64(n))
+			log.Info("Evicted expired trust objects", "count", n)
+		}
+	}
+}
@@ -28,10 +28,12 @@ const MaxReadBufSize = 2 << 16
 
 // Dispatcher handles incoming SCION packets.
 type Dispatcher struct {
-	conn         *snet.Conn
-	buf          common.RawBytes
-	chainHandler *ChainHandler
-	trcHandler   *TRCHandler
+	conn            *snet.Conn
+	buf             common.RawBytes
+	chainHandler    *ChainHandler
+	chainIssHandler *ChainIssHandler
+	trcHandler      *TRCHandler
+	revListHandler  *RevListHandler
 }
 
 // NewDispatcher creates a new dispatcher listening to SCION traffic on the specified address.
@@ -42,7 +44,9 @@ func NewDispatcher(public, bind *snet.Addr) (*Dispatcher, error) {
 	}
 	d := &Dispatcher{conn: conn, buf: make(common.RawBytes, MaxReadBufSize)}
 	d.chainHandler = NewChainHandler(d.conn)
+	d.chainIssHandler = NewChainIssHandler(d.conn)
 	d.trcHandler = NewTRCHandler(d.conn)
+	d.revListHandler = NewRevListHandler(d.conn)
 	return d, nil
 }
 
@@ -88,10 +92,16 @@ func (d *Dispatcher) dispatch(addr *snet.Addr, buf common.RawBytes) error {
 			d.chainHandler.HandleRep(addr, pld.(*cert_mgmt.Chain))
 		case *cert_mgmt.ChainReq:
 			d.chainHandler.HandleReq(addr, pld.(*cert_mgmt.ChainReq))
+		case *cert_mgmt.ChainIssReq:
+			d.chainIssHandler.HandleReq(addr, pld.(*cert_mgmt.ChainIssReq), signed)
 		case *cert_mgmt.TRC:
 			d.trcHandler.HandleRep(addr, pld.(*cert_mgmt.TRC))
 		case *cert_mgmt.TRCReq:
 			d.trcHandler.HandleReq(addr, pld.(*cert_mgmt.TRCReq))
+		case *cert_mgmt.RevList:
+			d.revListHandler.HandleRep(addr, pld.(*cert_mgmt.RevList))
+		case *cert_mgmt.RevListReq:
+			d.revListHandler.HandleReq(addr, pld.(*cert_mgmt.RevListReq))
 		default:
 			return common.NewBasicError("Handler for cert_mgmt.pld not implemented", nil,
 				"protoID", pld.ProtoId())
@@ -15,7 +15,9 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"io/ioutil"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
@@ -25,6 +27,7 @@ import (
 	log "github.com/inconshreveable/log15"
 
 	"github.com/scionproto/scion/go/cert_srv/conf"
+	"github.com/scionproto/scion/go/cert_srv/metrics"
 	"github.com/scionproto/scion/go/lib/common"
 	liblog "github.com/scionproto/scion/go/lib/log"
 	"github.com/scionproto/scion/go/lib/snet"
@@ -45,6 +48,7 @@ var (
 	cacheDir = flag.String("cached", "gen-cache", "Caching directory")
 	stateDir = flag.String("stated", "", "State directory (Defaults to confd)")
 	prom     = flag.String("prom", "127.0.0.1:1282", "Address to export prometheus metrics on")
+	keyPass  = flag.String("keyPassFile", "", "Password file of encrypted key files (Optional)")
 	config   *conf.Conf
 	sighup   chan os.Signal
 )
@@ -72,9 +76,17 @@ func main() {
 	if err = checkFlags(); err != nil {
 		fatal(err.Error())
 	}
-	if config, err = conf.Load(*id, *confDir, *cacheDir, *stateDir); err != nil {
+	pass, err := loadKeyPass()
+	if err != nil {
+		fatal(err.Error())
+	}
+	if config, err = conf.Load(*id, *confDir, *cacheDir, *stateDir, pass); err != nil {
 		fatal(err.Error())
 	}
+	metrics.Init(*id)
+	if err = metrics.Start(*prom); err != nil {
+		fatal("Unable to export prometheus metrics", "err", err)
+	}
 	// initialize snet with retries
 	if err = initSNET(initAttempts, initInterval); err != nil {
 		fatal("Unable to create local SCION Network context", "err", err)
@@ -84,6 +96,20 @@ func main() {
 	if err != nil {
 		fatal("Unable to initialize dispatcher", "err", err)
 	}
+	// non-core ASes renew their certificate chain at the issuing core AS
+	if !config.Topo.Core {
+		renewer, err := NewRenewer(config.PublicAddr)
+		if err != nil {
+			fatal("Unable to initialize certificate renewal", "err", err)
+		}
+		if !config.KeyFileSigner() {
+			log.Warn("Signing key is not stored in a key file, the certificate chain must be " +
+				"renewed manually")
+		}
+		go renewer.Run()
+	}
+	go dispatcher.revListHandler.Run()
+	go evictTrust()
 	dispatcher.run()
 
 }
@@ -107,6 +133,19 @@ func checkFlags() error {
 	return nil
 }
 
+// loadKeyPass reads the password of encrypted key files. It returns nil, if no password file is
+// specified.
+func loadKeyPass() ([]byte, error) {
+	if *keyPass == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(*keyPass)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to read key password file", err)
+	}
+	return bytes.TrimRight(b, "\r\n"), nil
+}
+
 // initSNET initializes snet. The number of attempts is specified, as well as the sleep duration.
 // This is needed, since supervisord might take some time, until sciond is initialized.
 func initSNET(attempts int, sleep time.Duration) (err error) {
@@ -0,0 +1,105 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics defines and exports certificate server metrics to be scraped
+// by prometheus.
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/infra/dedupe"
+	"github.com/scionproto/scion/go/lib/prom"
+)
+
+// Declare prometheus metrics to export.
+var (
+	// ChainsRejected, TRCsRejected and RevListsRejected count the trust
+	// objects received from the network that failed verification, by reason.
+	ChainsRejected   *prometheus.CounterVec
+	TRCsRejected     *prometheus.CounterVec
+	RevListsRejected *prometheus.CounterVec
+	// ChainsIssued counts the certificate chains issued to customer ASes, and
+	// IssReqsRejected the rejected issuance requests, by reason.
+	ChainsIssued    prometheus.Counter
+	IssReqsRejected *prometheus.CounterVec
+	// ChainExpiryDays is the time until the newest certificate chain of the
+	// AS expires, in days. ChainsRenewed and RenewalErrors count the renewal
+	// attempts of non-core ASes.
+	ChainExpiryDays prometheus.Gauge
+	ChainsRenewed   prometheus.Counter
+	RenewalErrors   prometheus.Counter
+	// TrustObjectsEvicted counts the expired trust objects evicted from the
+	// trust store.
+	TrustObjectsEvicted prometheus.Counter
+)
+
+// Ensure all metrics are registered.
+func Init(elem string) {
+	namespace := "cs"
+	constLabels := prometheus.Labels{"elem": elem}
+	reasonLabels := []string{"reason"}
+
+	newC := func(name, help string) prometheus.Counter {
+		c := prom.NewCounter(namespace, "", name, help, constLabels)
+		prometheus.MustRegister(c)
+		return c
+	}
+	newG := func(name, help string) prometheus.Gauge {
+		g := prom.NewGauge(namespace, "", name, help, constLabels)
+		prometheus.MustRegister(g)
+		return g
+	}
+	newCVec := func(name, help string, lNames []string) *prometheus.CounterVec {
+		v := prom.NewCounterVec(namespace, "", name, help, constLabels, lNames)
+		prometheus.MustRegister(v)
+		return v
+	}
+	ChainsRejected = newCVec("chains_rejected_total",
+		"Number of certificate chains rejected.", reasonLabels)
+	TRCsRejected = newCVec("trcs_rejected_total", "Number of TRCs rejected.", reasonLabels)
+	RevListsRejected = newCVec("rev_lists_rejected_total",
+		"Number of revocation lists rejected.", reasonLabels)
+	ChainsIssued = newC("chains_issued_total", "Number of certificate chains issued.")
+	IssReqsRejected = newCVec("iss_reqs_rejected_total",
+		"Number of certificate chain issuance requests rejected.", reasonLabels)
+	ChainExpiryDays = newG("chain_expiry_days",
+		"Days until the newest certificate chain of the AS expires.")
+	ChainsRenewed = newC("chains_renewed_total", "Number of certificate chains renewed.")
+	RenewalErrors = newC("renewal_errors_total", "Number of failed certificate chain renewals.")
+	TrustObjectsEvicted = newC("trust_objects_evicted_total",
+		"Number of expired trust objects evicted from the trust store.")
+	dedupe.InitMetrics(namespace, constLabels)
+}
+
+func init() {
+	http.Handle("/metrics", promhttp.Handler())
+}
+
+// Start exposes the prometheus metrics on addr.
+func Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return common.NewBasicError("Unable to bind prometheus metrics port", err)
+	}
+	log.Info("Exporting prometheus metrics", "addr", addr)
+	go http.Serve(ln, nil)
+	return nil
+}
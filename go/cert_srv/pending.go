@@ -0,0 +1,54 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/infra/dedupe"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// pendingExpire is the time after which a pending request is discarded.
+	pendingExpire = 30 * time.Second
+	// pendingRetry is the minimal time between two requests for the same key.
+	pendingRetry = time.Second
+)
+
+// newPendingReqs creates a Deduper for the pending requests of the trust objects of type name.
+// Requests are keyed by the trust object key, and their waiters are the requester addresses.
+func newPendingReqs(name string) *dedupe.Deduper {
+	return dedupe.New(dedupe.Config{Name: name, Expire: pendingExpire, Retry: pendingRetry})
+}
+
+// replyFunc returns a callback, which sends the reply payload it is resolved with to addr.
+func replyFunc(conn *snet.Conn, addr *snet.Addr, name string, key fmt.Stringer) dedupe.Callback {
+	return func(resp dedupe.Response) {
+		if resp.Err != nil {
+			log.Info(fmt.Sprintf("Dropping pending %s request", name), "addr", addr,
+				"key", key, "err", resp.Err)
+			return
+		}
+		if err := SendPayload(conn, resp.Data.(*ctrl.Pld), addr); err != nil {
+			log.Error(fmt.Sprintf("Unable to write %s reply", name), "addr", addr,
+				"key", key, "err", err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/cert_srv/conf"
+	"github.com/scionproto/scion/go/cert_srv/metrics"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/trust/issue"
+)
+
+const (
+	// renewCheckInterval is the interval in which the expiry of the certificate chain is checked.
+	renewCheckInterval = time.Minute
+	// renewTimeout is the time to wait for a reply from the issuing core AS.
+	renewTimeout = 5 * time.Second
+
+	ErrNoChain = "Certificate chain of local AS not found"
+)
+
+var renewBefore = flag.Duration("renewBefore", 24*time.Hour,
+	"Time before expiry at which the certificate chain is renewed (non-core ASes only)")
+
+// chainRequester requests new certificate chains from the issuing core AS. It is implemented by
+// issue.Client.
+type chainRequester interface {
+	Request(crt *cert.Certificate, src *ctrl.SignSrcDef, signer crypto.Signer, signAlgo string,
+		dst *snet.Addr, timeout time.Duration) (*cert.Chain, error)
+}
+
+// Renewer renews the certificate chain of a non-core AS at the issuing core AS, before it expires.
+type Renewer struct {
+	client chainRequester
+}
+
+// NewRenewer creates a renewer, which uses a separate connection on an ephemeral port, such that
+// the replies do not reach the dispatcher.
+func NewRenewer(public *snet.Addr) (*Renewer, error) {
+	conn, err := snet.ListenSCION("udp4", &snet.Addr{IA: public.IA, Host: public.Host})
+	if err != nil {
+		return nil, err
+	}
+	return &Renewer{client: issue.NewClient(conn)}, nil
+}
+
+// Run periodically checks the expiry of the newest certificate chain of the local AS, and renews
+// it once less than renewBefore is left.
+func (r *Renewer) Run() {
+	defer liblog.LogPanicAndExit()
+	ticker := time.NewTicker(renewCheckInterval)
+	defer ticker.Stop()
+	for ; true; <-ticker.C {
+		if err := r.check(); err != nil {
+			metrics.RenewalErrors.Inc()
+			log.Error("Unable to renew certificate chain", "err", err)
+		}
+	}
+}
+
+// check renews the certificate chain, if necessary.
+func (r *Renewer) check() error {
+	chain := config.Store.GetNewestChain(config.PublicAddr.IA)
+	if chain == nil {
+		return common.NewBasicError(ErrNoChain, nil, "ia", config.PublicAddr.IA)
+	}
+	left := time.Until(time.Unix(int64(chain.Leaf.ExpirationTime), 0))
+	metrics.ChainExpiryDays.Set(left.Hours() / 24)
+	if left > *renewBefore {
+		return nil
+	}
+	log.Info("Renewing certificate chain", "chain", chain, "left", left)
+	newChain, err := r.renew(chain)
+	if err != nil {
+		return err
+	}
+	metrics.ChainsRenewed.Inc()
+	left = time.Until(time.Unix(int64(newChain.Leaf.ExpirationTime), 0))
+	metrics.ChainExpiryDays.Set(left.Hours() / 24)
+	log.Info("Renewed certificate chain", "chain", newChain, "left", left)
+	return nil
+}
+
+// renew requests a new certificate chain with a new signing key from the issuer of chain, and
+// installs it together with the new key. Only signing keys stored in key files are renewed. The
+// key pair is generated for the signature algorithm of the current certificate, and persisted
+// until the new chain is installed. Failed renewals are retried with the same key pair, since the
+// issuer might already have replaced its verifying key with the new one.
+func (r *Renewer) renew(chain *cert.Chain) (*cert.Chain, error) {
+	if !config.KeyFileSigner() {
+		return nil, common.NewBasicError(conf.ErrorNoKeyFile, nil,
+			"msg", "renew the certificate chain manually")
+	}
+	pub, priv, err := r.newKeyPair(chain)
+	if err != nil {
+		return nil, err
+	}
+	crt := chain.Leaf.Copy()
+	crt.SubjectSignKey = pub
+	crt.Signature = nil
+	crt.Version = chain.Leaf.Version + 1
+	crt.IssuingTime = uint64(time.Now().Unix())
+	crt.ExpirationTime = crt.IssuingTime + cert.DefaultLeafCertValidity
+	src := &ctrl.SignSrcDef{IA: config.PublicAddr.IA, ChainVer: chain.Leaf.Version,
+		TRCVer: chain.Core.TRCVersion}
+	dst := &snet.Addr{IA: chain.Leaf.Issuer, Host: addr.SvcCS}
+	newChain, err := r.client.Request(crt, src, config.GetSigner(), chain.Leaf.SignAlgorithm,
+		dst, renewTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.Store.VerifyChain(newChain); err != nil {
+		return nil, err
+	}
+	if err = config.InstallChain(newChain, priv); err != nil {
+		return nil, err
+	}
+	return newChain, nil
+}
+
+// newKeyPair returns the key pair of the pending renewal of chain. If there is none, a new key pair
+// is generated and persisted.
+func (r *Renewer) newKeyPair(chain *cert.Chain) (common.RawBytes, common.RawBytes, error) {
+	pub, priv, err := config.PendingKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+	// A pending key pair that matches the current certificate has already been installed.
+	if pub != nil && !bytes.Equal(pub, chain.Leaf.SubjectSignKey) {
+		return pub, priv, nil
+	}
+	if pub, priv, err = crypto.GenKeyPair(chain.Leaf.SignAlgorithm); err != nil {
+		return nil, nil, err
+	}
+	if err = config.SetPendingKeys(pub, priv); err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
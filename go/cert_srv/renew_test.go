@@ -0,0 +1,165 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/lib/trust/issue"
+)
+
+var _ chainRequester = (*fakeIssuer)(nil)
+
+// fakeIssuer issues the requested certificates like core AS 1-13, without
+// network connection.
+type fakeIssuer struct {
+	// key is the core signing key the leaf certificates are signed with.
+	key  common.RawBytes
+	core *cert.Certificate
+	err  error
+	// reqs, signers, algos and dsts record the requests.
+	reqs    []*cert.Certificate
+	signers []crypto.Signer
+	algos   []string
+	dsts    []*snet.Addr
+}
+
+func (f *fakeIssuer) Request(crt *cert.Certificate, src *ctrl.SignSrcDef, signer crypto.Signer,
+	signAlgo string, dst *snet.Addr, timeout time.Duration) (*cert.Chain, error) {
+
+	f.reqs = append(f.reqs, crt.Copy())
+	f.signers = append(f.signers, signer)
+	f.algos = append(f.algos, signAlgo)
+	f.dsts = append(f.dsts, dst)
+	if f.err != nil {
+		return nil, f.err
+	}
+	leaf := crt.Copy()
+	if err := leaf.Sign(f.key, crypto.Ed25519); err != nil {
+		return nil, err
+	}
+	return &cert.Chain{Leaf: leaf, Core: f.core.Copy()}, nil
+}
+
+func TestRenewer(t *testing.T) {
+	validity := cert.DefaultLeafCertValidity * time.Second
+	Convey("Given a non-core AS", t, func() {
+		keys, cleanup := loadTestConf(t, custIA)
+		defer cleanup()
+		defer func(d time.Duration) { *renewBefore = d }(*renewBefore)
+		old := config.Store.GetNewestChain(custIA)
+		oldSigner := config.GetSigner()
+		iss := &fakeIssuer{key: keys.core, core: old.Core}
+		r := &Renewer{client: iss}
+		Convey("The chain is not renewed before the threshold", func() {
+			*renewBefore = validity - time.Minute
+			SoMsg("err", r.check(), ShouldBeNil)
+			SoMsg("reqs", iss.reqs, ShouldBeEmpty)
+			SoMsg("chain", config.Store.GetNewestChain(custIA), ShouldEqual, old)
+		})
+		Convey("The chain is renewed after the threshold", func() {
+			*renewBefore = validity + time.Minute
+			SoMsg("err", r.check(), ShouldBeNil)
+			SoMsg("reqs", len(iss.reqs), ShouldEqual, 1)
+			req := iss.reqs[0]
+			SoMsg("dst", iss.dsts[0].IA, ShouldResemble, coreIA)
+			SoMsg("req signer", iss.signers[0], ShouldEqual, oldSigner)
+			SoMsg("req algo", iss.algos[0], ShouldEqual, crypto.Ed25519)
+			SoMsg("subject", req.Subject, ShouldResemble, custIA)
+			SoMsg("issuer", req.Issuer, ShouldResemble, coreIA)
+			SoMsg("version", req.Version, ShouldEqual, old.Leaf.Version+1)
+			SoMsg("sign key", req.SubjectSignKey, ShouldNotResemble, old.Leaf.SubjectSignKey)
+			SoMsg("validity", req.ExpirationTime-req.IssuingTime, ShouldEqual,
+				cert.DefaultLeafCertValidity)
+			chain := config.Store.GetNewestChain(custIA)
+			SoMsg("chain", chain.Leaf.Version, ShouldEqual, req.Version)
+			sig, err := config.GetSigner().Sign([]byte("msg"), crypto.Ed25519)
+			SoMsg("sign", err, ShouldBeNil)
+			SoMsg("signer", crypto.Verify([]byte("msg"), sig, req.SubjectSignKey,
+				crypto.Ed25519), ShouldBeNil)
+			Convey("The renewed chain is not renewed again", func() {
+				*renewBefore = validity - time.Minute
+				SoMsg("err", r.check(), ShouldBeNil)
+				SoMsg("reqs", len(iss.reqs), ShouldEqual, 1)
+			})
+		})
+		Convey("Failed requests are reported", func() {
+			*renewBefore = validity + time.Minute
+			iss.err = common.NewBasicError(issue.ErrTimeout, nil)
+			SoMsg("err", common.GetErrorMsg(r.check()), ShouldEqual, issue.ErrTimeout)
+			SoMsg("chain", config.Store.GetNewestChain(custIA), ShouldEqual, old)
+			SoMsg("signer", config.GetSigner(), ShouldEqual, oldSigner)
+			Convey("The retry uses the same key pair", func() {
+				iss.err = nil
+				SoMsg("err", r.check(), ShouldBeNil)
+				SoMsg("reqs", len(iss.reqs), ShouldEqual, 2)
+				SoMsg("sign key", iss.reqs[1].SubjectSignKey, ShouldResemble,
+					iss.reqs[0].SubjectSignKey)
+				SoMsg("req signer", iss.signers[1], ShouldEqual, oldSigner)
+				pub, _, err := config.PendingKeys()
+				SoMsg("pending err", err, ShouldBeNil)
+				SoMsg("pending", pub, ShouldBeNil)
+			})
+		})
+		Convey("A pending key pair of the current chain is not reused", func() {
+			*renewBefore = validity + time.Minute
+			SoMsg("set", config.SetPendingKeys(old.Leaf.SubjectSignKey, keys.as), ShouldBeNil)
+			SoMsg("err", r.check(), ShouldBeNil)
+			SoMsg("sign key", iss.reqs[0].SubjectSignKey, ShouldNotResemble,
+				old.Leaf.SubjectSignKey)
+		})
+		Convey("The signature algorithm of the current chain is kept", func() {
+			pub, priv, _ := crypto.GenKeyPair(crypto.ECDSAP256)
+			chain := &cert.Chain{Leaf: old.Leaf.Copy(), Core: old.Core.Copy()}
+			chain.Leaf.SignAlgorithm = crypto.ECDSAP256
+			chain.Leaf.SubjectSignKey = pub
+			chain.Leaf.Version = old.Leaf.Version + 1
+			chain.Leaf.Sign(keys.core, crypto.Ed25519)
+			SoMsg("install", config.InstallChain(chain, priv), ShouldBeNil)
+			ecdsaSigner := config.GetSigner()
+			*renewBefore = validity + time.Minute
+			SoMsg("err", r.check(), ShouldBeNil)
+			req := iss.reqs[0]
+			SoMsg("req signer", iss.signers[0], ShouldEqual, ecdsaSigner)
+			SoMsg("req algo", iss.algos[0], ShouldEqual, crypto.ECDSAP256)
+			SoMsg("algo", req.SignAlgorithm, ShouldEqual, crypto.ECDSAP256)
+			sig, err := config.GetSigner().Sign([]byte("msg"), crypto.ECDSAP256)
+			SoMsg("sign", err, ShouldBeNil)
+			SoMsg("signer", crypto.Verify([]byte("msg"), sig, req.SubjectSignKey,
+				crypto.ECDSAP256), ShouldBeNil)
+		})
+		Convey("Invalid chains are not installed", func() {
+			*renewBefore = validity + time.Minute
+			iss.key = keys.as
+			SoMsg("err", common.GetErrorMsg(r.check()), ShouldEqual, trust.ErrInvalidChain)
+			SoMsg("chain", config.Store.GetNewestChain(custIA), ShouldEqual, old)
+			SoMsg("signer", config.GetSigner(), ShouldEqual, oldSigner)
+		})
+		Convey("Renewal fails without a chain", func() {
+			config.PublicAddr.IA = otherIA
+			SoMsg("err", common.GetErrorMsg(r.check()), ShouldEqual, ErrNoChain)
+			SoMsg("reqs", iss.reqs, ShouldBeEmpty)
+		})
+	})
+}
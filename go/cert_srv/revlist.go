@@ -0,0 +1,158 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/cert_srv/metrics"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/infra/dedupe"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// revListFetchInterval is the interval in which the newest revocation lists of all known core
+// ASes are requested.
+const revListFetchInterval = 10 * time.Minute
+
+type RevListHandler struct {
+	conn *snet.Conn
+	// pending are the pending requests for revocation lists, by key.
+	pending *dedupe.Deduper
+}
+
+func NewRevListHandler(conn *snet.Conn) *RevListHandler {
+	return &RevListHandler{conn: conn, pending: newPendingReqs("revlist")}
+}
+
+// HandleReq handles revocation list requests. If the revocation list is not already cached and
+// the cache-only flag is set or the requester is from a remote AS, the request is dropped.
+func (h *RevListHandler) HandleReq(addr *snet.Addr, req *cert_mgmt.RevListReq) {
+	log.Info("Received revocation list request", "addr", addr, "req", req)
+	var r *cert.RevList
+	if req.Version == cert_mgmt.NewestVersion {
+		r = config.Store.GetNewestRevList(req.Issuer())
+	} else {
+		r = config.Store.GetRevList(req.Issuer(), req.Version)
+	}
+	srcLocal := config.PublicAddr.IA.Eq(addr.IA)
+	if r != nil {
+		if err := h.sendRevListRep(addr, r); err != nil {
+			log.Error("Unable to send revocation list reply",
+				"addr", addr, "req", req, "err", err)
+		}
+	} else if !srcLocal || req.CacheOnly {
+		log.Info("Dropping revocation list request", "addr", addr, "req", req,
+			"err", "revocation list not found")
+	} else {
+		if err := h.fetchRevList(addr, req); err != nil {
+			log.Error("Unable to fetch revocation list", "req", req, "err", err)
+		}
+	}
+}
+
+// sendRevListRep creates a revocation list response and sends it to the requester.
+func (h *RevListHandler) sendRevListRep(addr *snet.Addr, r *cert.RevList) error {
+	raw, err := r.Compress()
+	if err != nil {
+		return err
+	}
+	cpld, err := ctrl.NewCertMgmtPld(&cert_mgmt.RevList{RawRevList: raw}, nil, nil)
+	if err != nil {
+		return err
+	}
+	log.Debug("Send revocation list reply", "revList", r, "addr", addr)
+	return SendPayload(h.conn, cpld, addr)
+}
+
+// fetchRevList fetches a revocation list from the issuing core AS.
+func (h *RevListHandler) fetchRevList(addr *snet.Addr, req *cert_mgmt.RevListReq) error {
+	key := cert.NewKey(req.Issuer(), req.Version)
+	sendReq := h.pending.Add(context.Background(), *key, addr.String(),
+		replyFunc(h.conn, addr.Copy(), "revocation list", key))
+	if sendReq { // rate limit
+		return h.sendRevListReq(req)
+	}
+	log.Info("Ignoring revocation list request (same request already pending)",
+		"addr", addr, "req", req)
+	return nil
+}
+
+// sendRevListReq sends a revocation list request to the issuing core AS.
+func (h *RevListHandler) sendRevListReq(req *cert_mgmt.RevListReq) error {
+	cpld, err := ctrl.NewCertMgmtPld(req, nil, nil)
+	if err != nil {
+		return err
+	}
+	a := &snet.Addr{IA: req.Issuer(), Host: addr.SvcCS}
+	log.Debug("Send revocation list request", "req", req, "addr", a)
+	return SendPayload(h.conn, cpld, a)
+}
+
+// HandleRep handles revocation list replies. Pending requests are answered and removed.
+func (h *RevListHandler) HandleRep(addr *snet.Addr, rep *cert_mgmt.RevList) {
+	log.Info("Received revocation list reply", "addr", addr, "rep", rep)
+	r, err := rep.RevList()
+	if err != nil {
+		log.Error("Unable to parse revocation list reply", "err", err)
+		return
+	}
+	if err = config.Store.AddRevListVerified(r, true); err != nil {
+		metrics.RevListsRejected.WithLabelValues(common.GetErrorMsg(err)).Inc()
+		log.Error("Unable to store revocation list", "key", r.Key(), "err", err)
+		return
+	}
+	cpld, err := ctrl.NewCertMgmtPld(rep, nil, nil)
+	if err != nil {
+		log.Error("Unable to create revocation list reply", "key", r.Key(), "err", err)
+		return
+	}
+	// Answer the pending requests for this version and for the newest version.
+	key := r.Key()
+	h.pending.Resolve(*key, dedupe.Response{Data: cpld})
+	key.Ver = cert_mgmt.NewestVersion
+	h.pending.Resolve(*key, dedupe.Response{Data: cpld})
+}
+
+// Run periodically requests the newest revocation list of every core AS listed in the newest
+// TRCs in the store, such that revocations are picked up before the revoked certificates expire.
+// The replies are handled by HandleRep.
+func (h *RevListHandler) Run() {
+	defer liblog.LogPanicAndExit()
+	ticker := time.NewTicker(revListFetchInterval)
+	defer ticker.Stop()
+	for ; true; <-ticker.C {
+		for _, t := range config.Store.GetTRCList() {
+			for _, issuer := range t.CoreASList() {
+				if issuer.Eq(config.PublicAddr.IA) {
+					continue
+				}
+				req := &cert_mgmt.RevListReq{RawIssuer: issuer.IAInt(),
+					Version: cert_mgmt.NewestVersion, CacheOnly: true}
+				if err := h.sendRevListReq(req); err != nil {
+					log.Error("Unable to request revocation list", "req", req, "err", err)
+				}
+			}
+		}
+	}
+}
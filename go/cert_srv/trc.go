@@ -15,29 +15,28 @@
 package main
 
 import (
-	"time"
+	"context"
 
 	log "github.com/inconshreveable/log15"
 
+	"github.com/scionproto/scion/go/cert_srv/metrics"
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/crypto/trc"
 	"github.com/scionproto/scion/go/lib/ctrl"
 	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/infra/dedupe"
 	"github.com/scionproto/scion/go/lib/snet"
 )
 
-var (
-	// trcReqCache is an expiring cache for pending requests of TRCs.
-	trcReqCache = NewReqCache(30*time.Second, 10*time.Minute, 1*time.Second)
-)
-
 type TRCHandler struct {
 	conn *snet.Conn
+	// pending are the pending requests for TRCs, by key.
+	pending *dedupe.Deduper
 }
 
 func NewTRCHandler(conn *snet.Conn) *TRCHandler {
-	return &TRCHandler{conn: conn}
+	return &TRCHandler{conn: conn, pending: newPendingReqs("trc")}
 }
 
 // HandleReq handles TRC requests. If the TRC is not already cached and the cache-only flag is set
@@ -80,8 +79,9 @@ func (h *TRCHandler) sendTRCRep(addr *snet.Addr, t *trc.TRC) error {
 
 // fetchTRC fetches a TRC from the remote AS.
 func (h *TRCHandler) fetchTRC(addr *snet.Addr, req *cert_mgmt.TRCReq) error {
-	key := trc.NewKey(req.ISD, req.Version).String()
-	sendReq := trcReqCache.Put(key, addr)
+	key := trc.NewKey(req.ISD, req.Version)
+	sendReq := h.pending.Add(context.Background(), *key, addr.String(),
+		replyFunc(h.conn, addr.Copy(), "TRC", key))
 	if sendReq { // rate limit
 		return h.sendTRCReq(req)
 	}
@@ -113,36 +113,19 @@ func (h *TRCHandler) HandleRep(addr *snet.Addr, rep *cert_mgmt.TRC) {
 		log.Error("Unable to parse TRC reply", "err", err)
 		return
 	}
-	if err = config.Store.AddTRC(t, true); err != nil {
+	if err = config.Store.AddTRCVerified(t, true); err != nil {
+		metrics.TRCsRejected.WithLabelValues(common.GetErrorMsg(err)).Inc()
 		log.Error("Unable to store TRC", "key", t.Key(), "err", err)
 		return
 	}
-	key := t.Key()
-	reqVer := chainReqCache.Pop(key.String())
-	key.Ver = cert_mgmt.NewestVersion
-	reqNew := chainReqCache.Pop(key.String())
-	key.Ver = t.Version
-	if reqVer == nil && reqNew == nil { // No pending requests
-		return
-	}
 	cpld, err := ctrl.NewCertMgmtPld(rep, nil, nil)
 	if err != nil {
 		log.Error("Unable to create TRC reply", "key", t.Key(), "err", err)
 		return
 	}
-	h.answerReqs(reqVer, cpld, key)
-	h.answerReqs(reqNew, cpld, key)
-}
-
-// answerReqs responds to pending requests.
-func (h *TRCHandler) answerReqs(reqs *AddrSet, cpld *ctrl.Pld, key *trc.Key) {
-	if reqs == nil {
-		return
-	}
-	for _, dst := range reqs.Addrs {
-		if err := SendPayload(h.conn, cpld, dst); err != nil {
-			log.Error("Unable to write TRC reply", "key", key, "err", err)
-			continue
-		}
-	}
+	// Answer the pending requests for this version and for the newest version.
+	key := t.Key()
+	h.pending.Resolve(*key, dedupe.Response{Data: cpld})
+	key.Ver = cert_mgmt.NewestVersion
+	h.pending.Resolve(*key, dedupe.Response{Data: cpld})
 }
@@ -0,0 +1,317 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/rand"
+	"net"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/hpkt"
+	"github.com/scionproto/scion/go/lib/l4"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/sock/reliable/regtable"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spkt"
+)
+
+const (
+	// appTimeout bounds the time spent on the registration of an application, and on sending
+	// a packet to it. An application that does not read its packets in time is disconnected.
+	appTimeout = 2 * time.Second
+	// appQueueLen is the number of packets queued for an application. Further packets to the
+	// application are dropped, so that a slow application does not block the dispatcher.
+	appQueueLen = 128
+)
+
+// app is an application registered with the dispatcher.
+type app struct {
+	conn  *reliable.Conn
+	reg   *reliable.Registration
+	queue chan appPkt
+	done  chan struct{}
+}
+
+// appPkt is a packet queued for an application, together with the overlay address it was
+// received from.
+type appPkt struct {
+	raw  common.RawBytes
+	from *net.UDPAddr
+}
+
+func newApp(conn *reliable.Conn, reg *reliable.Registration) *app {
+	return &app{
+		conn:  conn,
+		reg:   reg,
+		queue: make(chan appPkt, appQueueLen),
+		done:  make(chan struct{}),
+	}
+}
+
+// deliver queues a copy of the packet pkt, received from the overlay address from, for the
+// application. If the queue is full, the packet is dropped.
+func (a *app) deliver(pkt common.RawBytes, from *net.UDPAddr) {
+	select {
+	case a.queue <- appPkt{raw: append(common.RawBytes(nil), pkt...), from: from}:
+	default:
+		log.Debug("Application queue full, dropping packet", "reg", a.reg)
+	}
+}
+
+// run sends the queued packets to the application, until stop is called. If sending fails,
+// the connection to the application is closed.
+func (a *app) run() {
+	for {
+		select {
+		case <-a.done:
+			return
+		case p := <-a.queue:
+			lastHop := reliable.AppAddr{Addr: addr.HostFromIP(p.from.IP),
+				Port: uint16(p.from.Port)}
+			a.conn.SetWriteDeadline(time.Now().Add(appTimeout))
+			if _, err := a.conn.WriteTo(p.raw, lastHop); err != nil {
+				log.Warn("Unable to deliver packet to application, closing connection",
+					"reg", a.reg, "err", err)
+				a.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (a *app) stop() {
+	close(a.done)
+}
+
+// Dispatcher relays SCION packets between the overlay network and the applications registered
+// on its reliable socket.
+type Dispatcher struct {
+	table    *regtable.Table
+	listener *reliable.Listener
+	overlay  *overlayConn
+}
+
+// NewDispatcher listens for applications on the reliable socket appPath, and for SCION packets
+// on the overlay address laddr. The overlay is UDP/IPv4 or UDP/IPv6, depending on laddr.
+func NewDispatcher(appPath string, laddr *net.UDPAddr) (*Dispatcher, error) {
+	overlay, err := listenOverlay(laddr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := reliable.Listen(appPath)
+	if err != nil {
+		overlay.Close()
+		return nil, err
+	}
+	return &Dispatcher{table: regtable.New(), listener: l, overlay: overlay}, nil
+}
+
+// ServeApps accepts applications until the listener is closed. Each application is served in
+// its own goroutine.
+func (d *Dispatcher) ServeApps() error {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer liblog.LogPanicAndExit()
+			d.handleApp(conn)
+		}()
+	}
+}
+
+// handleApp registers the application on conn, and then sends its packets to the first hops
+// in their reliable socket headers, until the application closes the connection.
+func (d *Dispatcher) handleApp(conn *reliable.Conn) {
+	defer conn.Close()
+	buf := make(common.RawBytes, common.MaxMTU)
+	conn.SetReadDeadline(time.Now().Add(appTimeout))
+	n, err := conn.Read(buf)
+	if err != nil {
+		log.Error("Unable to read registration", "err", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	reg, err := reliable.ParseRegistration(buf[:n])
+	if err != nil {
+		log.Error("Invalid registration", "err", err)
+		return
+	}
+	a := newApp(conn, reg)
+	if err = d.table.Register(reg, a); err != nil {
+		log.Error("Unable to register application", "reg", reg, "err", err)
+		// A port of 0 tells the application that the registration failed.
+		d.reply(a, 0)
+		return
+	}
+	defer d.table.Unregister(reg)
+	if err = d.reply(a, reg.Public.Port); err != nil {
+		log.Error("Unable to send registration reply", "reg", reg, "err", err)
+		return
+	}
+	log.Info("Registered application", "reg", reg)
+	go func() {
+		defer liblog.LogPanicAndExit()
+		a.run()
+	}()
+	defer a.stop()
+	for {
+		n, dst, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Info("Application connection closed", "reg", reg, "err", err)
+			return
+		}
+		if dst == nil || dst.Addr.IP() == nil {
+			log.Error("Invalid first hop address, closing connection", "reg", reg, "addr", dst)
+			return
+		}
+		hop := &net.UDPAddr{IP: dst.Addr.IP(), Port: int(dst.Port)}
+		if _, err = d.overlay.WriteToUDP(buf[:n], hop); err != nil {
+			log.Warn("Unable to send packet", "reg", reg, "hop", hop, "err", err)
+		}
+	}
+}
+
+func (d *Dispatcher) reply(a *app, port uint16) error {
+	raw := make(common.RawBytes, 2)
+	common.Order.PutUint16(raw, port)
+	a.conn.SetWriteDeadline(time.Now().Add(appTimeout))
+	_, err := a.conn.Write(raw)
+	a.conn.SetWriteDeadline(time.Time{})
+	return err
+}
+
+// ServeOverlay reads SCION packets from the overlay and delivers them to the registered
+// applications, until the overlay socket is closed.
+func (d *Dispatcher) ServeOverlay() error {
+	buf := make(common.RawBytes, common.MaxMTU)
+	for {
+		n, from, dstIP, err := d.overlay.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		d.handlePacket(buf[:n], from, dstIP)
+	}
+}
+
+// handlePacket delivers the SCION packet raw, received from the overlay address from on the
+// local address dstIP.
+func (d *Dispatcher) handlePacket(raw common.RawBytes, from *net.UDPAddr, dstIP net.IP) {
+	pkt := &spkt.ScnPkt{
+		DstIA: &addr.ISD_AS{},
+		SrcIA: &addr.ISD_AS{},
+		Path:  &spath.Path{},
+	}
+	if err := hpkt.ParseScnPkt(pkt, raw); err != nil {
+		log.Warn("Dropping invalid packet", "from", from, "err", err)
+		return
+	}
+	var apps []*app
+	switch hdr := pkt.L4.(type) {
+	case *l4.UDP:
+		apps = d.udpDst(pkt, hdr, dstIP)
+	case *scmp.Hdr:
+		apps = d.scmpDst(pkt, hdr)
+	}
+	if len(apps) == 0 {
+		log.Debug("No application found for packet", "dstIA", pkt.DstIA,
+			"dstHost", pkt.DstHost, "l4", pkt.L4)
+		return
+	}
+	for _, a := range apps {
+		a.deliver(raw, from)
+	}
+}
+
+// udpDst returns the applications the SCION/UDP packet pkt is delivered to.
+func (d *Dispatcher) udpDst(pkt *spkt.ScnPkt, hdr *l4.UDP, dstIP net.IP) []*app {
+	svc, ok := pkt.DstHost.(addr.HostSVC)
+	if !ok {
+		if a, ok := d.table.LookupUDP(pkt.DstIA, pkt.DstHost, hdr.DstPort).(*app); ok {
+			return []*app{a}
+		}
+		return nil
+	}
+	if dstIP == nil {
+		log.Warn("Unknown local address, unable to deliver to SVC address", "svc", svc)
+		return nil
+	}
+	values := d.table.LookupSvc(pkt.DstIA, addr.HostFromIP(dstIP), svc)
+	if len(values) == 0 {
+		return nil
+	}
+	// Anycast SVC packets are delivered to one of the applications, picked at random, and
+	// multicast SVC packets to all of them.
+	if !svc.IsMulticast() {
+		values = []interface{}{values[rand.Intn(len(values))]}
+	}
+	apps := make([]*app, len(values))
+	for i, v := range values {
+		apps[i] = v.(*app)
+	}
+	return apps
+}
+
+// scmpDst returns the application that sent the packet quoted in the SCMP error pkt, if that
+// application registered for SCMP errors.
+func (d *Dispatcher) scmpDst(pkt *spkt.ScnPkt, hdr *scmp.Hdr) []*app {
+	if hdr.Class == scmp.C_General {
+		log.Debug("Dropping unsupported SCMP message", "class", hdr.Class, "type", hdr.Type)
+		return nil
+	}
+	pld, ok := pkt.Pld.(*scmp.Payload)
+	if !ok || pld.Meta.L4Proto != common.L4UDP || len(pld.L4Hdr) < l4.UDPLen ||
+		len(pld.CmnHdr) < spkt.CmnHdrLen {
+		log.Debug("Dropping SCMP error without UDP quote", "hdr", hdr)
+		return nil
+	}
+	cmnHdr, err := spkt.CmnHdrFromRaw(pld.CmnHdr)
+	if err != nil {
+		log.Debug("Dropping SCMP error with invalid common header quote", "err", err)
+		return nil
+	}
+	dstLen, errDst := addr.HostLen(cmnHdr.DstType)
+	srcLen, errSrc := addr.HostLen(cmnHdr.SrcType)
+	srcOff := 2*addr.IABytes + int(dstLen)
+	if errDst != nil || errSrc != nil || cmnHdr.SrcType == addr.HostTypeSVC ||
+		len(pld.AddrHdr) < srcOff+int(srcLen) {
+		log.Debug("Dropping SCMP error with invalid address header quote", "hdr", hdr)
+		return nil
+	}
+	srcIA := addr.IAFromRaw(pld.AddrHdr[addr.IABytes:])
+	srcHost, err := addr.HostFromRaw(pld.AddrHdr[srcOff:], cmnHdr.SrcType)
+	if err != nil {
+		log.Debug("Dropping SCMP error with invalid source address", "err", err)
+		return nil
+	}
+	srcPort := common.Order.Uint16(pld.L4Hdr)
+	a, ok := d.table.LookupUDP(srcIA, srcHost, srcPort).(*app)
+	if !ok || !a.reg.SCMP {
+		return nil
+	}
+	return []*app{a}
+}
+
+func (d *Dispatcher) Close() error {
+	d.listener.Close()
+	return d.overlay.Close()
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/hpkt"
+	"github.com/scionproto/scion/go/lib/l4"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/sock/reliable/regtable"
+	"github.com/scionproto/scion/go/lib/spkt"
+)
+
+var (
+	localIA  = &addr.ISD_AS{I: 1, A: 10}
+	remoteIA = &addr.ISD_AS{I: 2, A: 20}
+	appHost  = addr.HostFromIP(net.IPv4(127, 0, 0, 1))
+	peerHost = addr.HostFromIP(net.IPv4(192, 168, 0, 1))
+	brAddr   = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 30041}
+	routing  = scmp.ClassType{Class: scmp.C_Routing, Type: scmp.T_R_UnreachHost}
+)
+
+// register registers an application for host and port in the local AS with d. The returned
+// application has no connection, delivered packets stay in its queue.
+func register(t *testing.T, d *Dispatcher, host addr.HostAddr, port uint16, scmp bool) *app {
+	reg := &reliable.Registration{
+		SCMP:   scmp,
+		IA:     localIA,
+		Public: &reliable.AppAddr{Addr: host, Port: port},
+		SVC:    addr.SvcNone,
+	}
+	a := newApp(nil, reg)
+	if err := d.table.Register(reg, a); err != nil {
+		t.Fatalf("Unable to register application: %v", err)
+	}
+	return a
+}
+
+func writePkt(t *testing.T, pkt *spkt.ScnPkt) common.RawBytes {
+	raw := make(common.RawBytes, common.MaxMTU)
+	n, err := hpkt.WriteScnPkt(pkt, raw)
+	if err != nil {
+		t.Fatalf("Unable to write packet: %v", err)
+	}
+	return raw[:n]
+}
+
+// udpPkt returns a SCION/UDP packet without path from the local AS to the remote AS.
+func udpPkt(t *testing.T, srcPort, dstPort uint16) common.RawBytes {
+	pld := common.RawBytes("payload")
+	return writePkt(t, &spkt.ScnPkt{
+		DstIA:   remoteIA,
+		SrcIA:   localIA,
+		DstHost: peerHost,
+		SrcHost: appHost,
+		L4: &l4.UDP{SrcPort: srcPort, DstPort: dstPort, TotalLen: uint16(l4.UDPLen + len(pld)),
+			Checksum: make(common.RawBytes, 2)},
+		Pld: pld,
+	})
+}
+
+// scmpPkt returns an SCMP error of type ct to the application host, quoting the common,
+// address and L4 headers of the packet quoted. The quote of the L4 header is truncated to l4Len
+// bytes, and claims to be of protocol l4Proto.
+func scmpPkt(t *testing.T, ct scmp.ClassType, info scmp.Info, quoted common.RawBytes,
+	l4Proto common.L4ProtocolType, l4Len int) common.RawBytes {
+
+	cmnHdr, err := spkt.CmnHdrFromRaw(quoted)
+	if err != nil {
+		t.Fatalf("Unable to parse quoted common header: %v", err)
+	}
+	hdrLen := int(cmnHdr.HdrLen) * common.LineLen
+	pld := scmp.PldFromQuotes(ct, info, l4Proto, func(blk scmp.RawBlock) common.RawBytes {
+		switch blk {
+		case scmp.RawCmnHdr:
+			return quoted[:spkt.CmnHdrLen]
+		case scmp.RawAddrHdr:
+			return quoted[spkt.CmnHdrLen:hdrLen]
+		case scmp.RawL4Hdr:
+			return quoted[hdrLen : hdrLen+l4Len]
+		}
+		return nil
+	})
+	return writePkt(t, &spkt.ScnPkt{
+		DstIA:   localIA,
+		SrcIA:   remoteIA,
+		DstHost: appHost,
+		SrcHost: addr.HostFromIP(brAddr.IP),
+		L4:      scmp.NewHdr(ct, pld.Len()),
+		Pld:     pld,
+	})
+}
+
+func TestSCMPRouting(t *testing.T) {
+	Convey("Given a dispatcher with applications on port 40000 and 40001", t, func() {
+		d := &Dispatcher{table: regtable.New()}
+		scmpApp := register(t, d, appHost, 40000, true)
+		otherApp := register(t, d, appHost, 40001, false)
+		Convey("SCMP errors are relayed to the sender of the quoted packet", func() {
+			d.handlePacket(scmpPkt(t, routing, nil, udpPkt(t, 40000, 50000), common.L4UDP,
+				l4.UDPLen), brAddr, nil)
+			SoMsg("scmpApp", len(scmpApp.queue), ShouldEqual, 1)
+			SoMsg("otherApp", len(otherApp.queue), ShouldEqual, 0)
+			p := <-scmpApp.queue
+			SoMsg("from", p.from, ShouldResemble, brAddr)
+		})
+		Convey("SCMP errors are not relayed to senders not registered for SCMP", func() {
+			d.handlePacket(scmpPkt(t, routing, nil, udpPkt(t, 40001, 50000), common.L4UDP,
+				l4.UDPLen), brAddr, nil)
+			SoMsg("scmpApp", len(scmpApp.queue), ShouldEqual, 0)
+			SoMsg("otherApp", len(otherApp.queue), ShouldEqual, 0)
+		})
+		Convey("SCMP errors are not relayed by destination port", func() {
+			d.handlePacket(scmpPkt(t, routing, nil, udpPkt(t, 50000, 40000), common.L4UDP,
+				l4.UDPLen), brAddr, nil)
+			SoMsg("scmpApp", len(scmpApp.queue), ShouldEqual, 0)
+		})
+		Convey("SCMP errors quoting other L4 protocols are dropped", func() {
+			d.handlePacket(scmpPkt(t, routing, nil, udpPkt(t, 40000, 50000), common.L4SCMP,
+				l4.UDPLen), brAddr, nil)
+			SoMsg("scmpApp", len(scmpApp.queue), ShouldEqual, 0)
+		})
+		Convey("SCMP errors without L4 header quote are dropped", func() {
+			d.handlePacket(scmpPkt(t, routing, nil, udpPkt(t, 40000, 50000), common.L4UDP, 0),
+				brAddr, nil)
+			SoMsg("scmpApp", len(scmpApp.queue), ShouldEqual, 0)
+		})
+		Convey("SCMP general messages are dropped", func() {
+			echo := scmp.ClassType{Class: scmp.C_General, Type: scmp.T_G_EchoRequest}
+			d.handlePacket(scmpPkt(t, echo, &scmp.InfoEcho{Id: 1, Seq: 1},
+				udpPkt(t, 40000, 50000), common.L4UDP, l4.UDPLen), brAddr, nil)
+			SoMsg("scmpApp", len(scmpApp.queue), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	Convey("Given a dispatcher with an application on port 40000", t, func() {
+		d := &Dispatcher{table: regtable.New()}
+		a := register(t, d, appHost, 40000, false)
+		pkt := writePkt(t, &spkt.ScnPkt{
+			DstIA:   localIA,
+			SrcIA:   remoteIA,
+			DstHost: appHost,
+			SrcHost: peerHost,
+			L4: &l4.UDP{SrcPort: 50000, DstPort: 40000, TotalLen: l4.UDPLen,
+				Checksum: make(common.RawBytes, 2)},
+			Pld: common.RawBytes{},
+		})
+		Convey("UDP packets are queued for the application", func() {
+			d.handlePacket(pkt, brAddr, nil)
+			SoMsg("queue", len(a.queue), ShouldEqual, 1)
+			p := <-a.queue
+			SoMsg("raw", p.raw, ShouldResemble, pkt)
+		})
+		Convey("Queued packets are copied", func() {
+			d.handlePacket(pkt, brAddr, nil)
+			p := <-a.queue
+			p.raw[0] ^= 0xff
+			SoMsg("raw", p.raw, ShouldNotResemble, pkt)
+		})
+		Convey("Packets to an application with a full queue are dropped", func() {
+			for i := 0; i < appQueueLen+1; i++ {
+				d.handlePacket(pkt, brAddr, nil)
+			}
+			SoMsg("queue", len(a.queue), ShouldEqual, appQueueLen)
+		})
+	})
+}
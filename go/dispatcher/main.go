@@ -0,0 +1,120 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCION dispatcher, a Go implementation of c/dispatcher. Applications register their SCION
+// address with the dispatcher through the ReliableSocket protocol (see lib/sock/reliable).
+//
+// Incoming SCION/UDP packets are delivered to the application registered for the
+// destination (ISD-AS, host, port), either as public or as bind address. Packets to SVC
+// addresses are delivered to one of the applications registered for the SVC address on the
+// local address the packet was received on, or to all of them for multicast SVC addresses.
+// SCMP errors are relayed to the application that sent the quoted packet. SCMP echo requests
+// are not answered.
+//
+// Outgoing packets are sent to the first hop in the ReliableSocket header. The overlay is
+// UDP/IPv4 or UDP/IPv6, depending on the overlay address the dispatcher listens on.
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/common"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/overlay"
+)
+
+const DefaultAppPath = "/run/shm/dispatcher/default.sock"
+
+var (
+	id      = flag.String("id", "dispatcher", "Element ID")
+	appPath = flag.String("app", DefaultAppPath, "Application socket path")
+	ip      = flag.String("addr", "0.0.0.0", "Overlay IPv4 or IPv6 address to listen on")
+	port    = flag.Int("port", overlay.EndhostPort, "Overlay UDP port to listen on")
+)
+
+// main initializes the dispatcher and relays packets until it is terminated.
+func main() {
+	flag.Parse()
+	liblog.Setup(*id)
+	defer liblog.LogPanicAndExit()
+	setupSignals()
+	laddr, err := checkFlags()
+	if err != nil {
+		fatal(err.Error())
+	}
+	if err = os.MkdirAll(filepath.Dir(*appPath), 0755); err != nil {
+		fatal("Unable to create application socket directory", "err", err)
+	}
+	// Remove a stale socket of a previous run.
+	os.Remove(*appPath)
+	d, err := NewDispatcher(*appPath, laddr)
+	if err != nil {
+		fatal("Unable to start dispatcher", "err", err)
+	}
+	// Applications run under different users.
+	if err = os.Chmod(*appPath, 0777); err != nil {
+		fatal("Unable to set application socket permissions", "err", err)
+	}
+	go func() {
+		defer liblog.LogPanicAndExit()
+		if err := d.ServeApps(); err != nil {
+			fatal("Serving applications failed", "err", err)
+		}
+	}()
+	log.Info("Dispatcher started", "app", *appPath, "overlay", laddr)
+	if err = d.ServeOverlay(); err != nil {
+		fatal("Serving overlay failed", "err", err)
+	}
+}
+
+// checkFlags checks the flags and returns the overlay address to listen on.
+func checkFlags() (*net.UDPAddr, error) {
+	overlayIP := net.ParseIP(*ip)
+	if overlayIP == nil {
+		flag.Usage()
+		return nil, common.NewBasicError("Invalid overlay address", nil, "addr", *ip)
+	}
+	if *port <= 0 || *port > 65535 {
+		flag.Usage()
+		return nil, common.NewBasicError("Invalid overlay port", nil, "port", *port)
+	}
+	return &net.UDPAddr{IP: overlayIP, Port: *port}, nil
+}
+
+// setupSignals handle signals.
+func setupSignals() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		log.Info("Received signal, exiting...", "signal", s)
+		os.Remove(*appPath)
+		liblog.Flush()
+		os.Exit(1)
+	}()
+}
+
+func fatal(msg string, args ...interface{}) {
+	log.Crit(msg, args...)
+	liblog.Flush()
+	os.Exit(1)
+}
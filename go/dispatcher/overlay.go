@@ -0,0 +1,82 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/sockctrl"
+)
+
+// overlayConn is the UDP overlay socket of the dispatcher. Depending on the listen address, it
+// is a UDP/IPv4 or a UDP/IPv6 socket. Besides the source address, it reports the local address
+// packets are received on, which is needed to deliver packets to SVC addresses.
+type overlayConn struct {
+	*net.UDPConn
+	oob common.RawBytes
+}
+
+func listenOverlay(laddr *net.UDPAddr) (*overlayConn, error) {
+	network, level, opt := "udp6", syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO
+	if laddr.IP.To4() != nil {
+		network, level, opt = "udp4", syscall.IPPROTO_IP, syscall.IP_PKTINFO
+	}
+	c, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to listen on overlay", err, "addr", laddr)
+	}
+	if err = sockctrl.SetsockoptInt(c, level, opt, 1); err != nil {
+		c.Close()
+		return nil, common.NewBasicError("Unable to enable destination address reporting", err)
+	}
+	oob := make(common.RawBytes, syscall.CmsgSpace(syscall.SizeofInet6Pktinfo))
+	return &overlayConn{UDPConn: c, oob: oob}, nil
+}
+
+// ReadFrom reads a packet into b. It returns the number of bytes read, the source address, and
+// the destination address of the packet, or nil if it is unknown.
+func (c *overlayConn) ReadFrom(b common.RawBytes) (int, *net.UDPAddr, net.IP, error) {
+	n, oobn, _, src, err := c.ReadMsgUDP(b, c.oob)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return n, src, dstIP(c.oob[:oobn]), nil
+}
+
+// dstIP returns the destination address in the packet info control message in oob.
+func dstIP(oob common.RawBytes) net.IP {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_PKTINFO &&
+			len(m.Data) >= syscall.SizeofInet4Pktinfo:
+			info := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			return append(net.IP(nil), info.Addr[:]...)
+		case m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_PKTINFO &&
+			len(m.Data) >= syscall.SizeofInet6Pktinfo:
+			info := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			return append(net.IP(nil), info.Addr[:]...)
+		}
+	}
+	return nil
+}
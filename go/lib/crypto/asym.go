@@ -15,7 +15,10 @@
 package crypto
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/ed25519"
 
@@ -24,41 +27,130 @@ import (
 
 const (
 	Ed25519                    = "ed25519"
+	ECDSAP256                  = "ecdsap256"
+	ECDSAP384                  = "ecdsap384"
 	Curve25519xSalsa20Poly1305 = "curve25519xsalsa20poly1305"
+	InvalidKey                 = "Invalid key"
 	InvalidKeySize             = "Invalid key size"
 	UnsupportedSignAlgo        = "Unsupported signing algorithm"
 	InvalidSignature           = "Invalid signature"
 )
 
-// Sign takes a signature input and a signing key to create a signature. Currently only
-// ed25519 is supported
+// SignAlgo is a signature algorithm. Keys and signatures are passed in the raw encoding defined by
+// the algorithm, which is also used in certificates and TRCs.
+type SignAlgo interface {
+	// GenKeyPair generates a new key pair and returns the public and the private key.
+	GenKeyPair() (common.RawBytes, common.RawBytes, error)
+	// Sign creates a signature over sigInput with the private key signKey.
+	Sign(sigInput, signKey common.RawBytes) (common.RawBytes, error)
+	// Verify returns an error, if sig is not a valid signature over sigInput for the public
+	// key verifyKey.
+	Verify(sigInput, sig, verifyKey common.RawBytes) error
+}
+
+var (
+	signAlgosLock sync.RWMutex
+	// signAlgos maps the lower case algorithm names to the algorithms.
+	signAlgos = make(map[string]SignAlgo)
+)
+
+func init() {
+	RegisterSignAlgo(Ed25519, ed25519Algo{})
+}
+
+// RegisterSignAlgo registers a signature algorithm under the given name. The name is case
+// insensitive. Registering the same name twice panics.
+func RegisterSignAlgo(name string, algo SignAlgo) {
+	signAlgosLock.Lock()
+	defer signAlgosLock.Unlock()
+	name = strings.ToLower(name)
+	if _, ok := signAlgos[name]; ok {
+		panic(fmt.Sprintf("Signature algorithm %s already registered", name))
+	}
+	signAlgos[name] = algo
+}
+
+// GetSignAlgo returns the signature algorithm registered under the given name.
+func GetSignAlgo(name string) (SignAlgo, error) {
+	signAlgosLock.RLock()
+	defer signAlgosLock.RUnlock()
+	algo, ok := signAlgos[strings.ToLower(name)]
+	if !ok {
+		return nil, common.NewBasicError(UnsupportedSignAlgo, nil, "algo", name)
+	}
+	return algo, nil
+}
+
+// SignAlgos returns the sorted names of all registered signature algorithms.
+func SignAlgos() []string {
+	signAlgosLock.RLock()
+	defer signAlgosLock.RUnlock()
+	names := make([]string, 0, len(signAlgos))
+	for name := range signAlgos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GenKeyPair generates a new key pair for the given signing algorithm.
+func GenKeyPair(signAlgo string) (common.RawBytes, common.RawBytes, error) {
+	algo, err := GetSignAlgo(signAlgo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return algo.GenKeyPair()
+}
+
+// Sign takes a signature input and a signing key to create a signature, using the given signing
+// algorithm.
 func Sign(sigInput, signKey common.RawBytes, signAlgo string) (common.RawBytes, error) {
-	switch strings.ToLower(signAlgo) {
-	case Ed25519:
-		if len(signKey) != ed25519.PrivateKeySize {
-			return nil, common.NewBasicError(InvalidKeySize, nil, "expected",
-				ed25519.PrivateKeySize, "actual", len(signKey))
-		}
-		return ed25519.Sign(ed25519.PrivateKey(signKey), sigInput), nil
-	default:
-		return nil, common.NewBasicError(UnsupportedSignAlgo, nil, "algo", signAlgo)
+	algo, err := GetSignAlgo(signAlgo)
+	if err != nil {
+		return nil, err
 	}
+	return algo.Sign(sigInput, signKey)
 }
 
 // Verify takes a signature input and a verifying key and returns an error, if the
-// signature does not match. Currently only ed25519 is supported.
+// signature does not match, using the given signing algorithm.
 func Verify(sigInput, sig, verifyKey common.RawBytes, signAlgo string) error {
-	switch strings.ToLower(signAlgo) {
-	case Ed25519:
-		if len(verifyKey) != ed25519.PublicKeySize {
-			return common.NewBasicError(InvalidKeySize, nil,
-				"expected", ed25519.PublicKeySize, "actual", len(verifyKey))
-		}
-		if !ed25519.Verify(ed25519.PublicKey(verifyKey), sigInput, sig) {
-			return common.NewBasicError(InvalidSignature, nil)
-		}
-		return nil
-	default:
-		return common.NewBasicError(UnsupportedSignAlgo, nil, "algo", signAlgo)
+	algo, err := GetSignAlgo(signAlgo)
+	if err != nil {
+		return err
+	}
+	return algo.Verify(sigInput, sig, verifyKey)
+}
+
+var _ SignAlgo = ed25519Algo{}
+
+// ed25519Algo implements Ed25519. The private key is the 64 byte concatenation of seed and public
+// key used by golang.org/x/crypto/ed25519.
+type ed25519Algo struct{}
+
+func (ed25519Algo) GenKeyPair() (common.RawBytes, common.RawBytes, error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return common.RawBytes(pub), common.RawBytes(priv), nil
+}
+
+func (ed25519Algo) Sign(sigInput, signKey common.RawBytes) (common.RawBytes, error) {
+	if len(signKey) != ed25519.PrivateKeySize {
+		return nil, common.NewBasicError(InvalidKeySize, nil, "expected",
+			ed25519.PrivateKeySize, "actual", len(signKey))
+	}
+	return ed25519.Sign(ed25519.PrivateKey(signKey), sigInput), nil
+}
+
+func (ed25519Algo) Verify(sigInput, sig, verifyKey common.RawBytes) error {
+	if len(verifyKey) != ed25519.PublicKeySize {
+		return common.NewBasicError(InvalidKeySize, nil,
+			"expected", ed25519.PublicKeySize, "actual", len(verifyKey))
+	}
+	if !ed25519.Verify(ed25519.PublicKey(verifyKey), sigInput, sig) {
+		return common.NewBasicError(InvalidSignature, nil)
 	}
+	return nil
 }
@@ -0,0 +1,142 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+// vectors contains a test vector for every supported signature algorithm. The
+// ed25519 vector is TEST 1 of RFC 8032, section 7.1. The ECDSA vectors are the
+// "sample" vectors with SHA-256 resp. SHA-384 of RFC 6979, appendix A.2.5 and
+// A.2.6.
+var vectors = []struct {
+	algo string
+	priv string
+	pub  string
+	msg  string
+	sig  string
+}{
+	{
+		algo: Ed25519,
+		priv: "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60" +
+			"d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		pub: "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		msg: "",
+		sig: "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e06522490155" +
+			"5fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b",
+	},
+	{
+		algo: ECDSAP256,
+		priv: "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+		pub: "04" +
+			"60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6" +
+			"7903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299",
+		msg: "sample",
+		sig: "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716" +
+			"f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8",
+	},
+	{
+		algo: ECDSAP384,
+		priv: "6b9d3dad2e1b8c1c05b19875b6659f4de23c3b667bf297ba" +
+			"9aa47740787137d896d5724e4c70a825f872c9ea60d2edf5",
+		pub: "04" +
+			"ec3a4e415b4e19a4568618029f427fa5da9a8bc4ae92e02e" +
+			"06aae5286b300c64def8f0ea9055866064a254515480bc13" +
+			"8015d9b72d7d57244ea8ef9ac0c621896708a59367f9dfb9" +
+			"f54ca84b3f1c9db1288b231c3ae0d4fe7344fd2533264720",
+		msg: "sample",
+		sig: "94edbb92a5ecb8aad4736e56c691916b3f88140666ce9fa7" +
+			"3d64c4ea95ad133c81a648152e44acf96e36dd1e80fabe46" +
+			"99ef4aeb15f178cea1fe40db2603138f130e740a19624526" +
+			"203b6351d0a3a94fa329c145786e679e7b82c71a38628ac8",
+	},
+}
+
+func Test_Vectors(t *testing.T) {
+	Convey("Test vectors are verified correctly", t, func() {
+		SoMsg("coverage", len(vectors), ShouldEqual, len(SignAlgos()))
+		for _, v := range vectors {
+			Convey(v.algo, func() {
+				priv, pub, sig := fromHex(v.priv), fromHex(v.pub), fromHex(v.sig)
+				msg := common.RawBytes(v.msg)
+				SoMsg("verify", Verify(msg, sig, pub, v.algo), ShouldBeNil)
+				SoMsg("algo case", Verify(msg, sig, pub, strings.ToUpper(v.algo)), ShouldBeNil)
+				err := Verify(common.RawBytes("other"), sig, pub, v.algo)
+				SoMsg("verify other", common.GetErrorMsg(err), ShouldEqual, InvalidSignature)
+				// ECDSA signatures are randomized, so only check that the private key matches.
+				newSig, err := Sign(msg, priv, v.algo)
+				SoMsg("sign err", err, ShouldBeNil)
+				SoMsg("verify new", Verify(msg, newSig, pub, v.algo), ShouldBeNil)
+			})
+		}
+	})
+}
+
+func Test_SignAlgos(t *testing.T) {
+	Convey("All signature algorithms sign and verify correctly", t, func() {
+		msg := common.RawBytes("message")
+		for _, algo := range SignAlgos() {
+			Convey(algo, func() {
+				pub, priv, err := GenKeyPair(algo)
+				SoMsg("gen err", err, ShouldBeNil)
+				sig, err := Sign(msg, priv, algo)
+				SoMsg("sign err", err, ShouldBeNil)
+				SoMsg("verify", Verify(msg, sig, pub, algo), ShouldBeNil)
+				Convey("Tampered signature", func() {
+					sig[len(sig)-1] ^= 0xFF
+					err := Verify(msg, sig, pub, algo)
+					SoMsg("err", common.GetErrorMsg(err), ShouldEqual, InvalidSignature)
+				})
+				Convey("Other key", func() {
+					otherPub, _, _ := GenKeyPair(algo)
+					err := Verify(msg, sig, otherPub, algo)
+					SoMsg("err", common.GetErrorMsg(err), ShouldEqual, InvalidSignature)
+				})
+				Convey("Truncated keys", func() {
+					_, err := Sign(msg, priv[1:], algo)
+					SoMsg("sign", common.GetErrorMsg(err), ShouldEqual, InvalidKeySize)
+					SoMsg("verify", Verify(msg, sig, pub[1:], algo), ShouldNotBeNil)
+				})
+			})
+		}
+	})
+	Convey("Unknown algorithms are rejected", t, func() {
+		_, err := Sign(common.RawBytes("message"), nil, "rsa")
+		SoMsg("sign", common.GetErrorMsg(err), ShouldEqual, UnsupportedSignAlgo)
+		err = Verify(common.RawBytes("message"), nil, nil, "rsa")
+		SoMsg("verify", common.GetErrorMsg(err), ShouldEqual, UnsupportedSignAlgo)
+		_, _, err = GenKeyPair("rsa")
+		SoMsg("gen", common.GetErrorMsg(err), ShouldEqual, UnsupportedSignAlgo)
+	})
+	Convey("Registering an algorithm twice panics", t, func() {
+		SoMsg("panic", func() { RegisterSignAlgo(strings.ToUpper(Ed25519), ed25519Algo{}) },
+			ShouldPanic)
+	})
+}
+
+func fromHex(s string) common.RawBytes {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -119,11 +119,16 @@ func (c *Certificate) VerifySignature(verifyKey common.RawBytes, signAlgo string
 // Sign adds signature to the certificate. The signature is computed over the certificate
 // without the signature field.
 func (c *Certificate) Sign(signKey common.RawBytes, signAlgo string) error {
+	return c.SignWith(crypto.NewKeySigner(signKey), signAlgo)
+}
+
+// SignWith adds signature to the certificate, created by signer. See Sign.
+func (c *Certificate) SignWith(signer crypto.Signer, signAlgo string) error {
 	sigInput, err := c.sigPack()
 	if err != nil {
 		return err
 	}
-	sig, err := crypto.Sign(sigInput, signKey, signAlgo)
+	sig, err := signer.Sign(sigInput, signAlgo)
 	if err != nil {
 		return err
 	}
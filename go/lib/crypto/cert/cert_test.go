@@ -149,6 +149,31 @@ func Test_Certificate_Sign(t *testing.T) {
 	})
 }
 
+func Test_Certificate_SignAlgos(t *testing.T) {
+	Convey("Certificates with keys of all signature algorithms round-trip", t, func() {
+		for _, algo := range crypto.SignAlgos() {
+			Convey(algo, func() {
+				subjPub, _, err := crypto.GenKeyPair(algo)
+				SoMsg("gen subject err", err, ShouldBeNil)
+				issPub, issPriv, err := crypto.GenKeyPair(algo)
+				SoMsg("gen issuer err", err, ShouldBeNil)
+				c := loadCert(fnLeaf, t)
+				c.SignAlgorithm = algo
+				c.SubjectSignKey = subjPub
+				c.IssuingTime = uint64(time.Now().Unix())
+				c.ExpirationTime = c.IssuingTime + 1<<20
+				SoMsg("sign err", c.Sign(issPriv, algo), ShouldBeNil)
+				raw, err := c.JSON(true)
+				SoMsg("json err", err, ShouldBeNil)
+				parsed, err := CertificateFromRaw(raw)
+				SoMsg("parse err", err, ShouldBeNil)
+				SoMsg("eq", parsed.Eq(c), ShouldBeTrue)
+				SoMsg("verify", parsed.Verify(c.Subject, issPub, algo), ShouldBeNil)
+			})
+		}
+	})
+}
+
 func Test_Certificate_String(t *testing.T) {
 	Convey("Certificate is returned as String correctly", t, func() {
 		cert := loadCert(fnLeaf, t)
@@ -0,0 +1,240 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cert
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pierrec/lz4"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/util"
+)
+
+const (
+	MaxRevListByteLength uint32 = 1 << 20
+
+	// Error strings
+	RevListEarlyUsage    = "Revocation list IssuingTime in the future"
+	RevListInvalidEntry  = "Revocation list entry without subject"
+	RevListInvalidISD    = "Revocation list issued in other ISD"
+	RevListInvalidTRC    = "Revocation list issued under other TRC version"
+	RevListMissingIssuer = "Revocation list without issuer"
+	RevListTooShort      = "Revocation list LZ4 block too short"
+	RevListUnableSigPack = "RevList: Unable to create signature input"
+	RevokedCert          = "Certificate revoked"
+)
+
+// RevEntry identifies a revoked certificate.
+type RevEntry struct {
+	// Subject is the subject of the revoked certificate.
+	Subject *addr.ISD_AS
+	// Version is the version of the revoked certificate.
+	Version uint64
+	// RevocationTime is the unix timestamp in seconds at which the certificate was revoked.
+	RevocationTime uint64
+}
+
+func (e *RevEntry) String() string {
+	return fmt.Sprintf("%sv%d", e.Subject, e.Version)
+}
+
+// RevList is a list of revoked certificates, issued by a core AS. It contains the leaf
+// certificates issued by the core AS, as well as its own core certificates, that must no longer
+// be accepted, even though they have not expired yet. The list is signed with the online key of
+// the issuer, which is authenticated by the TRC. Each revocation list supersedes all lists of the
+// same issuer with a lower version.
+type RevList struct {
+	// Entries are the revoked certificates.
+	Entries []*RevEntry
+	// Issuer is the core AS that issued the revocation list.
+	Issuer *addr.ISD_AS
+	// IssuingTime is the unix timestamp in seconds at which the revocation list was created.
+	IssuingTime uint64
+	// Signature is the revocation list signature. It is computed over the rest of the list.
+	Signature common.RawBytes `json:",omitempty"`
+	// TRCVersion is the version of the TRC authenticating the online key of the issuer.
+	TRCVersion uint64
+	// Version is the revocation list version. The value 0 is reserved and shall not be used.
+	Version uint64
+}
+
+// RevListFromRaw parses a revocation list, which is lz4 compressed if lz4_ is set. Lists without
+// issuer, or with entries without subject are rejected.
+func RevListFromRaw(raw common.RawBytes, lz4_ bool) (*RevList, error) {
+	if lz4_ {
+		// Revocation lists use the same compression as certificate chains and TRCs, see
+		// ChainFromRaw.
+		if len(raw) < 4 {
+			return nil, common.NewBasicError(RevListTooShort, nil, "len", len(raw))
+		}
+		byteLen := binary.LittleEndian.Uint32(raw[:4])
+		if byteLen > MaxRevListByteLength {
+			return nil, common.NewBasicError("Revocation list LZ4 block too large", nil,
+				"max", MaxRevListByteLength, "actual", byteLen)
+		}
+		buf := make([]byte, byteLen)
+		n, err := lz4.UncompressBlock(raw[4:], buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		raw = buf[:n]
+	}
+	r := &RevList{}
+	if err := json.Unmarshal(raw, r); err != nil {
+		return nil, common.NewBasicError("Unable to parse revocation list", err)
+	}
+	if r.Version == 0 {
+		return nil, common.NewBasicError(ReservedVersion, nil)
+	}
+	if r.Issuer == nil {
+		return nil, common.NewBasicError(RevListMissingIssuer, nil)
+	}
+	for i, e := range r.Entries {
+		if e == nil || e.Subject == nil {
+			return nil, common.NewBasicError(RevListInvalidEntry, nil, "index", i)
+		}
+	}
+	return r, nil
+}
+
+// Verify checks that the revocation list was issued under the TRC t, and that it is signed
+// with the online key of the issuer.
+func (r *RevList) Verify(t *trc.TRC) error {
+	if int(t.ISD) != r.Issuer.I {
+		return common.NewBasicError(RevListInvalidISD, nil,
+			"expected", t.ISD, "actual", r.Issuer.I)
+	}
+	if t.Version != r.TRCVersion {
+		return common.NewBasicError(RevListInvalidTRC, nil,
+			"expected", t.Version, "actual", r.TRCVersion)
+	}
+	if now := uint64(time.Now().Unix()); now < r.IssuingTime {
+		return common.NewBasicError(RevListEarlyUsage, nil, "IssuingTime",
+			util.TimeToString(r.IssuingTime), "current", util.TimeToString(now))
+	}
+	coreAS, ok := t.CoreASes[*r.Issuer]
+	if !ok {
+		return common.NewBasicError(IssASNotFound, nil, "isdas", r.Issuer, "coreASes",
+			t.CoreASes)
+	}
+	sigInput, err := r.sigPack()
+	if err != nil {
+		return common.NewBasicError(RevListUnableSigPack, err)
+	}
+	return crypto.Verify(sigInput, r.Signature, coreAS.OnlineKey, coreAS.OnlineKeyAlg)
+}
+
+// Sign adds the signature to the revocation list. The signature is computed over the list
+// without the signature field.
+func (r *RevList) Sign(signKey common.RawBytes, signAlgo string) error {
+	return r.SignWith(crypto.NewKeySigner(signKey), signAlgo)
+}
+
+// SignWith adds the signature to the revocation list, created by signer. See Sign.
+func (r *RevList) SignWith(signer crypto.Signer, signAlgo string) error {
+	sigInput, err := r.sigPack()
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(sigInput, signAlgo)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// sigPack creates a sorted json object of all fields, except for the signature field.
+func (r *RevList) sigPack() (common.RawBytes, error) {
+	if r.Version == 0 {
+		return nil, common.NewBasicError(ReservedVersion, nil)
+	}
+	m := make(map[string]interface{})
+	m["Entries"] = r.Entries
+	m["Issuer"] = r.Issuer
+	m["IssuingTime"] = r.IssuingTime
+	m["TRCVersion"] = r.TRCVersion
+	m["Version"] = r.Version
+	sigInput, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return sigInput, nil
+}
+
+// Revokes returns the entry revoking the certificate c, or nil if c is not revoked by this
+// list. Only certificates issued by the issuer of the list can be revoked.
+func (r *RevList) Revokes(c *Certificate) *RevEntry {
+	if !r.Issuer.Eq(c.Issuer) {
+		return nil
+	}
+	for _, e := range r.Entries {
+		if e.Subject.Eq(c.Subject) && e.Version == c.Version {
+			return e
+		}
+	}
+	return nil
+}
+
+// CheckChain returns an error, if the leaf or the core certificate of the chain is revoked by
+// this list.
+func (r *RevList) CheckChain(c *Chain) error {
+	for _, crt := range []*Certificate{c.Leaf, c.Core} {
+		if e := r.Revokes(crt); e != nil {
+			return common.NewBasicError(RevokedCert, nil, "cert", crt, "revList", r,
+				"revocationTime", util.TimeToString(e.RevocationTime))
+		}
+	}
+	return nil
+}
+
+// Compress compresses the JSON generated from the revocation list using lz4 block mode and
+// prepends the original length (4 bytes, little endian, unsigned).
+func (r *RevList) Compress() (common.RawBytes, error) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	comp := make([]byte, lz4.CompressBlockBound(len(raw))+4)
+	binary.LittleEndian.PutUint32(comp[:4], uint32(len(raw)))
+	n, err := lz4.CompressBlock(raw, comp[4:], 0)
+	if err != nil {
+		return nil, err
+	}
+	return comp[:n+4], err
+}
+
+func (r *RevList) Key() *Key {
+	return NewKey(r.Issuer, r.Version)
+}
+
+func (r *RevList) String() string {
+	return fmt.Sprintf("RevList %sv%d", r.Issuer, r.Version)
+}
+
+func (r *RevList) JSON(indent bool) ([]byte, error) {
+	if indent {
+		return json.MarshalIndent(r, "", strings.Repeat(" ", 4))
+	}
+	return json.Marshal(r)
+}
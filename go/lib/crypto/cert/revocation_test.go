@@ -0,0 +1,167 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cert
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+// revListObjs returns the test TRC with a fresh online key for core AS 1-13, and an empty
+// revocation list of 1-13, signed accordingly.
+func revListObjs(t *testing.T) (*trc.TRC, common.RawBytes, *RevList) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	issuer := &addr.ISD_AS{I: 1, A: 13}
+	trc_ := loadTRC(fnTRC, t)
+	trc_.CoreASes[*issuer].OnlineKey = []byte(pub)
+	trc_.CoreASes[*issuer].OnlineKeyAlg = crypto.Ed25519
+	r := &RevList{Issuer: issuer, IssuingTime: uint64(time.Now().Unix()),
+		TRCVersion: trc_.Version, Version: 1}
+	if err := r.Sign([]byte(priv), crypto.Ed25519); err != nil {
+		t.Fatalf("Unable to sign revocation list: %v", err)
+	}
+	return trc_, []byte(priv), r
+}
+
+func Test_RevList_Verify(t *testing.T) {
+	Convey("Revocation list is verifiable", t, func() {
+		trc_, signKey, r := revListObjs(t)
+		SoMsg("err", r.Verify(trc_), ShouldBeNil)
+		Convey("Tampered list", func() {
+			r.Entries = append(r.Entries, &RevEntry{Subject: &addr.ISD_AS{I: 1, A: 10},
+				Version: 1})
+			err := r.Verify(trc_)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, crypto.InvalidSignature)
+			SoMsg("sign", r.Sign(signKey, crypto.Ed25519), ShouldBeNil)
+			SoMsg("resigned", r.Verify(trc_), ShouldBeNil)
+		})
+		Convey("Other TRC version", func() {
+			r.TRCVersion++
+			err := r.Verify(trc_)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, RevListInvalidTRC)
+		})
+		Convey("Unknown issuer", func() {
+			r.Issuer = &addr.ISD_AS{I: 1, A: 10}
+			err := r.Verify(trc_)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, IssASNotFound)
+		})
+		Convey("Issued in the future", func() {
+			r.IssuingTime += 1 << 10
+			err := r.Verify(trc_)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, RevListEarlyUsage)
+		})
+	})
+}
+
+func Test_RevList_CheckChain(t *testing.T) {
+	Convey("Revoked certificates are detected", t, func() {
+		_, _, r := revListObjs(t)
+		chain := loadChain(fnChain, t)
+		SoMsg("empty", r.CheckChain(chain), ShouldBeNil)
+		Convey("Revoked leaf", func() {
+			r.Entries = []*RevEntry{{Subject: chain.Leaf.Subject, Version: 1}}
+			SoMsg("entry", r.Revokes(chain.Leaf), ShouldEqual, r.Entries[0])
+			SoMsg("err", common.GetErrorMsg(r.CheckChain(chain)), ShouldEqual, RevokedCert)
+		})
+		Convey("Revoked core", func() {
+			r.Entries = []*RevEntry{{Subject: chain.Core.Subject, Version: 1}}
+			SoMsg("err", common.GetErrorMsg(r.CheckChain(chain)), ShouldEqual, RevokedCert)
+		})
+		Convey("Other version", func() {
+			r.Entries = []*RevEntry{{Subject: chain.Leaf.Subject, Version: 2}}
+			SoMsg("err", r.CheckChain(chain), ShouldBeNil)
+		})
+		Convey("Other issuer", func() {
+			r.Entries = []*RevEntry{{Subject: chain.Leaf.Subject, Version: 1}}
+			r.Issuer = &addr.ISD_AS{I: 1, A: 11}
+			SoMsg("err", r.CheckChain(chain), ShouldBeNil)
+		})
+	})
+}
+
+func Test_RevListFromRaw(t *testing.T) {
+	Convey("Revocation list is parsed correctly", t, func() {
+		_, _, r := revListObjs(t)
+		r.Entries = []*RevEntry{{Subject: &addr.ISD_AS{I: 1, A: 10}, Version: 1,
+			RevocationTime: r.IssuingTime}}
+		raw, err := r.JSON(false)
+		SoMsg("err", err, ShouldBeNil)
+		parsed, err := RevListFromRaw(raw, false)
+		SoMsg("err", err, ShouldBeNil)
+		SoMsg("parsed", parsed, ShouldResemble, r)
+		comp, err := r.Compress()
+		SoMsg("comp err", err, ShouldBeNil)
+		parsed, err = RevListFromRaw(comp, true)
+		SoMsg("uncomp err", err, ShouldBeNil)
+		SoMsg("uncomp", parsed, ShouldResemble, r)
+	})
+	Convey("Version 0 is rejected", t, func() {
+		_, err := RevListFromRaw(common.RawBytes(`{"Version": 0}`), false)
+		SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ReservedVersion)
+	})
+	Convey("Malformed revocation lists are rejected", t, func() {
+		tests := []struct {
+			desc   string
+			raw    string
+			lz4_   bool
+			errMsg string
+		}{
+			{"Empty compressed list", "", true, RevListTooShort},
+			{"Truncated length", "\x01\x00", true, RevListTooShort},
+			{"Missing issuer", `{"Version": 1}`, false, RevListMissingIssuer},
+			{"Null issuer", `{"Issuer": null, "Version": 1}`, false, RevListMissingIssuer},
+			{"Null entry", `{"Issuer": "1-13", "Version": 1, "Entries": [null]}`, false,
+				RevListInvalidEntry},
+			{"Entry without subject", `{"Issuer": "1-13", "Version": 1, "Entries": [{}]}`,
+				false, RevListInvalidEntry},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				r, err := RevListFromRaw(common.RawBytes(test.raw), test.lz4_)
+				SoMsg("rev list", r, ShouldBeNil)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, test.errMsg)
+			})
+		}
+	})
+	Convey("Random input does not cause a panic", t, func() {
+		rnd := rand.New(rand.NewSource(1))
+		_, _, r := revListObjs(t)
+		comp, err := r.Compress()
+		SoMsg("comp err", err, ShouldBeNil)
+		for i := 0; i < 1000; i++ {
+			raw := make(common.RawBytes, rnd.Intn(2*len(comp)))
+			rnd.Read(raw)
+			if i%2 == 0 {
+				// Keep a valid length prefix and mutate the compressed block.
+				raw = append(common.RawBytes(nil), comp[:rnd.Intn(len(comp))+1]...)
+				if len(raw) > 4 {
+					raw[4+rnd.Intn(len(raw)-4)] ^= byte(rnd.Intn(255) + 1)
+				}
+			}
+			SoMsg("lz4", func() { RevListFromRaw(raw, true) }, ShouldNotPanic)
+			SoMsg("json", func() { RevListFromRaw(raw, false) }, ShouldNotPanic)
+		}
+	})
+}
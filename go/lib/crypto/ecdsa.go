@@ -0,0 +1,105 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"math/big"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+func init() {
+	RegisterSignAlgo(ECDSAP256, &ecdsaAlgo{curve: elliptic.P256(), newHash: sha256.New})
+	RegisterSignAlgo(ECDSAP384, &ecdsaAlgo{curve: elliptic.P384(), newHash: sha512.New384})
+}
+
+var _ SignAlgo = (*ecdsaAlgo)(nil)
+
+// ecdsaAlgo implements ECDSA on a NIST curve, with SHA-256 for P-256 and SHA-384 for P-384. Public
+// keys are encoded as uncompressed points (SEC 1), private keys as big-endian scalars, and
+// signatures as the concatenation of r and s. All integers are padded to the byte length of the
+// curve order.
+type ecdsaAlgo struct {
+	curve   elliptic.Curve
+	newHash func() hash.Hash
+}
+
+// byteLen returns the length of an encoded integer.
+func (a *ecdsaAlgo) byteLen() int {
+	return (a.curve.Params().BitSize + 7) / 8
+}
+
+func (a *ecdsaAlgo) GenKeyPair() (common.RawBytes, common.RawBytes, error) {
+	priv, err := ecdsa.GenerateKey(a.curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub := elliptic.Marshal(a.curve, priv.X, priv.Y)
+	return pub, a.pad(priv.D), nil
+}
+
+func (a *ecdsaAlgo) Sign(sigInput, signKey common.RawBytes) (common.RawBytes, error) {
+	if len(signKey) != a.byteLen() {
+		return nil, common.NewBasicError(InvalidKeySize, nil,
+			"expected", a.byteLen(), "actual", len(signKey))
+	}
+	d := new(big.Int).SetBytes(signKey)
+	if d.Sign() == 0 || d.Cmp(a.curve.Params().N) >= 0 {
+		return nil, common.NewBasicError(InvalidKey, nil)
+	}
+	priv := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: a.curve}, D: d}
+	priv.X, priv.Y = a.curve.ScalarBaseMult(signKey)
+	r, s, err := ecdsa.Sign(rand.Reader, priv, a.digest(sigInput))
+	if err != nil {
+		return nil, err
+	}
+	return append(a.pad(r), a.pad(s)...), nil
+}
+
+func (a *ecdsaAlgo) Verify(sigInput, sig, verifyKey common.RawBytes) error {
+	x, y := elliptic.Unmarshal(a.curve, verifyKey)
+	if x == nil {
+		return common.NewBasicError(InvalidKey, nil)
+	}
+	if len(sig) != 2*a.byteLen() {
+		return common.NewBasicError(InvalidSignature, nil)
+	}
+	r := new(big.Int).SetBytes(sig[:a.byteLen()])
+	s := new(big.Int).SetBytes(sig[a.byteLen():])
+	pub := &ecdsa.PublicKey{Curve: a.curve, X: x, Y: y}
+	if !ecdsa.Verify(pub, a.digest(sigInput), r, s) {
+		return common.NewBasicError(InvalidSignature, nil)
+	}
+	return nil
+}
+
+func (a *ecdsaAlgo) digest(sigInput common.RawBytes) []byte {
+	h := a.newHash()
+	h.Write(sigInput)
+	return h.Sum(nil)
+}
+
+// pad encodes i as big-endian integer of byteLen bytes.
+func (a *ecdsaAlgo) pad(i *big.Int) common.RawBytes {
+	b := i.Bytes()
+	raw := make(common.RawBytes, a.byteLen()-len(b), a.byteLen())
+	return append(raw, b...)
+}
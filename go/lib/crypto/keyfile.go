@@ -0,0 +1,116 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+const (
+	// KDFPBKDF2SHA256 is PBKDF2 with HMAC-SHA256.
+	KDFPBKDF2SHA256 = "pbkdf2-sha256"
+	// DefaultKDFIterations is the number of PBKDF2 iterations used by EncryptKey.
+	DefaultKDFIterations = 100000
+
+	MissingPassword   = "Key file is encrypted, but no password is given"
+	UnsupportedKDF    = "Unsupported key derivation function"
+	KeyDecryptFailure = "Unable to decrypt key file, wrong password?"
+
+	kdfSaltLen = 16
+	// aesKeyLen selects AES-256.
+	aesKeyLen = 32
+)
+
+// EncryptedKey is the format of a password-encrypted key file. The private key is sealed with
+// AES-256-GCM, using a key derived from the password with the key derivation function KDF.
+type EncryptedKey struct {
+	KDF        string
+	Iterations int
+	Salt       common.RawBytes
+	Nonce      common.RawBytes
+	Ciphertext common.RawBytes
+}
+
+// EncryptKey encrypts the raw private key with password, and returns the JSON encoded
+// EncryptedKey, which can be stored as key file.
+func EncryptKey(key common.RawBytes, password []byte) (common.RawBytes, error) {
+	if len(password) == 0 {
+		return nil, common.NewBasicError(MissingPassword, nil)
+	}
+	e := &EncryptedKey{KDF: KDFPBKDF2SHA256, Iterations: DefaultKDFIterations,
+		Salt: make(common.RawBytes, kdfSaltLen)}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := e.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	e.Nonce = make(common.RawBytes, aead.NonceSize())
+	if _, err = rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, key, nil)
+	return json.MarshalIndent(e, "", "    ")
+}
+
+// DecryptKey decrypts the JSON encoded EncryptedKey raw with password, and returns the raw
+// private key.
+func DecryptKey(raw common.RawBytes, password []byte) (common.RawBytes, error) {
+	if len(password) == 0 {
+		return nil, common.NewBasicError(MissingPassword, nil)
+	}
+	e := &EncryptedKey{}
+	if err := json.Unmarshal(raw, e); err != nil {
+		return nil, common.NewBasicError(InvalidKeyFile, err)
+	}
+	aead, err := e.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, common.NewBasicError(InvalidKeyFile, nil, "err", "invalid nonce size",
+			"expected", aead.NonceSize(), "actual", len(e.Nonce))
+	}
+	key, err := aead.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return nil, common.NewBasicError(KeyDecryptFailure, nil)
+	}
+	return key, nil
+}
+
+// aead derives the key from password, and returns the cipher.
+func (e *EncryptedKey) aead(password []byte) (cipher.AEAD, error) {
+	if e.KDF != KDFPBKDF2SHA256 {
+		return nil, common.NewBasicError(UnsupportedKDF, nil, "kdf", e.KDF)
+	}
+	if e.Iterations <= 0 || len(e.Salt) == 0 {
+		return nil, common.NewBasicError(InvalidKeyFile, nil, "err", "invalid kdf parameters")
+	}
+	key := pbkdf2.Key(password, e.Salt, e.Iterations, aesKeyLen, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
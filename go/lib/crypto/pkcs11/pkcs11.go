@@ -0,0 +1,293 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build pkcs11
+
+// Package pkcs11 registers a signer backend for private keys stored in a
+// PKCS#11 token, e.g., a hardware security module or SoftHSM. Importing the
+// package registers the backend for the "pkcs11" scheme:
+//
+//	import _ "github.com/scionproto/scion/go/lib/crypto/pkcs11"
+//
+// Keys are identified by PKCS#11 URIs (RFC 7512), which are stored in the key
+// files instead of the keys themselves, e.g.:
+//
+//	pkcs11:token=scion;object=as-sig?module-path=/usr/lib/libsofthsm2.so&pin-source=/etc/pin
+//
+// The path attribute token selects the token by label, and object selects the
+// private key by label. The query attribute module-path is required. The user
+// PIN is given either by pin-value, or read from the file pin-source.
+//
+// The package requires cgo and github.com/miekg/pkcs11, and is only built
+// with the pkcs11 build tag.
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+)
+
+const (
+	Scheme = "pkcs11"
+
+	ErrInvalidURI  = "Invalid PKCS#11 URI"
+	ErrModule      = "Unable to load PKCS#11 module"
+	ErrNoToken     = "PKCS#11 token not found"
+	ErrNoKey       = "PKCS#11 private key not found"
+	ErrSession     = "Unable to open PKCS#11 session"
+	ErrSignFailure = "PKCS#11 signing failed"
+)
+
+// ckmEdDSA is CKM_EDDSA of PKCS#11 v3.0, which is not defined by all versions of the bindings.
+const ckmEdDSA = 0x1057
+
+func init() {
+	crypto.RegisterSignerBackend(Scheme, Open)
+}
+
+var (
+	modulesLock sync.Mutex
+	// modules maps module paths to the initialized modules. A module must only be initialized
+	// once per process.
+	modules = make(map[string]*pkcs11.Ctx)
+)
+
+var _ crypto.Signer = (*Signer)(nil)
+
+// Signer signs with a private key stored in a PKCS#11 token.
+type Signer struct {
+	uri string
+	ctx *pkcs11.Ctx
+	// lock guards the session, which must not be used concurrently.
+	lock    sync.Mutex
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+}
+
+// Open opens a session to the token identified by uri, logs in, and returns a Signer for the
+// private key identified by uri.
+func Open(uri string) (crypto.Signer, error) {
+	attrs, err := parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := loadModule(attrs["module-path"])
+	if err != nil {
+		return nil, err
+	}
+	slot, err := findSlot(ctx, attrs["token"])
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, common.NewBasicError(ErrSession, err, "uri", redact(uri))
+	}
+	s := &Signer{uri: redact(uri), ctx: ctx, session: session}
+	if err = s.login(attrs); err != nil {
+		ctx.CloseSession(session)
+		return nil, err
+	}
+	if s.key, err = s.findKey(attrs["object"]); err != nil {
+		ctx.CloseSession(session)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Sign creates a signature over sigInput. For ECDSA, the digest is computed locally, and the
+// token returns the concatenation of r and s, which is the encoding used by crypto.Sign.
+func (s *Signer) Sign(sigInput common.RawBytes, signAlgo string) (common.RawBytes, error) {
+	var mech uint
+	var data []byte
+	switch strings.ToLower(signAlgo) {
+	case crypto.Ed25519:
+		mech, data = ckmEdDSA, sigInput
+	case crypto.ECDSAP256:
+		d := sha256.Sum256(sigInput)
+		mech, data = pkcs11.CKM_ECDSA, d[:]
+	case crypto.ECDSAP384:
+		d := sha512.Sum384(sigInput)
+		mech, data = pkcs11.CKM_ECDSA, d[:]
+	default:
+		return nil, common.NewBasicError(crypto.UnsupportedSignAlgo, nil, "algo", signAlgo)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m := []*pkcs11.Mechanism{pkcs11.NewMechanism(mech, nil)}
+	if err := s.ctx.SignInit(s.session, m, s.key); err != nil {
+		return nil, common.NewBasicError(ErrSignFailure, err, "uri", s.uri)
+	}
+	sig, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, common.NewBasicError(ErrSignFailure, err, "uri", s.uri)
+	}
+	return sig, nil
+}
+
+// Close closes the session. The Signer must not be used afterwards.
+func (s *Signer) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ctx.CloseSession(s.session)
+}
+
+func (s *Signer) String() string {
+	return s.uri
+}
+
+func (s *Signer) login(attrs map[string]string) error {
+	pin, ok := attrs["pin-value"]
+	if src, srcOk := attrs["pin-source"]; srcOk {
+		raw, err := ioutil.ReadFile(strings.TrimPrefix(src, "file:"))
+		if err != nil {
+			return common.NewBasicError(ErrSession, err, "err", "unable to read pin",
+				"uri", s.uri)
+		}
+		pin, ok = string(bytes.TrimRight(raw, "\r\n")), true
+	}
+	if !ok {
+		return nil
+	}
+	err := s.ctx.Login(s.session, pkcs11.CKU_USER, pin)
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return common.NewBasicError(ErrSession, err, "err", "login failed", "uri", s.uri)
+	}
+	return nil
+}
+
+func (s *Signer) findKey(label string) (pkcs11.ObjectHandle, error) {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := s.ctx.FindObjectsInit(s.session, tmpl); err != nil {
+		return 0, common.NewBasicError(ErrNoKey, err, "uri", s.uri)
+	}
+	objs, _, err := s.ctx.FindObjects(s.session, 1)
+	s.ctx.FindObjectsFinal(s.session)
+	if err != nil {
+		return 0, common.NewBasicError(ErrNoKey, err, "uri", s.uri)
+	}
+	if len(objs) == 0 {
+		return 0, common.NewBasicError(ErrNoKey, nil, "uri", s.uri)
+	}
+	return objs[0], nil
+}
+
+// loadModule returns the initialized module at path.
+func loadModule(path string) (*pkcs11.Ctx, error) {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+	if ctx, ok := modules[path]; ok {
+		return ctx, nil
+	}
+	ctx := pkcs11.New(path)
+	if ctx == nil {
+		return nil, common.NewBasicError(ErrModule, nil, "path", path)
+	}
+	err := ctx.Initialize()
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, common.NewBasicError(ErrModule, err, "path", path)
+	}
+	modules[path] = ctx
+	return ctx, nil
+}
+
+// findSlot returns the slot containing the token with the given label.
+func findSlot(ctx *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, common.NewBasicError(ErrNoToken, err, "token", label)
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if strings.TrimRight(info.Label, " ") == label {
+			return slot, nil
+		}
+	}
+	return 0, common.NewBasicError(ErrNoToken, nil, "token", label)
+}
+
+// parseURI returns the path and query attributes of the PKCS#11 URI uri. The attributes token,
+// object and module-path are required.
+func parseURI(uri string) (map[string]string, error) {
+	if !strings.HasPrefix(strings.ToLower(uri), Scheme+":") {
+		return nil, common.NewBasicError(ErrInvalidURI, nil, "uri", redact(uri))
+	}
+	rest := uri[len(Scheme)+1:]
+	path, query := rest, ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		path, query = rest[:i], rest[i+1:]
+	}
+	attrs := make(map[string]string)
+	if err := parseAttrs(attrs, path, ";"); err != nil {
+		return nil, common.NewBasicError(ErrInvalidURI, err, "uri", redact(uri))
+	}
+	if err := parseAttrs(attrs, query, "&"); err != nil {
+		return nil, common.NewBasicError(ErrInvalidURI, err, "uri", redact(uri))
+	}
+	for _, k := range []string{"token", "object", "module-path"} {
+		if attrs[k] == "" {
+			return nil, common.NewBasicError(ErrInvalidURI, nil, "err", "missing attribute",
+				"attr", k, "uri", redact(uri))
+		}
+	}
+	return attrs, nil
+}
+
+func parseAttrs(attrs map[string]string, s, sep string) error {
+	if s == "" {
+		return nil
+	}
+	for _, attr := range strings.Split(s, sep) {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			return common.NewBasicError("Invalid attribute", nil, "attr", attr)
+		}
+		v, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return err
+		}
+		attrs[strings.ToLower(kv[0])] = v
+	}
+	return nil
+}
+
+// redact removes the PIN from uri, such that it can be logged.
+func redact(uri string) string {
+	i := strings.Index(uri, "pin-value=")
+	if i < 0 {
+		return uri
+	}
+	end := strings.IndexAny(uri[i:], ";&")
+	if end < 0 {
+		return uri[:i] + "pin-value=***"
+	}
+	return uri[:i] + "pin-value=***" + uri[i+end:]
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build pkcs11
+
+package pkcs11
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+)
+
+// oidP256 is the DER encoded object identifier of the P-256 curve.
+var oidP256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+func Test_parseURI(t *testing.T) {
+	Convey("PKCS#11 URIs are parsed correctly", t, func() {
+		attrs, err := parseURI("pkcs11:token=scion;object=as%20sig" +
+			"?module-path=/usr/lib/libsofthsm2.so&pin-value=1234")
+		SoMsg("err", err, ShouldBeNil)
+		SoMsg("token", attrs["token"], ShouldEqual, "scion")
+		SoMsg("object", attrs["object"], ShouldEqual, "as sig")
+		SoMsg("module", attrs["module-path"], ShouldEqual, "/usr/lib/libsofthsm2.so")
+		SoMsg("pin", attrs["pin-value"], ShouldEqual, "1234")
+		Convey("Missing attributes are rejected", func() {
+			_, err := parseURI("pkcs11:token=scion;object=as-sig")
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidURI)
+		})
+		Convey("PINs are not logged", func() {
+			SoMsg("redact", redact("pkcs11:token=scion?pin-value=1234&module-path=/m.so"),
+				ShouldEqual, "pkcs11:token=scion?pin-value=***&module-path=/m.so")
+		})
+	})
+}
+
+// Test_Signer needs a token that is initialized with a user PIN, e.g. by SoftHSM:
+//
+//	softhsm2-util --init-token --free --label scion --pin 1234 --so-pin 1234
+//	PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TOKEN=scion PKCS11_PIN=1234 \
+//		go test -tags pkcs11 ./lib/crypto/pkcs11/
+func Test_Signer(t *testing.T) {
+	module, token, pin := os.Getenv("PKCS11_MODULE"), os.Getenv("PKCS11_TOKEN"),
+		os.Getenv("PKCS11_PIN")
+	if module == "" {
+		t.Skip("PKCS11_MODULE not set")
+	}
+	Convey("Signatures created in the token are verifiable", t, func() {
+		label := fmt.Sprintf("scion-test-%d", os.Getpid())
+		pub := genKey(t, module, token, pin, label)
+		uri := fmt.Sprintf("pkcs11:token=%s;object=%s?module-path=%s&pin-value=%s",
+			token, label, module, pin)
+		signer, err := crypto.NewSigner(common.RawBytes(uri), nil)
+		SoMsg("open", err, ShouldBeNil)
+		defer signer.(*Signer).Close()
+		msg := common.RawBytes("message")
+		sig, err := signer.Sign(msg, crypto.ECDSAP256)
+		SoMsg("sign", err, ShouldBeNil)
+		SoMsg("verify", crypto.Verify(msg, sig, pub, crypto.ECDSAP256), ShouldBeNil)
+		_, err = signer.Sign(msg, "unknown")
+		SoMsg("algo", common.GetErrorMsg(err), ShouldEqual, crypto.UnsupportedSignAlgo)
+	})
+}
+
+// genKey generates a P-256 key pair with the given label in the token, and returns the public
+// key as uncompressed point.
+func genKey(t *testing.T, module, token, pin, label string) common.RawBytes {
+	ctx, err := loadModule(module)
+	if err != nil {
+		t.Fatalf("Unable to load module: %v", err)
+	}
+	slot, err := findSlot(ctx, token)
+	if err != nil {
+		t.Fatalf("Unable to find token: %v", err)
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatalf("Unable to open session: %v", err)
+	}
+	defer ctx.CloseSession(session)
+	if err = ctx.Login(session, pkcs11.CKU_USER, pin); err != nil &&
+		err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		t.Fatalf("Unable to login: %v", err)
+	}
+	pubTmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, oidP256),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	privTmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)}
+	pubObj, _, err := ctx.GenerateKeyPair(session, mech, pubTmpl, privTmpl)
+	if err != nil {
+		t.Fatalf("Unable to generate key pair: %v", err)
+	}
+	attrs, err := ctx.GetAttributeValue(session, pubObj,
+		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+	if err != nil {
+		t.Fatalf("Unable to read public key: %v", err)
+	}
+	// CKA_EC_POINT is the DER encoded octet string of the point.
+	var point []byte
+	if _, err = asn1.Unmarshal(attrs[0].Value, &point); err != nil {
+		t.Fatalf("Unable to parse public key: %v", err)
+	}
+	return point
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+const (
+	UnknownSignerBackend = "Unknown signer backend"
+	InvalidKeyFile       = "Invalid key file"
+)
+
+// Signer creates signatures with a private key. The key does not need to be accessible to the
+// caller, e.g., it can be stored in a hardware security module.
+type Signer interface {
+	// Sign creates a signature over sigInput, using the given signing algorithm.
+	Sign(sigInput common.RawBytes, signAlgo string) (common.RawBytes, error)
+}
+
+var _ Signer = (*KeySigner)(nil)
+
+// KeySigner is a Signer that holds the raw private key in memory.
+type KeySigner struct {
+	key common.RawBytes
+}
+
+// NewKeySigner creates a Signer for the raw private key signKey.
+func NewKeySigner(signKey common.RawBytes) *KeySigner {
+	return &KeySigner{key: signKey}
+}
+
+func (s *KeySigner) Sign(sigInput common.RawBytes, signAlgo string) (common.RawBytes, error) {
+	return Sign(sigInput, s.key, signAlgo)
+}
+
+func (s *KeySigner) String() string {
+	return "KeySigner"
+}
+
+// SignerBackend opens the key identified by uri, which starts with the scheme the backend is
+// registered for, and returns a Signer using it.
+type SignerBackend func(uri string) (Signer, error)
+
+var (
+	signerBackendsLock sync.RWMutex
+	// signerBackends maps the lower case URI schemes to the backends.
+	signerBackends = make(map[string]SignerBackend)
+)
+
+// RegisterSignerBackend registers a signer backend for key URIs with the given scheme, e.g.,
+// "pkcs11". The scheme is case insensitive. Registering the same scheme twice panics.
+func RegisterSignerBackend(scheme string, backend SignerBackend) {
+	signerBackendsLock.Lock()
+	defer signerBackendsLock.Unlock()
+	scheme = strings.ToLower(scheme)
+	if _, ok := signerBackends[scheme]; ok {
+		panic(fmt.Sprintf("Signer backend %s already registered", scheme))
+	}
+	signerBackends[scheme] = backend
+}
+
+// OpenSigner returns a Signer for the key identified by uri, using the backend registered for
+// the scheme of uri.
+func OpenSigner(uri string) (Signer, error) {
+	scheme := uri
+	if i := strings.IndexByte(uri, ':'); i >= 0 {
+		scheme = uri[:i]
+	}
+	signerBackendsLock.RLock()
+	backend, ok := signerBackends[strings.ToLower(scheme)]
+	signerBackendsLock.RUnlock()
+	if !ok {
+		return nil, common.NewBasicError(UnknownSignerBackend, nil, "scheme", scheme)
+	}
+	return backend(uri)
+}
+
+// NewSigner returns a Signer for the content of a key file. The content is either the base64
+// encoded raw private key, a password-encrypted key (see EncryptKey), which is decrypted with
+// password, or a key URI, e.g., "pkcs11:token=scion;object=as-sig", which is opened with the
+// signer backend registered for its scheme.
+func NewSigner(raw common.RawBytes, password []byte) (Signer, error) {
+	raw = bytes.TrimSpace(raw)
+	if isKeyURI(raw) {
+		return OpenSigner(string(raw))
+	}
+	key, err := DecodeKey(raw, password)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(key), nil
+}
+
+// DecodeKey returns the raw private key stored in the content of a key file, which is either
+// base64 encoded or password-encrypted (see EncryptKey).
+func DecodeKey(raw common.RawBytes, password []byte) (common.RawBytes, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		return DecryptKey(raw, password)
+	}
+	if isKeyURI(raw) {
+		return nil, common.NewBasicError(InvalidKeyFile, nil,
+			"err", "key is stored in a signer backend")
+	}
+	dbuf := make([]byte, base64.StdEncoding.DecodedLen(len(raw)))
+	n, err := base64.StdEncoding.Decode(dbuf, raw)
+	if err != nil {
+		return nil, common.NewBasicError(InvalidKeyFile, err)
+	}
+	return dbuf[:n], nil
+}
+
+// isKeyURI returns whether raw is a key URI. The base64 alphabet does not contain ':', and the
+// JSON object of an encrypted key starts with '{'.
+func isKeyURI(raw common.RawBytes) bool {
+	return len(raw) > 0 && raw[0] != '{' && bytes.IndexByte(raw, ':') > 0
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+// uriSigner records the URI it was opened with.
+type uriSigner struct {
+	uri string
+}
+
+func (s *uriSigner) Sign(sigInput common.RawBytes, signAlgo string) (common.RawBytes, error) {
+	return common.RawBytes(s.uri), nil
+}
+
+func init() {
+	RegisterSignerBackend("test", func(uri string) (Signer, error) {
+		return &uriSigner{uri: uri}, nil
+	})
+}
+
+func Test_NewSigner(t *testing.T) {
+	Convey("Signers are created from key files", t, func() {
+		pub, priv, err := GenKeyPair(Ed25519)
+		SoMsg("gen", err, ShouldBeNil)
+		msg := common.RawBytes("message")
+		password := []byte("secret")
+		Convey("Base64 encoded key", func() {
+			raw := []byte(base64.StdEncoding.EncodeToString(priv) + "\n")
+			s, err := NewSigner(raw, nil)
+			SoMsg("err", err, ShouldBeNil)
+			sig, err := s.Sign(msg, Ed25519)
+			SoMsg("sign", err, ShouldBeNil)
+			SoMsg("verify", Verify(msg, sig, pub, Ed25519), ShouldBeNil)
+		})
+		Convey("Encrypted key", func() {
+			raw, err := EncryptKey(priv, password)
+			SoMsg("encrypt", err, ShouldBeNil)
+			s, err := NewSigner(raw, password)
+			SoMsg("err", err, ShouldBeNil)
+			sig, err := s.Sign(msg, Ed25519)
+			SoMsg("sign", err, ShouldBeNil)
+			SoMsg("verify", Verify(msg, sig, pub, Ed25519), ShouldBeNil)
+			Convey("requires the correct password", func() {
+				_, err := NewSigner(raw, []byte("wrong"))
+				SoMsg("wrong", common.GetErrorMsg(err), ShouldEqual, KeyDecryptFailure)
+				_, err = NewSigner(raw, nil)
+				SoMsg("missing", common.GetErrorMsg(err), ShouldEqual, MissingPassword)
+			})
+		})
+		Convey("Key URI", func() {
+			s, err := NewSigner([]byte("test:object=as-sig\n"), nil)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("uri", s.(*uriSigner).uri, ShouldEqual, "test:object=as-sig")
+			_, err = NewSigner([]byte("unknown:object=as-sig"), nil)
+			SoMsg("unknown", common.GetErrorMsg(err), ShouldEqual, UnknownSignerBackend)
+			_, err = DecodeKey([]byte("test:object=as-sig"), nil)
+			SoMsg("raw", common.GetErrorMsg(err), ShouldEqual, InvalidKeyFile)
+		})
+	})
+}
@@ -181,15 +181,26 @@ func (t *TRC) CheckActive(maxTRC *TRC) error {
 }
 
 // Sign adds signature to the TRC. The signature is computed over the TRC without the signature map.
+// Core ASes sign the TRC of their own ISD with their online key, using their ISD-AS as name. A core
+// AS cross-signs the TRC of a foreign ISD the same way, which allows the TRC to be verified based
+// on the TRC of the core AS' ISD.
 func (t *TRC) Sign(name string, signKey common.RawBytes, signAlgo string) error {
+	return t.SignWith(name, crypto.NewKeySigner(signKey), signAlgo)
+}
+
+// SignWith adds the signature created by signer to the TRC, using name. See Sign.
+func (t *TRC) SignWith(name string, signer crypto.Signer, signAlgo string) error {
 	sigInput, err := t.sigPack()
 	if err != nil {
 		return common.NewBasicError("Unable to pack TRC for signing", err)
 	}
-	sig, err := crypto.Sign(sigInput, signKey, signAlgo)
+	sig, err := signer.Sign(sigInput, signAlgo)
 	if err != nil {
 		return common.NewBasicError("Unable to create signature", err)
 	}
+	if t.Signatures == nil {
+		t.Signatures = make(map[string]common.RawBytes)
+	}
 	t.Signatures[name] = sig
 	return nil
 }
@@ -200,7 +211,7 @@ func (t *TRC) Verify(trust *TRC) (*TRCVerResult, error) {
 	if t.ISD == trust.ISD {
 		return t.verifyUpdate(trust)
 	}
-	return nil, t.verifyXSig(trust)
+	return t.verifyXSig(trust)
 }
 
 // verifyUpdate checks the validity of a updated TRC.
@@ -225,15 +236,16 @@ func (t *TRC) verifyUpdate(old *TRC) (*TRCVerResult, error) {
 	return t.verifySignatures(old)
 }
 
-// verifySignatures checks the signatures of the updated TRC.
-func (t *TRC) verifySignatures(old *TRC) (*TRCVerResult, error) {
+// verifySignatures checks the signatures of the TRC from the core ASes defined in the trusted TRC,
+// i.e., the previous TRC for updates or the TRC of a foreign ISD for cross signatures.
+func (t *TRC) verifySignatures(trust *TRC) (*TRCVerResult, error) {
 	sigInput, err := t.sigPack()
 	if err != nil {
 		return nil, err
 	}
-	var tvr = &TRCVerResult{}
-	// Only verify signatures which are from core ASes defined in old TRC
-	for signer, coreAS := range old.CoreASes {
+	tvr := &TRCVerResult{Quorum: trust.QuorumTRC, Failed: make(map[*addr.ISD_AS]error)}
+	// Only verify signatures which are from core ASes defined in the trusted TRC
+	for signer, coreAS := range trust.CoreASes {
 		sig, ok := t.Signatures[signer.String()]
 		if !ok {
 			tvr.Failed[signer.Copy()] = common.NewBasicError(SignatureMissing, nil, "as", signer)
@@ -248,15 +260,18 @@ func (t *TRC) verifySignatures(old *TRC) (*TRCVerResult, error) {
 	}
 	if !tvr.QuorumOk() {
 		return tvr, common.NewBasicError(InvalidQuorum, nil,
-			"expected", old.QuorumTRC, "actual", len(tvr.Verified))
+			"expected", trust.QuorumTRC, "actual", len(tvr.Verified))
 	}
 	return tvr, nil
 }
 
-// verifyXSig checks the cross signatures of the updated TRC.
-func (t *TRC) verifyXSig(trust *TRC) error {
-	// FIXME(roosd): implement cross signatures
-	return nil
+// verifyXSig checks the cross signatures of a TRC of a foreign ISD. The TRC must be signed by a
+// quorum of the core ASes defined in the trusted TRC.
+func (t *TRC) verifyXSig(trust *TRC) (*TRCVerResult, error) {
+	if t.Quarantine || trust.Quarantine {
+		return nil, common.NewBasicError(EarlyAnnouncement, nil)
+	}
+	return t.verifySignatures(trust)
 }
 
 // sigPack creates a sorted json object of all fields, except for the signature map.
@@ -25,6 +25,8 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"golang.org/x/crypto/ed25519"
+
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/crypto"
@@ -221,6 +223,91 @@ func Test_TRC_CheckActive(t *testing.T) {
 	})
 }
 
+func Test_TRC_VerifyXSig(t *testing.T) {
+	Convey("Cross signatures should be verified correctly", t, func() {
+		trust := loadTRC(fnTRC, t)
+		foreign := loadTRC(fnTRC, t)
+		foreign.ISD = 2
+		foreign.Signatures = nil
+		keys := make(map[addr.ISD_AS]common.RawBytes)
+		for ia, coreAS := range trust.CoreASes {
+			pub, priv, _ := ed25519.GenerateKey(nil)
+			coreAS.OnlineKey = []byte(pub)
+			keys[ia] = []byte(priv)
+		}
+		xsign := func(ia addr.ISD_AS) {
+			err := foreign.Sign(ia.String(), keys[ia], crypto.Ed25519)
+			SoMsg("sign err", err, ShouldBeNil)
+		}
+
+		Convey("Quorum of cross signatures", func() {
+			xsign(addr.ISD_AS{I: 1, A: 11})
+			xsign(addr.ISD_AS{I: 1, A: 13})
+			tvr, err := foreign.Verify(trust)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("Verified", len(tvr.Verified), ShouldEqual, 2)
+			SoMsg("Failed", len(tvr.Failed), ShouldEqual, 1)
+		})
+		Convey("Not enough cross signatures", func() {
+			xsign(addr.ISD_AS{I: 1, A: 11})
+			_, err := foreign.Verify(trust)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, InvalidQuorum)
+		})
+		Convey("Invalid cross signature", func() {
+			xsign(addr.ISD_AS{I: 1, A: 11})
+			xsign(addr.ISD_AS{I: 1, A: 13})
+			foreign.Description = "Tampered"
+			_, err := foreign.Verify(trust)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, InvalidQuorum)
+		})
+		Convey("Quarantined TRC", func() {
+			xsign(addr.ISD_AS{I: 1, A: 11})
+			xsign(addr.ISD_AS{I: 1, A: 13})
+			trust.Quarantine = true
+			_, err := foreign.Verify(trust)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, EarlyAnnouncement)
+		})
+	})
+}
+
+func Test_TRC_SignAlgos(t *testing.T) {
+	Convey("TRCs with core AS keys of all signature algorithms round-trip", t, func() {
+		for _, algo := range crypto.SignAlgos() {
+			Convey(algo, func() {
+				old := loadTRC(fnTRC, t)
+				keys := make(map[addr.ISD_AS]common.RawBytes)
+				for ia, coreAS := range old.CoreASes {
+					pub, priv, err := crypto.GenKeyPair(algo)
+					SoMsg("gen err", err, ShouldBeNil)
+					coreAS.OnlineKey = pub
+					coreAS.OnlineKeyAlg = algo
+					keys[ia] = priv
+				}
+				raw, err := old.JSON(true)
+				SoMsg("json err", err, ShouldBeNil)
+				parsed, err := TRCFromRaw(raw, false)
+				SoMsg("parse err", err, ShouldBeNil)
+				SoMsg("core ASes", parsed.CoreASes, ShouldResemble, old.CoreASes)
+
+				next := loadTRC(fnTRC, t)
+				next.Version = old.Version + 1
+				next.CreationTime = old.CreationTime + old.GracePeriod
+				next.Signatures = nil
+				for ia, key := range keys {
+					SoMsg("sign err", next.Sign(ia.String(), key, algo), ShouldBeNil)
+				}
+				raw, err = next.JSON(true)
+				SoMsg("json err", err, ShouldBeNil)
+				next, err = TRCFromRaw(raw, false)
+				SoMsg("parse err", err, ShouldBeNil)
+				tvr, err := next.Verify(parsed)
+				SoMsg("verify", err, ShouldBeNil)
+				SoMsg("verified", len(tvr.Verified), ShouldEqual, len(keys))
+			})
+		}
+	})
+}
+
 func Test_TRC_Compress(t *testing.T) {
 	Convey("TRC is compressed correctly", t, func() {
 		trc := loadTRC(fnTRC, t)
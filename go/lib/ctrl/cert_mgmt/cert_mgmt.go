@@ -32,6 +32,8 @@ type union struct {
 	ChainIssRep *ChainIssRep `capnp:"certChainIssRep"`
 	TRCReq      *TRCReq      `capnp:"trcReq"`
 	TRCRep      *TRC         `capnp:"trc"`
+	RevListReq  *RevListReq  `capnp:"certRevListReq"`
+	RevListRep  *RevList     `capnp:"certRevList"`
 }
 
 func (u *union) set(c proto.Cerealizable) error {
@@ -54,6 +56,12 @@ func (u *union) set(c proto.Cerealizable) error {
 	case *TRC:
 		u.Which = proto.CertMgmt_Which_trc
 		u.TRCRep = p
+	case *RevListReq:
+		u.Which = proto.CertMgmt_Which_certRevListReq
+		u.RevListReq = p
+	case *RevList:
+		u.Which = proto.CertMgmt_Which_certRevList
+		u.RevListRep = p
 	default:
 		return common.NewBasicError("Unsupported cert mgmt union type (set)", nil,
 			"type", common.TypeOf(c))
@@ -75,6 +83,10 @@ func (u *union) get() (proto.Cerealizable, error) {
 		return u.TRCReq, nil
 	case proto.CertMgmt_Which_trc:
 		return u.TRCRep, nil
+	case proto.CertMgmt_Which_certRevListReq:
+		return u.RevListReq, nil
+	case proto.CertMgmt_Which_certRevList:
+		return u.RevListRep, nil
 	}
 	return nil, common.NewBasicError("Unsupported cert mgmt union type (get)", nil, "type", u.Which)
 }
@@ -0,0 +1,45 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cert_mgmt
+
+import (
+	"fmt"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var _ proto.Cerealizable = (*RevList)(nil)
+
+type RevList struct {
+	RawRevList common.RawBytes `capnp:"revList"`
+}
+
+func (r *RevList) RevList() (*cert.RevList, error) {
+	return cert.RevListFromRaw(r.RawRevList, true)
+}
+
+func (r *RevList) ProtoId() proto.ProtoIdType {
+	return proto.CertRevList_TypeID
+}
+
+func (r *RevList) String() string {
+	rl, err := r.RevList()
+	if err != nil {
+		return fmt.Sprintf("Invalid revocation list: %v", err)
+	}
+	return rl.String()
+}
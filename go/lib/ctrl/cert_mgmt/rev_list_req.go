@@ -0,0 +1,46 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the Go representation of revocation list requests.
+
+package cert_mgmt
+
+import (
+	"fmt"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var _ proto.Cerealizable = (*RevListReq)(nil)
+
+type RevListReq struct {
+	// RawIssuer is the core AS that issued the requested revocation list.
+	RawIssuer addr.IAInt `capnp:"isdas"`
+	Version   uint64
+	CacheOnly bool
+}
+
+func (r *RevListReq) Issuer() *addr.ISD_AS {
+	return r.RawIssuer.IA()
+}
+
+func (r *RevListReq) ProtoId() proto.ProtoIdType {
+	return proto.CertRevListReq_TypeID
+}
+
+func (r *RevListReq) String() string {
+	return fmt.Sprintf("Issuer: %s Version: %v CacheOnly: %v", r.Issuer(), r.Version,
+		r.CacheOnly)
+}
@@ -56,7 +56,7 @@ func (r *Requester) Request(ctx context.Context, pld *ctrl.Pld,
 		return nil, nil, common.NewBasicError("ctrl_msg: reply is not a ctrl.SignedPld", nil,
 			"type", common.TypeOf(reply), "reply", reply)
 	}
-	if err := r.sigv.Verify(rspld); err != nil {
+	if err := ctrl.VerifySig(rspld, r.sigv); err != nil {
 		return nil, rspld.Sign, err
 	}
 	rpld, err := rspld.Pld()
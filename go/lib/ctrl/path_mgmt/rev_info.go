@@ -17,15 +17,29 @@
 package path_mgmt
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"time"
 
 	//log "github.com/inconshreveable/log15"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
 	"github.com/scionproto/scion/go/proto"
 )
 
+const (
+	// HashTypeSHA256 is the only supported hash function of revocation hash trees.
+	HashTypeSHA256 = 0
+
+	// Error strings
+	ErrUnknownHashType = "Unknown hash tree hash type"
+	ErrInvalidTreeTTL  = "Invalid hash tree TTL"
+	ErrInvalidProof    = "Revocation proof does not match hash tree root"
+)
+
 var _ proto.Cerealizable = (*RevInfo)(nil)
 
 type RevInfo struct {
@@ -48,6 +62,46 @@ func NewRevInfoFromRaw(b common.RawBytes) (*RevInfo, error) {
 func (r *RevInfo) IA() *addr.ISD_AS {
 	return r.RawIsdas.IA()
 }
+
+// VerifyProof checks that the revocation proves the revocation of the interface for its epoch,
+// given root, the root of the connected hash tree of the revoking AS. The root is taken from the
+// AS entry of the revoking AS in a path segment. Since the connected root covers two adjacent
+// hash trees, the proof is accepted if it matches either join of the tree containing the
+// revoked leaf with its previous or next tree.
+func (r *RevInfo) VerifyProof(root common.RawBytes) error {
+	if r.HashType != HashTypeSHA256 {
+		return common.NewBasicError(ErrUnknownHashType, nil, "type", r.HashType)
+	}
+	ttl := time.Duration(r.TreeTTL) * time.Second
+	if ttl == 0 || ttl%crypto.HashTreeEpochTime != 0 {
+		return common.NewBasicError(ErrInvalidTreeTTL, nil, "ttl", r.TreeTTL)
+	}
+	nEpochs := uint64(ttl / crypto.HashTreeEpochTime)
+	leaf := make(common.RawBytes, 16, 16+len(r.Nonce))
+	common.Order.PutUint64(leaf[:8], r.IfID)
+	common.Order.PutUint64(leaf[8:], r.Epoch%nEpochs)
+	curr := hash(leaf, r.Nonce)
+	for _, s := range r.Siblings {
+		if s.IsLeft {
+			curr = hash(s.Hash, curr)
+		} else {
+			curr = hash(curr, s.Hash)
+		}
+	}
+	if bytes.Equal(hash(r.PrevRoot, curr), root) || bytes.Equal(hash(curr, r.NextRoot), root) {
+		return nil
+	}
+	return common.NewBasicError(ErrInvalidProof, nil, "rev", r)
+}
+
+// hash returns the SHA256 hash of the concatenation of a and b.
+func hash(a, b common.RawBytes) common.RawBytes {
+	h := sha256.New()
+	h.Write(a)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
 func (r *RevInfo) ProtoId() proto.ProtoIdType {
 	return proto.RevInfo_TypeID
 }
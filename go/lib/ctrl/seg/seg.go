@@ -21,6 +21,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
@@ -54,18 +55,28 @@ func NewSegFromRaw(b common.RawBytes) (*PathSegment, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ps, ps.ParseRaw()
+}
+
+// ParseRaw populates the non-capnp fields of ps from the raw signed data and AS entries, and
+// validates the result. It must be called on segments parsed as part of another message
+// (e.g., in a Meta).
+func (ps *PathSegment) ParseRaw() error {
+	var err error
 	ps.SData, err = NewPathSegmentSignedDataFromRaw(ps.RawSData)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	ps.ASEntries = make([]*ASEntry, 0, len(ps.RawASEntries))
 	for i := range ps.RawASEntries {
 		ase, err := newASEntryFromRaw(ps.RawASEntries[i].Blob)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		ps.ASEntries = append(ps.ASEntries, ase)
 	}
-	return ps, ps.Validate()
+	ps.id = nil
+	return ps.Validate()
 }
 
 func (ps *PathSegment) ID() (common.RawBytes, error) {
@@ -89,6 +100,29 @@ func (ps *PathSegment) InfoF() (*spath.InfoField, error) {
 	return ps.SData.InfoF()
 }
 
+// Expiry returns the time the segment expires, i.e., the expiration time of the
+// hop field that expires first.
+func (ps *PathSegment) Expiry() (time.Time, error) {
+	info, err := ps.InfoF()
+	if err != nil {
+		return time.Time{}, err
+	}
+	minExp := -1
+	for _, ase := range ps.ASEntries {
+		hopF, err := ase.HopEntries[0].HopField()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if minExp < 0 || int(hopF.ExpTime) < minExp {
+			minExp = int(hopF.ExpTime)
+		}
+	}
+	// The relative expiration time of a hop field is encoded in units of 1/256
+	// of the maximum TTL, starting at one unit.
+	rel := time.Duration(minExp+1) * spath.MaxTTL * time.Second / 256
+	return info.Timestamp().Add(rel), nil
+}
+
 func (ps *PathSegment) Validate() error {
 	if len(ps.RawASEntries) == 0 {
 		return common.NewBasicError("PathSegment has no AS Entries", nil)
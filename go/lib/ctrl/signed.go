@@ -21,6 +21,7 @@ import (
 
 	"github.com/scionproto/scion/go/lib/assert"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
 	"github.com/scionproto/scion/go/proto"
 )
 
@@ -35,17 +36,17 @@ type SignedPld struct {
 	pld  *Pld
 }
 
-func newSignedPld(cpld *Pld, sign *proto.SignS, key common.RawBytes) (*SignedPld, error) {
+func newSignedPld(cpld *Pld, sign *proto.SignS, signer crypto.Signer) (*SignedPld, error) {
 	// Make a copy of signer, so the caller can re-use it.
 	spld := &SignedPld{Sign: sign.Copy()}
 	if spld.Sign == nil && assert.On {
-		assert.Must(len(key) == 0, "If there's no Sign, key must be empty")
+		assert.Must(signer == nil, "If there's no Sign, signer must be nil")
 	}
 	if err := spld.SetPld(cpld); err != nil {
 		return nil, err
 	}
 	if spld.Sign != nil {
-		if err := spld.Sign.SignAndSet(key, spld.Blob); err != nil {
+		if err := spld.Sign.SignAndSetWith(signer, spld.Blob); err != nil {
 			return nil, err
 		}
 	}
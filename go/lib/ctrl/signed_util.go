@@ -15,14 +15,18 @@
 package ctrl
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
 	"github.com/scionproto/scion/go/lib/crypto/cert"
 	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/infra"
 	"github.com/scionproto/scion/go/proto"
 )
 
@@ -35,28 +39,37 @@ var _ Signer = (*BasicSigner)(nil)
 
 // BasicSigner is a simple implementation of Signer.
 type BasicSigner struct {
-	s   *proto.SignS
-	key common.RawBytes
+	s      *proto.SignS
+	signer crypto.Signer
 }
 
 // NewBasicSigner creates a Signer that uses the supplied s and key to sign Pld's.
 func NewBasicSigner(s *proto.SignS, key common.RawBytes) *BasicSigner {
-	return &BasicSigner{s: s, key: key}
+	var signer crypto.Signer
+	if s != nil || len(key) > 0 {
+		signer = crypto.NewKeySigner(key)
+	}
+	return NewBasicSignerWith(s, signer)
+}
+
+// NewBasicSignerWith creates a Signer that uses the supplied s and signer to sign Pld's. This
+// allows signing with keys that are not held in memory, e.g., keys stored in a PKCS#11 token.
+func NewBasicSignerWith(s *proto.SignS, signer crypto.Signer) *BasicSigner {
+	return &BasicSigner{s: s, signer: signer}
 }
 
 func (b *BasicSigner) Sign(pld *Pld) (*SignedPld, error) {
-	return newSignedPld(pld, b.s, b.key)
+	return newSignedPld(pld, b.s, b.signer)
 }
 
 // NullSigner is a Signer that creates SignedPld's with no signature.
 var NullSigner Signer = NewBasicSigner(nil, nil)
 
-type trustStore struct{} // TODO(kormat): replace this with trust store interface
-
-// VerifySig does some sanity checks on p, and then verifies the signature using sigV.
+// VerifySig does some sanity checks on p, and then verifies the signature using sigV. Payloads
+// without signature are accepted.
 func VerifySig(p *SignedPld, sigV SigVerifier) error {
 	// Perform common checks before calling real checker.
-	if p.Sign.Type == proto.SignType_none && len(p.Sign.Signature) == 0 {
+	if p.Sign == nil || (p.Sign.Type == proto.SignType_none && len(p.Sign.Signature) == 0) {
 		// Nothing to check.
 		return nil
 	}
@@ -74,15 +87,25 @@ type SigVerifier interface {
 	Verify(*SignedPld) error
 }
 
+const (
+	// DefaultSigVerifyTimeout is the maximum time BasicSigVerifier waits for the trust store to
+	// resolve the certificate of the signer.
+	DefaultSigVerifyTimeout = 2 * time.Second
+
+	ErrInvalidSig       = "Invalid SignedPld signature"
+	ErrSignTypeMismatch = "SignedPld sign type does not match certificate"
+)
+
 var _ SigVerifier = (*BasicSigVerifier)(nil)
 
-// BasicSigVerifier is a SigVerifier that ignores signatures on cert_mgmt.TRC
-// and cert_mgmt.Chain messages, to avoid dependency cycles.
+// BasicSigVerifier is a SigVerifier that verifies signatures against the certificate chain of
+// the signing AS, which is resolved and verified by the trust store. It ignores signatures on
+// cert_mgmt.TRC and cert_mgmt.Chain messages, to avoid dependency cycles.
 type BasicSigVerifier struct {
-	tStore *trustStore
+	tStore infra.TrustStore
 }
 
-func NewBasicSigVerifier(tStore *trustStore) *BasicSigVerifier {
+func NewBasicSigVerifier(tStore infra.TrustStore) *BasicSigVerifier {
 	return &BasicSigVerifier{
 		tStore: tStore,
 	}
@@ -93,14 +116,32 @@ func (b *BasicSigVerifier) Verify(p *SignedPld) error {
 	if err != nil {
 		return err
 	}
-	if b.ignoreSign(cpld) {
+	if p.Sign == nil || b.ignoreSign(cpld) || p.Sign.Type == proto.SignType_none {
 		return nil
 	}
-	vKey, err := b.getVerifyKeyForSign(p.Sign)
+	sigSrc, err := NewSignSrcDefFromRaw(p.Sign.Src)
+	if err != nil {
+		return err
+	}
+	crt, err := b.getCertForSign(sigSrc)
 	if err != nil {
 		return err
 	}
-	return p.Sign.Verify(vKey, p.Blob)
+	// The signature is verified with the algorithm of the certificate. The sign type only
+	// has to be consistent with it.
+	signType, err := proto.SignTypeFromAlgo(crt.SignAlgorithm)
+	if err != nil {
+		return common.NewBasicError(ErrInvalidSig, err, "src", string(p.Sign.Src))
+	}
+	if p.Sign.Type != signType {
+		return common.NewBasicError(ErrSignTypeMismatch, nil, "src", string(p.Sign.Src),
+			"type", p.Sign.Type, "certAlgo", crt.SignAlgorithm)
+	}
+	err = crypto.Verify(p.Blob, p.Sign.Signature, crt.SubjectSignKey, crt.SignAlgorithm)
+	if err != nil {
+		return common.NewBasicError(ErrInvalidSig, err, "src", string(p.Sign.Src))
+	}
+	return nil
 }
 
 func (b *BasicSigVerifier) ignoreSign(p *Pld) bool {
@@ -118,27 +159,13 @@ func (b *BasicSigVerifier) ignoreSign(p *Pld) bool {
 	}
 }
 
-func (b *BasicSigVerifier) getVerifyKeyForSign(s *proto.SignS) (common.RawBytes, error) {
-	if s.Type == proto.SignType_none {
-		return nil, nil
-	}
-	sigSrc, err := NewSignSrcDefFromRaw(s.Src)
-	if err != nil {
-		return nil, err
-	}
-	chain, err := b.getChainForSign(sigSrc)
-	if err != nil {
-		return nil, err
-	}
-	if chain == nil { // FIXME(roosd): remove after getChainForSign is implemented
-		return nil, nil
-	}
-	return chain.Leaf.SubjectSignKey, nil
-}
-
-func (b *BasicSigVerifier) getChainForSign(s *SignSrcDef) (*cert.Chain, error) {
-	// TODO(kormat): query b.tStore
-	return nil, nil
+// getCertForSign returns the verified leaf certificate of the signer, as described by s.
+func (b *BasicSigVerifier) getCertForSign(s *SignSrcDef) (*cert.Certificate, error) {
+	ctx, cancelF := context.WithTimeout(context.Background(), DefaultSigVerifyTimeout)
+	defer cancelF()
+	trail := []infra.TrustDescriptor{{Type: infra.ChainDescriptor, IA: *s.IA,
+		ChainVersion: s.ChainVer, TRCVersion: s.TRCVer}}
+	return b.tStore.GetCertificate(ctx, trail, nil)
 }
 
 const (
@@ -0,0 +1,84 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctrl
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/proto"
+)
+
+// fakeTrustStore returns crt for every certificate lookup.
+type fakeTrustStore struct {
+	infra.TrustStore
+	crt *cert.Certificate
+}
+
+func (s *fakeTrustStore) GetCertificate(ctx context.Context, trail []infra.TrustDescriptor,
+	hint net.Addr) (*cert.Certificate, error) {
+
+	return s.crt, nil
+}
+
+// signedPld returns a path segment request signed with key, using signType.
+func signedPld(t *testing.T, signType proto.SignType, key common.RawBytes) *SignedPld {
+	pld, err := NewPathMgmtPld(&path_mgmt.SegReq{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to create payload: %v", err)
+	}
+	src := &SignSrcDef{IA: &addr.ISD_AS{I: 1, A: 10}, ChainVer: 1, TRCVer: 1}
+	spld, err := pld.SignedPld(NewBasicSigner(proto.NewSignS(signType, src.Pack()), key))
+	if err != nil {
+		t.Fatalf("Unable to sign payload: %v", err)
+	}
+	return spld
+}
+
+func TestBasicSigVerifier(t *testing.T) {
+	Convey("Signatures are verified with the algorithm of the certificate", t, func() {
+		for _, algo := range []string{crypto.Ed25519, crypto.ECDSAP256, crypto.ECDSAP384} {
+			Convey(algo, func() {
+				pub, priv, _ := crypto.GenKeyPair(algo)
+				otherPub, _, _ := crypto.GenKeyPair(algo)
+				signType, err := proto.SignTypeFromAlgo(algo)
+				SoMsg("sign type", err, ShouldBeNil)
+				crt := &cert.Certificate{SignAlgorithm: algo, SubjectSignKey: pub}
+				v := NewBasicSigVerifier(&fakeTrustStore{crt: crt})
+				spld := signedPld(t, signType, priv)
+				SoMsg("valid", VerifySig(spld, v), ShouldBeNil)
+				crt.SubjectSignKey = otherPub
+				err = VerifySig(spld, v)
+				SoMsg("other key", common.GetErrorMsg(err), ShouldEqual, ErrInvalidSig)
+			})
+		}
+	})
+	Convey("A sign type that does not match the certificate is rejected", t, func() {
+		pub, priv, _ := crypto.GenKeyPair(crypto.Ed25519)
+		crt := &cert.Certificate{SignAlgorithm: crypto.ECDSAP256, SubjectSignKey: pub}
+		v := NewBasicSigVerifier(&fakeTrustStore{crt: crt})
+		err := VerifySig(signedPld(t, proto.SignType_ed25519, priv), v)
+		SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrSignTypeMismatch)
+	})
+}
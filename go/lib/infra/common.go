@@ -16,10 +16,13 @@ package infra
 
 import (
 	"context"
+	"fmt"
 	"net"
 
+	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/crypto/cert"
 	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
 	"github.com/scionproto/scion/go/proto"
 )
 
@@ -37,6 +40,20 @@ func (f HandlerFunc) Handle(r *Request) {
 	f(r)
 }
 
+// Middleware wraps the handler for messages of type msgType, e.g., to limit,
+// instrument or log the requests passed to it. See package
+// infra/middleware for the built-in middlewares.
+type Middleware func(msgType string, next Handler) Handler
+
+// Chain wraps h for msgType with mws. The first middleware is the outermost
+// one, i.e., it sees each request first.
+func Chain(msgType string, h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](msgType, h)
+	}
+	return h
+}
+
 // Request describes an object received from the network that is not part of an
 // exchange initiated by the local node. A Request includes its associated
 // context.
@@ -73,6 +90,13 @@ func (r *Request) Context() context.Context {
 	return r.ctx
 }
 
+// WithContext returns a shallow copy of r with its context changed to ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
 var (
 	// MessengerContextKey is a context key. It can be used in SCION infra
 	// request handlers to access the messaging layer the message arrived on.
@@ -94,6 +118,15 @@ type Messenger interface {
 	GetCertChain(ctx context.Context, msg *cert_mgmt.ChainReq, a net.Addr,
 		id uint64) (*cert_mgmt.Chain, error)
 	SendCertChain(ctx context.Context, msg *cert_mgmt.Chain, a net.Addr, id uint64) error
+	GetPaths(ctx context.Context, msg *path_mgmt.SegReq, a net.Addr,
+		id uint64) (*path_mgmt.SegReply, error)
+	SendSegReply(ctx context.Context, msg *path_mgmt.SegReply, a net.Addr, id uint64) error
+	SendSegReg(ctx context.Context, msg *path_mgmt.SegReg, a net.Addr, id uint64) error
+	SendSegSync(ctx context.Context, msg *path_mgmt.SegSync, a net.Addr, id uint64) error
+	SendRev(ctx context.Context, msg *path_mgmt.RevInfo, a net.Addr, id uint64) error
+	SendIfStateReq(ctx context.Context, msg *path_mgmt.IFStateReq, a net.Addr, id uint64) error
+	SendIfStateInfos(ctx context.Context, msg *path_mgmt.IFStateInfos, a net.Addr,
+		id uint64) error
 	AddHandler(msgType string, h Handler)
 	ListenAndServe()
 	CloseServer() error
@@ -108,6 +141,42 @@ type TrustStore interface {
 	GetCertificate(ctx context.Context, trail []TrustDescriptor, hint net.Addr) (*cert.Certificate, error)
 }
 
+// TrustDescriptorType is the type of trust object a TrustDescriptor refers to.
+type TrustDescriptorType int
+
+const (
+	ChainDescriptor TrustDescriptorType = iota
+	TRCDescriptor
+)
+
+func (t TrustDescriptorType) String() string {
+	switch t {
+	case ChainDescriptor:
+		return "Chain"
+	case TRCDescriptor:
+		return "TRC"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", int(t))
+}
+
+// TrustDescriptor identifies a trust object. A trail passed to
+// TrustStore.GetCertificate consists of zero or more TRC descriptors, which
+// are resolved in order, followed by the descriptor of the certificate chain
+// containing the requested certificate.
 type TrustDescriptor struct {
-	// FIXME(scrye): include type when trust store gets merged
+	Type TrustDescriptorType
+	// IA is the subject of the certificate chain. For TRCs, it is an AS of the
+	// ISD, which can be asked for the TRC.
+	IA addr.ISD_AS
+	// ChainVersion is the version of the certificate chain. It is ignored for
+	// TRCs.
+	ChainVersion uint64
+	// TRCVersion is the version of the TRC, or the version of the TRC the
+	// certificate chain was issued under.
+	TRCVersion uint64
+}
+
+func (d *TrustDescriptor) String() string {
+	return fmt.Sprintf("%s IA: %s ChainVer: %d TRCVer: %d", d.Type, d.IA, d.ChainVersion,
+		d.TRCVersion)
 }
@@ -0,0 +1,280 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedupe coalesces concurrent requests for the same object, such that
+// only one request is sent over the network and its response is fanned out
+// to all waiters.
+//
+// Requests are identified by a key, which can be any comparable value (e.g.,
+// a cert.Key). Servers that answer requests asynchronously register a waiter
+// for each received request, and send a request upstream only if Add tells
+// them to:
+//  if d.Add(ctx, key, requester.String(), replyFunc) {
+//      sendRequest(key)
+//  }
+// When the response arrives, Resolve passes it to all waiters:
+//  d.Resolve(key, dedupe.Response{Data: reply})
+//
+// Synchronous callers use Do instead, which runs the fetch function once for
+// all concurrent callers:
+//  obj, err := d.Do(ctx, key, fetch)
+//
+// Pending requests expire after Config.Expire, and each waiter stops waiting
+// when its context is done. In both cases, the waiter's callback is called
+// with an error. If all waiters of a request are gone, the request is
+// discarded, and the context passed to the fetch function is canceled.
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/infra"
+	liblog "github.com/scionproto/scion/go/lib/log"
+)
+
+const (
+	ErrExpired = "Pending request expired"
+)
+
+// Response is the outcome of a request, as passed to the waiters.
+type Response struct {
+	Data interface{}
+	Err  error
+}
+
+// Callback is called with the response to a request.
+type Callback func(Response)
+
+// FetchFunc fetches the object identified by key. The context is canceled if
+// the request expires, or all waiters stop waiting.
+type FetchFunc func(ctx context.Context, key interface{}) (interface{}, error)
+
+type Config struct {
+	// Name identifies the Deduper in the exported metrics.
+	Name string
+	// Expire is the time after which a pending request is discarded. If zero,
+	// pending requests do not expire.
+	Expire time.Duration
+	// Retry is the minimum interval between two requests for the same key, if
+	// the response to the first one is still pending. If zero, only one
+	// request is sent for each key.
+	Retry time.Duration
+}
+
+// Deduper keeps track of pending requests and their waiters. It is safe for
+// concurrent use.
+type Deduper struct {
+	cfg     Config
+	lock    sync.Mutex
+	entries map[interface{}]*entry
+	metrics *metrics
+}
+
+// entry is a pending request.
+type entry struct {
+	waiters []*waiter
+	// lastReq is the time the last request was sent.
+	lastReq time.Time
+	timer   *time.Timer
+	// ctx is passed to the fetch function, and canceled once the entry is
+	// removed.
+	ctx     context.Context
+	cancelF context.CancelFunc
+}
+
+type waiter struct {
+	id interface{}
+	cb Callback
+	// done is closed when the waiter is removed, to stop watching its context.
+	done chan struct{}
+}
+
+func New(cfg Config) *Deduper {
+	return &Deduper{
+		cfg:     cfg,
+		entries: make(map[interface{}]*entry),
+		metrics: newMetrics(cfg.Name),
+	}
+}
+
+// Add registers cb as a waiter for key, and returns whether the caller should
+// send a request for key. This is the case if no request for key is pending,
+// or if the last request was sent at least Config.Retry ago.
+//
+// cb is called exactly once, either with the response passed to Resolve, or
+// with an error if the request expires or ctx is done first. If id is not nil,
+// and a waiter with an equal id is already registered for key, it is replaced
+// and its callback is never called. id must be comparable.
+func (d *Deduper) Add(ctx context.Context, key, id interface{}, cb Callback) bool {
+	_, _, send := d.add(ctx, key, id, cb)
+	return send
+}
+
+// Do calls fetch for key, and returns its result. If a call for key is
+// already in progress, Do waits for its result instead. Do returns early if
+// ctx is done. Do must not be used for keys that are resolved with Resolve.
+func (d *Deduper) Do(ctx context.Context, key interface{}, fetch FetchFunc) (interface{},
+	error) {
+
+	respC := make(chan Response, 1)
+	e, first, _ := d.add(ctx, key, nil, func(resp Response) { respC <- resp })
+	if first {
+		go func() {
+			defer liblog.LogPanicAndExit()
+			data, err := fetch(e.ctx, key)
+			d.resolve(key, e, Response{Data: data, Err: err})
+		}()
+	}
+	resp := <-respC
+	return resp.Data, resp.Err
+}
+
+// Resolve passes resp to the waiters for key, and removes the pending request.
+// It returns the number of waiters.
+func (d *Deduper) Resolve(key interface{}, resp Response) int {
+	d.lock.Lock()
+	e, ok := d.entries[key]
+	d.lock.Unlock()
+	if !ok {
+		return 0
+	}
+	return d.resolve(key, e, resp)
+}
+
+// Pending returns the number of pending requests.
+func (d *Deduper) Pending() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.entries)
+}
+
+func (d *Deduper) add(ctx context.Context, key, id interface{},
+	cb Callback) (*entry, bool, bool) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := time.Now()
+	e, ok := d.entries[key]
+	if !ok {
+		e = &entry{}
+		e.ctx, e.cancelF = context.WithCancel(context.Background())
+		if d.cfg.Expire > 0 {
+			e.timer = time.AfterFunc(d.cfg.Expire, func() { d.expire(key, e) })
+		}
+		d.entries[key] = e
+		d.metrics.setPending(len(d.entries))
+	}
+	w := &waiter{id: id, cb: cb, done: make(chan struct{})}
+	if !e.replace(w) {
+		e.waiters = append(e.waiters, w)
+	}
+	send := !ok || (d.cfg.Retry > 0 && now.Sub(e.lastReq) >= d.cfg.Retry)
+	if send {
+		e.lastReq = now
+		d.metrics.incRequests()
+	} else {
+		d.metrics.incCoalesced()
+	}
+	if ctx.Done() != nil {
+		go d.watch(ctx, key, e, w)
+	}
+	return e, !ok, send
+}
+
+// replace replaces the waiter with the same id as w, and returns whether there
+// was one.
+func (e *entry) replace(w *waiter) bool {
+	if w.id == nil {
+		return false
+	}
+	for i, old := range e.waiters {
+		if old.id == w.id {
+			close(old.done)
+			e.waiters[i] = w
+			return true
+		}
+	}
+	return false
+}
+
+// watch removes waiter w of entry e once ctx is done.
+func (d *Deduper) watch(ctx context.Context, key interface{}, e *entry, w *waiter) {
+	defer liblog.LogPanicAndExit()
+	select {
+	case <-w.done:
+		return
+	case <-ctx.Done():
+	}
+	d.lock.Lock()
+	found := false
+	for i, other := range e.waiters {
+		if other == w {
+			e.waiters = append(e.waiters[:i], e.waiters[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if found && len(e.waiters) == 0 {
+		d.remove(key, e)
+	}
+	d.lock.Unlock()
+	if found {
+		d.metrics.incWaiters(resultCanceled, 1)
+		w.cb(Response{Err: infra.NewCtxDoneError("key", key)})
+	}
+}
+
+func (d *Deduper) expire(key interface{}, e *entry) {
+	n := d.notify(key, e,
+		Response{Err: common.NewBasicError(ErrExpired, nil, "key", key)})
+	d.metrics.incWaiters(resultExpired, n)
+}
+
+func (d *Deduper) resolve(key interface{}, e *entry, resp Response) int {
+	n := d.notify(key, e, resp)
+	d.metrics.incWaiters(resultResolved, n)
+	return n
+}
+
+// notify removes entry e, and passes resp to its waiters. It returns the
+// number of waiters.
+func (d *Deduper) notify(key interface{}, e *entry, resp Response) int {
+	d.lock.Lock()
+	waiters := e.waiters
+	e.waiters = nil
+	d.remove(key, e)
+	d.lock.Unlock()
+	for _, w := range waiters {
+		close(w.done)
+		w.cb(resp)
+	}
+	return len(waiters)
+}
+
+// remove removes entry e, if it is still the pending request for key. The
+// caller must hold the lock.
+func (d *Deduper) remove(key interface{}, e *entry) {
+	if d.entries[key] != e {
+		return
+	}
+	delete(d.entries, key)
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	e.cancelF()
+	d.metrics.setPending(len(d.entries))
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+type testKey struct {
+	name string
+	ver  uint64
+}
+
+// collector collects the responses passed to its callbacks.
+type collector struct {
+	sync.Mutex
+	resps map[string]Response
+}
+
+func newCollector() *collector {
+	return &collector{resps: make(map[string]Response)}
+}
+
+func (c *collector) cb(name string) Callback {
+	return func(resp Response) {
+		c.Lock()
+		defer c.Unlock()
+		c.resps[name] = resp
+	}
+}
+
+func (c *collector) get(name string) (Response, bool) {
+	c.Lock()
+	defer c.Unlock()
+	resp, ok := c.resps[name]
+	return resp, ok
+}
+
+func TestAddResolve(t *testing.T) {
+	Convey("Given a Deduper", t, func() {
+		d := New(Config{Name: "test", Expire: time.Second})
+		c := newCollector()
+		key := testKey{"a", 1}
+		ctx := context.Background()
+		Convey("Only the first waiter sends a request", func() {
+			SoMsg("first", d.Add(ctx, key, "w1", c.cb("w1")), ShouldBeTrue)
+			SoMsg("second", d.Add(ctx, key, "w2", c.cb("w2")), ShouldBeFalse)
+			SoMsg("other key", d.Add(ctx, testKey{"a", 2}, "w3", c.cb("w3")), ShouldBeTrue)
+			SoMsg("pending", d.Pending(), ShouldEqual, 2)
+
+			Convey("The response is passed to all waiters of the key", func() {
+				n := d.Resolve(key, Response{Data: "data"})
+				SoMsg("waiters", n, ShouldEqual, 2)
+				for _, name := range []string{"w1", "w2"} {
+					resp, ok := c.get(name)
+					SoMsg(name+" called", ok, ShouldBeTrue)
+					SoMsg(name+" data", resp.Data, ShouldEqual, "data")
+				}
+				_, ok := c.get("w3")
+				SoMsg("w3 called", ok, ShouldBeFalse)
+				SoMsg("pending", d.Pending(), ShouldEqual, 1)
+				SoMsg("resolve again", d.Resolve(key, Response{}), ShouldEqual, 0)
+			})
+		})
+		Convey("Waiters with the same id are replaced", func() {
+			d.Add(ctx, key, "w", c.cb("old"))
+			d.Add(ctx, key, "w", c.cb("new"))
+			SoMsg("waiters", d.Resolve(key, Response{}), ShouldEqual, 1)
+			_, ok := c.get("old")
+			SoMsg("old called", ok, ShouldBeFalse)
+			_, ok = c.get("new")
+			SoMsg("new called", ok, ShouldBeTrue)
+		})
+		Convey("Requests are resent after the retry interval", func() {
+			d := New(Config{Name: "test", Expire: time.Second, Retry: 10 * time.Millisecond})
+			SoMsg("first", d.Add(ctx, key, "w1", c.cb("w1")), ShouldBeTrue)
+			SoMsg("second", d.Add(ctx, key, "w2", c.cb("w2")), ShouldBeFalse)
+			time.Sleep(20 * time.Millisecond)
+			SoMsg("retry", d.Add(ctx, key, "w3", c.cb("w3")), ShouldBeTrue)
+		})
+		Convey("Pending requests expire", func() {
+			d := New(Config{Name: "test", Expire: 10 * time.Millisecond})
+			d.Add(ctx, key, "w1", c.cb("w1"))
+			time.Sleep(50 * time.Millisecond)
+			resp, ok := c.get("w1")
+			SoMsg("called", ok, ShouldBeTrue)
+			SoMsg("err", common.GetErrorMsg(resp.Err), ShouldEqual, ErrExpired)
+			SoMsg("pending", d.Pending(), ShouldEqual, 0)
+		})
+		Convey("Waiters stop waiting when their context is done", func() {
+			cctx, cancelF := context.WithCancel(ctx)
+			d.Add(cctx, key, "w1", c.cb("w1"))
+			d.Add(ctx, key, "w2", c.cb("w2"))
+			cancelF()
+			time.Sleep(10 * time.Millisecond)
+			resp, ok := c.get("w1")
+			SoMsg("called", ok, ShouldBeTrue)
+			SoMsg("err", common.IsTimeoutErr(resp.Err), ShouldBeTrue)
+			SoMsg("waiters", d.Resolve(key, Response{}), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestDo(t *testing.T) {
+	Convey("Given a Deduper", t, func() {
+		d := New(Config{Name: "test", Expire: time.Second})
+		key := testKey{"a", 1}
+		Convey("Concurrent calls share one fetch", func() {
+			var calls int32
+			release := make(chan struct{})
+			fetch := func(ctx context.Context, key interface{}) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return key.(testKey).name, nil
+			}
+			var wg sync.WaitGroup
+			results := make([]interface{}, 5)
+			for i := range results {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], _ = d.Do(context.Background(), key, fetch)
+				}(i)
+			}
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			SoMsg("calls", atomic.LoadInt32(&calls), ShouldEqual, 1)
+			for _, r := range results {
+				SoMsg("result", r, ShouldEqual, "a")
+			}
+		})
+		Convey("The fetch is canceled once all callers are gone", func() {
+			fetchCtx := make(chan context.Context, 1)
+			fetch := func(ctx context.Context, key interface{}) (interface{}, error) {
+				fetchCtx <- ctx
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			ctx, cancelF := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancelF()
+			_, err := d.Do(ctx, key, fetch)
+			SoMsg("err", common.IsTimeoutErr(err), ShouldBeTrue)
+			select {
+			case fctx := <-fetchCtx:
+				<-fctx.Done()
+			case <-time.After(time.Second):
+				t.Fatal("fetch not called")
+			}
+			SoMsg("pending", d.Pending(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/scionproto/scion/go/lib/prom"
+)
+
+const (
+	resultResolved = "resolved"
+	resultExpired  = "expired"
+	resultCanceled = "canceled"
+)
+
+// Deduper metrics, labeled by the name of the Deduper. They are nil until
+// InitMetrics is called, and Dedupers created before that do not export
+// metrics.
+var (
+	// Requests counts the waiters that had to send a request, and Coalesced
+	// the waiters that joined a pending request.
+	Requests  *prometheus.CounterVec
+	Coalesced *prometheus.CounterVec
+	// Waiters counts the waiters that are done, by result (resolved, expired
+	// or canceled).
+	Waiters *prometheus.CounterVec
+	// Pending is the number of pending requests.
+	Pending *prometheus.GaugeVec
+)
+
+// InitMetrics registers the Deduper metrics in namespace. It must be called at
+// most once.
+func InitMetrics(namespace string, constLabels prometheus.Labels) {
+	newCVec := func(name, help string, lNames ...string) *prometheus.CounterVec {
+		v := prom.NewCounterVec(namespace, "dedupe", name, help, constLabels,
+			append([]string{"name"}, lNames...))
+		prometheus.MustRegister(v)
+		return v
+	}
+	Requests = newCVec("requests_total", "Number of requests sent.")
+	Coalesced = newCVec("coalesced_total", "Number of requests joining a pending request.")
+	Waiters = newCVec("waiters_total", "Number of waiters done, by result.", "result")
+	Pending = prom.NewGaugeVec(namespace, "dedupe", "pending", "Number of pending requests.",
+		constLabels, []string{"name"})
+	prometheus.MustRegister(Pending)
+}
+
+// metrics are the metrics of a Deduper. All methods are no-ops on a nil
+// metrics.
+type metrics struct {
+	name      string
+	requests  prometheus.Counter
+	coalesced prometheus.Counter
+	pending   prometheus.Gauge
+}
+
+// newMetrics returns the metrics of Deduper name, or nil if InitMetrics was
+// not called.
+func newMetrics(name string) *metrics {
+	if Requests == nil {
+		return nil
+	}
+	l := prometheus.Labels{"name": name}
+	return &metrics{
+		name:      name,
+		requests:  Requests.With(l),
+		coalesced: Coalesced.With(l),
+		pending:   Pending.With(l),
+	}
+}
+
+func (m *metrics) incRequests() {
+	if m != nil {
+		m.requests.Inc()
+	}
+}
+
+func (m *metrics) incCoalesced() {
+	if m != nil {
+		m.coalesced.Inc()
+	}
+}
+
+func (m *metrics) incWaiters(result string, n int) {
+	if m != nil && n > 0 {
+		Waiters.WithLabelValues(m.name, result).Add(float64(n))
+	}
+}
+
+func (m *metrics) setPending(n int) {
+	if m != nil {
+		m.pending.Set(float64(n))
+	}
+}
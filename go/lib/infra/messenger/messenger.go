@@ -16,13 +16,21 @@
 // infra.Messenger. Sent and received messages must be one of the supported
 // types below.
 //
-// The following message types are valid messages. At the moment, no signature
-// verification is performed on the SignedPld.
-//  ChainRequest -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.ChainReq
-//  Chain        -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.Chain
-//  TRCRequest   -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.TRCReq
-//  TRC          -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.TRC
-//  PathRequest  -> ctrl.SignedPld/ctrl.Pld/path_mgmt.SegReq
+// The following message types are valid messages. If the Messenger is created
+// with a trust store, signed SignedPld's are verified against the certificate
+// chain of the signer, and rejected if the signature is invalid. Unsigned
+// payloads are accepted.
+//  ChainRequest   -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.ChainReq
+//  Chain          -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.Chain
+//  TRCRequest     -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.TRCReq
+//  TRC            -> ctrl.SignedPld/ctrl.Pld/cert_mgmt.TRC
+//  SegRequest     -> ctrl.SignedPld/ctrl.Pld/path_mgmt.SegReq
+//  SegReply       -> ctrl.SignedPld/ctrl.Pld/path_mgmt.SegReply
+//  SegReg         -> ctrl.SignedPld/ctrl.Pld/path_mgmt.SegReg
+//  SegSync        -> ctrl.SignedPld/ctrl.Pld/path_mgmt.SegSync
+//  RevInfo        -> ctrl.SignedPld/ctrl.Pld/path_mgmt.RevInfo
+//  IfStateRequest -> ctrl.SignedPld/ctrl.Pld/path_mgmt.IFStateReq
+//  IfStateInfos   -> ctrl.SignedPld/ctrl.Pld/path_mgmt.IFStateInfos
 //
 // The word "reliable" in method descriptions means a reliable protocol is used
 // to deliver that message.
@@ -33,6 +41,13 @@
 //  msger := New(...)
 //  msger.ListenAndServe()
 //
+// Received messages are validated, which includes verifying their signature,
+// before they are passed to the middlewares. At most MaxPending messages are
+// validated at the same time, and at most MaxPendingPerPeer of them can come
+// from the same peer. Further messages of that peer are dropped, while
+// ListenAndServe waits for a slot to become free if the total limit is
+// reached.
+//
 // ListenAndServe will log errors for all received messages. To process
 // messages, handlers need to be registered. Handlers allow different
 // infrastructure servers to choose which requests they service, and to exploit
@@ -41,6 +56,12 @@
 //   msger.AddHandler(ChainRequest, MyCustomHandler)
 //   msger.AddHandler(TRCRequest, MyOtherCustomHandler)
 //
+// Middlewares registered with Use wrap all handlers, e.g., to limit, log and
+// instrument the requests (see package infra/middleware):
+//   msger.Use(middleware.Log(logger), middleware.Metrics(), middleware.Recover(logger))
+// Servers should use the limiting middlewares to bound the number of handlers
+// running at the same time.
+//
 // Each handler runs indepedently (i.e., without any synchronization) until
 // completion. Goroutines inherit a reference to the Messenger via the
 // infra.MessengerContextKey context key. This allows handlers to directly send
@@ -75,14 +96,31 @@ import (
 	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
 	"github.com/scionproto/scion/go/lib/infra"
 	"github.com/scionproto/scion/go/lib/infra/disp"
+	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/proto"
 )
 
 const (
-	ChainRequest = "ChainRequest"
-	Chain        = "Chain"
-	TRCRequest   = "TRCRequest"
-	TRC          = "TRC"
+	// MaxPending is the maximum number of received messages that are
+	// validated at the same time.
+	MaxPending = 1 << 8
+	// MaxPendingPerPeer is the maximum number of received messages of a
+	// single peer that are validated at the same time.
+	MaxPendingPerPeer = 1 << 4
+)
+
+const (
+	ChainRequest   = "ChainRequest"
+	Chain          = "Chain"
+	TRCRequest     = "TRCRequest"
+	TRC            = "TRC"
+	SegRequest     = "SegRequest"
+	SegReply       = "SegReply"
+	SegReg         = "SegReg"
+	SegSync        = "SegSync"
+	RevInfo        = "RevInfo"
+	IfStateRequest = "IfStateRequest"
+	IfStateInfos   = "IfStateInfos"
 )
 
 var _ infra.Messenger = (*Messenger)(nil)
@@ -102,6 +140,16 @@ type Messenger struct {
 	handlersLock sync.RWMutex
 	// Handlers for received messages processing
 	handlers map[string]infra.Handler
+	// Middlewares wrapping the handlers
+	middlewares []infra.Middleware
+	// Handlers wrapped in the middlewares, used to serve messages
+	chains map[string]infra.Handler
+
+	// Slots for messages that are being validated
+	pending chan struct{}
+	// Number of messages of each peer that are being validated
+	pendingPeersLock sync.Mutex
+	pendingPeers     map[string]int
 
 	closeLock sync.Mutex
 	closeChan chan struct{}
@@ -115,14 +163,15 @@ type Messenger struct {
 // New creates a new Messenger that uses dispatcher for sending and receiving
 // messages, and trustStore as crypto information database.
 func New(dispatcher *disp.Dispatcher, store infra.TrustStore, logger log.Logger) *Messenger {
-	// XXX(scrye): A trustStore object is passed to the Messenger as it is required
-	// to verify top-level signatures. This is never used right now since only
-	// unsigned messages are supported. The content of received messages is
-	// processed in the relevant handlers which have their own reference to the
-	// trustStore.
+	// The trustStore is used to verify top-level signatures. The content of
+	// received messages is processed in the relevant handlers which have their
+	// own reference to the trustStore.
 	ctx, cancelF := context.WithCancel(context.Background())
 	signer := ctrl.NullSigner
 	verifier := ctrl.NullSigVerifier
+	if store != nil {
+		verifier = ctrl.NewBasicSigVerifier(store)
+	}
 	return &Messenger{
 		dispatcher: dispatcher,
 		signer:     signer,
@@ -130,10 +179,13 @@ func New(dispatcher *disp.Dispatcher, store infra.TrustStore, logger log.Logger)
 		requester:  ctrl_msg.NewRequester(signer, verifier, dispatcher),
 		trustStore: store,
 		handlers:   make(map[string]infra.Handler),
-		closeChan:  make(chan struct{}),
-		ctx:        ctx,
-		cancelF:    cancelF,
-		log:        logger,
+		chains:       make(map[string]infra.Handler),
+		pending:      make(chan struct{}, MaxPending),
+		pendingPeers: make(map[string]int),
+		closeChan:    make(chan struct{}),
+		ctx:          ctx,
+		cancelF:      cancelF,
+		log:          logger,
 	}
 	// XXX(scrye): More crypto is needed to send signed messages (a local
 	// signing key, at a minimum).
@@ -152,7 +204,7 @@ func (m *Messenger) GetTRC(ctx context.Context, msg *cert_mgmt.TRCReq,
 	if err != nil {
 		return nil, err
 	}
-	_, replyMsg, err := m.validate(replyCtrlPld)
+	_, replyMsg, err := m.validatePld(replyCtrlPld)
 	if err != nil {
 		return nil, err
 	}
@@ -185,7 +237,7 @@ func (m *Messenger) GetCertChain(ctx context.Context, msg *cert_mgmt.ChainReq,
 	if err != nil {
 		return nil, err
 	}
-	_, replyMsg, err := m.validate(replyCtrlPld)
+	_, replyMsg, err := m.validatePld(replyCtrlPld)
 	if err != nil {
 		return nil, err
 	}
@@ -220,7 +272,7 @@ func (m *Messenger) GetPaths(ctx context.Context, msg *path_mgmt.SegReq,
 	if err != nil {
 		return nil, err
 	}
-	_, replyMsg, err := m.validate(replyCtrlPld)
+	_, replyMsg, err := m.validatePld(replyCtrlPld)
 	if err != nil {
 		return nil, err
 	}
@@ -231,13 +283,84 @@ func (m *Messenger) GetPaths(ctx context.Context, msg *path_mgmt.SegReq,
 	return reply, nil
 }
 
+// SendSegReply sends a reliable path_mgmt.SegReply to address a. To answer a
+// SegRequest, id must be the ID of the request.
+func (m *Messenger) SendSegReply(ctx context.Context, msg *path_mgmt.SegReply, a net.Addr,
+	id uint64) error {
+
+	return m.sendPathMgmt(ctx, msg, a, id)
+}
+
+// SendSegReg sends a reliable path_mgmt.SegReg to address a.
+func (m *Messenger) SendSegReg(ctx context.Context, msg *path_mgmt.SegReg, a net.Addr,
+	id uint64) error {
+
+	return m.sendPathMgmt(ctx, msg, a, id)
+}
+
+// SendSegSync sends a reliable path_mgmt.SegSync to address a.
+func (m *Messenger) SendSegSync(ctx context.Context, msg *path_mgmt.SegSync, a net.Addr,
+	id uint64) error {
+
+	return m.sendPathMgmt(ctx, msg, a, id)
+}
+
+// SendRev sends a reliable path_mgmt.RevInfo to address a.
+func (m *Messenger) SendRev(ctx context.Context, msg *path_mgmt.RevInfo, a net.Addr,
+	id uint64) error {
+
+	return m.sendPathMgmt(ctx, msg, a, id)
+}
+
+// SendIfStateReq sends a reliable path_mgmt.IFStateReq to address a. The
+// beacon server answers asynchronously with path_mgmt.IFStateInfos, so the
+// reply is received by the IfStateInfos handler.
+func (m *Messenger) SendIfStateReq(ctx context.Context, msg *path_mgmt.IFStateReq,
+	a net.Addr, id uint64) error {
+
+	return m.sendPathMgmt(ctx, msg, a, id)
+}
+
+// SendIfStateInfos sends a reliable path_mgmt.IFStateInfos to address a.
+func (m *Messenger) SendIfStateInfos(ctx context.Context, msg *path_mgmt.IFStateInfos,
+	a net.Addr, id uint64) error {
+
+	return m.sendPathMgmt(ctx, msg, a, id)
+}
+
+// sendPathMgmt wraps the path_mgmt message msg in a ctrl.Pld, and sends it
+// reliably to address a.
+func (m *Messenger) sendPathMgmt(ctx context.Context, msg proto.Cerealizable, a net.Addr,
+	id uint64) error {
+
+	pld, err := ctrl.NewPathMgmtPld(msg, nil, &ctrl.Data{ReqId: id})
+	if err != nil {
+		return err
+	}
+	return m.requester.Notify(ctx, pld, a)
+}
+
 // AddHandler registers a handler for msgType.
 func (m *Messenger) AddHandler(msgType string, handler infra.Handler) {
 	m.handlersLock.Lock()
 	m.handlers[msgType] = handler
+	m.chains[msgType] = infra.Chain(msgType, handler, m.middlewares...)
 	m.handlersLock.Unlock()
 }
 
+// Use appends mws to the middlewares wrapping the handlers. The first
+// middleware is the outermost one. Use should be called before serving
+// messages, since the handlers are wrapped anew and stateful middlewares thus
+// lose their state.
+func (m *Messenger) Use(mws ...infra.Middleware) {
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	m.middlewares = append(m.middlewares, mws...)
+	for msgType, handler := range m.handlers {
+		m.chains[msgType] = infra.Chain(msgType, handler, m.middlewares...)
+	}
+}
+
 // ListenAndServe starts listening and serving messages on srv's Messenger
 // interface. The function runs in the current goroutine. Multiple
 // ListenAndServe methods can run in parallel.
@@ -268,47 +391,106 @@ func (m *Messenger) ListenAndServe() {
 				"actual", common.TypeOf(genericMsg))
 			continue
 		}
-
-		err = m.verifier.Verify(signedPld)
-		if err != nil {
-			m.log.Error("Verification error", "err", err)
+		key := peerKey(address)
+		if !m.acquirePeer(key) {
+			m.log.Warn("Dropping message, too many pending messages of peer",
+				"peer", address)
 			continue
 		}
-
-		pld, err := signedPld.Pld()
-		if err != nil {
-			m.log.Error("Unable to extract Pld from CtrlPld", "err", err)
-			continue
+		select {
+		case m.pending <- struct{}{}:
+		case <-m.closeChan:
+			m.releasePeer(key)
+			return
 		}
-		m.serve(pld, address)
+		// Verifying the signature might require fetching the certificate
+		// chain of the signer, so each message is served in its own goroutine.
+		go m.serve(signedPld, address, key)
 	}
 }
 
-func (m *Messenger) serve(pld *ctrl.Pld, address net.Addr) {
+func (m *Messenger) serve(signedPld *ctrl.SignedPld, address net.Addr, key string) {
 	// Validate that the message is of acceptable type, and that its top-level
 	// signature is correct.
-	msgType, msg, err := m.validate(pld)
+	pld, msgType, msg, err := m.validate(signedPld)
+	// The handlers are bounded by the middlewares, so the slots are only held
+	// during validation.
+	<-m.pending
+	m.releasePeer(key)
 	if err != nil {
 		m.log.Error("Received message, but unable to validate message", "err", err)
 		return
 	}
 
 	m.handlersLock.RLock()
-	handler := m.handlers[msgType]
+	handler := m.chains[msgType]
 	m.handlersLock.RUnlock()
 	if handler == nil {
 		m.log.Error("Received message, but handler not found", "msgType", msgType)
 		return
 	}
 	serveCtx := context.WithValue(m.ctx, infra.MessengerContextKey, m)
-	go handler.Handle(infra.NewRequest(serveCtx, msg, pld, address, pld.ReqId))
+	handler.Handle(infra.NewRequest(serveCtx, msg, pld, address, pld.ReqId))
+}
+
+// acquirePeer reserves a validation slot for the peer identified by key, and
+// returns whether one was available.
+func (m *Messenger) acquirePeer(key string) bool {
+	m.pendingPeersLock.Lock()
+	defer m.pendingPeersLock.Unlock()
+	if m.pendingPeers[key] >= MaxPendingPerPeer {
+		return false
+	}
+	m.pendingPeers[key]++
+	return true
 }
 
-// validate checks that msg is one of the acceptable message types for SCION
+// releasePeer frees a validation slot of the peer identified by key.
+func (m *Messenger) releasePeer(key string) {
+	m.pendingPeersLock.Lock()
+	defer m.pendingPeersLock.Unlock()
+	m.pendingPeers[key]--
+	if m.pendingPeers[key] <= 0 {
+		delete(m.pendingPeers, key)
+	}
+}
+
+// peerKey identifies the peer at a by its IA and host address, ignoring the
+// port.
+func peerKey(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	if sa, ok := a.(*snet.Addr); ok && sa.Host != nil {
+		return fmt.Sprintf("%s,[%s]", sa.IA, sa.Host)
+	}
+	return a.String()
+}
+
+// validate verifies the top-level signature of signedPld, and checks that the
+// contained message is one of the acceptable message types (see validatePld).
+// It returns the Pld, the message type ID string, the message, and an error (if
+// one occurred).
+func (m *Messenger) validate(signedPld *ctrl.SignedPld) (*ctrl.Pld, string,
+	proto.Cerealizable, error) {
+
+	if err := ctrl.VerifySig(signedPld, m.verifier); err != nil {
+		return nil, "", nil, err
+	}
+	pld, err := signedPld.Pld()
+	if err != nil {
+		return nil, "", nil, common.NewBasicError("Unable to extract Pld from CtrlPld", err)
+	}
+	msgType, msg, err := m.validatePld(pld)
+	return pld, msgType, msg, err
+}
+
+// validatePld checks that msg is one of the acceptable message types for SCION
 // infra communication (listed in package level documentation), and returns the
 // message type ID string, the message (the inner proto.Cerealizable object),
-// and an error (if one occurred).
-func (m *Messenger) validate(pld *ctrl.Pld) (string, proto.Cerealizable, error) {
+// and an error (if one occurred). Replies to requests are passed to validatePld
+// directly, since their signature is verified by the requester.
+func (m *Messenger) validatePld(pld *ctrl.Pld) (string, proto.Cerealizable, error) {
 	// XXX(scrye): For now, only the messages in the top comment of this
 	// package are supported.
 	switch pld.Which {
@@ -327,6 +509,27 @@ func (m *Messenger) validate(pld *ctrl.Pld) (string, proto.Cerealizable, error)
 				common.NewBasicError("Unsupported SignedPld.CtrlPld.CertMgmt.Xxx message type",
 					nil, "capnp_which", pld.CertMgmt.Which)
 		}
+	case proto.CtrlPld_Which_pathMgmt:
+		switch pld.PathMgmt.Which {
+		case proto.PathMgmt_Which_segReq:
+			return SegRequest, pld.PathMgmt.SegReq, nil
+		case proto.PathMgmt_Which_segReply:
+			return SegReply, pld.PathMgmt.SegReply, nil
+		case proto.PathMgmt_Which_segReg:
+			return SegReg, pld.PathMgmt.SegReg, nil
+		case proto.PathMgmt_Which_segSync:
+			return SegSync, pld.PathMgmt.SegSync, nil
+		case proto.PathMgmt_Which_revInfo:
+			return RevInfo, pld.PathMgmt.RevInfo, nil
+		case proto.PathMgmt_Which_ifStateReq:
+			return IfStateRequest, pld.PathMgmt.IFStateReq, nil
+		case proto.PathMgmt_Which_ifStateInfos:
+			return IfStateInfos, pld.PathMgmt.IFStateInfos, nil
+		default:
+			return "", nil,
+				common.NewBasicError("Unsupported SignedPld.CtrlPld.PathMgmt.Xxx message type",
+					nil, "capnp_which", pld.PathMgmt.Which)
+		}
 	default:
 		return "", nil, common.NewBasicError("Unsupported SignedPld.Pld.Xxx message type",
 			nil, "capnp_which", pld.Which)
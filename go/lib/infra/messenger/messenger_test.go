@@ -26,6 +26,7 @@ import (
 
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
 	"github.com/scionproto/scion/go/lib/infra"
 	"github.com/scionproto/scion/go/lib/infra/disp"
 	"github.com/scionproto/scion/go/lib/infra/transport"
@@ -35,7 +36,9 @@ import (
 
 // TestCase data
 var (
-	mockTRC = &cert_mgmt.TRC{RawTRC: common.RawBytes("foobar")}
+	mockTRC      = &cert_mgmt.TRC{RawTRC: common.RawBytes("foobar")}
+	mockSegReply = &path_mgmt.SegReply{Req: &path_mgmt.SegReq{RawSrcIA: 42, RawDstIA: 1337},
+		Recs: &path_mgmt.SegRecs{}}
 )
 
 func MockTRCHandler(request *infra.Request) {
@@ -56,6 +59,24 @@ func MockTRCHandler(request *infra.Request) {
 	}
 }
 
+func MockSegReqHandler(request *infra.Request) {
+	messenger, ok := request.Context().Value(infra.MessengerContextKey).(*Messenger)
+	if !ok {
+		log.Warn("Unable to service request, bad Messenger value found")
+		return
+	}
+	if _, ok := request.Message.(*path_mgmt.SegReq); !ok {
+		log.Warn("Unable to service request, bad message type", "msg", request.Message)
+		return
+	}
+	subCtx, cancelF := context.WithTimeout(request.Context(), 3*time.Second)
+	defer cancelF()
+	err := messenger.SendSegReply(subCtx, mockSegReply, &MockAddress{}, request.ID)
+	if err != nil {
+		log.Error("Server error", "err", err)
+	}
+}
+
 type MockAddress struct{}
 
 func (m *MockAddress) Network() string {
@@ -94,6 +115,49 @@ func TestTRCExchange(t *testing.T) {
 	})
 }
 
+func TestPathSegExchange(t *testing.T) {
+	Convey("Setup", t, func() {
+		c2s, s2c := p2p.New()
+		clientMessenger := setupMessenger(c2s, "client")
+		serverMessenger := setupMessenger(s2c, "server")
+
+		Convey("Client/server", xtest.Parallel(func(sc *xtest.SC) {
+			// The client requests path segments from the server, and
+			// receives the reply.
+			ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancelF()
+
+			msg := &path_mgmt.SegReq{RawSrcIA: 42, RawDstIA: 1337}
+			reply, err := clientMessenger.GetPaths(ctx, msg, &MockAddress{}, 42)
+			serverMessenger.CloseServer()
+			sc.SoMsg("client request err", err, ShouldBeNil)
+			sc.SoMsg("client received reply", reply, ShouldNotBeNil)
+			sc.SoMsg("reply request", reply.Req, ShouldResemble, mockSegReply.Req)
+		}, func(sc *xtest.SC) {
+			serverMessenger.AddHandler(SegRequest, infra.HandlerFunc(MockSegReqHandler))
+			serverMessenger.ListenAndServe()
+		}))
+	})
+}
+
+func TestPendingPeers(t *testing.T) {
+	Convey("The pending messages of each peer are limited", t, func() {
+		m := New(nil, nil, log.Root())
+		for i := 0; i < MaxPendingPerPeer; i++ {
+			SoMsg("acquire", m.acquirePeer("a"), ShouldBeTrue)
+		}
+		SoMsg("acquire over limit", m.acquirePeer("a"), ShouldBeFalse)
+		SoMsg("acquire other peer", m.acquirePeer("b"), ShouldBeTrue)
+		m.releasePeer("a")
+		SoMsg("acquire after release", m.acquirePeer("a"), ShouldBeTrue)
+		for i := 0; i < MaxPendingPerPeer; i++ {
+			m.releasePeer("a")
+		}
+		m.releasePeer("b")
+		SoMsg("peers", m.pendingPeers, ShouldBeEmpty)
+	})
+}
+
 func setupMessenger(conn net.PacketConn, name string) *Messenger {
 	transport := transport.NewRUDP(conn, log.New("name", name))
 	dispatcher := disp.New(transport, DefaultAdapter, log.New("name", name))
@@ -0,0 +1,147 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// pruneInterval is the minimum interval between two scans for idle peers.
+const pruneInterval = time.Minute
+
+// RateLimit limits the requests of each peer, across all message types, to
+// rate requests per second, with bursts of up to burst requests. Requests
+// above the limit are dropped and reported as OutcomeRateLimited. Peers are
+// identified by their IA and host address, ignoring the port.
+func RateLimit(rate float64, burst int) infra.Middleware {
+	l := newRateLimiter(rate, burst)
+	return func(msgType string, next infra.Handler) infra.Handler {
+		return infra.HandlerFunc(func(r *infra.Request) {
+			if !l.allow(peerKey(r.Peer), time.Now()) {
+				SetOutcome(r, OutcomeRateLimited)
+				return
+			}
+			next.Handle(r)
+		})
+	}
+}
+
+func peerKey(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	if sa, ok := a.(*snet.Addr); ok && sa.Host != nil {
+		return fmt.Sprintf("%s,[%s]", sa.IA, sa.Host)
+	}
+	return a.String()
+}
+
+// bucket is the token bucket of a peer.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per peer. Buckets that refilled completely
+// are discarded, since they are equivalent to new ones.
+type rateLimiter struct {
+	sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of key at time now, and returns whether
+// one was available.
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.lastPrune) > pruneInterval {
+		l.prune(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *rateLimiter) refill(b *bucket, now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ConcurrencyLimit limits the number of concurrently handled requests of each
+// message type to limit, or to the limit in perType. Message types with a
+// non-positive limit are not limited. Requests wait for one of the running
+// requests to finish, until their context is done; requests that time out
+// waiting are dropped and reported as OutcomeOverloaded. To bound the waiting
+// time, Timeout should be applied before ConcurrencyLimit.
+func ConcurrencyLimit(limit int, perType map[string]int) infra.Middleware {
+	return func(msgType string, next infra.Handler) infra.Handler {
+		n := limit
+		if typeLimit, ok := perType[msgType]; ok {
+			n = typeLimit
+		}
+		if n <= 0 {
+			return next
+		}
+		sem := make(chan struct{}, n)
+		return infra.HandlerFunc(func(r *infra.Request) {
+			select {
+			case sem <- struct{}{}:
+			case <-r.Context().Done():
+				SetOutcome(r, OutcomeOverloaded)
+				return
+			}
+			defer func() { <-sem }()
+			next.Handle(r)
+		})
+	}
+}
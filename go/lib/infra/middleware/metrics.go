@@ -0,0 +1,54 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/prom"
+)
+
+// Latency is the handling time of requests, labeled by message type and
+// outcome. It is nil until InitMetrics is called.
+var Latency *prometheus.HistogramVec
+
+// InitMetrics registers the handler metrics in namespace. It must be called at
+// most once, and before the Metrics middleware is used.
+func InitMetrics(namespace string, constLabels prometheus.Labels) {
+	Latency = prom.NewHistogramVec(namespace, "handler", "duration_seconds",
+		"Time spent handling requests.", constLabels, []string{"msgType", "outcome"},
+		prometheus.ExponentialBuckets(0.001, 2, 15))
+	prometheus.MustRegister(Latency)
+}
+
+// Metrics exports the handling time and outcome of each request in Latency.
+// If InitMetrics was not called, the handlers are not wrapped.
+func Metrics() infra.Middleware {
+	return func(msgType string, next infra.Handler) infra.Handler {
+		if Latency == nil {
+			return next
+		}
+		return infra.HandlerFunc(func(r *infra.Request) {
+			start := time.Now()
+			r, rec := withRecorder(r)
+			next.Handle(r)
+			Latency.WithLabelValues(msgType, rec.result(r.Context())).Observe(
+				time.Since(start).Seconds())
+		})
+	}
+}
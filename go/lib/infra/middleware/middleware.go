@@ -0,0 +1,174 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package middleware contains infra.Middleware implementations for the
+// handlers of infra.Messenger.
+//
+// The middlewares are applied in the order they are passed to
+// messenger.Messenger.Use, the first one being the outermost. The recommended
+// order is:
+//  msger.Use(
+//      middleware.Log(logger),
+//      middleware.Metrics(),
+//      middleware.Recover(logger),
+//      middleware.RateLimit(rate, burst),
+//      middleware.Timeout(timeout, nil),
+//      middleware.ConcurrencyLimit(limit, nil),
+//  )
+// Log and Metrics record the outcome of each request (see the Outcome
+// constants). The other middlewares report rejected, panicked and timed out
+// requests to them, and handlers can report failures with SetOutcome.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/infra"
+)
+
+// Outcomes of a request, as logged by Log and exported by Metrics.
+const (
+	OutcomeOK          = "ok"
+	OutcomeError       = "error"
+	OutcomePanic       = "panic"
+	OutcomeTimeout     = "timeout"
+	OutcomeCanceled    = "canceled"
+	OutcomeRateLimited = "rate_limited"
+	OutcomeOverloaded  = "overloaded"
+)
+
+type outcomeKey struct{}
+
+// recorder stores the outcome of a request. The first reported outcome wins.
+type recorder struct {
+	sync.Mutex
+	outcome string
+}
+
+// withRecorder returns r with a recorder in its context, and the recorder. If r
+// already has one, it is reused.
+func withRecorder(r *infra.Request) (*infra.Request, *recorder) {
+	if rec, ok := r.Context().Value(outcomeKey{}).(*recorder); ok {
+		return r, rec
+	}
+	rec := &recorder{}
+	return r.WithContext(context.WithValue(r.Context(), outcomeKey{}, rec)), rec
+}
+
+func (rec *recorder) set(outcome string) {
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.outcome == "" {
+		rec.outcome = outcome
+	}
+}
+
+// result returns the recorded outcome. If none was reported, the outcome is
+// derived from ctx, the context the request was handled with.
+func (rec *recorder) result(ctx context.Context) string {
+	rec.Lock()
+	defer rec.Unlock()
+	if rec.outcome != "" {
+		return rec.outcome
+	}
+	return ctxOutcome(ctx)
+}
+
+func ctxOutcome(ctx context.Context) string {
+	switch ctx.Err() {
+	case nil:
+		return OutcomeOK
+	case context.DeadlineExceeded:
+		return OutcomeTimeout
+	default:
+		return OutcomeCanceled
+	}
+}
+
+// SetOutcome reports the outcome of request r to the Log and Metrics
+// middlewares. Handlers call it with OutcomeError if they fail to process a
+// request. Only the first outcome reported for a request is kept.
+func SetOutcome(r *infra.Request, outcome string) {
+	if rec, ok := r.Context().Value(outcomeKey{}).(*recorder); ok {
+		rec.set(outcome)
+	}
+}
+
+// Log logs each request after it has been handled, with its message type,
+// peer, ID, outcome and duration. Successful requests are logged at debug
+// level, all others at warning level.
+func Log(logger log.Logger) infra.Middleware {
+	return func(msgType string, next infra.Handler) infra.Handler {
+		return infra.HandlerFunc(func(r *infra.Request) {
+			start := time.Now()
+			r, rec := withRecorder(r)
+			next.Handle(r)
+			outcome := rec.result(r.Context())
+			lf := logger.Debug
+			if outcome != OutcomeOK {
+				lf = logger.Warn
+			}
+			lf("Handled request", "msgType", msgType, "peer", r.Peer, "id", r.ID,
+				"outcome", outcome, "duration", time.Since(start))
+		})
+	}
+}
+
+// Recover recovers from panics in the wrapped handlers. The panic is logged
+// with its stack trace, and the request is reported as OutcomePanic.
+func Recover(logger log.Logger) infra.Middleware {
+	return func(msgType string, next infra.Handler) infra.Handler {
+		return infra.HandlerFunc(func(r *infra.Request) {
+			defer func() {
+				if msg := recover(); msg != nil {
+					logger.Error("Panic while handling request", "msgType", msgType,
+						"peer", r.Peer, "id", r.ID, "msg", fmt.Sprintf("%v", msg),
+						"stack", string(debug.Stack()))
+					SetOutcome(r, OutcomePanic)
+				}
+			}()
+			next.Handle(r)
+		})
+	}
+}
+
+// Timeout bounds the context of each request to timeout, or to the timeout in
+// perType for its message type. Message types with a non-positive timeout are
+// not bounded. Requests whose deadline passed are reported as OutcomeTimeout.
+func Timeout(timeout time.Duration, perType map[string]time.Duration) infra.Middleware {
+	return func(msgType string, next infra.Handler) infra.Handler {
+		d := timeout
+		if typeTimeout, ok := perType[msgType]; ok {
+			d = typeTimeout
+		}
+		if d <= 0 {
+			return next
+		}
+		return infra.HandlerFunc(func(r *infra.Request) {
+			ctx, cancelF := context.WithTimeout(r.Context(), d)
+			defer cancelF()
+			r = r.WithContext(ctx)
+			next.Handle(r)
+			if ctx.Err() == context.DeadlineExceeded {
+				SetOutcome(r, OutcomeTimeout)
+			}
+		})
+	}
+}
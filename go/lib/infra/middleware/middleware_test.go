@@ -0,0 +1,200 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// outcomeOf handles a request with h wrapped in mws, and returns the recorded
+// outcome.
+func outcomeOf(ctx context.Context, h infra.Handler, mws ...infra.Middleware) string {
+	r, rec := withRecorder(infra.NewRequest(ctx, nil, nil, nil, 1))
+	infra.Chain("test", h, mws...).Handle(r)
+	return rec.result(r.Context())
+}
+
+func TestChain(t *testing.T) {
+	Convey("Middlewares are applied in order, the first one being the outermost", t, func() {
+		var calls []string
+		mw := func(name string) infra.Middleware {
+			return func(msgType string, next infra.Handler) infra.Handler {
+				return infra.HandlerFunc(func(r *infra.Request) {
+					calls = append(calls, name+":"+msgType)
+					next.Handle(r)
+				})
+			}
+		}
+		h := infra.HandlerFunc(func(r *infra.Request) { calls = append(calls, "h") })
+		infra.Chain("foo", h, mw("a"), mw("b")).Handle(
+			infra.NewRequest(context.Background(), nil, nil, nil, 1))
+		SoMsg("calls", calls, ShouldResemble, []string{"a:foo", "b:foo", "h"})
+	})
+}
+
+func TestOutcome(t *testing.T) {
+	Convey("The outcome of a request is recorded", t, func() {
+		Convey("A handled request is ok", func() {
+			h := infra.HandlerFunc(func(r *infra.Request) {})
+			SoMsg("outcome", outcomeOf(context.Background(), h), ShouldEqual, OutcomeOK)
+		})
+		Convey("The first reported outcome is kept", func() {
+			h := infra.HandlerFunc(func(r *infra.Request) {
+				SetOutcome(r, OutcomeError)
+				SetOutcome(r, OutcomeOK)
+			})
+			SoMsg("outcome", outcomeOf(context.Background(), h), ShouldEqual, OutcomeError)
+		})
+		Convey("A canceled request is reported as canceled", func() {
+			ctx, cancelF := context.WithCancel(context.Background())
+			h := infra.HandlerFunc(func(r *infra.Request) { cancelF() })
+			SoMsg("outcome", outcomeOf(ctx, h), ShouldEqual, OutcomeCanceled)
+		})
+		Convey("Outer recorders are reused", func() {
+			h := infra.HandlerFunc(func(r *infra.Request) { SetOutcome(r, OutcomeError) })
+			outcome := outcomeOf(context.Background(), h, Log(log.Root()), Metrics())
+			SoMsg("outcome", outcome, ShouldEqual, OutcomeError)
+		})
+	})
+}
+
+func TestRecover(t *testing.T) {
+	Convey("Panics are recovered and reported", t, func() {
+		h := infra.HandlerFunc(func(r *infra.Request) { panic("test") })
+		outcome := outcomeOf(context.Background(), h, Recover(log.Root()))
+		SoMsg("outcome", outcome, ShouldEqual, OutcomePanic)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	Convey("Timeout bounds the request context", t, func() {
+		var deadline time.Time
+		var ok bool
+		h := infra.HandlerFunc(func(r *infra.Request) {
+			deadline, ok = r.Context().Deadline()
+		})
+		mw := Timeout(time.Second, map[string]time.Duration{"other": 0})
+		outcomeOf(context.Background(), h, mw)
+		SoMsg("deadline set", ok, ShouldBeTrue)
+		SoMsg("deadline", deadline, ShouldHappenWithin, time.Second, time.Now())
+
+		Convey("Types with a non-positive timeout are not bounded", func() {
+			infra.Chain("other", h, mw).Handle(
+				infra.NewRequest(context.Background(), nil, nil, nil, 1))
+			SoMsg("deadline set", ok, ShouldBeFalse)
+		})
+		Convey("Expired requests are reported as timed out", func() {
+			h := infra.HandlerFunc(func(r *infra.Request) { <-r.Context().Done() })
+			outcome := outcomeOf(context.Background(), h, Timeout(time.Millisecond, nil))
+			SoMsg("outcome", outcome, ShouldEqual, OutcomeTimeout)
+		})
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	Convey("Given a rate limiter with rate 2 and burst 3", t, func() {
+		l := newRateLimiter(2, 3)
+		now := time.Now()
+		Convey("Bursts are allowed, and the bucket refills at rate", func() {
+			for i := 0; i < 3; i++ {
+				SoMsg("burst", l.allow("a", now), ShouldBeTrue)
+			}
+			SoMsg("empty", l.allow("a", now), ShouldBeFalse)
+			SoMsg("other peer", l.allow("b", now), ShouldBeTrue)
+			SoMsg("refilled", l.allow("a", now.Add(500*time.Millisecond)), ShouldBeTrue)
+			SoMsg("empty again", l.allow("a", now.Add(500*time.Millisecond)), ShouldBeFalse)
+		})
+		Convey("Full buckets are pruned", func() {
+			l.allow("a", now)
+			l.allow("b", now.Add(pruneInterval))
+			SoMsg("buckets", len(l.buckets), ShouldEqual, 2)
+			l.allow("b", now.Add(2*pruneInterval+time.Second))
+			SoMsg("buckets", len(l.buckets), ShouldEqual, 1)
+		})
+	})
+	Convey("Rejected requests are reported as rate limited", t, func() {
+		h := infra.HandlerFunc(func(r *infra.Request) {})
+		mw := RateLimit(0, 1)
+		SoMsg("first", outcomeOf(context.Background(), h, mw), ShouldEqual, OutcomeOK)
+		SoMsg("second", outcomeOf(context.Background(), h, mw), ShouldEqual,
+			OutcomeRateLimited)
+	})
+}
+
+func TestPeerKey(t *testing.T) {
+	Convey("Peers are identified by IA and host, without the port", t, func() {
+		ia, _ := addr.IAFromString("1-10")
+		a := &snet.Addr{IA: ia, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1)), L4Port: 1}
+		b := a.Copy()
+		b.L4Port = 2
+		SoMsg("key", peerKey(a), ShouldEqual, peerKey(b))
+		SoMsg("nil", peerKey(nil), ShouldEqual, "")
+	})
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	Convey("Given a handler limited to 2 concurrent requests", t, func() {
+		var lock sync.Mutex
+		running, maxRunning := 0, 0
+		h := infra.HandlerFunc(func(r *infra.Request) {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+		})
+		handler := infra.Chain("test", h, Timeout(time.Second, nil), ConcurrencyLimit(2, nil))
+		Convey("At most 2 requests run at the same time", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func(id uint64) {
+					defer wg.Done()
+					handler.Handle(infra.NewRequest(context.Background(), nil, nil, nil, id))
+				}(uint64(i))
+			}
+			wg.Wait()
+			SoMsg("max running", maxRunning, ShouldEqual, 2)
+		})
+		Convey("Requests that time out waiting are reported as overloaded", func() {
+			block := make(chan struct{})
+			h := infra.HandlerFunc(func(r *infra.Request) { <-block })
+			handler := infra.Chain("test", h, Timeout(50*time.Millisecond, nil),
+				ConcurrencyLimit(1, nil))
+			go handler.Handle(infra.NewRequest(context.Background(), nil, nil, nil, 1))
+			time.Sleep(10 * time.Millisecond)
+			r, rec := withRecorder(infra.NewRequest(context.Background(), nil, nil, nil, 2))
+			handler.Handle(r)
+			close(block)
+			SoMsg("outcome", rec.result(r.Context()), ShouldEqual, OutcomeOverloaded)
+		})
+	})
+}
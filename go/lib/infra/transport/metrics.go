@@ -0,0 +1,145 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/scionproto/scion/go/lib/prom"
+)
+
+// Per-peer RUDP metrics, labeled by the host of the peer. They are nil until InitMetrics
+// is called, and RUDP transports only export metrics after that.
+var (
+	// MsgsSent counts the messages sent, MsgsReceived the messages received (after
+	// reassembly).
+	MsgsSent     *prometheus.CounterVec
+	MsgsReceived *prometheus.CounterVec
+	// Retransmits counts the retransmitted datagrams, and SendFailures the reliable messages
+	// that were not acknowledged before their context ended.
+	Retransmits  *prometheus.CounterVec
+	SendFailures *prometheus.CounterVec
+	// FragsDropped counts the received fragments that were discarded, because the
+	// reassembly buffer was full or the message timed out.
+	FragsDropped *prometheus.CounterVec
+	// RTT is the smoothed round-trip time, and RTO the current retransmission timeout.
+	RTT *prometheus.GaugeVec
+	RTO *prometheus.GaugeVec
+)
+
+// InitMetrics registers the RUDP metrics in namespace. It must be called at most once.
+func InitMetrics(namespace string, constLabels prometheus.Labels) {
+	lNames := []string{"peer"}
+	newCVec := func(name, help string) *prometheus.CounterVec {
+		v := prom.NewCounterVec(namespace, "rudp", name, help, constLabels, lNames)
+		prometheus.MustRegister(v)
+		return v
+	}
+	newGVec := func(name, help string) *prometheus.GaugeVec {
+		v := prom.NewGaugeVec(namespace, "rudp", name, help, constLabels, lNames)
+		prometheus.MustRegister(v)
+		return v
+	}
+	MsgsSent = newCVec("msgs_sent_total", "Number of messages sent.")
+	MsgsReceived = newCVec("msgs_received_total", "Number of messages received.")
+	Retransmits = newCVec("retransmits_total", "Number of retransmitted datagrams.")
+	SendFailures = newCVec("send_failures_total",
+		"Number of reliable messages that were not acknowledged.")
+	FragsDropped = newCVec("frags_dropped_total", "Number of discarded fragments.")
+	RTT = newGVec("rtt_seconds", "Smoothed round-trip time.")
+	RTO = newGVec("rto_seconds", "Retransmission timeout.")
+}
+
+// peerMetrics are the metrics of a peer. All methods are no-ops on a nil peerMetrics.
+type peerMetrics struct {
+	peer         string
+	msgsSent     prometheus.Counter
+	msgsReceived prometheus.Counter
+	retransmits  prometheus.Counter
+	sendFailures prometheus.Counter
+	fragsDropped prometheus.Counter
+	rtt          prometheus.Gauge
+	rto          prometheus.Gauge
+}
+
+// newPeerMetrics returns the metrics of peer, or nil if InitMetrics was not called.
+func newPeerMetrics(peer string) *peerMetrics {
+	if MsgsSent == nil {
+		return nil
+	}
+	l := prometheus.Labels{"peer": peer}
+	return &peerMetrics{
+		peer:         peer,
+		msgsSent:     MsgsSent.With(l),
+		msgsReceived: MsgsReceived.With(l),
+		retransmits:  Retransmits.With(l),
+		sendFailures: SendFailures.With(l),
+		fragsDropped: FragsDropped.With(l),
+		rtt:          RTT.With(l),
+		rto:          RTO.With(l),
+	}
+}
+
+func (m *peerMetrics) incSent() {
+	if m != nil {
+		m.msgsSent.Inc()
+	}
+}
+
+func (m *peerMetrics) incReceived() {
+	if m != nil {
+		m.msgsReceived.Inc()
+	}
+}
+
+func (m *peerMetrics) incRetransmits() {
+	if m != nil {
+		m.retransmits.Inc()
+	}
+}
+
+func (m *peerMetrics) incSendFailures() {
+	if m != nil {
+		m.sendFailures.Inc()
+	}
+}
+
+func (m *peerMetrics) addFragsDropped(n int) {
+	if m != nil {
+		m.fragsDropped.Add(float64(n))
+	}
+}
+
+func (m *peerMetrics) setRTT(rtt, rto time.Duration) {
+	if m != nil {
+		m.rtt.Set(rtt.Seconds())
+		m.rto.Set(rto.Seconds())
+	}
+}
+
+// delete removes the metrics of the peer from the exported vectors.
+func (m *peerMetrics) delete() {
+	if m == nil {
+		return
+	}
+	for _, v := range []*prometheus.CounterVec{MsgsSent, MsgsReceived, Retransmits,
+		SendFailures, FragsDropped} {
+		v.DeleteLabelValues(m.peer)
+	}
+	RTT.DeleteLabelValues(m.peer)
+	RTO.DeleteLabelValues(m.peer)
+}
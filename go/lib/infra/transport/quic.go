@@ -0,0 +1,454 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	logext "github.com/inconshreveable/log15/ext"
+	"github.com/lucas-clemente/quic-go"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/infra"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/snet/squic"
+)
+
+const (
+	// Maximum amount of time to receive a message on an accepted stream, and to
+	// hand it to the upper layer.
+	quicRecvTimeout = 10 * time.Second
+)
+
+// Default values for QUICConfig.
+const (
+	DefaultQUICMaxMsgLen      = 1 << 20
+	DefaultQUICMaxStreamReads = 1 << 6
+	DefaultQUICMaxSessions    = 1 << 10
+)
+
+// QUICConfig customizes a QUIC transport. Zero values are replaced by the defaults in the
+// package constants.
+type QUICConfig struct {
+	// MaxMsgLen is the maximum length of a message, both for sending and receiving.
+	MaxMsgLen int
+	// MaxStreamReads bounds the number of messages that are received concurrently, and thus
+	// the memory used by incoming messages to MaxStreamReads * MaxMsgLen. Streams opened while
+	// the limit is reached are reset.
+	MaxStreamReads int
+	// MaxSessions bounds the number of sessions. Sessions accepted while the limit is reached
+	// are closed.
+	MaxSessions int
+}
+
+func (cfg *QUICConfig) setDefaults() {
+	if cfg.MaxMsgLen == 0 {
+		cfg.MaxMsgLen = DefaultQUICMaxMsgLen
+	}
+	if cfg.MaxStreamReads == 0 {
+		cfg.MaxStreamReads = DefaultQUICMaxStreamReads
+	}
+	if cfg.MaxSessions == 0 {
+		cfg.MaxSessions = DefaultQUICMaxSessions
+	}
+}
+
+var _ Transport = (*QUIC)(nil)
+
+// QUICDialFunc opens a QUIC session to a.
+type QUICDialFunc func(a net.Addr) (quic.Session, error)
+
+// QUIC implements a message-based transport on top of QUIC sessions.
+//
+// Each message is sent on its own stream. The sender writes the message and
+// closes its side of the stream, and the receiver closes its side once the
+// message was handed to the upper layer. SendMsgTo waits for this before
+// returning, SendUnreliableMsgTo returns as soon as the message is written.
+// Messages can be up to QUICConfig.MaxMsgLen long, 1 MiB by default.
+//
+// Sessions are reused for all messages to the same peer, in both directions:
+// sessions accepted from a peer are used to send messages to it as well. If a
+// session fails, it is discarded and the next message to the peer dials a new
+// one.
+//
+// QUIC can be safely used by concurrent goroutines.
+//
+// All methods receive a context argument. If the context is canceled prior to
+// completing work, ErrContextDone is returned. If the transport is closed,
+// running functions terminate with ErrClosed.
+type QUIC struct {
+	listener quic.Listener
+	dial     QUICDialFunc
+	cfg      QUICConfig
+	// Sessions by peer address, guarded by sessionsLock
+	sessions     map[string]quic.Session
+	sessionsLock sync.Mutex
+	// Channel for received messages, used between the stream goroutines and receivers
+	readEvents chan *readEventDesc
+	// Semaphore bounding the streams that are read concurrently
+	streamReads chan struct{}
+	// Closed when Close() starts to run
+	closedChan chan struct{}
+	// Closed when the accepting goroutine finishes shutting down
+	doneChan chan struct{}
+	log      log.Logger
+}
+
+// NewQUIC creates a new QUIC transport with the default configuration, that
+// accepts sessions on listener, and opens sessions to peers with dial.
+//
+// NewQUIC also spawns a background goroutine that accepts sessions and reads
+// messages from them.
+func NewQUIC(listener quic.Listener, dial QUICDialFunc, logger log.Logger) *QUIC {
+	return NewQUICWithConfig(listener, dial, nil, logger)
+}
+
+// NewQUICWithConfig is like NewQUIC, but customizes the transport with cfg. A
+// nil cfg uses the defaults.
+func NewQUICWithConfig(listener quic.Listener, dial QUICDialFunc, cfg *QUICConfig,
+	logger log.Logger) *QUIC {
+
+	t := &QUIC{
+		listener:   listener,
+		dial:       dial,
+		sessions:   make(map[string]quic.Session),
+		readEvents: make(chan *readEventDesc, maxReadEvents),
+		closedChan: make(chan struct{}),
+		doneChan:   make(chan struct{}),
+		log:        logger.New("id", logext.RandId(4), "goroutine", "quic_bck"),
+	}
+	if cfg != nil {
+		t.cfg = *cfg
+	}
+	t.cfg.setDefaults()
+	t.streamReads = make(chan struct{}, t.cfg.MaxStreamReads)
+	t.goBackgroundAcceptor()
+	return t
+}
+
+// NewSQUIC creates a new QUIC transport over SCION, listening on laddr in
+// network. Sessions to peers are dialed from laddr's host, on a port assigned
+// by the dispatcher. squic.Init must have been called before.
+func NewSQUIC(network *snet.Network, laddr *snet.Addr, logger log.Logger) (*QUIC, error) {
+	listener, err := squic.ListenSCION(network, laddr)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to listen on QUIC", err, "addr", laddr)
+	}
+	dial := func(a net.Addr) (quic.Session, error) {
+		raddr, ok := a.(*snet.Addr)
+		if !ok {
+			return nil, common.NewBasicError("Unable to dial non-SCION address", nil,
+				"addr", a)
+		}
+		return squic.DialSCION(network, &snet.Addr{IA: laddr.IA, Host: laddr.Host}, raddr)
+	}
+	return NewQUIC(listener, dial, logger), nil
+}
+
+// SendUnreliableMsgTo sends a message on a new stream and returns once it is
+// written, without waiting for the peer to receive it.
+func (t *QUIC) SendUnreliableMsgTo(ctx context.Context, b common.RawBytes, a net.Addr) error {
+	return t.sendMsg(ctx, b, a, false)
+}
+
+// SendMsgTo sends a message on a new stream and waits until the peer received
+// it.
+func (t *QUIC) SendMsgTo(ctx context.Context, b common.RawBytes, a net.Addr) error {
+	return t.sendMsg(ctx, b, a, true)
+}
+
+func (t *QUIC) sendMsg(ctx context.Context, b common.RawBytes, a net.Addr, wait bool) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return common.NewBasicError("Bad context, missing deadline", nil, "dst", a)
+	}
+	if len(b) > t.cfg.MaxMsgLen {
+		return common.NewBasicError("Unable to send, message too long", nil,
+			"msg_len", len(b), "max_allowed", t.cfg.MaxMsgLen)
+	}
+	session, err := t.session(ctx, a)
+	if err != nil {
+		return err
+	}
+	stream, err := session.OpenStream()
+	if err != nil {
+		// The session is most likely broken, dial a new one next time.
+		t.removeSession(a.String(), session)
+		return common.NewBasicError("Unable to open stream", err, "dst", a)
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		defer liblog.LogPanicAndExit()
+		errChan <- writeStream(stream, b, deadline, wait)
+	}()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			return common.NewBasicError("Unable to send message", err, "dst", a)
+		}
+		return nil
+	case <-ctx.Done():
+		// Unblock the writing goroutine
+		stream.Reset(ctx.Err())
+		return infra.NewCtxDoneError()
+	case <-t.closedChan:
+		err := common.NewBasicError(infra.StrClosedError, nil)
+		stream.Reset(err)
+		return err
+	}
+}
+
+// writeStream writes b to stream and closes the sending side. If wait is set,
+// it then waits until the peer closes the stream, too.
+func writeStream(stream quic.Stream, b common.RawBytes, deadline time.Time, wait bool) error {
+	if err := stream.SetDeadline(deadline); err != nil {
+		return err
+	}
+	if _, err := stream.Write(b); err != nil {
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	if !wait {
+		return nil
+	}
+	// The peer does not send any data, reading returns once it closes the stream.
+	_, err := io.Copy(ioutil.Discard, stream)
+	return err
+}
+
+// session returns the session to a, dialing a new one if necessary.
+func (t *QUIC) session(ctx context.Context, a net.Addr) (quic.Session, error) {
+	key := a.String()
+	t.sessionsLock.Lock()
+	session, ok := t.sessions[key]
+	t.sessionsLock.Unlock()
+	if ok {
+		return session, nil
+	}
+	type dialResult struct {
+		session quic.Session
+		err     error
+	}
+	resultChan := make(chan dialResult, 1)
+	go func() {
+		defer liblog.LogPanicAndExit()
+		session, err := t.dial(a)
+		if err == nil {
+			// Even if the caller gave up, the session is kept for later messages.
+			session = t.addSession(key, session)
+		}
+		resultChan <- dialResult{session: session, err: err}
+	}()
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return nil, common.NewBasicError("Unable to dial QUIC session", result.err,
+				"dst", a)
+		}
+		return result.session, nil
+	case <-ctx.Done():
+		return nil, infra.NewCtxDoneError()
+	case <-t.closedChan:
+		return nil, common.NewBasicError(infra.StrClosedError, nil)
+	}
+}
+
+// addSession stores the dialed session as the session to peer key and starts
+// reading messages from it. If there is a session to the peer already, session
+// is closed and the existing session is returned instead.
+func (t *QUIC) addSession(key string, session quic.Session) quic.Session {
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+	select {
+	case <-t.closedChan:
+		// Do not leak sessions dialed while closing.
+		session.Close(nil)
+		return session
+	default:
+	}
+	if existing, ok := t.sessions[key]; ok {
+		session.Close(nil)
+		return existing
+	}
+	t.sessions[key] = session
+	t.goServeSession(key, session)
+	return session
+}
+
+// addAcceptedSession stores the accepted session as the session to peer key and
+// starts reading messages from it. If there is a session to the peer already,
+// the session limit is reached, or the transport is closing, the accepted
+// session is closed, so that it is not leaked past Close.
+func (t *QUIC) addAcceptedSession(key string, session quic.Session) {
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+	select {
+	case <-t.closedChan:
+		session.Close(nil)
+		return
+	default:
+	}
+	if _, ok := t.sessions[key]; ok {
+		t.log.Debug("Closing duplicate session", "peer", key)
+		session.Close(nil)
+		return
+	}
+	if len(t.sessions) >= t.cfg.MaxSessions {
+		t.log.Warn("Session limit reached, closing accepted session", "peer", key,
+			"max", t.cfg.MaxSessions)
+		session.Close(nil)
+		return
+	}
+	t.sessions[key] = session
+	t.goServeSession(key, session)
+}
+
+// removeSession removes session, if it is the session to peer key.
+func (t *QUIC) removeSession(key string, session quic.Session) {
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+	if t.sessions[key] == session {
+		delete(t.sessions, key)
+	}
+}
+
+// goBackgroundAcceptor accepts sessions from peers until the listener is
+// closed.
+func (t *QUIC) goBackgroundAcceptor() {
+	go func() {
+		defer liblog.LogPanicAndExit()
+		t.log.Info("Started")
+		defer t.log.Info("Stopped")
+		defer close(t.doneChan)
+		for {
+			session, err := t.listener.Accept()
+			if err != nil {
+				select {
+				case <-t.closedChan:
+				default:
+					t.log.Error("Accept error, shutting down", "err", err)
+				}
+				return
+			}
+			t.addAcceptedSession(session.RemoteAddr().String(), session)
+		}
+	}()
+}
+
+// goServeSession reads messages from the streams opened by the peer, until the
+// session fails.
+func (t *QUIC) goServeSession(key string, session quic.Session) {
+	go func() {
+		defer liblog.LogPanicAndExit()
+		defer t.removeSession(key, session)
+		for {
+			stream, err := session.AcceptStream()
+			if err != nil {
+				t.log.Debug("Session closed", "peer", key, "err", err)
+				return
+			}
+			select {
+			case t.streamReads <- struct{}{}:
+			default:
+				t.log.Warn("Too many concurrent messages, dropped message", "peer", key)
+				stream.Reset(common.NewBasicError("Too many concurrent messages", nil))
+				continue
+			}
+			go func() {
+				defer liblog.LogPanicAndExit()
+				defer func() { <-t.streamReads }()
+				t.handleStream(stream, session.RemoteAddr())
+			}()
+		}
+	}()
+}
+
+// handleStream reads a message from stream and passes it to the upper layer.
+// The stream is closed once the upper layer has the message, or reset if the
+// message could not be received.
+func (t *QUIC) handleStream(stream quic.Stream, address net.Addr) {
+	deadline := time.Now().Add(quicRecvTimeout)
+	if err := stream.SetReadDeadline(deadline); err != nil {
+		stream.Reset(err)
+		return
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(stream, int64(t.cfg.MaxMsgLen)+1))
+	if err != nil {
+		t.log.Warn("Unable to read message", "peer", address, "err", err)
+		stream.Reset(err)
+		return
+	}
+	if len(b) > t.cfg.MaxMsgLen {
+		t.log.Warn("Message too long, dropped", "peer", address)
+		stream.Reset(common.NewBasicError("Message too long", nil))
+		return
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case t.readEvents <- &readEventDesc{msg: b, address: address}:
+		// The message was received, signal this to the sender
+		stream.Close()
+	case <-timer.C:
+		t.log.Warn("Internal queue full, dropped message", "peer", address,
+			"msg_len", len(b))
+		stream.Reset(common.NewBasicError("Receive queue full", nil))
+	case <-t.closedChan:
+		stream.Reset(common.NewBasicError(infra.StrClosedError, nil))
+	}
+}
+
+// RecvFrom returns the next message received on any session.
+func (t *QUIC) RecvFrom(ctx context.Context) (common.RawBytes, net.Addr, error) {
+	select {
+	case event := <-t.readEvents:
+		return event.msg, event.address, nil
+	case <-ctx.Done():
+		return nil, nil, infra.NewCtxDoneError()
+	case <-t.closedChan:
+		return nil, nil, common.NewBasicError(infra.StrClosedError, nil)
+	}
+}
+
+// Close closes the listener and all sessions. If Close blocks for too long
+// while waiting for the background goroutine to terminate, it returns
+// ErrContextDone.
+func (t *QUIC) Close(ctx context.Context) error {
+	t.sessionsLock.Lock()
+	close(t.closedChan)
+	for key, session := range t.sessions {
+		session.Close(nil)
+		delete(t.sessions, key)
+	}
+	t.sessionsLock.Unlock()
+	if err := t.listener.Close(); err != nil {
+		return common.NewBasicError("Unable to close listener", err)
+	}
+	select {
+	case <-ctx.Done():
+		return infra.NewCtxDoneError()
+	case <-t.doneChan:
+		return nil
+	}
+}
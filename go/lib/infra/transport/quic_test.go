@@ -0,0 +1,310 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/lucas-clemente/quic-go"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+func TestQUIC(t *testing.T) {
+	Convey("Given two QUIC transports", t, func() {
+		mn := newMemNet()
+		defer mn.close()
+		a := NewQUIC(mn.listen("a"), mn.dialFrom("a"), log.Root())
+		b := NewQUIC(mn.listen("b"), mn.dialFrom("b"), log.Root())
+		ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancelF()
+
+		Convey("A reliable message is received, and the reply reuses the session", func() {
+			msg := make(common.RawBytes, 100000)
+			msg[len(msg)-1] = 1
+			err := a.SendMsgTo(ctx, msg, memAddr("b"))
+			SoMsg("send err", err, ShouldBeNil)
+			recvMsg, from, err := b.RecvFrom(ctx)
+			SoMsg("recv err", err, ShouldBeNil)
+			SoMsg("msg", recvMsg, ShouldResemble, msg)
+			SoMsg("from", from, ShouldResemble, memAddr("a"))
+
+			err = b.SendUnreliableMsgTo(ctx, common.RawBytes("reply"), from)
+			SoMsg("reply err", err, ShouldBeNil)
+			recvMsg, _, err = a.RecvFrom(ctx)
+			SoMsg("reply recv err", err, ShouldBeNil)
+			SoMsg("reply", recvMsg, ShouldResemble, common.RawBytes("reply"))
+			SoMsg("dials", mn.dials(), ShouldEqual, 1)
+		})
+		Convey("A failed session is replaced", func() {
+			err := a.SendMsgTo(ctx, common.RawBytes("1"), memAddr("b"))
+			SoMsg("first send err", err, ShouldBeNil)
+			mn.closeSessions()
+			err = a.SendMsgTo(ctx, common.RawBytes("2"), memAddr("b"))
+			// The first attempt may still use the failed session.
+			if err != nil {
+				err = a.SendMsgTo(ctx, common.RawBytes("2"), memAddr("b"))
+			}
+			SoMsg("second send err", err, ShouldBeNil)
+			SoMsg("dials", mn.dials(), ShouldEqual, 2)
+		})
+		Convey("A session accepted from a peer with a session already is closed", func() {
+			err := a.SendMsgTo(ctx, common.RawBytes("1"), memAddr("b"))
+			SoMsg("first send err", err, ShouldBeNil)
+			dup, err := mn.dialFrom("b")(memAddr("a"))
+			SoMsg("dial err", err, ShouldBeNil)
+			select {
+			case <-dup.Context().Done():
+			case <-ctx.Done():
+			}
+			SoMsg("closed", dup.Context().Err(), ShouldNotBeNil)
+			err = a.SendMsgTo(ctx, common.RawBytes("2"), memAddr("b"))
+			SoMsg("second send err", err, ShouldBeNil)
+			// The first send and the duplicate dialed, the second send reused the session.
+			SoMsg("dials", mn.dials(), ShouldEqual, 2)
+		})
+		Convey("Sending times out if the message is not received", func() {
+			shortCtx, cancelF := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancelF()
+			err := a.SendMsgTo(shortCtx, common.RawBytes("1"), memAddr("nowhere"))
+			SoMsg("err", common.IsTimeoutErr(err), ShouldBeTrue)
+		})
+
+		SoMsg("close a", a.Close(ctx), ShouldBeNil)
+		SoMsg("close b", b.Close(ctx), ShouldBeNil)
+	})
+	Convey("Given a QUIC transport with limits", t, func() {
+		mn := newMemNet()
+		defer mn.close()
+		a := NewQUIC(mn.listen("a"), mn.dialFrom("a"), log.Root())
+		b := NewQUICWithConfig(mn.listen("b"), mn.dialFrom("b"),
+			&QUICConfig{MaxMsgLen: 10, MaxSessions: 1}, log.Root())
+		ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancelF()
+
+		Convey("Long messages are neither sent nor received", func() {
+			err := b.SendMsgTo(ctx, make(common.RawBytes, 11), memAddr("a"))
+			SoMsg("send err", err, ShouldNotBeNil)
+			SoMsg("dials", mn.dials(), ShouldEqual, 0)
+			err = a.SendMsgTo(ctx, make(common.RawBytes, 11), memAddr("b"))
+			SoMsg("recv err", err, ShouldNotBeNil)
+			err = a.SendMsgTo(ctx, make(common.RawBytes, 10), memAddr("b"))
+			SoMsg("short err", err, ShouldBeNil)
+		})
+		Convey("Sessions accepted beyond the limit are closed", func() {
+			err := a.SendMsgTo(ctx, common.RawBytes("1"), memAddr("b"))
+			SoMsg("send err", err, ShouldBeNil)
+			other, err := mn.dialFrom("x")(memAddr("b"))
+			SoMsg("dial err", err, ShouldBeNil)
+			select {
+			case <-other.Context().Done():
+			case <-ctx.Done():
+			}
+			SoMsg("closed", other.Context().Err(), ShouldNotBeNil)
+		})
+		Convey("Streams opened beyond the read limit are reset", func() {
+			c := NewQUICWithConfig(mn.listen("c"), mn.dialFrom("c"),
+				&QUICConfig{MaxStreamReads: 1}, log.Root())
+			defer c.Close(ctx)
+			session, err := mn.dialFrom("x")(memAddr("c"))
+			SoMsg("dial err", err, ShouldBeNil)
+			held, err := session.OpenStream()
+			SoMsg("open err", err, ShouldBeNil)
+			_, err = held.Write(common.RawBytes("1"))
+			SoMsg("write err", err, ShouldBeNil)
+			stream, err := session.OpenStream()
+			SoMsg("second open err", err, ShouldBeNil)
+			_, err = stream.Write(common.RawBytes("2"))
+			SoMsg("reset", err, ShouldNotBeNil)
+			SoMsg("close held", held.Close(), ShouldBeNil)
+			recvMsg, _, err := c.RecvFrom(ctx)
+			SoMsg("recv err", err, ShouldBeNil)
+			SoMsg("msg", recvMsg, ShouldResemble, common.RawBytes("1"))
+		})
+
+		SoMsg("close a", a.Close(ctx), ShouldBeNil)
+		SoMsg("close b", b.Close(ctx), ShouldBeNil)
+	})
+}
+
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+// memNet connects in-memory QUIC sessions. Dials to unknown addresses block
+// until the memNet is closed.
+type memNet struct {
+	sync.Mutex
+	closed    chan struct{}
+	listeners map[string]*memListener
+	sessions  []*memSession
+	numDials  int
+}
+
+func newMemNet() *memNet {
+	return &memNet{closed: make(chan struct{}), listeners: make(map[string]*memListener)}
+}
+
+func (n *memNet) close() {
+	close(n.closed)
+}
+
+func (n *memNet) listen(name string) *memListener {
+	n.Lock()
+	defer n.Unlock()
+	l := &memListener{addr: memAddr(name), sessions: make(chan quic.Session, 16),
+		closed: make(chan struct{})}
+	n.listeners[name] = l
+	return l
+}
+
+func (n *memNet) dialFrom(name string) QUICDialFunc {
+	return func(a net.Addr) (quic.Session, error) {
+		n.Lock()
+		n.numDials++
+		l, ok := n.listeners[a.String()]
+		n.Unlock()
+		if !ok {
+			<-n.closed
+			return nil, io.EOF
+		}
+		client, server := newMemSessionPair(memAddr(name), memAddr(a.String()))
+		n.Lock()
+		n.sessions = append(n.sessions, client, server)
+		n.Unlock()
+		l.sessions <- server
+		return client, nil
+	}
+}
+
+func (n *memNet) dials() int {
+	n.Lock()
+	defer n.Unlock()
+	return n.numDials
+}
+
+func (n *memNet) closeSessions() {
+	n.Lock()
+	defer n.Unlock()
+	for _, s := range n.sessions {
+		s.Close(nil)
+	}
+}
+
+type memListener struct {
+	addr      memAddr
+	sessions  chan quic.Session
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (l *memListener) Accept() (quic.Session, error) {
+	select {
+	case s := <-l.sessions:
+		return s, nil
+	case <-l.closed:
+		return nil, io.EOF
+	}
+}
+
+func (l *memListener) Addr() net.Addr { return l.addr }
+
+func (l *memListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+type memSession struct {
+	local, remote memAddr
+	peer          *memSession
+	streams       chan quic.Stream
+	ctx           context.Context
+	cancelF       context.CancelFunc
+}
+
+func newMemSessionPair(local, remote memAddr) (*memSession, *memSession) {
+	newSession := func(local, remote memAddr) *memSession {
+		ctx, cancelF := context.WithCancel(context.Background())
+		return &memSession{local: local, remote: remote, streams: make(chan quic.Stream, 16),
+			ctx: ctx, cancelF: cancelF}
+	}
+	a, b := newSession(local, remote), newSession(remote, local)
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (s *memSession) AcceptStream() (quic.Stream, error) {
+	select {
+	case stream := <-s.streams:
+		return stream, nil
+	case <-s.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+func (s *memSession) OpenStream() (quic.Stream, error) {
+	if s.ctx.Err() != nil || s.peer.ctx.Err() != nil {
+		return nil, io.EOF
+	}
+	local, remote := newMemStreamPair()
+	s.peer.streams <- remote
+	return local, nil
+}
+
+func (s *memSession) OpenStreamSync() (quic.Stream, error) { return s.OpenStream() }
+func (s *memSession) LocalAddr() net.Addr                  { return s.local }
+func (s *memSession) RemoteAddr() net.Addr                 { return s.remote }
+func (s *memSession) Context() context.Context             { return s.ctx }
+
+func (s *memSession) Close(error) error {
+	s.cancelF()
+	s.peer.cancelF()
+	return nil
+}
+
+// memStream is one end of a bidirectional stream made of two pipes.
+type memStream struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newMemStreamPair() (*memStream, *memStream) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	return &memStream{r: r1, w: w2}, &memStream{r: r2, w: w1}
+}
+
+func (s *memStream) Read(b []byte) (int, error)  { return s.r.Read(b) }
+func (s *memStream) Write(b []byte) (int, error) { return s.w.Write(b) }
+func (s *memStream) Close() error                { return s.w.Close() }
+func (s *memStream) StreamID() quic.StreamID     { return 0 }
+func (s *memStream) Context() context.Context    { return context.Background() }
+
+func (s *memStream) Reset(err error) {
+	s.r.CloseWithError(err)
+	s.w.CloseWithError(err)
+}
+
+func (s *memStream) SetReadDeadline(t time.Time) error  { return nil }
+func (s *memStream) SetWriteDeadline(t time.Time) error { return nil }
+func (s *memStream) SetDeadline(t time.Time) error      { return nil }
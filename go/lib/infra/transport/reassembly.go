@@ -0,0 +1,189 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+const (
+	// expireInterval is the minimum interval between two scans for expired messages.
+	expireInterval = time.Second
+	// fragSliceSize is the memory used per fragment of a message under reassembly, before the
+	// fragment is received.
+	fragSliceSize = int(unsafe.Sizeof(common.RawBytes(nil)))
+)
+
+// fragStatus is the outcome of adding a fragment to the reassembler.
+type fragStatus int
+
+const (
+	// fragStored means that the fragment was buffered.
+	fragStored fragStatus = iota
+	// fragDuplicate means that the fragment was received before.
+	fragDuplicate
+	// fragComplete means that the fragment completed its message.
+	fragComplete
+	// fragDropped means that the fragment was discarded.
+	fragDropped
+)
+
+// fragKey identifies a fragmented message.
+type fragKey struct {
+	peer string
+	id   uint56
+}
+
+// partialMsg is a message under reassembly.
+type partialMsg struct {
+	frags   []common.RawBytes
+	have    int
+	size    int
+	created time.Time
+	metrics *peerMetrics
+}
+
+// reassembler buffers fragments until their messages are complete. The buffered bytes,
+// including the fragment lists of the messages, are bounded, and incomplete messages are
+// discarded after a timeout. Completed messages are
+// remembered for the same timeout, so that retransmitted fragments are acknowledged again
+// instead of starting a new message.
+//
+// reassembler is not safe for concurrent use.
+type reassembler struct {
+	maxMsgLen int
+	// maxFrags is the number of fragments of a message of maximum length.
+	maxFrags int
+	maxBytes int
+	timeout  time.Duration
+	bytes    int
+	// lastExpire is the time expired messages were last discarded.
+	lastExpire time.Time
+	partial    map[fragKey]*partialMsg
+	completed  map[fragKey]time.Time
+}
+
+func newReassembler(cfg *RUDPConfig) *reassembler {
+	fragLen := cfg.fragLen()
+	return &reassembler{
+		maxMsgLen: cfg.MaxMsgLen,
+		maxFrags:  (cfg.MaxMsgLen + fragLen - 1) / fragLen,
+		maxBytes:  cfg.MaxReassemblyBytes,
+		timeout:   cfg.ReassemblyTimeout,
+		partial:   make(map[fragKey]*partialMsg),
+		completed: make(map[fragKey]time.Time),
+	}
+}
+
+// add buffers fragment index of count fragments of message key. If the fragment completes the
+// message, the message is returned. The caller has to call either done, after delivering the
+// message, or undo, to discard the fragment again.
+func (r *reassembler) add(key fragKey, index, count int, b common.RawBytes,
+	m *peerMetrics) (fragStatus, common.RawBytes) {
+
+	now := time.Now()
+	if now.Sub(r.lastExpire) > expireInterval {
+		r.expire(now)
+	}
+	if _, ok := r.completed[key]; ok {
+		return fragDuplicate, nil
+	}
+	if index >= count || count > r.maxFrags {
+		m.addFragsDropped(1)
+		return fragDropped, nil
+	}
+	msg, ok := r.partial[key]
+	if !ok {
+		if r.bytes+count*fragSliceSize+len(b) > r.maxBytes {
+			m.addFragsDropped(1)
+			return fragDropped, nil
+		}
+		msg = &partialMsg{frags: make([]common.RawBytes, count), created: now, metrics: m}
+		r.partial[key] = msg
+		r.bytes += count * fragSliceSize
+	}
+	switch {
+	case count != len(msg.frags):
+		m.addFragsDropped(1)
+		return fragDropped, nil
+	case msg.frags[index] != nil:
+		return fragDuplicate, nil
+	case msg.size+len(b) > r.maxMsgLen:
+		// The message can never be completed, discard it.
+		r.remove(key)
+		m.addFragsDropped(msg.have + 1)
+		return fragDropped, nil
+	case r.bytes+len(b) > r.maxBytes:
+		m.addFragsDropped(1)
+		return fragDropped, nil
+	}
+	msg.frags[index] = append(common.RawBytes(nil), b...)
+	msg.have++
+	msg.size += len(b)
+	r.bytes += len(b)
+	if msg.have < count {
+		return fragStored, nil
+	}
+	full := make(common.RawBytes, 0, msg.size)
+	for _, frag := range msg.frags {
+		full = append(full, frag...)
+	}
+	return fragComplete, full
+}
+
+// done marks the completed message key as delivered.
+func (r *reassembler) done(key fragKey) {
+	r.remove(key)
+	r.completed[key] = time.Now().Add(r.timeout)
+}
+
+// undo discards fragment index of message key, after its message could not be delivered.
+func (r *reassembler) undo(key fragKey, index int) {
+	msg, ok := r.partial[key]
+	if !ok || msg.frags[index] == nil {
+		return
+	}
+	r.bytes -= len(msg.frags[index])
+	msg.size -= len(msg.frags[index])
+	msg.frags[index] = nil
+	msg.have--
+}
+
+func (r *reassembler) remove(key fragKey) {
+	if msg, ok := r.partial[key]; ok {
+		r.bytes -= msg.size + len(msg.frags)*fragSliceSize
+		delete(r.partial, key)
+	}
+}
+
+// expire discards incomplete messages older than the timeout, and forgets completed messages
+// after the timeout.
+func (r *reassembler) expire(now time.Time) {
+	r.lastExpire = now
+	for key, msg := range r.partial {
+		if now.Sub(msg.created) > r.timeout {
+			msg.metrics.addFragsDropped(msg.have)
+			r.remove(key)
+		}
+	}
+	for key, expiry := range r.completed {
+		if now.After(expiry) {
+			delete(r.completed, key)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+func TestReassembler(t *testing.T) {
+	Convey("Given a reassembler", t, func() {
+		// Fragments carry 4 bytes, messages have at most 2 fragments.
+		r := newReassembler(&RUDPConfig{MaxDatagramLen: rudpHdrLen + rudpFragHdrLen + 4,
+			MaxMsgLen: 8, MaxReassemblyBytes: 2*fragSliceSize + 10,
+			ReassemblyTimeout: time.Minute})
+		key := fragKey{peer: "a", id: 1}
+		Convey("Fragments are reassembled in any order", func() {
+			status, _ := r.add(key, 1, 2, common.RawBytes("cd"), nil)
+			SoMsg("first", status, ShouldEqual, fragStored)
+			status, _ = r.add(key, 1, 2, common.RawBytes("cd"), nil)
+			SoMsg("duplicate", status, ShouldEqual, fragDuplicate)
+			status, msg := r.add(key, 0, 2, common.RawBytes("ab"), nil)
+			SoMsg("last", status, ShouldEqual, fragComplete)
+			SoMsg("msg", msg, ShouldResemble, common.RawBytes("abcd"))
+			r.done(key)
+			SoMsg("bytes", r.bytes, ShouldEqual, 0)
+			status, _ = r.add(key, 0, 2, common.RawBytes("ab"), nil)
+			SoMsg("after done", status, ShouldEqual, fragDuplicate)
+		})
+		Convey("An undone fragment can be added again", func() {
+			r.add(key, 0, 2, common.RawBytes("ab"), nil)
+			status, _ := r.add(key, 1, 2, common.RawBytes("cd"), nil)
+			SoMsg("complete", status, ShouldEqual, fragComplete)
+			r.undo(key, 1)
+			status, _ = r.add(key, 1, 2, common.RawBytes("cd"), nil)
+			SoMsg("again", status, ShouldEqual, fragComplete)
+		})
+		Convey("Invalid fragments are dropped", func() {
+			status, _ := r.add(key, 2, 2, common.RawBytes("ab"), nil)
+			SoMsg("index", status, ShouldEqual, fragDropped)
+			r.add(key, 0, 2, common.RawBytes("ab"), nil)
+			status, _ = r.add(key, 1, 3, common.RawBytes("cd"), nil)
+			SoMsg("count", status, ShouldEqual, fragDropped)
+		})
+		Convey("Fragments of messages with too many fragments are dropped", func() {
+			status, _ := r.add(key, 0, 3, common.RawBytes("ab"), nil)
+			SoMsg("status", status, ShouldEqual, fragDropped)
+			SoMsg("partial", len(r.partial), ShouldEqual, 0)
+			SoMsg("bytes", r.bytes, ShouldEqual, 0)
+		})
+		Convey("The fragment list of a message is charged to the buffer", func() {
+			r.add(key, 0, 2, common.RawBytes("ab"), nil)
+			SoMsg("bytes", r.bytes, ShouldEqual, 2*fragSliceSize+2)
+		})
+		Convey("Messages longer than the maximum are discarded", func() {
+			r.add(key, 0, 2, common.RawBytes("abcd"), nil)
+			status, _ := r.add(key, 1, 2, common.RawBytes("efghi"), nil)
+			SoMsg("status", status, ShouldEqual, fragDropped)
+			SoMsg("bytes", r.bytes, ShouldEqual, 0)
+		})
+		Convey("Fragments beyond the buffer limit are dropped", func() {
+			r.add(key, 0, 2, common.RawBytes("abcdefgh"), nil)
+			status, _ := r.add(fragKey{peer: "b", id: 1}, 0, 2, common.RawBytes("abc"), nil)
+			SoMsg("status", status, ShouldEqual, fragDropped)
+			SoMsg("partial", len(r.partial), ShouldEqual, 1)
+		})
+		Convey("Incomplete messages expire", func() {
+			r.add(key, 0, 2, common.RawBytes("ab"), nil)
+			r.expire(time.Now().Add(2 * time.Minute))
+			SoMsg("bytes", r.bytes, ShouldEqual, 0)
+			SoMsg("partial", len(r.partial), ShouldEqual, 0)
+		})
+	})
+}
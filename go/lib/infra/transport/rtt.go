@@ -0,0 +1,232 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// rttGranularity is the minimum variance term of the retransmission timeout.
+	rttGranularity = 10 * time.Millisecond
+	// peerIdleTimeout is the time after which the state of a peer without traffic is
+	// discarded.
+	peerIdleTimeout = 10 * time.Minute
+)
+
+// rttEstimator computes retransmission timeouts from round-trip time samples, as described
+// in RFC 6298. It is safe for concurrent use.
+type rttEstimator struct {
+	sync.Mutex
+	srtt      time.Duration
+	rttvar    time.Duration
+	rto       time.Duration
+	minRTO    time.Duration
+	maxRTO    time.Duration
+	hasSample bool
+}
+
+func newRTTEstimator(initialRTO, minRTO, maxRTO time.Duration) *rttEstimator {
+	return &rttEstimator{rto: initialRTO, minRTO: minRTO, maxRTO: maxRTO}
+}
+
+// RTO returns the current retransmission timeout.
+func (e *rttEstimator) RTO() time.Duration {
+	e.Lock()
+	defer e.Unlock()
+	return e.rto
+}
+
+// SRTT returns the smoothed round-trip time, or 0 if there were no samples yet.
+func (e *rttEstimator) SRTT() time.Duration {
+	e.Lock()
+	defer e.Unlock()
+	return e.srtt
+}
+
+// Sample updates the estimate with the round-trip time rtt of a message that was not
+// retransmitted, and recomputes the retransmission timeout. This resets any backoff.
+func (e *rttEstimator) Sample(rtt time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+	if !e.hasSample {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.hasSample = true
+	} else {
+		delta := e.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar = (3*e.rttvar + delta) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+	variance := 4 * e.rttvar
+	if variance < rttGranularity {
+		variance = rttGranularity
+	}
+	e.rto = e.clamp(e.srtt + variance)
+}
+
+// Backoff doubles the retransmission timeout, after a retransmission timer expired.
+func (e *rttEstimator) Backoff() {
+	e.Lock()
+	defer e.Unlock()
+	e.rto = e.clamp(2 * e.rto)
+}
+
+func (e *rttEstimator) clamp(rto time.Duration) time.Duration {
+	if rto < e.minRTO {
+		return e.minRTO
+	}
+	if rto > e.maxRTO {
+		return e.maxRTO
+	}
+	return rto
+}
+
+// peer is the state kept for a remote host.
+type peer struct {
+	*rttEstimator
+	metrics *peerMetrics
+	// key is the key in the peer table. It is empty, if the state is not stored in the table.
+	key string
+	// lastUsed is guarded by the lock of the peer table.
+	lastUsed time.Time
+}
+
+// Sample updates the RTT estimate with rtt.
+func (p *peer) Sample(rtt time.Duration) {
+	p.rttEstimator.Sample(rtt)
+	p.metrics.setRTT(p.SRTT(), p.RTO())
+}
+
+// Backoff backs off the retransmission timeout.
+func (p *peer) Backoff() {
+	p.rttEstimator.Backoff()
+	p.metrics.setRTT(p.SRTT(), p.RTO())
+}
+
+// peerKey returns the key of the host of a. The port is not part of the key, such that all
+// sockets of a host share their state.
+func peerKey(a net.Addr) string {
+	switch v := a.(type) {
+	case *snet.Addr:
+		return fmt.Sprintf("%s,[%s]", v.IA, v.Host)
+	case *net.UDPAddr:
+		return v.IP.String()
+	}
+	return a.String()
+}
+
+// peerTable maps remote hosts to their state. State is only created for hosts that acknowledged
+// a message, such that unsolicited traffic cannot fill the table. The table holds at most
+// cfg.MaxPeers entries, the least recently used peer is evicted first. Peers without traffic for
+// peerIdleTimeout are removed. It is safe for concurrent use.
+type peerTable struct {
+	sync.Mutex
+	cfg   *RUDPConfig
+	peers map[string]*list.Element
+	// lru orders the peers by last use, the most recently used peer is at the front.
+	lru *list.List
+}
+
+func newPeerTable(cfg *RUDPConfig) *peerTable {
+	return &peerTable{cfg: cfg, peers: make(map[string]*list.Element), lru: list.New()}
+}
+
+// find returns the state of the host of a, or nil if there is none.
+func (t *peerTable) find(a net.Addr) *peer {
+	t.Lock()
+	defer t.Unlock()
+	return t.touch(peerKey(a))
+}
+
+// lookup returns the state of the host of a. If there is none, it returns new state that is not
+// stored in the table and has no metrics.
+func (t *peerTable) lookup(a net.Addr) *peer {
+	if p := t.find(a); p != nil {
+		return p
+	}
+	return t.newPeer("", nil)
+}
+
+// get returns the state of the host of a, creating it if necessary. It must only be called once
+// the host acknowledged a message.
+func (t *peerTable) get(a net.Addr) *peer {
+	t.Lock()
+	defer t.Unlock()
+	key := peerKey(a)
+	if p := t.touch(key); p != nil {
+		return p
+	}
+	now := time.Now()
+	t.expire(now)
+	for t.lru.Len() >= t.cfg.MaxPeers {
+		t.remove(t.lru.Back())
+	}
+	p := t.newPeer(key, newPeerMetrics(key))
+	p.lastUsed = now
+	t.peers[key] = t.lru.PushFront(p)
+	return p
+}
+
+// touch marks the peer with key as used and returns it, or nil if there is none.
+func (t *peerTable) touch(key string) *peer {
+	e, ok := t.peers[key]
+	if !ok {
+		return nil
+	}
+	t.lru.MoveToFront(e)
+	p := e.Value.(*peer)
+	p.lastUsed = time.Now()
+	return p
+}
+
+func (t *peerTable) newPeer(key string, m *peerMetrics) *peer {
+	return &peer{
+		rttEstimator: newRTTEstimator(t.cfg.InitialRTO, t.cfg.MinRTO, t.cfg.MaxRTO),
+		metrics:      m,
+		key:          key,
+	}
+}
+
+func (t *peerTable) expire(now time.Time) {
+	for e := t.lru.Back(); e != nil; e = t.lru.Back() {
+		if now.Sub(e.Value.(*peer).lastUsed) <= peerIdleTimeout {
+			return
+		}
+		t.remove(e)
+	}
+}
+
+func (t *peerTable) remove(e *list.Element) {
+	p := t.lru.Remove(e).(*peer)
+	p.metrics.delete()
+	delete(t.peers, p.key)
+}
+
+// len returns the number of peers in the table.
+func (t *peerTable) len() int {
+	t.Lock()
+	defer t.Unlock()
+	return t.lru.Len()
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	Convey("Given an estimator without samples", t, func() {
+		e := newRTTEstimator(time.Second, 100*time.Millisecond, 4*time.Second)
+		SoMsg("initial rto", e.RTO(), ShouldEqual, time.Second)
+		Convey("The first sample sets the RTO to three times the RTT", func() {
+			e.Sample(100 * time.Millisecond)
+			SoMsg("srtt", e.SRTT(), ShouldEqual, 100*time.Millisecond)
+			SoMsg("rto", e.RTO(), ShouldEqual, 300*time.Millisecond)
+			Convey("Later samples are smoothed", func() {
+				e.Sample(100 * time.Millisecond)
+				SoMsg("srtt", e.SRTT(), ShouldEqual, 100*time.Millisecond)
+				SoMsg("rto", e.RTO(), ShouldEqual, 250*time.Millisecond)
+			})
+		})
+		Convey("Backoff doubles the RTO up to the maximum", func() {
+			e.Backoff()
+			SoMsg("rto", e.RTO(), ShouldEqual, 2*time.Second)
+			e.Backoff()
+			e.Backoff()
+			SoMsg("max rto", e.RTO(), ShouldEqual, 4*time.Second)
+		})
+		Convey("The RTO is at least the minimum", func() {
+			e.Sample(time.Millisecond)
+			SoMsg("rto", e.RTO(), ShouldEqual, 100*time.Millisecond)
+		})
+	})
+}
+
+func TestPeerTable(t *testing.T) {
+	Convey("Given a peer table with room for two peers", t, func() {
+		cfg := &RUDPConfig{MaxPeers: 2}
+		cfg.setDefaults()
+		pt := newPeerTable(cfg)
+		udpAddr := func(ip byte, port int) net.Addr {
+			return &net.UDPAddr{IP: net.IPv4(127, 0, 0, ip), Port: port}
+		}
+		Convey("Looking up unknown peers does not create state", func() {
+			p := pt.lookup(udpAddr(1, 1))
+			SoMsg("rto", p.RTO(), ShouldEqual, DefaultInitialRTO)
+			SoMsg("stored", pt.find(udpAddr(1, 1)), ShouldBeNil)
+			SoMsg("len", pt.len(), ShouldEqual, 0)
+		})
+		Convey("Peers are keyed by host, without port", func() {
+			p := pt.get(udpAddr(1, 1))
+			SoMsg("same host", pt.get(udpAddr(1, 2)), ShouldEqual, p)
+			SoMsg("lookup", pt.lookup(udpAddr(1, 3)), ShouldEqual, p)
+			SoMsg("other host", pt.get(udpAddr(2, 1)), ShouldNotEqual, p)
+			ia := &addr.ISD_AS{I: 1, A: 10}
+			host := addr.HostFromIP(net.IPv4(127, 0, 0, 1))
+			sp := pt.get(&snet.Addr{IA: ia, Host: host, L4Port: 1})
+			SoMsg("scion", pt.find(&snet.Addr{IA: ia, Host: host, L4Port: 2}), ShouldEqual, sp)
+		})
+		Convey("The least recently used peer is evicted", func() {
+			p1 := pt.get(udpAddr(1, 1))
+			pt.get(udpAddr(2, 1))
+			SoMsg("touch", pt.lookup(udpAddr(1, 1)), ShouldEqual, p1)
+			pt.get(udpAddr(3, 1))
+			SoMsg("len", pt.len(), ShouldEqual, 2)
+			SoMsg("recent", pt.find(udpAddr(1, 1)), ShouldEqual, p1)
+			SoMsg("evicted", pt.find(udpAddr(2, 1)), ShouldBeNil)
+		})
+	})
+}
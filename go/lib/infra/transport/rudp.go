@@ -46,18 +46,34 @@ const (
 	flagNeedACK = rudpFlag(0x01)
 	// Included in ACKs.
 	flagACK = rudpFlag(0x02)
+	// Included in fragments of messages, and in ACKs for them.
+	flagFragment = rudpFlag(0x04)
 	// Size of RUDP header.
 	rudpHdrLen = 8
+	// Size of the fragment header, following the RUDP header if flagFragment is set.
+	rudpFragHdrLen = 4
 	// Maximum amount of time to try and put an ACK on the network
 	rudpACKTimeout = 2 * time.Second
-	// If no ACK is received, senders will resend the message every
-	// rudpRetryTimeout seconds for as long as the context is not canceled.
-	rudpRetryTimeout = 2 * time.Second
+)
+
+// Default values for RUDPConfig.
+const (
+	// DefaultMaxDatagramLen leaves room for the SCION headers of long paths within the
+	// minimum SCION MTU.
+	DefaultMaxDatagramLen     = 1024
+	DefaultMaxMsgLen          = 1 << 20
+	DefaultMaxReassemblyBytes = 1 << 23
+	DefaultReassemblyTimeout  = 10 * time.Second
+	DefaultInitialRTO         = time.Second
+	DefaultMinRTO             = 200 * time.Millisecond
+	DefaultMaxRTO             = 30 * time.Second
+	DefaultMaxPeers           = 1 << 10
 )
 
 // Internal constants
 const (
 	maxReadEvents = 1 << 8
+	maxFragments  = 1<<16 - 1
 )
 
 var (
@@ -65,6 +81,59 @@ var (
 	generator = rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
 )
 
+// RUDPConfig customizes an RUDP transport. Zero values are replaced by the defaults in the
+// package constants.
+type RUDPConfig struct {
+	// MaxDatagramLen is the maximum length of a datagram, including the RUDP headers.
+	// Longer messages are fragmented.
+	MaxDatagramLen int
+	// MaxMsgLen is the maximum length of a message, both for sending and reassembly.
+	MaxMsgLen int
+	// MaxReassemblyBytes bounds the memory used by fragments of incomplete messages.
+	MaxReassemblyBytes int
+	// ReassemblyTimeout is the time after which incomplete messages are discarded.
+	ReassemblyTimeout time.Duration
+	// InitialRTO is the retransmission timeout for peers without RTT samples. MinRTO and
+	// MaxRTO bound the retransmission timeout.
+	InitialRTO time.Duration
+	MinRTO     time.Duration
+	MaxRTO     time.Duration
+	// MaxPeers bounds the number of hosts for which RTT estimates and metrics are kept.
+	MaxPeers int
+}
+
+func (cfg *RUDPConfig) setDefaults() {
+	if cfg.MaxDatagramLen == 0 {
+		cfg.MaxDatagramLen = DefaultMaxDatagramLen
+	}
+	if cfg.MaxMsgLen == 0 {
+		cfg.MaxMsgLen = DefaultMaxMsgLen
+	}
+	if cfg.MaxReassemblyBytes == 0 {
+		cfg.MaxReassemblyBytes = DefaultMaxReassemblyBytes
+	}
+	if cfg.ReassemblyTimeout == 0 {
+		cfg.ReassemblyTimeout = DefaultReassemblyTimeout
+	}
+	if cfg.InitialRTO == 0 {
+		cfg.InitialRTO = DefaultInitialRTO
+	}
+	if cfg.MinRTO == 0 {
+		cfg.MinRTO = DefaultMinRTO
+	}
+	if cfg.MaxRTO == 0 {
+		cfg.MaxRTO = DefaultMaxRTO
+	}
+	if cfg.MaxPeers == 0 {
+		cfg.MaxPeers = DefaultMaxPeers
+	}
+}
+
+// fragLen returns the payload length of a fragment.
+func (cfg *RUDPConfig) fragLen() int {
+	return cfg.MaxDatagramLen - rudpHdrLen - rudpFragHdrLen
+}
+
 var _ Transport = (*RUDP)(nil)
 
 // RUDP (Reliable UDP) implements a simple UDP protocol with ACKs on top of SCION/UDP.
@@ -73,9 +142,17 @@ var _ Transport = (*RUDP)(nil)
 //
 // SendUnreliableMsgTo sends a message and returns without waiting for an ACK.
 //
-// SendMsgTo sends a message and waits for a limited amount of time for an
-// ACK; if time allows, also resends the message. Once the parent context is
-// canceled, the function returns immediately with an error.
+// SendMsgTo sends a message and waits for an ACK; if none arrives within the
+// retransmission timeout, resends the message. The retransmission timeout is
+// estimated from the round-trip times to the peer, and doubles with every
+// retransmission. Once the parent context is canceled, the function returns
+// immediately with an error.
+//
+// Messages longer than the maximum datagram length are split into fragments,
+// which are reassembled by the receiver. Each fragment of a reliable message is
+// acknowledged and retransmitted on its own. The memory used for reassembly is
+// bounded, fragments that do not fit are dropped (and retransmitted later, if
+// the message is reliable).
 //
 // Header format:
 //   0B       1        2        3        4        5        6        7
@@ -83,6 +160,15 @@ var _ Transport = (*RUDP)(nil)
 //   | Flags  |                           PacketID                           |
 //   +--------+--------+--------+--------+--------+--------+--------+--------+
 //
+// If the fragment flag is set, the header is followed by the fragment header:
+//   0B       1        2        3
+//   +--------+--------+--------+--------+
+//   |  FragmentIndex  |  FragmentCount  |
+//   +--------+--------+--------+--------+
+//
+// All fragments of a message carry the same packet ID. ACKs for a fragment
+// copy its fragment header.
+//
 // RUDP can be safely used by concurrent goroutines.
 //
 // All methods receive a context argument. If the context is canceled prior to
@@ -90,10 +176,15 @@ var _ Transport = (*RUDP)(nil)
 // connection is closed, running functions terminate with ErrClosed.
 type RUDP struct {
 	conn net.PacketConn
+	cfg  RUDPConfig
 	// Incrementing packet ID generator
 	nextPktID uint56
 	// Track senders waiting for ACKs
 	ackTable ackTable
+	// RTT estimates and metrics, by peer
+	peers *peerTable
+	// Fragments of incomplete messages, only accessed by the background goroutine
+	reassembler *reassembler
 	// Channel for received messages, used between the background goroutine and receivers
 	readEvents chan *readEventDesc
 	// Closed when Close() starts to run
@@ -106,11 +197,18 @@ type RUDP struct {
 	writeLock *channelLock
 }
 
-// NewRUDP creates a new RUDP connection by wrapping around a PacketConn.
+// NewRUDP creates a new RUDP connection with the default configuration by
+// wrapping around a PacketConn.
 //
 // NewRUDP also spawns a background receiving goroutine that continuously reads
 // from conn and keeps track of ACKs and messages.
 func NewRUDP(conn net.PacketConn, logger log.Logger) *RUDP {
+	return NewRUDPWithConfig(conn, nil, logger)
+}
+
+// NewRUDPWithConfig is like NewRUDP, but customizes the transport with cfg. A
+// nil cfg uses the defaults.
+func NewRUDPWithConfig(conn net.PacketConn, cfg *RUDPConfig, logger log.Logger) *RUDP {
 	t := &RUDP{
 		conn:       conn,
 		nextPktID:  uint56(generator.Intn(maxUint56 + 1)),
@@ -120,6 +218,12 @@ func NewRUDP(conn net.PacketConn, logger log.Logger) *RUDP {
 		log:        logger.New("id", logext.RandId(4), "goroutine", "transport_bck"),
 		writeLock:  newChannelLock(),
 	}
+	if cfg != nil {
+		t.cfg = *cfg
+	}
+	t.cfg.setDefaults()
+	t.peers = newPeerTable(&t.cfg)
+	t.reassembler = newReassembler(&t.cfg)
 	t.goBackgroundReceiver()
 	return t
 }
@@ -127,57 +231,89 @@ func NewRUDP(conn net.PacketConn, logger log.Logger) *RUDP {
 // SendUnreliableMsgTo sends a message and returns without waiting for an ACK.
 func (t *RUDP) SendUnreliableMsgTo(ctx context.Context, b common.RawBytes, a net.Addr) error {
 	id := t.nextPktID.Inc()
-	buffer, err := t.putHeader(id, flagsNone, b)
+	buffers, err := t.fragment(id, flagsNone, b)
 	if err != nil {
 		return err
 	}
-	defer bufpool.Put(buffer)
-	return t.send(ctx, buffer.B, a)
+	defer putBuffers(buffers)
+	t.peers.lookup(a).metrics.incSent()
+	for _, buffer := range buffers {
+		if err := t.send(ctx, buffer.B, a); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// SendMsgTo sends a message and waits for an ACK. If no ACK is received for a
-// set amount of time, the message is retransmitted. This process repeats while
-// ctx is not canceled.
+// SendMsgTo sends a message and waits for an ACK. If no ACK is received within
+// the retransmission timeout, the unacknowledged fragments of the message are
+// retransmitted, and the timeout is doubled. This process repeats while ctx is
+// not canceled.
 func (t *RUDP) SendMsgTo(ctx context.Context, b common.RawBytes, a net.Addr) error {
 	id := t.nextPktID.Inc()
-	buffer, err := t.putHeader(id, flagNeedACK, b)
+	buffers, err := t.fragment(id, flagNeedACK, b)
 	if err != nil {
 		return err
 	}
-	defer bufpool.Put(buffer)
-	// Store the channel in the shared table s.t. the background receiver can
-	// close it when it gets the ACK
-	ackChannel := make(chan struct{})
-	_, loaded := t.ackTable.LoadOrStore(id, ackChannel)
+	defer putBuffers(buffers)
+	// Store the message in the shared table s.t. the background receiver can
+	// mark its fragments when it gets the ACKs
+	msg := newPendingMsg(len(buffers))
+	_, loaded := t.ackTable.LoadOrStore(id, msg)
 	if loaded {
 		// Packet IDs should be unique, this points to a programming error
 		panic(fmt.Sprintf("Duplicate session ID=%d", id))
 	}
-
 	defer t.ackTable.Delete(id)
+
+	// Until the peer acknowledged a message, its state is not stored in the peer table.
+	p := t.peers.lookup(a)
+	p.metrics.incSent()
 	for {
-		if err := t.send(ctx, buffer.B, a); err != nil {
-			return err
+		for _, i := range msg.unacked() {
+			if msg.sent(i) {
+				p.metrics.incRetransmits()
+			}
+			if err := t.send(ctx, buffers[i].B, a); err != nil {
+				p.metrics.incSendFailures()
+				return err
+			}
 		}
+		timer := time.NewTimer(p.RTO())
 		select {
-		case <-ackChannel:
-			// Received ack and can return successfully
+		case <-msg.done:
+			// Received all ACKs and can return successfully
+			timer.Stop()
 			return nil
 		case <-ctx.Done():
 			// Context was canceled or we are out of time, return with failure
+			timer.Stop()
+			p.metrics.incSendFailures()
 			return infra.NewCtxDoneError()
-		case <-time.After(rudpRetryTimeout):
-			// Did not get ACK and context is not canceled yet, so do nothing
-			// and try to send again
+		case <-timer.C:
+			// Did not get all ACKs and context is not canceled yet, so back off
+			// and try to send the missing fragments again
+			if p.key == "" {
+				// Switch to the stored state, once the peer acknowledged a message.
+				if stored := t.peers.find(a); stored != nil {
+					p = stored
+				}
+			}
+			p.Backoff()
 		case <-t.closedChan:
 			// Someone called Close, return immediately
+			timer.Stop()
 			return common.NewBasicError(infra.StrClosedError, nil)
 		}
 	}
 }
 
-func (t *RUDP) sendACK(id uint56, a net.Addr) error {
-	buffer, err := t.putHeader(id, flagACK, nil)
+func (t *RUDP) sendACK(id uint56, fragHdr common.RawBytes, a net.Addr) error {
+	flags := flagACK
+	if fragHdr != nil {
+		flags |= flagFragment
+	}
+	buffer, err := t.putHeader(id, flags, fragHdr, nil)
 	if err != nil {
 		return err
 	}
@@ -220,29 +356,79 @@ func (t *RUDP) send(ctx context.Context, b common.RawBytes, a net.Addr) error {
 	return nil
 }
 
-// putHeader returns a new buffer containing the Reliable UDP header and b.
-func (t *RUDP) putHeader(id uint56, flags rudpFlag, b common.RawBytes) (*bufpool.Buffer, error) {
+// fragment returns the datagrams for message b. If b fits in a single
+// datagram, it is sent without fragment header.
+func (t *RUDP) fragment(id uint56, flags rudpFlag, b common.RawBytes) ([]*bufpool.Buffer,
+	error) {
+
+	if rudpHdrLen+len(b) <= t.cfg.MaxDatagramLen {
+		buffer, err := t.putHeader(id, flags, nil, b)
+		if err != nil {
+			return nil, err
+		}
+		return []*bufpool.Buffer{buffer}, nil
+	}
+	fragLen := t.cfg.fragLen()
+	count := (len(b) + fragLen - 1) / fragLen
+	if len(b) > t.cfg.MaxMsgLen || count > maxFragments {
+		return nil, common.NewBasicError("Unable to send, message too long", nil,
+			"msg_len", len(b), "max_allowed", t.cfg.MaxMsgLen)
+	}
+	buffers := make([]*bufpool.Buffer, 0, count)
+	fragHdr := make(common.RawBytes, rudpFragHdrLen)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * fragLen
+		if end > len(b) {
+			end = len(b)
+		}
+		putFragHdr(fragHdr, i, count)
+		buffer, err := t.putHeader(id, flags|flagFragment, fragHdr, b[i*fragLen:end])
+		if err != nil {
+			putBuffers(buffers)
+			return nil, err
+		}
+		buffers = append(buffers, buffer)
+	}
+	return buffers, nil
+}
+
+// putHeader returns a new buffer containing the Reliable UDP header, the
+// optional fragment header fragHdr and b.
+func (t *RUDP) putHeader(id uint56, flags rudpFlag, fragHdr,
+	b common.RawBytes) (*bufpool.Buffer, error) {
+
 	buffer := bufpool.Get()
-	if rudpHdrLen+len(b) > len(buffer.B) {
+	hdrLen := rudpHdrLen + len(fragHdr)
+	if hdrLen+len(b) > len(buffer.B) {
 		bufpool.Put(buffer)
 		return nil, common.NewBasicError("Unable to send, payload too long", nil,
-			"pld_len", len(b), "max_allowed", len(buffer.B)-rudpHdrLen)
+			"pld_len", len(b), "max_allowed", len(buffer.B)-hdrLen)
 	}
 	buffer.B[0] = byte(flags)
 	id.putUint56(buffer.B[1:])
+	copy(buffer.B[rudpHdrLen:], fragHdr)
 	// Because we checked bounds above, this will never reallocate
-	buffer.B = append(buffer.B[:rudpHdrLen], b...)
+	buffer.B = append(buffer.B[:hdrLen], b...)
 	return buffer, nil
 }
 
+func putFragHdr(b common.RawBytes, index, count int) {
+	common.Order.PutUint16(b, uint16(index))
+	common.Order.PutUint16(b[2:], uint16(count))
+}
+
+func putBuffers(buffers []*bufpool.Buffer) {
+	for _, buffer := range buffers {
+		bufpool.Put(buffer)
+	}
+}
+
 // RecvFrom returns the next non-ACK message.
 func (t *RUDP) RecvFrom(ctx context.Context) (common.RawBytes, net.Addr, error) {
 	select {
 	case event := <-t.readEvents:
 		// Propagate message payload to caller
-		b := event.buffer.CloneB()
-		bufpool.Put(event.buffer)
-		return b, event.address, nil
+		return event.msg, event.address, nil
 	case <-ctx.Done():
 		// We timed out, return with failure
 		return nil, nil, infra.NewCtxDoneError()
@@ -260,76 +446,125 @@ func (t *RUDP) goBackgroundReceiver() {
 		t.log.Info("Started")
 		defer t.log.Info("Stopped")
 		defer close(t.doneChan)
+		b := make(common.RawBytes, common.MaxMTU)
 		for {
-			b := bufpool.Get()
-			n, address, err := t.conn.ReadFrom(b.B)
+			n, address, err := t.conn.ReadFrom(b)
 			if err != nil {
 				// FIXME(scrye): For now just log and continue on SCMP errors,
 				// and destroy the background receiver on other errors.
 				if opErr, ok := err.(*snet.OpError); ok && opErr.SCMP() != nil {
 					t.log.Warn("Received SCMP message", "msg", opErr.SCMP())
-					bufpool.Put(b)
 					continue
 				} else {
 					// Do not log close events
 					if err != io.EOF {
 						t.log.Error("Read error, shutting down", "err", err)
 					}
-					bufpool.Put(b)
 					return
 				}
 			}
+			t.handleDatagram(b[:n], address)
+		}
+	}()
+}
 
-			flags, id, payload, err := t.popHeader(b.B[:n])
-			if err != nil {
-				t.log.Error("Unable to remove Reliable UDP header", "err", err)
-				bufpool.Put(b)
-				continue
-			}
-			b.B = payload
-
-			// If the received message is an ACK we do not propagate it up the
-			// stack. Instead, we signal the waiting goroutine by closing its
-			// channel.
-			if flags.isSet(flagACK) {
-				ackChannel, loaded := t.ackTable.Load(id)
-				if !loaded {
-					t.log.Warn("Received ACK, but no one is waiting for it", "id", id)
-				} else {
-					close(ackChannel)
-				}
-				bufpool.Put(b)
-				continue
-			}
+// handleDatagram processes a datagram received from address.
+func (t *RUDP) handleDatagram(b common.RawBytes, address net.Addr) {
+	flags, id, fragHdr, payload, err := t.popHeader(b)
+	if err != nil {
+		t.log.Error("Unable to remove Reliable UDP header", "err", err)
+		return
+	}
+	// If the received message is an ACK we do not propagate it up the
+	// stack. Instead, we mark the fragment as acknowledged.
+	if flags.isSet(flagACK) {
+		msg, loaded := t.ackTable.Load(id)
+		if !loaded {
+			t.log.Warn("Received ACK, but no one is waiting for it", "id", id)
+			return
+		}
+		index := 0
+		if fragHdr != nil {
+			index = int(common.Order.Uint16(fragHdr))
+		}
+		// The peer acknowledged one of our messages, so its state is kept.
+		p := t.peers.get(address)
+		if rtt, ok := msg.ack(index); ok {
+			p.Sample(rtt)
+		}
+		return
+	}
+	p := t.peers.lookup(address)
 
-			// The received message is for the upper layer.
-			event := &readEventDesc{address: address, buffer: b}
-			select {
-			case t.readEvents <- event:
-				// We reliably sent the message to the upper layer, send ACK
-				// (if requested)
-				if flags.isSet(flagNeedACK) {
-					if err := t.sendACK(id, address); err != nil {
-						t.log.Warn("Unable to send ACK", "err", err)
-					}
-				}
-			default:
-				t.log.Warn("Internal queue full, dropped message", "id", id, "flags", flags,
-					"msg_len", n)
-			}
+	if fragHdr == nil {
+		// The received message is for the upper layer.
+		if t.deliver(payload, address, p) && flags.isSet(flagNeedACK) {
+			// We reliably sent the message to the upper layer, send ACK
+			t.ack(id, nil, address)
 		}
-	}()
+		return
+	}
+
+	index := int(common.Order.Uint16(fragHdr))
+	count := int(common.Order.Uint16(fragHdr[2:]))
+	key := fragKey{peer: address.String(), id: id}
+	status, msg := t.reassembler.add(key, index, count, payload, p.metrics)
+	switch status {
+	case fragDropped:
+		t.log.Debug("Dropped fragment", "id", id, "index", index, "count", count)
+		return
+	case fragComplete:
+		if !t.deliver(msg, address, p) {
+			// Drop the last fragment, so that the sender retransmits it.
+			t.reassembler.undo(key, index)
+			return
+		}
+		t.reassembler.done(key)
+	}
+	if flags.isSet(flagNeedACK) {
+		t.ack(id, fragHdr, address)
+	}
+}
+
+// deliver passes msg to the upper layer, and returns whether it succeeded.
+func (t *RUDP) deliver(msg common.RawBytes, address net.Addr, p *peer) bool {
+	event := &readEventDesc{address: address, msg: append(common.RawBytes(nil), msg...)}
+	select {
+	case t.readEvents <- event:
+		p.metrics.incReceived()
+		return true
+	default:
+		t.log.Warn("Internal queue full, dropped message", "msg_len", len(msg))
+		return false
+	}
 }
 
-// popHeader returns a slice referring only to the payload of b.
-func (t *RUDP) popHeader(b common.RawBytes) (rudpFlag, uint56, common.RawBytes, error) {
+func (t *RUDP) ack(id uint56, fragHdr common.RawBytes, address net.Addr) {
+	if err := t.sendACK(id, fragHdr, address); err != nil {
+		t.log.Warn("Unable to send ACK", "err", err)
+	}
+}
+
+// popHeader returns the flags and ID of b, the fragment header (nil if the
+// fragment flag is not set), and a slice referring only to the payload of b.
+func (t *RUDP) popHeader(b common.RawBytes) (rudpFlag, uint56, common.RawBytes,
+	common.RawBytes, error) {
+
 	if len(b) < rudpHdrLen {
-		return 0, 0, nil, common.NewBasicError("Packet shorter than min length", nil,
+		return 0, 0, nil, nil, common.NewBasicError("Packet shorter than min length", nil,
 			"length", len(b), "min_length", rudpHdrLen)
 	}
 	flags := rudpFlag(b[0])
 	id := getUint56(b[1:])
-	return flags, id, b[rudpHdrLen:], nil
+	if !flags.isSet(flagFragment) {
+		return flags, id, nil, b[rudpHdrLen:], nil
+	}
+	hdrLen := rudpHdrLen + rudpFragHdrLen
+	if len(b) < hdrLen {
+		return 0, 0, nil, nil, common.NewBasicError("Fragment shorter than min length", nil,
+			"length", len(b), "min_length", hdrLen)
+	}
+	return flags, id, b[rudpHdrLen:hdrLen], b[hdrLen:], nil
 }
 
 // Close closes the net.PacketConn connection and shuts down the background
@@ -351,6 +586,6 @@ func (t *RUDP) Close(ctx context.Context) error {
 }
 
 type readEventDesc struct {
-	buffer  *bufpool.Buffer
+	msg     common.RawBytes
 	address net.Addr
 }
@@ -19,6 +19,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/xtest/loopback"
+	"github.com/scionproto/scion/go/lib/xtest/p2p"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -94,6 +96,67 @@ func TestSendMsgToBadLink(t *testing.T) {
 	})
 }
 
+func TestSendMsgToFragmented(t *testing.T) {
+	Convey("Send a message longer than a datagram over a lossy link", t, func() {
+		cfg := &RUDPConfig{MaxDatagramLen: 64, InitialRTO: 50 * time.Millisecond,
+			MinRTO: 10 * time.Millisecond}
+		connA, connB := p2p.New()
+		a := NewRUDPWithConfig(&lossyConn{Conn: connA}, cfg, log.Root())
+		b := NewRUDPWithConfig(connB, cfg, log.Root())
+		msg := make(common.RawBytes, 1000)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+
+		ctx, cancelF := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancelF()
+		err := a.SendMsgTo(ctx, msg, &p2p.Addr{})
+		SoMsg("send err", err, ShouldBeNil)
+
+		recvMsg, _, err := b.RecvFrom(ctx)
+		SoMsg("recv err", err, ShouldBeNil)
+		SoMsg("payload", recvMsg, ShouldResemble, msg)
+
+		Convey("Retransmitted fragments do not deliver the message again", func() {
+			ctx, cancelF := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancelF()
+			_, _, err := b.RecvFrom(ctx)
+			SoMsg("recv err", common.IsTimeoutErr(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSendMsgToTooLong(t *testing.T) {
+	Convey("Messages longer than the maximum message length are rejected", t, func() {
+		cfg := &RUDPConfig{MaxDatagramLen: 64, MaxMsgLen: 100}
+		udp := NewRUDPWithConfig(loopback.New(), cfg, log.Root())
+		ctx, cancelF := context.WithTimeout(context.Background(), time.Second)
+		defer cancelF()
+		err := udp.SendMsgTo(ctx, make(common.RawBytes, 101), &loopback.Addr{})
+		SoMsg("send err", err, ShouldNotBeNil)
+		err = udp.Close(ctx)
+		SoMsg("err", err, ShouldBeNil)
+	})
+}
+
+// lossyConn drops every other datagram it sends.
+type lossyConn struct {
+	*p2p.Conn
+	mu    sync.Mutex
+	count int
+}
+
+func (c *lossyConn) WriteTo(b []byte, a net.Addr) (int, error) {
+	c.mu.Lock()
+	c.count++
+	drop := c.count%2 == 0
+	c.mu.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.Conn.WriteTo(b, a)
+}
+
 // Loopback with 100% drop rate
 type BadLoopback struct {
 	*loopback.Conn
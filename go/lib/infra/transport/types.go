@@ -17,46 +17,112 @@ package transport
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/scionproto/scion/go/lib/common"
 )
 
-// ackTable maps packet IDs to channels. Goroutines waiting for an ACK for a
-// packet ID create a channel, store it in the map at that ID and wait for the
-// channel to be closed. The background receiving goroutine closes the channel
-// when it receives the corresponding ack.
+// ackTable maps packet IDs to the messages waiting for ACKs. The background
+// receiving goroutine marks the fragments of a message as acknowledged when it
+// receives the corresponding ACKs.
 type ackTable sync.Map
 
 func (m *ackTable) Delete(key uint56) {
 	(*sync.Map)(m).Delete(key)
 }
 
-func (m *ackTable) Load(key uint56) (chan struct{}, bool) {
+func (m *ackTable) Load(key uint56) (*pendingMsg, bool) {
 	value, loaded := (*sync.Map)(m).Load(key)
 	if value == nil {
 		return nil, loaded
 	}
-	return value.(chan struct{}), loaded
+	return value.(*pendingMsg), loaded
 }
 
-func (m *ackTable) LoadOrStore(key uint56, value chan struct{}) (chan struct{}, bool) {
+func (m *ackTable) LoadOrStore(key uint56, value *pendingMsg) (*pendingMsg, bool) {
 	newValue, loaded := (*sync.Map)(m).LoadOrStore(key, value)
 	if newValue == nil {
 		return nil, loaded
 	}
-	return newValue.(chan struct{}), loaded
+	return newValue.(*pendingMsg), loaded
 }
 
-func (m *ackTable) Range(f func(uint56, chan struct{}) bool) {
+func (m *ackTable) Range(f func(uint56, *pendingMsg) bool) {
 	(*sync.Map)(m).Range(func(k, v interface{}) bool {
-		return f(k.(uint56), v.(chan struct{}))
+		return f(k.(uint56), v.(*pendingMsg))
 	})
 }
 
-func (m *ackTable) Store(key uint56, value chan struct{}) {
+func (m *ackTable) Store(key uint56, value *pendingMsg) {
 	(*sync.Map)(m).Store(key, value)
 }
 
+// pendingMsg tracks the fragments of a reliable message that were not
+// acknowledged yet. Unfragmented messages consist of a single fragment.
+type pendingMsg struct {
+	sync.Mutex
+	acked     []bool
+	sentAt    []time.Time
+	resent    []bool
+	remaining int
+	// Closed once all fragments are acknowledged
+	done chan struct{}
+}
+
+func newPendingMsg(frags int) *pendingMsg {
+	return &pendingMsg{
+		acked:     make([]bool, frags),
+		sentAt:    make([]time.Time, frags),
+		resent:    make([]bool, frags),
+		remaining: frags,
+		done:      make(chan struct{}),
+	}
+}
+
+// unacked returns the indexes of the fragments that were not acknowledged.
+func (p *pendingMsg) unacked() []int {
+	p.Lock()
+	defer p.Unlock()
+	var indexes []int
+	for i, acked := range p.acked {
+		if !acked {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// sent records that fragment index is sent now, and returns whether this is a
+// retransmission.
+func (p *pendingMsg) sent(index int) bool {
+	p.Lock()
+	defer p.Unlock()
+	resent := !p.sentAt[index].IsZero()
+	p.resent[index] = p.resent[index] || resent
+	p.sentAt[index] = time.Now()
+	return resent
+}
+
+// ack marks fragment index as acknowledged. If this is the first ACK for a
+// fragment that was not retransmitted, its round-trip time is returned as a
+// sample for the RTT estimation (Karn's algorithm).
+func (p *pendingMsg) ack(index int) (time.Duration, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if index >= len(p.acked) || p.acked[index] || p.sentAt[index].IsZero() {
+		return 0, false
+	}
+	p.acked[index] = true
+	p.remaining--
+	if p.remaining == 0 {
+		close(p.done)
+	}
+	if p.resent[index] {
+		return 0, false
+	}
+	return time.Since(p.sentAt[index]), true
+}
+
 // Supports atomic increments and wraps on 7 bytes.
 type uint56 uint64
 
@@ -18,12 +18,18 @@ package pathdb
 
 import (
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
 	"github.com/scionproto/scion/go/lib/ctrl/seg"
 	"github.com/scionproto/scion/go/lib/pathdb/conn"
 	"github.com/scionproto/scion/go/lib/pathdb/query"
 	"github.com/scionproto/scion/go/lib/pathdb/sqlite"
 )
 
+const (
+	// Error strings
+	ErrNoHashTreeRoot = "No path segment with hash tree root of revoking AS"
+)
+
 type DB struct {
 	conn conn.Conn
 }
@@ -74,3 +80,27 @@ func (db *DB) DeleteWithIntf(intf query.IntfSpec) (int, error) {
 func (db *DB) Get(params *query.Params) ([]*query.Result, error) {
 	return db.conn.Get(params)
 }
+
+// VerifyRev checks the hash tree proof of a revocation against the hash tree roots of the
+// revoking AS in the path segments containing the revoked interface. The proof is valid if it
+// matches the root of at least one segment. If no segment contains the interface, the proof
+// cannot be checked and an error with message ErrNoHashTreeRoot is returned.
+func (db *DB) VerifyRev(rev *path_mgmt.RevInfo) error {
+	ia := rev.IA()
+	res, err := db.Get(&query.Params{Intfs: []*query.IntfSpec{{IA: ia, IfID: rev.IfID}}})
+	if err != nil {
+		return err
+	}
+	err = common.NewBasicError(ErrNoHashTreeRoot, nil, "rev", rev)
+	for _, r := range res {
+		for _, ase := range r.Seg.ASEntries {
+			if !ase.IA().Eq(ia) {
+				continue
+			}
+			if err = rev.VerifyProof(ase.HashTreeRoot); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
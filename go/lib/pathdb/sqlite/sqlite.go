@@ -432,7 +432,8 @@ func (b *Backend) DeleteWithIntf(intf query.IntfSpec) (int, error) {
 		return 0, err
 	}
 	delStmt := `DELETE FROM Segments WHERE EXISTS (
-		SELECT * FROM IntfToSeg WHERE IsdID=? AND AsID=? AND IntfID=?)`
+		SELECT * FROM IntfToSeg WHERE IsdID=? AND AsID=? AND IntfID=?
+		AND SegRowID=Segments.RowID)`
 	res, err := b.prepareAndExec(delStmt, intf.IA.I, intf.IA.A, intf.IfID)
 	if err != nil {
 		b.tx.Rollback()
@@ -343,13 +343,29 @@ func Test_DeleteWithIntf(t *testing.T) {
 		pseg2, _ := allocPathSegment(ifs2, TS)
 		insertSeg(t, b, pseg1, types, hpCfgIDs)
 		insertSeg(t, b, pseg2, types, hpCfgIDs)
-		// Call
-		deleted, err := b.DeleteWithIntf(query.IntfSpec{IA: ia16, IfID: 2})
-		if err != nil {
-			t.Fatal(err)
-		}
-		// Check return value
-		SoMsg("Deleted", deleted, ShouldEqual, 2)
+		Convey("Interface on both segments", func() {
+			// Call
+			deleted, err := b.DeleteWithIntf(query.IntfSpec{IA: ia16, IfID: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Check return value
+			SoMsg("Deleted", deleted, ShouldEqual, 2)
+		})
+		Convey("Interface on one segment", func() {
+			// Call
+			deleted, err := b.DeleteWithIntf(query.IntfSpec{IA: ia16, IfID: 6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Check return value
+			SoMsg("Deleted", deleted, ShouldEqual, 1)
+			res, err := b.Get(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			SoMsg("Remaining", len(res), ShouldEqual, 1)
+		})
 	})
 }
 
@@ -28,6 +28,8 @@ const (
 	numReqPaths = 5
 	// time between reconnection attempts if SCIOND fails
 	reconnectInterval = 3 * time.Second
+	// maximum time to wait for the reply to a SCIOND query
+	lookupTimeout = 10 * time.Second
 	// wildcard filter key string
 	matchAll = "*"
 )
@@ -46,7 +46,7 @@ func ExamplePR() {
 	}
 	// Initialize path resolver
 	sciondPath := fmt.Sprintf("/run/shm/sciond/sd%s.sock", src.String())
-	sciondService := sciond.NewService(sciondPath)
+	sciondService := sciond.NewMuxService(sciondPath, nil)
 	pr, err := New(sciondService, time.Second, time.Minute, log.Root())
 	if err != nil {
 		fmt.Println("Failed to connect to SCIOND", "err", err)
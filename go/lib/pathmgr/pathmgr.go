@@ -30,8 +30,9 @@
 // infra test file.
 //
 // If the connection to SCIOND fails, the resolver automatically attempts to
-// reestablish the connection. During this period, paths are not expired. Paths
-// will be transparently refreshed after reconnecting to SCIOND.
+// reestablish the connection, unless the connector does so by itself, as the
+// connectors of sciond.NewMuxService do. During this period, paths are not
+// expired. Paths will be transparently refreshed after reconnecting to SCIOND.
 package pathmgr
 
 // The manager is composed of the public PR struct, which is a proxy that
@@ -86,7 +87,7 @@ func setDefaultTimers(timers *Timers) {
 }
 
 type PR struct {
-	// Lookup, reconnect and Register acquire this lock as separate goroutines
+	// Lookup, Revoke and Register acquire this lock as separate goroutines
 	sync.Mutex
 	sciondService sciond.Service
 	// Number of IAs registered for priority tracking
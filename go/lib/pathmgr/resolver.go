@@ -15,6 +15,7 @@
 package pathmgr
 
 import (
+	"context"
 	"time"
 
 	log "github.com/inconshreveable/log15"
@@ -79,12 +80,25 @@ func (r *resolver) run() {
 	}
 }
 
-// lookup queries SCIOND, blocking while waiting for the response.
+// lookup queries SCIOND, blocking while waiting for the response. Lookups on
+// connectors that support contexts are bounded by lookupTimeout. After network
+// errors, connectors that do not reconnect by themselves are replaced.
 func (r *resolver) lookup(src, dst *addr.ISD_AS) AppPathSet {
-	reply, err := r.sciondConn.Paths(dst, src, numReqPaths, sciond.PathReqFlags{})
+	var reply *sciond.PathReply
+	var err error
+	if conn, ok := r.sciondConn.(sciond.ContextConnector); ok {
+		ctx, cancelF := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancelF()
+		reply, err = conn.PathsCtx(ctx, dst, src, numReqPaths, sciond.PathReqFlags{})
+	} else {
+		reply, err = r.sciondConn.Paths(dst, src, numReqPaths, sciond.PathReqFlags{})
+	}
 	if err != nil {
 		log.Error("SCIOND network error", "err", err)
-		r.reconnect()
+		if !sciond.Reconnects(r.sciondConn) {
+			r.reconnect()
+		}
+		return make(AppPathSet)
 	}
 	if reply.ErrorCode != sciond.ErrorOk {
 		// SCIOND internal error, return 0 paths set
@@ -96,6 +110,7 @@ func (r *resolver) lookup(src, dst *addr.ISD_AS) AppPathSet {
 
 // reconnect repeatedly tries to reconnect to SCIOND.
 func (r *resolver) reconnect() {
+	r.sciondConn.Close()
 	for {
 		sciondConn, err := r.sciondService.Connect()
 		if err != nil {
@@ -0,0 +1,339 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sciond
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/proto"
+)
+
+const (
+	// DefaultMuxDialTimeout is the default timeout for connecting to SCIOND.
+	DefaultMuxDialTimeout = time.Second
+	// DefaultMuxReconnectInterval is the default minimum time between two
+	// attempts to reconnect a failed connection.
+	DefaultMuxReconnectInterval = time.Second
+)
+
+const (
+	ErrMuxClosed       = "Connector closed"
+	ErrMuxNotConnected = "Not connected to SCIOND"
+	ErrMuxConnLost     = "Connection to SCIOND lost"
+	ErrMuxCtxDone      = "Context done while waiting for SCIOND"
+)
+
+// MuxConfig configures the connectors returned by a mux service. Zero fields
+// are set to their defaults.
+type MuxConfig struct {
+	// PoolSize is the number of connections to SCIOND. Requests are spread
+	// across the connections in round-robin fashion. Defaults to 1.
+	PoolSize int
+	// DialTimeout bounds each attempt to connect to SCIOND.
+	DialTimeout time.Duration
+	// ReconnectInterval is the minimum time between two attempts to reconnect a
+	// failed connection. Requests in between are sent over the other
+	// connections of the pool, or fail immediately if all of them failed.
+	ReconnectInterval time.Duration
+}
+
+func (cfg *MuxConfig) setDefaults() {
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 1
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = DefaultMuxDialTimeout
+	}
+	if cfg.ReconnectInterval == 0 {
+		cfg.ReconnectInterval = DefaultMuxReconnectInterval
+	}
+}
+
+type muxService struct {
+	path string
+	cfg  MuxConfig
+}
+
+// NewMuxService returns a Service for the SCIOND server at path, whose
+// connectors multiplex concurrent requests over their connections by request
+// ID, and transparently reconnect to SCIOND if a connection fails. The
+// connectors implement ContextConnector. If cfg is nil, the defaults are used.
+func NewMuxService(path string, cfg *MuxConfig) Service {
+	s := &muxService{path: path}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+	s.cfg.setDefaults()
+	return s
+}
+
+func (s *muxService) Connect() (Connector, error) {
+	return s.ConnectTimeout(s.cfg.DialTimeout)
+}
+
+// ConnectTimeout connects all connections of the pool, each with the
+// specified timeout. Future reconnection attempts use MuxConfig.DialTimeout.
+func (s *muxService) ConnectTimeout(timeout time.Duration) (Connector, error) {
+	pool := &muxPool{conns: make([]*muxConn, s.cfg.PoolSize)}
+	for i := range pool.conns {
+		pool.conns[i] = &muxConn{path: s.path, cfg: s.cfg,
+			pending: make(map[uint64]chan muxReply)}
+		if err := pool.conns[i].dial(timeout); err != nil {
+			pool.close()
+			return nil, err
+		}
+	}
+	return newConnector(pool), nil
+}
+
+// Reconnects returns whether conn transparently reconnects to SCIOND after
+// failures, i.e., whether it was returned by a service of NewMuxService. Other
+// connectors must be replaced by a new connector after network errors.
+func Reconnects(conn Connector) bool {
+	c, ok := conn.(*connector)
+	if !ok {
+		return false
+	}
+	_, ok = c.rt.(*muxPool)
+	return ok
+}
+
+// muxPool spreads the requests across a pool of connections.
+type muxPool struct {
+	conns []*muxConn
+	next  uint32
+	// deadline is the time.Time set with setDeadline.
+	deadline atomic.Value
+}
+
+func (p *muxPool) roundTrip(ctx context.Context, pld *Pld) (*Pld, error) {
+	if ctx.Done() == nil {
+		if d, ok := p.deadline.Load().(time.Time); ok && !d.IsZero() {
+			var cancelF context.CancelFunc
+			ctx, cancelF = context.WithDeadline(ctx, d)
+			defer cancelF()
+		}
+	}
+	// Connections that failed within the reconnect interval are skipped. If
+	// all of them did, the request fails on the next connection in turn.
+	n := uint32(len(p.conns))
+	i := atomic.AddUint32(&p.next, 1) % n
+	for j := uint32(0); j < n; j++ {
+		if c := p.conns[(i+j)%n]; !c.down() {
+			return c.roundTrip(ctx, pld)
+		}
+	}
+	return p.conns[i].roundTrip(ctx, pld)
+}
+
+// setDeadline sets the deadline of queries without context, or with a context
+// that is never done.
+func (p *muxPool) setDeadline(t time.Time) error {
+	p.deadline.Store(t)
+	return nil
+}
+
+func (p *muxPool) close() error {
+	var err error
+	for _, c := range p.conns {
+		if c == nil {
+			continue
+		}
+		if cerr := c.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type muxReply struct {
+	pld *Pld
+	err error
+}
+
+// muxConn multiplexes requests over a connection to SCIOND. A reader goroutine
+// passes the replies to the waiting requests by request ID. If the connection
+// fails, all pending requests fail, and the next request reconnects.
+type muxConn struct {
+	path string
+	cfg  MuxConfig
+	// writeLock serializes the writes of requests.
+	writeLock sync.Mutex
+
+	lock sync.Mutex
+	// conn is nil if not connected.
+	conn net.Conn
+	// pending are the reply channels of the pending requests, by request ID.
+	pending  map[uint64]chan muxReply
+	lastDial time.Time
+	dialErr  error
+	closed   bool
+}
+
+func (c *muxConn) roundTrip(ctx context.Context, p *Pld) (*Pld, error) {
+	raw, err := proto.PackRoot(p)
+	if err != nil {
+		return nil, err
+	}
+	conn, replyC, err := c.register(ctx, p.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(p.Id)
+	if err := c.write(ctx, conn, raw); err != nil {
+		c.fail(conn, common.NewBasicError(ErrMuxConnLost, err))
+		return nil, err
+	}
+	select {
+	case reply := <-replyC:
+		return reply.pld, reply.err
+	case <-ctx.Done():
+		return nil, common.NewBasicError(ErrMuxCtxDone, ctx.Err(), "id", p.Id)
+	}
+}
+
+// register registers a pending request with ID id, connecting to SCIOND first
+// if necessary.
+func (c *muxConn) register(ctx context.Context, id uint64) (net.Conn, chan muxReply,
+	error) {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil, nil, common.NewBasicError(ErrMuxClosed, nil)
+	}
+	if c.conn == nil {
+		if time.Since(c.lastDial) < c.cfg.ReconnectInterval {
+			return nil, nil, common.NewBasicError(ErrMuxNotConnected, c.dialErr)
+		}
+		timeout := c.cfg.DialTimeout
+		if d, ok := ctx.Deadline(); ok && time.Until(d) < timeout {
+			timeout = time.Until(d)
+			if timeout <= 0 {
+				return nil, nil, common.NewBasicError(ErrMuxCtxDone, ctx.Err())
+			}
+		}
+		if err := c.dialLocked(timeout); err != nil {
+			return nil, nil, common.NewBasicError(ErrMuxNotConnected, err)
+		}
+	}
+	replyC := make(chan muxReply, 1)
+	c.pending[id] = replyC
+	return c.conn, replyC, nil
+}
+
+// down returns whether the connection failed, and the reconnect interval has
+// not passed since the last attempt to connect.
+func (c *muxConn) down() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.closed && c.conn == nil && time.Since(c.lastDial) < c.cfg.ReconnectInterval
+}
+
+func (c *muxConn) unregister(id uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, id)
+}
+
+func (c *muxConn) dial(timeout time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.dialLocked(timeout)
+}
+
+// dialLocked connects to SCIOND, and starts the reader goroutine. The caller
+// must hold the lock.
+func (c *muxConn) dialLocked(timeout time.Duration) error {
+	c.lastDial = time.Now()
+	conn, err := reliable.DialTimeout(c.path, timeout)
+	c.dialErr = err
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	go c.read(conn)
+	return nil
+}
+
+func (c *muxConn) write(ctx context.Context, conn net.Conn, raw []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	d, _ := ctx.Deadline()
+	if err := conn.SetWriteDeadline(d); err != nil {
+		return err
+	}
+	_, err := conn.Write(raw)
+	return err
+}
+
+// read passes the replies received on conn to the pending requests, until
+// conn fails.
+func (c *muxConn) read(conn net.Conn) {
+	for {
+		p := &Pld{}
+		if err := proto.ParseFromReader(p, proto.SCIONDMsg_TypeID, conn); err != nil {
+			c.fail(conn, common.NewBasicError(ErrMuxConnLost, err))
+			return
+		}
+		c.lock.Lock()
+		replyC, ok := c.pending[p.Id]
+		delete(c.pending, p.Id)
+		c.lock.Unlock()
+		// Replies to requests that are no longer pending are dropped.
+		if ok {
+			replyC <- muxReply{pld: p}
+		}
+	}
+}
+
+// fail closes conn, if it is still the current connection, and fails all
+// pending requests with err.
+func (c *muxConn) fail(conn net.Conn, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn != conn {
+		return
+	}
+	c.failLocked(err)
+}
+
+func (c *muxConn) failLocked(err error) {
+	c.conn.Close()
+	c.conn = nil
+	for id, replyC := range c.pending {
+		replyC <- muxReply{err: err}
+		delete(c.pending, id)
+	}
+}
+
+func (c *muxConn) close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.conn != nil {
+		c.failLocked(common.NewBasicError(ErrMuxClosed, nil))
+	}
+	return nil
+}
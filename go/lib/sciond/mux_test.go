@@ -0,0 +1,176 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sciond
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/proto"
+)
+
+// asInfoServer answers AS info requests concurrently, each after a delay of
+// as many milliseconds as the AS number of the requested IA. Replies are thus
+// sent out of order.
+type asInfoServer struct {
+	listener *reliable.Listener
+	lock     sync.Mutex
+	conns    []net.Conn
+}
+
+func newASInfoServer(path string) (*asInfoServer, error) {
+	l, err := reliable.Listen(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &asInfoServer{listener: l}
+	go s.serve()
+	return s, nil
+}
+
+func (s *asInfoServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *asInfoServer) handle(conn net.Conn) {
+	var writeLock sync.Mutex
+	for {
+		req := &Pld{}
+		if err := proto.ParseFromReader(req, proto.SCIONDMsg_TypeID, conn); err != nil {
+			return
+		}
+		go func() {
+			time.Sleep(time.Duration(req.AsInfoReq.Isdas.IA().A) * time.Millisecond)
+			reply := &Pld{Id: req.Id, Which: proto.SCIONDMsg_Which_asInfoReply}
+			reply.AsInfoReply.Entries = []ASInfoReplyEntry{{RawIsdas: req.AsInfoReq.Isdas}}
+			raw, err := proto.PackRoot(reply)
+			if err != nil {
+				return
+			}
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			conn.Write(raw)
+		}()
+	}
+}
+
+// dropConns closes all connections of clients.
+func (s *asInfoServer) dropConns() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *asInfoServer) Close() error {
+	s.dropConns()
+	return s.listener.Close()
+}
+
+func TestMuxConnector(t *testing.T) {
+	Convey("Given a mux connector with a pool of 2 connections", t, func() {
+		name := getRandFile()
+		srv, err := newASInfoServer(name)
+		SoMsg("listen err", err, ShouldBeNil)
+		Reset(func() { srv.Close() })
+		c, err := NewMuxService(name, &MuxConfig{PoolSize: 2,
+			ReconnectInterval: 10 * time.Millisecond}).Connect()
+		SoMsg("connect err", err, ShouldBeNil)
+		Reset(func() { c.Close() })
+		conn := c.(ContextConnector)
+
+		Convey("Concurrent requests receive their own replies", func() {
+			var wg sync.WaitGroup
+			errs := make([]error, 10)
+			replies := make([]*ASInfoReply, 10)
+			for i := range replies {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					ia := &addr.ISD_AS{I: 1, A: 50 - 5*i}
+					replies[i], errs[i] = conn.ASInfoCtx(context.Background(), ia)
+				}(i)
+			}
+			wg.Wait()
+			for i, reply := range replies {
+				SoMsg("err", errs[i], ShouldBeNil)
+				SoMsg("entries", len(reply.Entries), ShouldEqual, 1)
+				SoMsg("ia", reply.Entries[0].ISD_AS().A, ShouldEqual, 50-5*i)
+			}
+		})
+		Convey("A timed out request does not affect later ones", func() {
+			ctx, cancelF := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancelF()
+			_, err := conn.ASInfoCtx(ctx, &addr.ISD_AS{I: 1, A: 200})
+			SoMsg("timeout", common.IsTimeoutErr(err), ShouldBeTrue)
+			reply, err := conn.ASInfoCtx(context.Background(), &addr.ISD_AS{I: 1, A: 1})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("ia", reply.Entries[0].ISD_AS().A, ShouldEqual, 1)
+		})
+		Convey("The connector reconnects after the connections fail", func() {
+			srv.dropConns()
+			var reply *ASInfoReply
+			for i := 2; i < 100; i++ {
+				reply, err = conn.ASInfoCtx(context.Background(), &addr.ISD_AS{I: 1, A: i})
+				if err == nil {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("reply", reply, ShouldNotBeNil)
+		})
+		Convey("Requests skip connections waiting to reconnect", func() {
+			down := c.(*connector).rt.(*muxPool).conns[0]
+			down.lock.Lock()
+			down.failLocked(common.NewBasicError(ErrMuxConnLost, nil))
+			down.cfg.ReconnectInterval = time.Hour
+			down.lastDial = time.Now()
+			down.lock.Unlock()
+			for i := 1; i <= 4; i++ {
+				_, err := conn.ASInfoCtx(context.Background(), &addr.ISD_AS{I: 1, A: i})
+				SoMsg("err", err, ShouldBeNil)
+			}
+		})
+		Convey("The connector reconnects by itself", func() {
+			SoMsg("mux", Reconnects(c), ShouldBeTrue)
+			SoMsg("sync", Reconnects(newConnector(&syncConn{})), ShouldBeFalse)
+		})
+		Convey("Requests fail after the connector is closed", func() {
+			c.Close()
+			_, err := conn.ASInfoCtx(context.Background(), &addr.ISD_AS{I: 1, A: 1})
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrMuxClosed)
+		})
+	})
+}
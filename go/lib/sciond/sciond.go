@@ -21,12 +21,22 @@
 //
 // Connector method calls return the entire answer of SCIOND.
 //
+// The connectors of NewService send one request at a time, and a timed out
+// request leaves the connection unusable. The connectors of NewMuxService
+// instead multiplex concurrent requests over a pool of connections, reconnect
+// after failures, and can be bounded by per-call contexts (see
+// ContextConnector):
+//  conn, err := NewMuxService(path, &MuxConfig{PoolSize: 2}).Connect()
+//  ...
+//  reply, err := conn.(ContextConnector).PathsCtx(ctx, dst, src, max, flags)
+//
 // Fields prefixed with Raw (e.g., RawErrorCode) contain data in the format
 // received from SCIOND.  These are used internally, and the accessors without
 // the prefix (e.g., ErrorCode()) should be used instead.
 package sciond
 
 import (
+	"context"
 	"math/rand"
 	"net"
 	"strconv"
@@ -125,9 +135,38 @@ type Connector interface {
 	SetDeadline(t time.Time) error
 }
 
+// A ContextConnector is a Connector whose queries can be bounded by a
+// context. The context replaces the deadline set with SetDeadline.
+//
+// To check for exceeded deadlines, call common.IsTimeoutErr on the returned
+// error. Like with SetDeadline, a query aborted by its context desynchronizes
+// the protocol of connectors returned by NewService. Connectors returned by
+// NewMuxService are not affected.
+type ContextConnector interface {
+	Connector
+	PathsCtx(ctx context.Context, dst, src *addr.ISD_AS, max uint16,
+		f PathReqFlags) (*PathReply, error)
+	ASInfoCtx(ctx context.Context, ia *addr.ISD_AS) (*ASInfoReply, error)
+	IFInfoCtx(ctx context.Context, ifs []uint64) (*IFInfoReply, error)
+	SVCInfoCtx(ctx context.Context, svcTypes []ServiceType) (*ServiceInfoReply, error)
+	RevNotificationFromRawCtx(ctx context.Context, revInfo []byte) (*RevReply, error)
+	RevNotificationCtx(ctx context.Context, revInfo *path_mgmt.RevInfo) (*RevReply, error)
+}
+
+// roundTripper sends requests to SCIOND and returns the replies.
+type roundTripper interface {
+	// roundTrip sends request p and waits for the reply. The exchange is
+	// aborted when ctx is done.
+	roundTrip(ctx context.Context, p *Pld) (*Pld, error)
+	setDeadline(t time.Time) error
+	close() error
+}
+
+var _ ContextConnector = (*connector)(nil)
+
+// connector implements the caching of SCIOND replies on top of a roundTripper.
 type connector struct {
-	sync.Mutex
-	conn      net.Conn
+	rt        roundTripper
 	requestID uint64
 
 	asInfos  *cache.Cache
@@ -144,14 +183,18 @@ func connectTimeout(socketName string, timeout time.Duration) (*connector, error
 	if err != nil {
 		return nil, err
 	}
+	return newConnector(&syncConn{conn: conn}), nil
+}
+
+func newConnector(rt roundTripper) *connector {
 	rand.Seed(time.Now().UnixNano())
-	c := &connector{conn: conn, requestID: uint64(rand.Uint32())}
+	c := &connector{rt: rt, requestID: uint64(rand.Uint32())}
 
 	cleanupInterval := time.Minute
 	c.asInfos = cache.New(ASInfoTTL, cleanupInterval)
 	c.ifInfos = cache.New(IFInfoTTL, cleanupInterval)
 	c.svcInfos = cache.New(SVCInfoTTL, cleanupInterval)
-	return c, nil
+	return c
 }
 
 // Self incrementing atomic counter for request IDs
@@ -159,27 +202,12 @@ func (c *connector) nextID() uint64 {
 	return atomic.AddUint64(&c.requestID, 1)
 }
 
-func (c *connector) send(p *Pld) error {
-	raw, err := proto.PackRoot(p)
-	if err != nil {
-		return err
-	}
-	_, err = c.conn.Write(raw)
-	return err
-}
-
-func (c *connector) receive() (*Pld, error) {
-	p := &Pld{}
-	err := proto.ParseFromReader(p, proto.SCIONDMsg_TypeID, c.conn)
-	if err != nil {
-		return nil, err
-	}
-	return p, nil
+func (c *connector) Paths(dst, src *addr.ISD_AS, max uint16, f PathReqFlags) (*PathReply, error) {
+	return c.PathsCtx(context.Background(), dst, src, max, f)
 }
 
-func (c *connector) Paths(dst, src *addr.ISD_AS, max uint16, f PathReqFlags) (*PathReply, error) {
-	c.Lock()
-	defer c.Unlock()
+func (c *connector) PathsCtx(ctx context.Context, dst, src *addr.ISD_AS, max uint16,
+	f PathReqFlags) (*PathReply, error) {
 
 	request := &Pld{Id: c.nextID(), Which: proto.SCIONDMsg_Which_pathReq}
 	request.PathReq.Dst = dst.IAInt()
@@ -187,22 +215,18 @@ func (c *connector) Paths(dst, src *addr.ISD_AS, max uint16, f PathReqFlags) (*P
 	request.PathReq.MaxPaths = max
 	request.PathReq.Flags = f
 
-	err := c.send(request)
-	if err != nil {
-		return nil, err
-	}
-	reply, err := c.receive()
+	reply, err := c.rt.roundTrip(ctx, request)
 	if err != nil {
 		return nil, err
 	}
-
 	return &reply.PathReply, nil
 }
 
 func (c *connector) ASInfo(ia *addr.ISD_AS) (*ASInfoReply, error) {
-	c.Lock()
-	defer c.Unlock()
+	return c.ASInfoCtx(context.Background(), ia)
+}
 
+func (c *connector) ASInfoCtx(ctx context.Context, ia *addr.ISD_AS) (*ASInfoReply, error) {
 	// Check if information for this ISD-AS is cached
 	key := ia.String()
 	if value, found := c.asInfos.Get(key); found {
@@ -212,11 +236,7 @@ func (c *connector) ASInfo(ia *addr.ISD_AS) (*ASInfoReply, error) {
 	// Value not in cache, so we ask SCIOND
 	request := &Pld{Id: c.nextID(), Which: proto.SCIONDMsg_Which_asInfoReq}
 	request.AsInfoReq.Isdas = ia.IAInt()
-	err := c.send(request)
-	if err != nil {
-		return nil, err
-	}
-	reply, err := c.receive()
+	reply, err := c.rt.roundTrip(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -227,9 +247,10 @@ func (c *connector) ASInfo(ia *addr.ISD_AS) (*ASInfoReply, error) {
 }
 
 func (c *connector) IFInfo(ifs []uint64) (*IFInfoReply, error) {
-	c.Lock()
-	defer c.Unlock()
+	return c.IFInfoCtx(context.Background(), ifs)
+}
 
+func (c *connector) IFInfoCtx(ctx context.Context, ifs []uint64) (*IFInfoReply, error) {
 	// Store uncached interface IDs
 	uncachedIfs := make([]uint64, 0, len(ifs))
 	cachedEntries := make([]IFInfoReplyEntry, 0, len(ifs))
@@ -249,11 +270,7 @@ func (c *connector) IFInfo(ifs []uint64) (*IFInfoReply, error) {
 	// Some values were not in the cache, so we ask SCIOND for them
 	request := &Pld{Id: c.nextID(), Which: proto.SCIONDMsg_Which_ifInfoRequest}
 	request.IfInfoRequest.IfIDs = uncachedIfs
-	err := c.send(request)
-	if err != nil {
-		return nil, err
-	}
-	reply, err := c.receive()
+	reply, err := c.rt.roundTrip(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -272,8 +289,11 @@ func (c *connector) IFInfo(ifs []uint64) (*IFInfoReply, error) {
 }
 
 func (c *connector) SVCInfo(svcTypes []ServiceType) (*ServiceInfoReply, error) {
-	c.Lock()
-	defer c.Unlock()
+	return c.SVCInfoCtx(context.Background(), svcTypes)
+}
+
+func (c *connector) SVCInfoCtx(ctx context.Context,
+	svcTypes []ServiceType) (*ServiceInfoReply, error) {
 
 	// Store uncached SVC Types
 	uncachedSVCs := make([]ServiceType, 0, len(svcTypes))
@@ -294,11 +314,7 @@ func (c *connector) SVCInfo(svcTypes []ServiceType) (*ServiceInfoReply, error) {
 	// Some values were not in the cache, so we ask SCIOND for them
 	request := &Pld{Id: c.nextID(), Which: proto.SCIONDMsg_Which_serviceInfoRequest}
 	request.ServiceInfoRequest.ServiceTypes = uncachedSVCs
-	err := c.send(request)
-	if err != nil {
-		return nil, err
-	}
-	reply, err := c.receive()
+	reply, err := c.rt.roundTrip(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -314,38 +330,114 @@ func (c *connector) SVCInfo(svcTypes []ServiceType) (*ServiceInfoReply, error) {
 }
 
 func (c *connector) RevNotificationFromRaw(revInfo []byte) (*RevReply, error) {
+	return c.RevNotificationFromRawCtx(context.Background(), revInfo)
+}
+
+func (c *connector) RevNotificationFromRawCtx(ctx context.Context,
+	revInfo []byte) (*RevReply, error) {
+
 	// Extract information from notification
 	ri, err := path_mgmt.NewRevInfoFromRaw(revInfo)
 	if err != nil {
 		return nil, err
 	}
-	return c.RevNotification(ri)
+	return c.RevNotificationCtx(ctx, ri)
 }
 
 func (c *connector) RevNotification(revInfo *path_mgmt.RevInfo) (*RevReply, error) {
-	c.Lock()
-	defer c.Unlock()
+	return c.RevNotificationCtx(context.Background(), revInfo)
+}
+
+func (c *connector) RevNotificationCtx(ctx context.Context,
+	revInfo *path_mgmt.RevInfo) (*RevReply, error) {
 
 	// Encapsulate RevInfo item in RevNotification object
 	request := &Pld{Id: c.nextID(), Which: proto.SCIONDMsg_Which_revNotification}
 	request.RevNotification.RevInfo = revInfo
 
-	err := c.send(request)
+	reply, err := c.rt.roundTrip(ctx, request)
 	if err != nil {
 		return nil, err
 	}
-	reply, err := c.receive()
-	if err != nil {
-		return nil, err
-	}
-
 	return &reply.RevReply, nil
 }
 
 func (c *connector) Close() error {
-	return c.conn.Close()
+	return c.rt.close()
 }
 
 func (c *connector) SetDeadline(t time.Time) error {
+	return c.rt.setDeadline(t)
+}
+
+// syncConn sends one request at a time over a single connection, and waits for
+// its reply before sending the next one. If a context is passed that can be
+// done, it replaces the deadline set with setDeadline for the exchange.
+type syncConn struct {
+	// lock serializes the exchanges on conn.
+	lock         sync.Mutex
+	conn         net.Conn
+	deadlineLock sync.Mutex
+	deadline     time.Time
+}
+
+func (c *syncConn) roundTrip(ctx context.Context, p *Pld) (*Pld, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if ctx.Done() != nil {
+		d, _ := ctx.Deadline()
+		if err := c.conn.SetDeadline(d); err != nil {
+			return nil, err
+		}
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				// Unblock the exchange.
+				c.conn.SetDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-stopped
+			c.deadlineLock.Lock()
+			c.conn.SetDeadline(c.deadline)
+			c.deadlineLock.Unlock()
+		}()
+	}
+	if err := c.send(p); err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+func (c *syncConn) send(p *Pld) error {
+	raw, err := proto.PackRoot(p)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(raw)
+	return err
+}
+
+func (c *syncConn) receive() (*Pld, error) {
+	p := &Pld{}
+	err := proto.ParseFromReader(p, proto.SCIONDMsg_TypeID, c.conn)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *syncConn) setDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	c.deadline = t
 	return c.conn.SetDeadline(t)
 }
+
+func (c *syncConn) close() error {
+	return c.conn.Close()
+}
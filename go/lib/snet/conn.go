@@ -220,7 +220,9 @@ func (c *Conn) handleSCMPRev(hdr *scmp.Hdr, pkt *spkt.ScnPkt) {
 	}
 	log.Info("Received SCMP revocation", "header", hdr.String(), "payload", scmpPayload.String())
 	// Extract RevInfo buffer and send it to path manager
-	c.scionNet.pathResolver.Revoke(info.RevToken)
+	if c.scionNet.pathResolver != nil {
+		c.scionNet.pathResolver.Revoke(info.RevToken)
+	}
 }
 
 // WriteToSCION sends b to raddr.
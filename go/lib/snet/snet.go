@@ -113,7 +113,7 @@ func NewNetworkBasic(ia *addr.ISD_AS, sPath string, dPath string) *Network {
 // dispatcher at dPath, and ia for the local ISD-AS.
 func NewNetwork(ia *addr.ISD_AS, sPath string, dPath string) (*Network, error) {
 	network := NewNetworkBasic(ia, sPath, dPath)
-	sd := sciond.NewService(sPath)
+	sd := sciond.NewMuxService(sPath, nil)
 	timers := &pathmgr.Timers{
 		NormalRefire: time.Minute,
 		ErrorRefire:  3 * time.Second,
@@ -0,0 +1,122 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reliable
+
+import (
+	"fmt"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+const (
+	ErrorRegTruncated = "Truncated registration"
+	ErrorRegCommand   = "Invalid registration command"
+	ErrorRegProto     = "Unsupported L4 protocol in registration"
+	ErrorRegAddr      = "Invalid address in registration"
+)
+
+const (
+	regRegisterFlag = 0x01
+	regSCMPFlag     = 0x02
+)
+
+// Registration is a registration request received by a dispatcher.
+type Registration struct {
+	// SCMP is set if the application wants to receive SCMP errors.
+	SCMP bool
+	IA   *addr.ISD_AS
+	// Public is the address packets are delivered to. A port of 0 requests a port to be
+	// assigned by the dispatcher.
+	Public *AppAddr
+	// Bind is the optional bind address, packets addressed to it are delivered as well.
+	Bind *AppAddr
+	// SVC is the service address the application registered for, or addr.SvcNone.
+	SVC addr.HostSVC
+}
+
+// ParseRegistration parses the payload of a registration message, see the package
+// documentation for the format. It is meant to be used by dispatchers, on the first message
+// received from a client.
+func ParseRegistration(b common.RawBytes) (*Registration, error) {
+	if len(b) < 8 {
+		return nil, common.NewBasicError(ErrorRegTruncated, nil, "len", len(b))
+	}
+	cmd := b[0]
+	if cmd&regRegisterFlag == 0 {
+		return nil, common.NewBasicError(ErrorRegCommand, nil, "cmd", cmd)
+	}
+	if proto := common.L4ProtocolType(b[1]); proto != common.L4UDP {
+		return nil, common.NewBasicError(ErrorRegProto, nil, "proto", proto)
+	}
+	reg := &Registration{SCMP: cmd&regSCMPFlag != 0, IA: addr.IAFromRaw(b[2:]), SVC: addr.SvcNone}
+	port := common.Order.Uint16(b[6:])
+	offset := 8
+	var err error
+	if reg.Public, offset, err = parseRegAddr(b, offset, port); err != nil {
+		return nil, err
+	}
+	if cmd&regBindFlag != 0 {
+		if len(b) < offset+2 {
+			return nil, common.NewBasicError(ErrorRegTruncated, nil, "len", len(b))
+		}
+		bindPort := common.Order.Uint16(b[offset:])
+		if reg.Bind, offset, err = parseRegAddr(b, offset+2, bindPort); err != nil {
+			return nil, err
+		}
+	}
+	switch len(b) - offset {
+	case 0:
+	case 2:
+		reg.SVC = addr.HostSVC(common.Order.Uint16(b[offset:]))
+	default:
+		return nil, common.NewBasicError(ErrorRegTruncated, nil, "len", len(b),
+			"trailing", len(b)-offset)
+	}
+	return reg, nil
+}
+
+// parseRegAddr parses the address type and address at offset in b, and returns the address
+// together with the offset following it.
+func parseRegAddr(b common.RawBytes, offset int, port uint16) (*AppAddr, int, error) {
+	if len(b) < offset+1 {
+		return nil, 0, common.NewBasicError(ErrorRegTruncated, nil, "len", len(b))
+	}
+	t := addr.HostAddrType(b[offset])
+	if t != addr.HostTypeIPv4 && t != addr.HostTypeIPv6 {
+		return nil, 0, common.NewBasicError(ErrorRegAddr, nil, "type", t)
+	}
+	offset++
+	l, _ := addr.HostLen(t)
+	if len(b) < offset+int(l) {
+		return nil, 0, common.NewBasicError(ErrorRegTruncated, nil, "len", len(b))
+	}
+	host, err := addr.HostFromRaw(b[offset:offset+int(l)], t)
+	if err != nil {
+		return nil, 0, common.NewBasicError(ErrorRegAddr, err)
+	}
+	return &AppAddr{Addr: host.Copy(), Port: port}, offset + int(l), nil
+}
+
+func (r *Registration) String() string {
+	s := fmt.Sprintf("%s %s:%d", r.IA, r.Public.Addr, r.Public.Port)
+	if r.Bind != nil {
+		s += fmt.Sprintf(" bind %s:%d", r.Bind.Addr, r.Bind.Port)
+	}
+	if r.SVC != addr.SvcNone {
+		s += fmt.Sprintf(" svc %s", r.SVC)
+	}
+	return s
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regtable contains the table of registered applications of a dispatcher.
+//
+// Applications register a public address, an optional bind address, and an optional SVC
+// address, see reliable.Registration. The table assigns free ports to registrations that do
+// not request a specific port, and maps the destination addresses of packets to the values
+// stored with the registrations, e.g., the connections to the applications.
+package regtable
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+)
+
+const (
+	ErrorPortTaken  = "Requested port not available"
+	ErrorNoPorts    = "No available ports"
+	ErrorMaxSvcApps = "Reached maximum number of applications for SVC address"
+)
+
+const (
+	// MinPort and MaxPort bound the ports assigned by the table.
+	MinPort = 1025
+	MaxPort = 65535
+	// MaxSvcApps is the maximum number of applications registered for the same SVC address
+	// on the same host.
+	MaxSvcApps = 10
+)
+
+// udpKey identifies the destination of a SCION/UDP packet.
+type udpKey struct {
+	ia   addr.IAInt
+	host string
+	port uint16
+}
+
+func newUDPKey(ia *addr.ISD_AS, a *reliable.AppAddr) udpKey {
+	return udpKey{ia: ia.IAInt(), host: string(a.Addr.Pack()), port: a.Port}
+}
+
+// svcKey identifies the applications registered for a SVC address in an ISD-AS. The
+// multicast bit of the SVC address is ignored.
+type svcKey struct {
+	ia  addr.IAInt
+	svc addr.HostSVC
+}
+
+func newSvcKey(ia *addr.ISD_AS, svc addr.HostSVC) svcKey {
+	return svcKey{ia: ia.IAInt(), svc: svc.Base()}
+}
+
+type entry struct {
+	reg   *reliable.Registration
+	value interface{}
+}
+
+// Table maps destination addresses to the values of the registered applications. It is safe
+// for concurrent use.
+type Table struct {
+	mu      sync.RWMutex
+	udp     map[udpKey]*entry
+	bindUDP map[udpKey]*entry
+	// svc contains the entries registered for a SVC address, in the order of registration.
+	svc map[svcKey][]*entry
+	// nextPort is the next port candidate to be assigned.
+	nextPort uint16
+}
+
+func New() *Table {
+	return &Table{
+		udp:      make(map[udpKey]*entry),
+		bindUDP:  make(map[udpKey]*entry),
+		svc:      make(map[svcKey][]*entry),
+		nextPort: MinPort + uint16(rand.Intn(MaxPort-MinPort+1)),
+	}
+}
+
+// Register adds reg to the table, with value v. Unset ports in reg are replaced by the
+// assigned ports. If any of the addresses is taken, the table is not modified.
+func (t *Table) Register(reg *reliable.Registration, v interface{}) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pubPort, err := t.allocPort(t.udp, newUDPKey(reg.IA, reg.Public))
+	if err != nil {
+		return err
+	}
+	var bindPort uint16
+	if reg.Bind != nil {
+		if bindPort, err = t.allocPort(t.bindUDP, newUDPKey(reg.IA, reg.Bind)); err != nil {
+			return err
+		}
+	}
+	if reg.SVC != addr.SvcNone {
+		n := 0
+		for _, e := range t.svc[newSvcKey(reg.IA, reg.SVC)] {
+			if addr.HostEq(e.reg.Public.Addr, reg.Public.Addr) {
+				n++
+			}
+		}
+		if n >= MaxSvcApps {
+			return common.NewBasicError(ErrorMaxSvcApps, nil, "svc", reg.SVC,
+				"host", reg.Public.Addr)
+		}
+	}
+	e := &entry{reg: reg, value: v}
+	reg.Public.Port = pubPort
+	t.udp[newUDPKey(reg.IA, reg.Public)] = e
+	if reg.Bind != nil {
+		reg.Bind.Port = bindPort
+		t.bindUDP[newUDPKey(reg.IA, reg.Bind)] = e
+	}
+	if reg.SVC != addr.SvcNone {
+		k := newSvcKey(reg.IA, reg.SVC)
+		t.svc[k] = append(t.svc[k], e)
+	}
+	return nil
+}
+
+// allocPort returns the port of k, if it is not taken in m. If the port of k is 0, the next
+// free port is returned instead.
+func (t *Table) allocPort(m map[udpKey]*entry, k udpKey) (uint16, error) {
+	if k.port != 0 {
+		if _, ok := m[k]; ok {
+			return 0, common.NewBasicError(ErrorPortTaken, nil, "port", k.port)
+		}
+		return k.port, nil
+	}
+	for i := 0; i <= MaxPort-MinPort; i++ {
+		k.port = t.nextPort
+		if t.nextPort == MaxPort {
+			t.nextPort = MinPort
+		} else {
+			t.nextPort++
+		}
+		if _, ok := m[k]; !ok {
+			return k.port, nil
+		}
+	}
+	return 0, common.NewBasicError(ErrorNoPorts, nil)
+}
+
+// Unregister removes all entries of reg, which must have been passed to a successful call to
+// Register, from the table.
+func (t *Table) Unregister(reg *reliable.Registration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if k := newUDPKey(reg.IA, reg.Public); t.udp[k] != nil && t.udp[k].reg == reg {
+		delete(t.udp, k)
+	}
+	if reg.Bind != nil {
+		k := newUDPKey(reg.IA, reg.Bind)
+		if t.bindUDP[k] != nil && t.bindUDP[k].reg == reg {
+			delete(t.bindUDP, k)
+		}
+	}
+	if reg.SVC == addr.SvcNone {
+		return
+	}
+	k := newSvcKey(reg.IA, reg.SVC)
+	entries := t.svc[k]
+	for i, e := range entries {
+		if e.reg == reg {
+			entries = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(t.svc, k)
+	} else {
+		t.svc[k] = entries
+	}
+}
+
+// LookupUDP returns the value of the application registered for port on host in ia, either
+// as public or as bind address. It returns nil, if there is none.
+func (t *Table) LookupUDP(ia *addr.ISD_AS, host addr.HostAddr, port uint16) interface{} {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	k := newUDPKey(ia, &reliable.AppAddr{Addr: host, Port: port})
+	if e, ok := t.udp[k]; ok {
+		return e.value
+	}
+	if e, ok := t.bindUDP[k]; ok {
+		return e.value
+	}
+	return nil
+}
+
+// LookupSvc returns the values of the applications registered for svc on host in ia, in the
+// order of registration. Applications registered with host as public address take precedence
+// over the ones registered with host as bind address. If host is nil, the applications on all
+// hosts in ia are returned. Picking one of the applications for anycast SVC addresses is left
+// to the caller.
+func (t *Table) LookupSvc(ia *addr.ISD_AS, host addr.HostAddr, svc addr.HostSVC) []interface{} {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var values []interface{}
+	for _, e := range t.svcEntries(ia, host, svc) {
+		values = append(values, e.value)
+	}
+	return values
+}
+
+// svcEntries returns the entries registered for svc on host in ia, see LookupSvc. The caller
+// must hold the lock.
+func (t *Table) svcEntries(ia *addr.ISD_AS, host addr.HostAddr, svc addr.HostSVC) []*entry {
+	entries := t.svc[newSvcKey(ia, svc)]
+	if host == nil {
+		return entries
+	}
+	var pub, bind []*entry
+	for _, e := range entries {
+		if addr.HostEq(e.reg.Public.Addr, host) {
+			pub = append(pub, e)
+		} else if e.reg.Bind != nil && addr.HostEq(e.reg.Bind.Addr, host) {
+			bind = append(bind, e)
+		}
+	}
+	if len(pub) > 0 {
+		return pub
+	}
+	return bind
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regtable
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+)
+
+var (
+	ia    = &addr.ISD_AS{I: 1, A: 10}
+	host1 = addr.HostFromIP(net.IPv4(127, 0, 0, 1))
+	host2 = addr.HostFromIP(net.IPv4(127, 0, 0, 2))
+)
+
+func newReg(host addr.HostAddr, port uint16, svc addr.HostSVC) *reliable.Registration {
+	return &reliable.Registration{
+		IA:     ia,
+		Public: &reliable.AppAddr{Addr: host, Port: port},
+		SVC:    svc,
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Convey("Given a table", t, func() {
+		tbl := New()
+		Convey("Requested ports are assigned", func() {
+			reg := newReg(host1, 40000, addr.SvcNone)
+			SoMsg("err", tbl.Register(reg, "a"), ShouldBeNil)
+			SoMsg("port", reg.Public.Port, ShouldEqual, 40000)
+			SoMsg("lookup", tbl.LookupUDP(ia, host1, 40000), ShouldEqual, "a")
+			SoMsg("other host", tbl.LookupUDP(ia, host2, 40000), ShouldBeNil)
+			SoMsg("other ia", tbl.LookupUDP(&addr.ISD_AS{I: 1, A: 11}, host1, 40000),
+				ShouldBeNil)
+		})
+		Convey("Taken ports are rejected", func() {
+			SoMsg("first", tbl.Register(newReg(host1, 40000, addr.SvcNone), "a"), ShouldBeNil)
+			err := tbl.Register(newReg(host1, 40000, addr.SvcNone), "b")
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorPortTaken)
+			SoMsg("other host", tbl.Register(newReg(host2, 40000, addr.SvcNone), "c"),
+				ShouldBeNil)
+			SoMsg("lookup", tbl.LookupUDP(ia, host1, 40000), ShouldEqual, "a")
+		})
+		Convey("Free ports are assigned to registrations without port", func() {
+			reg1 := newReg(host1, 0, addr.SvcNone)
+			reg2 := newReg(host1, 0, addr.SvcNone)
+			SoMsg("err1", tbl.Register(reg1, "a"), ShouldBeNil)
+			SoMsg("err2", tbl.Register(reg2, "b"), ShouldBeNil)
+			SoMsg("port1", reg1.Public.Port, ShouldBeGreaterThanOrEqualTo, MinPort)
+			SoMsg("port2", reg2.Public.Port, ShouldBeGreaterThanOrEqualTo, MinPort)
+			SoMsg("distinct", reg1.Public.Port, ShouldNotEqual, reg2.Public.Port)
+			SoMsg("lookup1", tbl.LookupUDP(ia, host1, reg1.Public.Port), ShouldEqual, "a")
+			SoMsg("lookup2", tbl.LookupUDP(ia, host1, reg2.Public.Port), ShouldEqual, "b")
+		})
+		Convey("Port assignment wraps around", func() {
+			tbl.nextPort = MaxPort
+			reg1 := newReg(host1, 0, addr.SvcNone)
+			reg2 := newReg(host1, 0, addr.SvcNone)
+			tbl.Register(reg1, "a")
+			tbl.Register(reg2, "b")
+			SoMsg("port1", reg1.Public.Port, ShouldEqual, MaxPort)
+			SoMsg("port2", reg2.Public.Port, ShouldEqual, MinPort)
+		})
+		Convey("Bind addresses are looked up", func() {
+			reg := newReg(host1, 40000, addr.SvcNone)
+			reg.Bind = &reliable.AppAddr{Addr: host2, Port: 0}
+			SoMsg("err", tbl.Register(reg, "a"), ShouldBeNil)
+			SoMsg("bind port", reg.Bind.Port, ShouldNotEqual, 0)
+			SoMsg("lookup", tbl.LookupUDP(ia, host2, reg.Bind.Port), ShouldEqual, "a")
+		})
+		Convey("Unregistered applications are removed", func() {
+			reg := newReg(host1, 40000, addr.SvcPS)
+			reg.Bind = &reliable.AppAddr{Addr: host2, Port: 40001}
+			tbl.Register(reg, "a")
+			tbl.Unregister(reg)
+			SoMsg("public", tbl.LookupUDP(ia, host1, 40000), ShouldBeNil)
+			SoMsg("bind", tbl.LookupUDP(ia, host2, 40001), ShouldBeNil)
+			SoMsg("svc", tbl.LookupSvc(ia, nil, addr.SvcPS), ShouldBeEmpty)
+			SoMsg("reregister", tbl.Register(newReg(host1, 40000, addr.SvcNone), "b"),
+				ShouldBeNil)
+		})
+	})
+}
+
+func TestLookupSvc(t *testing.T) {
+	Convey("Given a table with SVC registrations", t, func() {
+		tbl := New()
+		tbl.Register(newReg(host1, 0, addr.SvcPS), "ps1")
+		tbl.Register(newReg(host1, 0, addr.SvcCS), "cs")
+		tbl.Register(newReg(host2, 0, addr.SvcPS), "ps2")
+		bindReg := newReg(host2, 0, addr.SvcPS)
+		bindReg.Bind = &reliable.AppAddr{Addr: host1, Port: 0}
+		tbl.Register(bindReg, "ps3")
+		Convey("Applications are looked up by host", func() {
+			SoMsg("host1", tbl.LookupSvc(ia, host1, addr.SvcPS), ShouldResemble,
+				[]interface{}{"ps1"})
+			SoMsg("host2", tbl.LookupSvc(ia, host2, addr.SvcPS), ShouldResemble,
+				[]interface{}{"ps2", "ps3"})
+		})
+		Convey("The multicast bit is ignored", func() {
+			SoMsg("multicast", tbl.LookupSvc(ia, host1, addr.SvcPS.Multicast()),
+				ShouldResemble, []interface{}{"ps1"})
+		})
+		Convey("A nil host matches all hosts", func() {
+			SoMsg("all", tbl.LookupSvc(ia, nil, addr.SvcPS), ShouldResemble,
+				[]interface{}{"ps1", "ps2", "ps3"})
+		})
+		Convey("Bind addresses are used if no public address matches", func() {
+			tbl.Unregister(bindReg)
+			reg := newReg(host2, 0, addr.SvcBS)
+			reg.Bind = &reliable.AppAddr{Addr: host1, Port: 0}
+			tbl.Register(reg, "bs")
+			SoMsg("bind", tbl.LookupSvc(ia, host1, addr.SvcBS), ShouldResemble,
+				[]interface{}{"bs"})
+		})
+		Convey("The number of applications per SVC address and host is limited", func() {
+			for i := 1; i < MaxSvcApps; i++ {
+				SoMsg("register", tbl.Register(newReg(host1, 0, addr.SvcPS), i), ShouldBeNil)
+			}
+			err := tbl.Register(newReg(host1, 0, addr.SvcPS), "over")
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorMaxSvcApps)
+			SoMsg("other host", tbl.Register(newReg(host2, 0, addr.SvcPS), "ok"), ShouldBeNil)
+		})
+	})
+}
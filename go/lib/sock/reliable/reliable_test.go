@@ -225,6 +225,44 @@ func TestWriteTo(t *testing.T) {
 	})
 }
 
+func TestParseRegistration(t *testing.T) {
+	Convey("Parse registration messages", t, func() {
+		ia := &addr.ISD_AS{I: 2, A: 21}
+		Convey("Public address", func() {
+			reg, err := ParseRegistration([]byte{3, 17, 0, 32, 0, 21, 0, 80, 1, 127, 0, 0, 1})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("scmp", reg.SCMP, ShouldBeTrue)
+			SoMsg("ia", reg.IA, ShouldResemble, ia)
+			SoMsg("public addr", reg.Public.Addr.IP().Equal(net.IPv4(127, 0, 0, 1)),
+				ShouldBeTrue)
+			SoMsg("public port", reg.Public.Port, ShouldEqual, 80)
+			SoMsg("bind", reg.Bind, ShouldBeNil)
+			SoMsg("svc", reg.SVC, ShouldEqual, addr.SvcNone)
+		})
+		Convey("Bind address and SVC", func() {
+			reg, err := ParseRegistration([]byte{7, 17, 0, 32, 0, 21, 0, 80, 1, 127, 0, 0, 1,
+				0, 81, 1, 127, 0, 0, 2, 0, 2})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("bind", reg.Bind, ShouldNotBeNil)
+			SoMsg("bind addr", reg.Bind.Addr.IP().Equal(net.IPv4(127, 0, 0, 2)), ShouldBeTrue)
+			SoMsg("bind port", reg.Bind.Port, ShouldEqual, 81)
+			SoMsg("svc", reg.SVC, ShouldEqual, addr.SvcCS)
+		})
+		Convey("Unsupported L4 protocol", func() {
+			_, err := ParseRegistration([]byte{3, 6, 0, 32, 0, 21, 0, 80, 1, 127, 0, 0, 1})
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+		Convey("Truncated address", func() {
+			_, err := ParseRegistration([]byte{3, 17, 0, 32, 0, 21, 0, 80, 1, 127, 0})
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+		Convey("Trailing bytes", func() {
+			_, err := ParseRegistration([]byte{3, 17, 0, 32, 0, 21, 0, 80, 1, 127, 0, 0, 1, 0})
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+	})
+}
+
 func server(sc *xtest.SC, tc *TestCase, listener *Listener) {
 	err := listener.SetDeadline(time.Now().Add(time.Second))
 	sc.SoMsg("listener deadline err", err, ShouldBeNil)
@@ -0,0 +1,160 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+const (
+	ErrExport = "Unable to export trust object"
+	ErrImport = "Unable to import trust object"
+)
+
+// Export writes all trust objects in the store to dir, using the file names of the certificate
+// directory. It returns the number of written files.
+func (s *Store) Export(dir string) (int, error) {
+	var objs []JSON
+	var names []string
+	s.trcLock.RLock()
+	for key, t := range s.trcMap {
+		objs = append(objs, t)
+		names = append(names, fmt.Sprintf("ISD%d-V%d.trc", key.ISD, key.Ver))
+	}
+	s.trcLock.RUnlock()
+	s.revListLock.RLock()
+	for key, r := range s.revListMap {
+		objs = append(objs, r)
+		names = append(names, fmt.Sprintf("ISD%d-AS%d-V%d.crl", key.IA.I, key.IA.A, key.Ver))
+	}
+	s.revListLock.RUnlock()
+	s.chainLock.RLock()
+	for key, chain := range s.chainMap {
+		objs = append(objs, chain)
+		names = append(names, fmt.Sprintf("ISD%d-AS%d-V%d.crt", key.IA.I, key.IA.A, key.Ver))
+	}
+	s.chainLock.RUnlock()
+	for i, obj := range objs {
+		raw, err := obj.JSON(true)
+		if err != nil {
+			return i, common.NewBasicError(ErrExport, err, "name", names[i])
+		}
+		path := filepath.Join(dir, names[i])
+		if err = ioutil.WriteFile(path, raw, 0644); err != nil {
+			return i, common.NewBasicError(ErrExport, err, "file", path)
+		}
+	}
+	return len(objs), nil
+}
+
+// Import adds the trust objects in the TRC (*.trc), revocation list (*.crl) and certificate chain
+// (*.crt) files in dir to the store, and writes them to the database. If verify is true, the
+// objects are verified (see AddTRCVerified, AddRevListVerified and AddChainVerified). Otherwise,
+// they are trusted as is, like the objects in the certificate directory. TRCs are imported in
+// order of increasing version, such that updates can be verified against their predecessors. It
+// returns the number of imported objects.
+func (s *Store) Import(dir string, verify bool) (int, error) {
+	var trcs []*trc.TRC
+	err := readDir(dir, "*.trc", func(raw common.RawBytes) error {
+		t, err := trc.TRCFromRaw(raw, false)
+		trcs = append(trcs, t)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(trcs, func(i, j int) bool {
+		return trcs[i].ISD < trcs[j].ISD ||
+			(trcs[i].ISD == trcs[j].ISD && trcs[i].Version < trcs[j].Version)
+	})
+	var revLists []*cert.RevList
+	err = readDir(dir, "*.crl", func(raw common.RawBytes) error {
+		r, err := cert.RevListFromRaw(raw, false)
+		revLists = append(revLists, r)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var chains []*cert.Chain
+	err = readDir(dir, "*.crt", func(raw common.RawBytes) error {
+		chain, err := cert.ChainFromRaw(raw, false)
+		chains = append(chains, chain)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, t := range trcs {
+		if verify {
+			err = s.AddTRCVerified(t, true)
+		} else {
+			err = s.AddTRC(t, true)
+		}
+		if err != nil {
+			return n, common.NewBasicError(ErrImport, err, "trc", t.Key())
+		}
+		n++
+	}
+	for _, r := range revLists {
+		if verify {
+			err = s.AddRevListVerified(r, true)
+		} else {
+			err = s.AddRevList(r, true)
+		}
+		if err != nil {
+			return n, common.NewBasicError(ErrImport, err, "revList", r.Key())
+		}
+		n++
+	}
+	for _, chain := range chains {
+		if verify {
+			err = s.AddChainVerified(chain, true)
+		} else {
+			err = s.AddChain(chain, true)
+		}
+		if err != nil {
+			return n, common.NewBasicError(ErrImport, err, "chain", chain.Key())
+		}
+		n++
+	}
+	return n, nil
+}
+
+// readDir calls parse for the content of each file in dir matching pattern.
+func readDir(dir, pattern string, parse func(common.RawBytes) error) error {
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return common.NewBasicError(ErrImport, err, "dir", dir)
+	}
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return common.NewBasicError(ErrImport, err, "file", file)
+		}
+		if err = parse(raw); err != nil {
+			return common.NewBasicError(ErrImport, err, "file", file)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package issue implements the customer side of online certificate chain
+// issuance.
+//
+// A non-core (customer) AS requests a new certificate chain from the
+// certificate server of the core AS it is a customer of. The request contains
+// the desired certificate, most importantly the new subject signing key, and
+// is signed with the current signing key of the customer, using a
+// crypto.Signer. The core AS replaces
+// its copy of the customer's verifying key with the new key, and replies with
+// the issued chain:
+//
+//	c := issue.NewClient(conn)
+//	chain, err := c.Request(crt, src, signer, signAlgo, csAddr, 5*time.Second)
+//
+// The issued chain is not verified against a TRC. Callers should use
+// trust.Store.VerifyChain before using it.
+package issue
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/proto"
+)
+
+const (
+	ErrTimeout      = "Timeout waiting for certificate chain issuance reply"
+	ErrInvalidReply = "Issued certificate chain does not match request"
+
+	maxReadBufSize = 2 << 16
+)
+
+// NewReq creates a certificate chain issuance request for the desired certificate crt. The
+// request is signed by signer with the current signing key of the subject, as described by src.
+// signAlgo is the signature algorithm of the current certificate of the subject.
+func NewReq(crt *cert.Certificate, src *ctrl.SignSrcDef, signer crypto.Signer,
+	signAlgo string) (*ctrl.SignedPld, error) {
+
+	raw, err := crt.JSON(false)
+	if err != nil {
+		return nil, common.NewBasicError("Unable to pack certificate", err)
+	}
+	cpld, err := ctrl.NewCertMgmtPld(&cert_mgmt.ChainIssReq{RawCert: raw}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	signType, err := proto.SignTypeFromAlgo(signAlgo)
+	if err != nil {
+		return nil, err
+	}
+	sign := proto.NewSignS(signType, src.Pack())
+	return cpld.SignedPld(ctrl.NewBasicSignerWith(sign, signer))
+}
+
+// Client requests certificate chains from the certificate server of a core AS.
+type Client struct {
+	conn *snet.Conn
+	buf  common.RawBytes
+}
+
+// NewClient creates a client which uses conn to send requests and receive replies. The client
+// consumes all packets received on conn while waiting for a reply, so conn should not be shared.
+func NewClient(conn *snet.Conn) *Client {
+	return &Client{conn: conn, buf: make(common.RawBytes, maxReadBufSize)}
+}
+
+// Request requests a new certificate chain for the desired certificate crt from the certificate
+// server at dst, and waits for the reply until timeout. See NewReq for the remaining arguments.
+func (c *Client) Request(crt *cert.Certificate, src *ctrl.SignSrcDef, signer crypto.Signer,
+	signAlgo string, dst *snet.Addr, timeout time.Duration) (*cert.Chain, error) {
+
+	spld, err := NewReq(crt, src, signer, signAlgo)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := spld.PackPld()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer c.conn.SetReadDeadline(time.Time{})
+	if _, err = c.conn.WriteToSCION(raw, dst); err != nil {
+		return nil, common.NewBasicError("Unable to send certificate chain issuance request",
+			err, "dst", dst)
+	}
+	for {
+		rep, err := c.read(dst)
+		if err != nil {
+			return nil, err
+		}
+		if rep == nil {
+			continue
+		}
+		chain, err := rep.Chain()
+		if err != nil {
+			return nil, err
+		}
+		if !chain.Leaf.Subject.Eq(crt.Subject) ||
+			!bytes.Equal(chain.Leaf.SubjectSignKey, crt.SubjectSignKey) {
+			return nil, common.NewBasicError(ErrInvalidReply, nil, "chain", chain)
+		}
+		return chain, nil
+	}
+}
+
+// read reads the next packet from the connection. It returns nil, if the packet is not a
+// certificate chain issuance reply from the AS of dst.
+func (c *Client) read(dst *snet.Addr) (*cert_mgmt.ChainIssRep, error) {
+	n, from, err := c.conn.ReadFromSCION(c.buf)
+	if err != nil {
+		if common.IsTimeoutErr(err) {
+			return nil, common.NewBasicError(ErrTimeout, err, "dst", dst)
+		}
+		return nil, err
+	}
+	if !from.IA.Eq(dst.IA) {
+		return nil, nil
+	}
+	signed, err := ctrl.NewSignedPldFromRaw(c.buf[:n])
+	if err != nil {
+		return nil, nil
+	}
+	cpld, err := signed.Pld()
+	if err != nil {
+		return nil, nil
+	}
+	certPld, _, err := cpld.GetCertMgmt()
+	if err != nil {
+		return nil, nil
+	}
+	u, err := certPld.Union()
+	if err != nil {
+		return nil, nil
+	}
+	rep, _ := u.(*cert_mgmt.ChainIssRep)
+	return rep, nil
+}
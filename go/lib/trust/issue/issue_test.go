@@ -0,0 +1,76 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issue
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/ctrl"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/proto"
+)
+
+func Test_NewReq(t *testing.T) {
+	Convey("NewReq creates a signed issuance request", t, func() {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		newPub, _, _ := ed25519.GenerateKey(nil)
+		ia := &addr.ISD_AS{I: 1, A: 10}
+		crt := &cert.Certificate{Subject: ia, SubjectSignKey: []byte(newPub),
+			SignAlgorithm: crypto.Ed25519, Version: 2}
+		src := &ctrl.SignSrcDef{IA: ia, ChainVer: 1, TRCVer: 1}
+		spld, err := NewReq(crt, src, crypto.NewKeySigner([]byte(priv)), crypto.Ed25519)
+		SoMsg("err", err, ShouldBeNil)
+		Convey("The signature is verifiable with the current key", func() {
+			SoMsg("verify", spld.Sign.Verify([]byte(pub), spld.Blob), ShouldBeNil)
+			SoMsg("verify new", spld.Sign.Verify([]byte(newPub), spld.Blob), ShouldNotBeNil)
+			pSrc, err := ctrl.NewSignSrcDefFromRaw(spld.Sign.Src)
+			SoMsg("src err", err, ShouldBeNil)
+			SoMsg("src", pSrc, ShouldResemble, src)
+		})
+		Convey("The request contains the desired certificate", func() {
+			cpld, err := spld.Pld()
+			SoMsg("pld err", err, ShouldBeNil)
+			certPld, _, err := cpld.GetCertMgmt()
+			SoMsg("cert mgmt err", err, ShouldBeNil)
+			u, err := certPld.Union()
+			SoMsg("union err", err, ShouldBeNil)
+			req, ok := u.(*cert_mgmt.ChainIssReq)
+			SoMsg("type", ok, ShouldBeTrue)
+			pCrt, err := req.Cert()
+			SoMsg("cert err", err, ShouldBeNil)
+			SoMsg("cert", pCrt.Eq(crt), ShouldBeTrue)
+		})
+	})
+	Convey("NewReq signs with the algorithm of the current key", t, func() {
+		pub, priv, _ := crypto.GenKeyPair(crypto.ECDSAP256)
+		ia := &addr.ISD_AS{I: 1, A: 10}
+		crt := &cert.Certificate{Subject: ia, SubjectSignKey: pub,
+			SignAlgorithm: crypto.ECDSAP256, Version: 2}
+		src := &ctrl.SignSrcDef{IA: ia, ChainVer: 1, TRCVer: 1}
+		spld, err := NewReq(crt, src, crypto.NewKeySigner(priv), crypto.ECDSAP256)
+		SoMsg("err", err, ShouldBeNil)
+		SoMsg("type", spld.Sign.Type, ShouldEqual, proto.SignType_ecdsap256)
+		SoMsg("verify", spld.Sign.Verify(pub, spld.Blob), ShouldBeNil)
+		_, err = NewReq(crt, src, crypto.NewKeySigner(priv), "rsa")
+		SoMsg("unsupported", err, ShouldNotBeNil)
+	})
+}
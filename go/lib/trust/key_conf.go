@@ -15,25 +15,27 @@
 package trust
 
 import (
-	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
 
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
 )
 
+// KeyConf holds the AS level keys. The private keys used for signing are only accessible through
+// signers, such that they can be kept in encrypted key files or in a PKCS#11 token.
 type KeyConf struct {
-	// CoreSigKey is the AS core signing Key.
-	CoreSigKey common.RawBytes
+	// CoreSigner signs with the AS core signing key.
+	CoreSigner crypto.Signer
 	// DecryptKey is the AS decryption key.
 	DecryptKey common.RawBytes
-	// OffRootKey is the AS offline root key.
-	OffRootKey common.RawBytes
-	// OnRootKey is the AS online root key.
-	OnRootKey common.RawBytes
-	// SignKey is the AS signing key.
-	SignKey common.RawBytes
+	// OffRootSigner signs with the AS offline root key.
+	OffRootSigner crypto.Signer
+	// OnRootSigner signs with the AS online root key.
+	OnRootSigner crypto.Signer
+	// Signer signs with the AS signing key.
+	Signer crypto.Signer
 }
 
 const (
@@ -49,52 +51,79 @@ const (
 	ErrorParse = "Unable to parse key"
 )
 
-// LoadKeyConf loads key configuration from specified path.
+// LoadKeyConf loads key configuration from specified path. Key files can contain the base64
+// encoded key, the key encrypted with password, or a key URI (see crypto.NewSigner).
 // coreSigKey, onKey, offKey can be set true, to load the respective keys.
-func LoadKeyConf(path string, coreSigKey, onKey, offKey bool) (*KeyConf, error) {
+func LoadKeyConf(path string, password []byte, coreSigKey, onKey,
+	offKey bool) (*KeyConf, error) {
+
 	conf := &KeyConf{}
 	var err error
-	if conf.DecryptKey, err = loadKeyCond(filepath.Join(path, DecKeyFile), true); err != nil {
+	if conf.DecryptKey, err = LoadKeyWithPassword(filepath.Join(path, DecKeyFile),
+		password); err != nil {
 		return nil, err
 	}
-	if conf.SignKey, err = loadKeyCond(filepath.Join(path, SigKeyFile), true); err != nil {
+	if conf.Signer, err = loadSignerCond(filepath.Join(path, SigKeyFile), password,
+		true); err != nil {
 		return nil, err
 	}
-	if conf.CoreSigKey, err = loadKeyCond(filepath.Join(path, CoreSigKeyFile), coreSigKey); err != nil {
-
+	if conf.CoreSigner, err = loadSignerCond(filepath.Join(path, CoreSigKeyFile), password,
+		coreSigKey); err != nil {
+		return nil, err
 	}
-	if conf.OffRootKey, err = loadKeyCond(filepath.Join(path, OffKeyFile), offKey); err != nil {
+	if conf.OffRootSigner, err = loadSignerCond(filepath.Join(path, OffKeyFile), password,
+		offKey); err != nil {
 		return nil, err
 	}
-	if conf.OnRootKey, err = loadKeyCond(filepath.Join(path, OnKeyFile), onKey); err != nil {
+	if conf.OnRootSigner, err = loadSignerCond(filepath.Join(path, OnKeyFile), password,
+		onKey); err != nil {
 		return nil, err
 	}
 	return conf, nil
 }
 
-func loadKeyCond(file string, load bool) (common.RawBytes, error) {
+func loadSignerCond(file string, password []byte, load bool) (crypto.Signer, error) {
 	if !load {
 		return nil, nil
 	}
-	return LoadKey(file)
+	return LoadSigner(file, password)
+}
+
+// LoadSigner returns a signer for the key stored in file. See crypto.NewSigner for the supported
+// formats.
+func LoadSigner(file string, password []byte) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, common.NewBasicError(ErrorOpen, err)
+	}
+	signer, err := crypto.NewSigner(b, password)
+	if err != nil {
+		return nil, common.NewBasicError(ErrorParse, err, "file", file)
+	}
+	return signer, nil
 }
 
 // LoadKey decodes a base64 encoded key stored in file and returns the raw bytes.
 func LoadKey(file string) (common.RawBytes, error) {
+	return LoadKeyWithPassword(file, nil)
+}
+
+// LoadKeyWithPassword decodes a base64 encoded or password-encrypted key stored in file and
+// returns the raw bytes.
+func LoadKeyWithPassword(file string, password []byte) (common.RawBytes, error) {
 	b, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, common.NewBasicError(ErrorOpen, err)
 	}
-	dbuf := make([]byte, base64.StdEncoding.DecodedLen(len(b)))
-	n, err := base64.StdEncoding.Decode(dbuf, b)
+	key, err := crypto.DecodeKey(b, password)
 	if err != nil {
-		return nil, common.NewBasicError(ErrorParse, err)
+		return nil, common.NewBasicError(ErrorParse, err, "file", file)
 	}
-	return dbuf[:n], nil
+	return key, nil
 }
 
 func (a *KeyConf) String() string {
 	return fmt.Sprintf(
-		"DecryptKey:%s SigningKey:%s CoreSigningKey: %s OfflineRootKey:%s OnlineRootKey:%s",
-		a.DecryptKey, a.SignKey, a.CoreSigKey, a.OffRootKey, a.OnRootKey)
+		"DecryptKey:%t Signer:%v CoreSigner:%v OffRootSigner:%v OnRootSigner:%v",
+		a.DecryptKey != nil, a.Signer, a.CoreSigner, a.OffRootSigner, a.OnRootSigner)
 }
@@ -0,0 +1,306 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"context"
+	"math/rand"
+	"net"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	ErrMissingChain  = "Certificate chain not found"
+	ErrNoResolver    = "Trust object not found and resolvers not started"
+	ErrInvalidTrail  = "Invalid trust trail"
+	ErrInvalidObject = "Received trust object does not match request"
+)
+
+var _ infra.TrustStore = (*Store)(nil)
+
+// StartResolvers enables the store to fetch missing certificate chains and
+// TRCs over the network, using messenger.
+func (s *Store) StartResolvers(messenger infra.Messenger) error {
+	s.msgerLock.Lock()
+	defer s.msgerLock.Unlock()
+	s.msger = messenger
+	return nil
+}
+
+func (s *Store) getMessenger() infra.Messenger {
+	s.msgerLock.RLock()
+	defer s.msgerLock.RUnlock()
+	return s.msger
+}
+
+// GetCertificate resolves the trust trail and returns the leaf certificate of
+// the certificate chain described by the last descriptor. Each object is
+// verified before it is returned or added to the store. Missing objects are
+// requested from hint, or from the certificate server of the AS in the
+// descriptor if hint is nil.
+func (s *Store) GetCertificate(ctx context.Context, trail []infra.TrustDescriptor,
+	hint net.Addr) (*cert.Certificate, error) {
+
+	if len(trail) == 0 || trail[len(trail)-1].Type != infra.ChainDescriptor {
+		return nil, common.NewBasicError(ErrInvalidTrail, nil, "trail", trail)
+	}
+	for _, d := range trail[:len(trail)-1] {
+		if d.Type != infra.TRCDescriptor {
+			return nil, common.NewBasicError(ErrInvalidTrail, nil, "trail", trail)
+		}
+		if _, err := s.GetValidTRC(ctx, uint16(d.IA.I), d.TRCVersion,
+			s.server(hint, &d.IA)); err != nil {
+			return nil, err
+		}
+	}
+	d := trail[len(trail)-1]
+	chain, err := s.GetValidChain(ctx, &d.IA, d.ChainVersion, hint)
+	if err != nil {
+		return nil, err
+	}
+	if chain.Core.TRCVersion != d.TRCVersion {
+		return nil, common.NewBasicError(ErrInvalidTrail, nil, "chain", chain.Key(),
+			"expected", d.TRCVersion, "actual", chain.Core.TRCVersion)
+	}
+	return chain.Leaf, nil
+}
+
+// GetValidChain returns the certificate chain of ia with version ver, or the
+// newest one if ver is cert_mgmt.NewestVersion, after verifying it. If the
+// chain or its TRC is not in the store, it is requested from hint (or the
+// certificate server of ia, resp. the issuer) and added to the store.
+func (s *Store) GetValidChain(ctx context.Context, ia *addr.ISD_AS, ver uint64,
+	hint net.Addr) (*cert.Chain, error) {
+
+	chain := s.lookupChain(ia, ver)
+	if chain != nil {
+		if err := s.VerifyChain(chain); err != nil {
+			return nil, err
+		}
+		return chain, nil
+	}
+	m := s.getMessenger()
+	if m == nil {
+		return nil, common.NewBasicError(ErrNoResolver, nil, "chain", cert.NewKey(ia, ver))
+	}
+	req := &cert_mgmt.ChainReq{RawIA: ia.IAInt(), Version: ver}
+	rep, err := m.GetCertChain(ctx, req, s.server(hint, ia), rand.Uint64())
+	if err != nil {
+		return nil, common.NewBasicError(ErrMissingChain, err, "req", req)
+	}
+	chain, err = rep.Chain()
+	if err != nil {
+		return nil, err
+	}
+	if !chain.Leaf.Subject.Eq(ia) ||
+		(ver != cert_mgmt.NewestVersion && chain.Leaf.Version != ver) {
+		return nil, common.NewBasicError(ErrInvalidObject, nil, "req", req, "chain", chain)
+	}
+	if err = s.addChainResolved(ctx, chain, hint); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// addChainResolved fetches the TRC of the chain if necessary, and adds the
+// chain to the store after verifying it.
+func (s *Store) addChainResolved(ctx context.Context, chain *cert.Chain, hint net.Addr) error {
+	isd, ver := uint16(chain.Leaf.Subject.I), chain.Core.TRCVersion
+	if s.GetTRC(isd, ver) == nil {
+		server := s.server(hint, chain.Core.Issuer)
+		if _, err := s.GetValidTRC(ctx, isd, ver, server); err != nil {
+			return err
+		}
+	}
+	return s.AddChainVerified(chain, true)
+}
+
+// GetValidTRC returns the TRC of isd with version ver, or the newest one if ver
+// is cert_mgmt.NewestVersion. If the TRC is not in the store, it is requested
+// from server and added to the store after verifying it.
+func (s *Store) GetValidTRC(ctx context.Context, isd uint16, ver uint64,
+	server net.Addr) (*trc.TRC, error) {
+
+	if t := s.lookupTRC(isd, ver); t != nil {
+		return t, nil
+	}
+	m := s.getMessenger()
+	if m == nil {
+		return nil, common.NewBasicError(ErrNoResolver, nil, "trc", trc.NewKey(isd, ver))
+	}
+	req := &cert_mgmt.TRCReq{ISD: isd, Version: ver}
+	rep, err := m.GetTRC(ctx, req, server, rand.Uint64())
+	if err != nil {
+		return nil, common.NewBasicError(ErrMissingTRC, err, "req", req)
+	}
+	t, err := rep.TRC()
+	if err != nil {
+		return nil, err
+	}
+	if t.ISD != isd || (ver != cert_mgmt.NewestVersion && t.Version != ver) {
+		return nil, common.NewBasicError(ErrInvalidObject, nil, "req", req, "trc", t)
+	}
+	if err = s.AddTRCVerified(t, true); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// lookupChain returns the certificate chain with the given version, or the
+// newest one if ver is cert_mgmt.NewestVersion, or nil if it is not present.
+func (s *Store) lookupChain(ia *addr.ISD_AS, ver uint64) *cert.Chain {
+	if ver == cert_mgmt.NewestVersion {
+		return s.GetNewestChain(ia)
+	}
+	return s.GetChain(ia, ver)
+}
+
+// lookupTRC returns the TRC with the given version, or the newest one if ver
+// is cert_mgmt.NewestVersion, or nil if it is not present.
+func (s *Store) lookupTRC(isd uint16, ver uint64) *trc.TRC {
+	if ver == cert_mgmt.NewestVersion {
+		return s.GetNewestTRC(isd)
+	}
+	return s.GetTRC(isd, ver)
+}
+
+// server returns hint, or the certificate server of ia if hint is nil.
+func (s *Store) server(hint net.Addr, ia *addr.ISD_AS) net.Addr {
+	if hint != nil {
+		return hint
+	}
+	return &snet.Addr{IA: ia.Copy(), Host: addr.SvcCS}
+}
+
+// NewChainReqHandler returns a handler answering certificate chain requests.
+// Chains not in the store are fetched first, unless the request is cache-only.
+func (s *Store) NewChainReqHandler() infra.Handler {
+	return infra.HandlerFunc(func(r *infra.Request) {
+		req, ok := r.Message.(*cert_mgmt.ChainReq)
+		m, mOk := r.Context().Value(infra.MessengerContextKey).(infra.Messenger)
+		if !ok || !mOk {
+			log.Error("Unable to handle chain request", "msg", r.Message)
+			return
+		}
+		var chain *cert.Chain
+		var err error
+		if req.CacheOnly {
+			if chain = s.lookupChain(req.IA(), req.Version); chain == nil {
+				err = common.NewBasicError(ErrMissingChain, nil, "req", req)
+			}
+		} else {
+			chain, err = s.GetValidChain(r.Context(), req.IA(), req.Version, nil)
+		}
+		if err != nil {
+			log.Info("Dropping chain request", "req", req, "peer", r.Peer, "err", err)
+			return
+		}
+		raw, err := chain.Compress()
+		if err != nil {
+			log.Error("Unable to compress chain", "chain", chain, "err", err)
+			return
+		}
+		if err = m.SendCertChain(r.Context(), &cert_mgmt.Chain{RawChain: raw}, r.Peer,
+			r.ID); err != nil {
+			log.Error("Unable to send chain reply", "peer", r.Peer, "err", err)
+		}
+	})
+}
+
+// NewTRCReqHandler returns a handler answering TRC requests. TRCs not in the
+// store are fetched first, unless the request is cache-only.
+func (s *Store) NewTRCReqHandler() infra.Handler {
+	return infra.HandlerFunc(func(r *infra.Request) {
+		req, ok := r.Message.(*cert_mgmt.TRCReq)
+		m, mOk := r.Context().Value(infra.MessengerContextKey).(infra.Messenger)
+		if !ok || !mOk {
+			log.Error("Unable to handle TRC request", "msg", r.Message)
+			return
+		}
+		var t *trc.TRC
+		var err error
+		if req.CacheOnly {
+			if t = s.lookupTRC(req.ISD, req.Version); t == nil {
+				err = common.NewBasicError(ErrMissingTRC, nil, "req", req)
+			}
+		} else {
+			t, err = s.GetValidTRC(r.Context(), req.ISD, req.Version,
+				s.server(nil, req.IA()))
+		}
+		if err != nil {
+			log.Info("Dropping TRC request", "req", req, "peer", r.Peer, "err", err)
+			return
+		}
+		raw, err := t.Compress()
+		if err != nil {
+			log.Error("Unable to compress TRC", "trc", t, "err", err)
+			return
+		}
+		if err = m.SendTRC(r.Context(), &cert_mgmt.TRC{RawTRC: raw}, r.Peer,
+			r.ID); err != nil {
+			log.Error("Unable to send TRC reply", "peer", r.Peer, "err", err)
+		}
+	})
+}
+
+// NewPushChainHandler returns a handler adding certificate chains pushed by
+// other nodes to the store, after verifying them. A missing TRC is requested
+// from the sender.
+func (s *Store) NewPushChainHandler() infra.Handler {
+	return infra.HandlerFunc(func(r *infra.Request) {
+		rep, ok := r.Message.(*cert_mgmt.Chain)
+		if !ok {
+			log.Error("Unable to handle pushed chain", "msg", r.Message)
+			return
+		}
+		chain, err := rep.Chain()
+		if err != nil {
+			log.Error("Unable to parse pushed chain", "peer", r.Peer, "err", err)
+			return
+		}
+		if err = s.addChainResolved(r.Context(), chain, r.Peer); err != nil {
+			log.Error("Unable to add pushed chain", "chain", chain, "peer", r.Peer, "err", err)
+		}
+	})
+}
+
+// NewPushTRCHandler returns a handler adding TRCs pushed by other nodes to the
+// store, after verifying them.
+func (s *Store) NewPushTRCHandler() infra.Handler {
+	return infra.HandlerFunc(func(r *infra.Request) {
+		rep, ok := r.Message.(*cert_mgmt.TRC)
+		if !ok {
+			log.Error("Unable to handle pushed TRC", "msg", r.Message)
+			return
+		}
+		t, err := rep.TRC()
+		if err != nil {
+			log.Error("Unable to parse pushed TRC", "peer", r.Peer, "err", err)
+			return
+		}
+		if err = s.AddTRCVerified(t, true); err != nil {
+			log.Error("Unable to add pushed TRC", "trc", t, "peer", r.Peer, "err", err)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/infra"
+)
+
+var _ infra.Messenger = (*mockMessenger)(nil)
+
+// mockMessenger answers chain and TRC requests with fixed objects, and counts
+// the requests.
+type mockMessenger struct {
+	chain    *cert.Chain
+	trc      *trc.TRC
+	chainReq int
+	trcReq   int
+}
+
+func (m *mockMessenger) GetTRC(_ context.Context, _ *cert_mgmt.TRCReq, _ net.Addr,
+	_ uint64) (*cert_mgmt.TRC, error) {
+
+	m.trcReq++
+	raw, err := m.trc.Compress()
+	return &cert_mgmt.TRC{RawTRC: raw}, err
+}
+
+func (m *mockMessenger) GetCertChain(_ context.Context, _ *cert_mgmt.ChainReq, _ net.Addr,
+	_ uint64) (*cert_mgmt.Chain, error) {
+
+	m.chainReq++
+	raw, err := m.chain.Compress()
+	return &cert_mgmt.Chain{RawChain: raw}, err
+}
+
+func (m *mockMessenger) SendTRC(context.Context, *cert_mgmt.TRC, net.Addr, uint64) error {
+	return nil
+}
+
+func (m *mockMessenger) SendCertChain(context.Context, *cert_mgmt.Chain, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) GetPaths(context.Context, *path_mgmt.SegReq, net.Addr,
+	uint64) (*path_mgmt.SegReply, error) {
+
+	return nil, nil
+}
+
+func (m *mockMessenger) SendSegReply(context.Context, *path_mgmt.SegReply, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) SendSegReg(context.Context, *path_mgmt.SegReg, net.Addr, uint64) error {
+	return nil
+}
+
+func (m *mockMessenger) SendSegSync(context.Context, *path_mgmt.SegSync, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) SendRev(context.Context, *path_mgmt.RevInfo, net.Addr, uint64) error {
+	return nil
+}
+
+func (m *mockMessenger) SendIfStateReq(context.Context, *path_mgmt.IFStateReq, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) SendIfStateInfos(context.Context, *path_mgmt.IFStateInfos, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) AddHandler(string, infra.Handler) {}
+
+func (m *mockMessenger) ListenAndServe() {}
+
+func (m *mockMessenger) CloseServer() error {
+	return nil
+}
+
+func Test_GetCertificate(t *testing.T) {
+	Convey("Resolving certificates", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t_, signKey, chain := trustObjs(t)
+		ia, ver := chain.IAVer()
+		trail := []infra.TrustDescriptor{{Type: infra.ChainDescriptor, IA: *ia,
+			ChainVersion: ver, TRCVersion: t_.Version}}
+		ctx := context.Background()
+		Convey("Without resolvers, missing chains are not found", func() {
+			_, err := s.GetCertificate(ctx, trail, nil)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrNoResolver)
+		})
+		Convey("Local objects are verified", func() {
+			SoMsg("trc", s.AddTRC(t_, false), ShouldBeNil)
+			SoMsg("chain", s.AddChain(chain, false), ShouldBeNil)
+			crt, err := s.GetCertificate(ctx, trail, nil)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("crt", crt, ShouldEqual, chain.Leaf)
+			Convey("and rejected if invalid", func() {
+				chain.Leaf.Comment = "Tampered"
+				_, err := s.GetCertificate(ctx, trail, nil)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidChain)
+			})
+		})
+		Convey("Missing chains are fetched and stored", func() {
+			SoMsg("trc", s.AddTRC(t_, false), ShouldBeNil)
+			m := &mockMessenger{chain: chain}
+			SoMsg("start", s.StartResolvers(m), ShouldBeNil)
+			crt, err := s.GetCertificate(ctx, trail, nil)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("crt", crt.Eq(chain.Leaf), ShouldBeTrue)
+			SoMsg("requests", m.chainReq, ShouldEqual, 1)
+			SoMsg("stored", s.GetChain(ia, ver), ShouldNotBeNil)
+			Convey("A chain of another AS is rejected", func() {
+				other := trail[0]
+				other.IA.A++
+				_, err := s.GetCertificate(ctx, []infra.TrustDescriptor{other}, nil)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidObject)
+			})
+		})
+		Convey("Missing TRCs are fetched and verified", func() {
+			SoMsg("trc", s.AddTRC(t_, false), ShouldBeNil)
+			next := nextTRC(t_, signKey, t)
+			m := &mockMessenger{trc: next}
+			SoMsg("start", s.StartResolvers(m), ShouldBeNil)
+			fetched, err := s.GetValidTRC(ctx, next.ISD, next.Version, nil)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("requests", m.trcReq, ShouldEqual, 1)
+			SoMsg("stored", s.GetTRC(next.ISD, next.Version), ShouldEqual, fetched)
+			Convey("and rejected if invalid", func() {
+				next.Description = "Tampered"
+				next.Version++
+				_, err := s.GetValidTRC(ctx, next.ISD, next.Version, nil)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidTRC)
+			})
+		})
+		Convey("Invalid trails are rejected", func() {
+			trail[0].Type = infra.TRCDescriptor
+			_, err := s.GetCertificate(ctx, trail, nil)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidTrail)
+			_, err = s.GetCertificate(ctx, nil, nil)
+			SoMsg("empty", common.GetErrorMsg(err), ShouldEqual, ErrInvalidTrail)
+		})
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+// newRevList returns a revocation list of core AS 1-13 revoking the given
+// certificates, signed with signKey.
+func newRevList(t_ *trc.TRC, signKey common.RawBytes, ver uint64, revoked []*cert.Certificate,
+	t *testing.T) *cert.RevList {
+
+	now := uint64(time.Now().Unix())
+	r := &cert.RevList{Issuer: coreIA.Copy(), IssuingTime: now, TRCVersion: t_.Version,
+		Version: ver}
+	for _, c := range revoked {
+		r.Entries = append(r.Entries, &cert.RevEntry{Subject: c.Subject.Copy(),
+			Version: c.Version, RevocationTime: now})
+	}
+	if err := r.Sign(signKey, crypto.Ed25519); err != nil {
+		t.Fatalf("Unable to sign revocation list: %v", err)
+	}
+	return r
+}
+
+func Test_AddRevListVerified(t *testing.T) {
+	Convey("Adding verified revocation lists", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t_, signKey, chain := trustObjs(t)
+		r := newRevList(t_, signKey, 1, []*cert.Certificate{chain.Leaf}, t)
+		Convey("Without the TRC, the revocation list is rejected", func() {
+			err := s.AddRevListVerified(r, false)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrMissingTRC)
+			SoMsg("revList", s.GetRevList(r.Issuer, 1), ShouldBeNil)
+		})
+		Convey("With the TRC", func() {
+			SoMsg("err", s.AddTRC(t_, false), ShouldBeNil)
+			Convey("A valid revocation list is added", func() {
+				SoMsg("err", s.AddRevListVerified(r, true), ShouldBeNil)
+				SoMsg("revList", s.GetRevList(r.Issuer, 1), ShouldEqual, r)
+				SoMsg("newest", s.GetNewestRevList(r.Issuer), ShouldEqual, r)
+				Convey("and loaded from the cache", func() {
+					s2, err := NewStore(s.certDir, s.cacheDir, s.eName)
+					SoMsg("err", err, ShouldBeNil)
+					defer s2.Close()
+					SoMsg("loaded", s2.GetNewestRevList(r.Issuer), ShouldResemble, r)
+				})
+			})
+			Convey("A revocation list with an invalid signature is rejected", func() {
+				r.Entries = nil
+				err := s.AddRevListVerified(r, false)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidRevList)
+				SoMsg("revList", s.GetRevList(r.Issuer, 1), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func Test_VerifyChain_Revoked(t *testing.T) {
+	Convey("Revoked certificate chains are rejected", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t_, signKey, chain := trustObjs(t)
+		SoMsg("err", s.AddTRC(t_, false), ShouldBeNil)
+		SoMsg("valid", s.VerifyChain(chain), ShouldBeNil)
+		Convey("Revoked leaf certificate", func() {
+			r := newRevList(t_, signKey, 1, []*cert.Certificate{chain.Leaf}, t)
+			SoMsg("add", s.AddRevListVerified(r, false), ShouldBeNil)
+			err := s.AddChainVerified(chain, false)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrRevokedChain)
+			SoMsg("chain", s.GetChain(chain.Leaf.Subject, 1), ShouldBeNil)
+		})
+		Convey("Revoked core certificate", func() {
+			r := newRevList(t_, signKey, 1, []*cert.Certificate{chain.Core}, t)
+			SoMsg("add", s.AddRevListVerified(r, false), ShouldBeNil)
+			err := s.VerifyChain(chain)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrRevokedChain)
+		})
+		Convey("Only the newest revocation list is considered", func() {
+			r := newRevList(t_, signKey, 1, []*cert.Certificate{chain.Leaf}, t)
+			SoMsg("add", s.AddRevListVerified(r, false), ShouldBeNil)
+			r = newRevList(t_, signKey, 2, nil, t)
+			SoMsg("add newer", s.AddRevListVerified(r, false), ShouldBeNil)
+			SoMsg("err", s.VerifyChain(chain), ShouldBeNil)
+		})
+	})
+}
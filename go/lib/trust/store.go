@@ -20,27 +20,40 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
 
 	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/crypto/cert"
 	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/trust/trustdb"
 )
 
+// DBFileSuffix is appended to the element name to form the file name of the database.
+const DBFileSuffix = ".trust.db"
+
 type JSON interface {
 	JSON(bool) ([]byte, error)
 }
 
 var _ JSON = (*cert.Chain)(nil)
 var _ JSON = (*trc.TRC)(nil)
+var _ JSON = (*cert.RevList)(nil)
 
-// Store handles storage and management of trust objects (certificate chains and TRCs)
+// Store handles storage and management of trust objects (certificate chains, TRCs and
+// revocation lists). The objects are kept in memory, and persisted in a trustdb.DB.
 type Store struct {
 	// certDir is the certificate directory.
 	certDir string
-	// cacheDir is the directory to cache TRCs and certs in.
+	// cacheDir is the directory containing the database.
 	cacheDir string
-	// eName is the element name, used to generate cache file names.
+	// eName is the element name, used to generate the database file name.
 	eName string
+	// db persists the trust objects added with write set to true.
+	db *trustdb.DB
 	// chainMap is a mapping form (ISD-AS, version) to certificate chain
 	chainMap map[cert.Key]*cert.Chain
 	// maxChainMap is a mapping from (ISD-AS) to max version.
@@ -53,75 +66,133 @@ type Store struct {
 	maxTrcMap map[uint16]uint64
 	// trcLock guards trcMap and maxTrcMap.
 	trcLock sync.RWMutex
+	// revListMap is a mapping from (issuer ISD-AS, version) to revocation list.
+	revListMap map[cert.Key]*cert.RevList
+	// maxRevListMap is a mapping from (issuer ISD-AS) to max version.
+	maxRevListMap map[addr.ISD_AS]uint64
+	// revListLock guards revListMap and maxRevListMap.
+	revListLock sync.RWMutex
+	// msger is used to fetch missing trust objects, once the resolvers are started.
+	msger infra.Messenger
+	// msgerLock guards msger.
+	msgerLock sync.RWMutex
 }
 
+// NewStore creates a store containing the trust objects in the database in cacheDir, and the
+// files in certDir. Trust objects from files that cannot be loaded are quarantined in the
+// database, and skipped. Files cached by earlier versions of the store in cacheDir are moved to
+// the database.
 func NewStore(certDir, cacheDir, eName string) (*Store, error) {
-	s := &Store{certDir: certDir, cacheDir: cacheDir, eName: eName,
-		chainMap:    make(map[cert.Key]*cert.Chain),
-		maxChainMap: make(map[addr.ISD_AS]uint64),
-		trcMap:      make(map[trc.Key]*trc.TRC),
-		maxTrcMap:   make(map[uint16]uint64)}
-	s.initChains()
-	s.initTRCs()
+	db, err := trustdb.New(filepath.Join(cacheDir, eName+DBFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{certDir: certDir, cacheDir: cacheDir, eName: eName, db: db,
+		chainMap:      make(map[cert.Key]*cert.Chain),
+		maxChainMap:   make(map[addr.ISD_AS]uint64),
+		trcMap:        make(map[trc.Key]*trc.TRC),
+		maxTrcMap:     make(map[uint16]uint64),
+		revListMap:    make(map[cert.Key]*cert.RevList),
+		maxRevListMap: make(map[addr.ISD_AS]uint64)}
+	if err = s.initDB(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, ext := range []string{"trc", "crl", "crt"} {
+		s.loadFiles(filepath.Join(certDir, "*."+ext), false)
+		s.loadFiles(filepath.Join(cacheDir, fmt.Sprintf("%s*.%s", eName, ext)), true)
+	}
 	return s, nil
 }
 
-// initChains loads the certificate chain files from dir and cacheDir and populates chainMap
-// as well as maxChainMap.
-func (s *Store) initChains() error {
-	files, err := filepath.Glob(fmt.Sprintf("%s/*.crt", s.certDir))
+// Close closes the database. The store must not be used afterwards.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// initDB loads all trust objects from the database.
+func (s *Store) initDB() error {
+	trcs, err := s.db.GetAllTRCs()
 	if err != nil {
 		return err
 	}
-	cachedFiles, err := filepath.Glob(fmt.Sprintf("%s/%s*.crt", s.cacheDir, s.eName))
+	for _, t := range trcs {
+		s.AddTRC(t, false)
+	}
+	revLists, err := s.db.GetAllRevLists()
 	if err != nil {
 		return err
 	}
+	for _, r := range revLists {
+		s.AddRevList(r, false)
+	}
+	chains, err := s.db.GetAllChains()
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		s.AddChain(chain, false)
+	}
+	return nil
+}
 
-	for _, file := range append(files, cachedFiles...) {
-		// FIXME(roosd): do not abort, but log errors
+// loadFiles adds the trust objects in the files matching pattern to the store. The type of the
+// objects is determined by the file extension. Files that cannot be loaded are quarantined. If
+// migrate is true, the objects are written to the database, and the files are removed.
+func (s *Store) loadFiles(pattern string, migrate bool) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Error("Unable to list trust object files", "pattern", pattern, "err", err)
+		return
+	}
+	for _, file := range files {
 		raw, err := ioutil.ReadFile(file)
 		if err != nil {
-			return err
+			log.Error("Unable to read trust object file", "file", file, "err", err)
+			continue
 		}
-		chain, err := cert.ChainFromRaw(raw, false)
-		if err != nil {
-			return err
+		if err = s.addRaw(raw, filepath.Ext(file), migrate); err != nil {
+			log.Error("Quarantining trust object file", "file", file, "err", err)
+			if err = s.db.Quarantine(file, err.Error(), raw); err != nil {
+				log.Error("Unable to quarantine trust object file", "file", file, "err", err)
+				continue
+			}
 		}
-		if err = s.AddChain(chain, false); err != nil {
-			return err
+		if migrate {
+			if err = os.Remove(file); err != nil {
+				log.Error("Unable to remove migrated file", "file", file, "err", err)
+			}
 		}
 	}
-	return nil
 }
 
-// initTRCs loads the TRC files from dir and cacheDir and populates trcMap as well as maxTrcMap.
-func (s *Store) initTRCs() error {
-	files, err := filepath.Glob(fmt.Sprintf("%s/*.trc", s.certDir))
-	if err != nil {
-		return err
-	}
-	cachedFiles, err := filepath.Glob(fmt.Sprintf("%s/%s*.trc", s.cacheDir, s.eName))
-	if err != nil {
-		return err
-	}
-	for _, file := range append(files, cachedFiles...) {
-		// FIXME(roosd): do not abort, but log errors
-		raw, err := ioutil.ReadFile(file)
+// addRaw parses the trust object of type ext and adds it to the store.
+func (s *Store) addRaw(raw common.RawBytes, ext string, write bool) error {
+	switch ext {
+	case ".trc":
+		t, err := trc.TRCFromRaw(raw, false)
 		if err != nil {
 			return err
 		}
-		t, err := trc.TRCFromRaw(raw, false)
+		return s.AddTRC(t, write)
+	case ".crl":
+		r, err := cert.RevListFromRaw(raw, false)
 		if err != nil {
 			return err
 		}
-		s.AddTRC(t, false)
+		return s.AddRevList(r, write)
+	case ".crt":
+		chain, err := cert.ChainFromRaw(raw, false)
+		if err != nil {
+			return err
+		}
+		return s.AddChain(chain, write)
 	}
-	return nil
+	return common.NewBasicError("Unknown trust object file type", nil, "ext", ext)
 }
 
 // AddChain adds a trusted certificate chain to the store. If write is true, the certificate chain
-// is written to the filesystem (in case it does not already exist).
+// is written to the database (in case it does not already exist).
 func (s *Store) AddChain(chain *cert.Chain, write bool) error {
 	ia, ver := chain.IAVer()
 	key := *chain.Key()
@@ -134,12 +205,13 @@ func (s *Store) AddChain(chain *cert.Chain, write bool) error {
 	}
 	s.chainLock.Unlock()
 	if write {
-		return s.writeChain(chain)
+		_, err := s.db.InsertChain(chain)
+		return err
 	}
 	return nil
 }
 
-// AddTRC adds a trusted TRC to the store. If write is true, the TRC is written to the filesystem
+// AddTRC adds a trusted TRC to the store. If write is true, the TRC is written to the database
 // (in case it does not already exist).
 func (s *Store) AddTRC(trc *trc.TRC, write bool) error {
 	isd, ver := trc.IsdVer()
@@ -153,37 +225,75 @@ func (s *Store) AddTRC(trc *trc.TRC, write bool) error {
 	}
 	s.trcLock.Unlock()
 	if write {
-		return s.writeTRC(trc)
+		_, err := s.db.InsertTRC(trc)
+		return err
 	}
 	return nil
 }
 
-// writeChain writes certificate chain to the filesystem, if it does not already exist.
-func (s *Store) writeChain(chain *cert.Chain) error {
-	ia, ver := chain.IAVer()
-	name := fmt.Sprintf("%s-ISD%d-AS%d-V%d.crt", s.eName, ia.I, ia.A, ver)
-	return s.writeJSON(chain, filepath.Join(s.cacheDir, name))
-}
-
-// writeTRC writes TRC to the filesystem, if it does not already exist.
-func (s *Store) writeTRC(trc *trc.TRC) error {
-	isd, ver := trc.IsdVer()
-	name := fmt.Sprintf("%s-ISD%d-V%d.trc", s.eName, isd, ver)
-	return s.writeJSON(trc, filepath.Join(s.cacheDir, name))
+// AddRevList adds a trusted revocation list to the store. If write is true, the revocation list
+// is written to the database (in case it does not already exist).
+func (s *Store) AddRevList(r *cert.RevList, write bool) error {
+	key := *r.Key()
+	s.revListLock.Lock()
+	if _, ok := s.revListMap[key]; !ok {
+		s.revListMap[key] = r
+		if v, ok := s.maxRevListMap[*r.Issuer]; !ok || r.Version > v {
+			s.maxRevListMap[*r.Issuer] = r.Version
+		}
+	}
+	s.revListLock.Unlock()
+	if write {
+		_, err := s.db.InsertRevList(r)
+		return err
+	}
+	return nil
 }
 
-// writeJSON writes object of type JSON to the filesystem, if it does not already exist.
-func (s *Store) writeJSON(j JSON, path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		b, err := j.JSON(true)
-		if err != nil {
-			return err
+// EvictExpired removes certificate chains and TRCs that expired before now, as well as
+// revocation lists that are superseded by a newer version, from the store and the database. The
+// newest TRC of each ISD is kept, even if it is expired. It returns the number of objects
+// evicted from memory.
+func (s *Store) EvictExpired(now time.Time) (int, error) {
+	ts := uint64(now.Unix())
+	evicted := 0
+	s.chainLock.Lock()
+	for key, chain := range s.chainMap {
+		if chain.Leaf.ExpirationTime < ts {
+			delete(s.chainMap, key)
+			evicted++
 		}
-		if err = ioutil.WriteFile(path, b, 0644); err != nil {
-			return err
+	}
+	s.maxChainMap = make(map[addr.ISD_AS]uint64)
+	for key := range s.chainMap {
+		if v, ok := s.maxChainMap[key.IA]; !ok || key.Ver > v {
+			s.maxChainMap[key.IA] = key.Ver
 		}
 	}
-	return nil
+	s.chainLock.Unlock()
+	s.trcLock.Lock()
+	for key, t := range s.trcMap {
+		if t.ExpirationTime < ts && key.Ver != s.maxTrcMap[key.ISD] {
+			delete(s.trcMap, key)
+			evicted++
+		}
+	}
+	s.trcLock.Unlock()
+	s.revListLock.Lock()
+	for key := range s.revListMap {
+		if key.Ver != s.maxRevListMap[key.IA] {
+			delete(s.revListMap, key)
+			evicted++
+		}
+	}
+	s.revListLock.Unlock()
+	_, err := s.db.DeleteExpired(now)
+	return evicted, err
+}
+
+// GetQuarantined returns the trust objects that could not be loaded.
+func (s *Store) GetQuarantined() ([]*trustdb.Quarantined, error) {
+	return s.db.GetQuarantined()
 }
 
 // GetChain returns the certificate chain for the specified values or nil, if it is not present.
@@ -236,3 +346,23 @@ func (s *Store) GetTRCList() []*trc.TRC {
 	}
 	return list
 }
+
+// GetRevList returns the revocation list for the specified values or nil, if it is not present.
+func (s *Store) GetRevList(issuer *addr.ISD_AS, ver uint64) *cert.RevList {
+	s.revListLock.RLock()
+	defer s.revListLock.RUnlock()
+	return s.revListMap[*cert.NewKey(issuer, ver)]
+}
+
+// GetNewestRevList returns the revocation list with the highest version for the specified issuer
+// or nil, if there is no revocation list present for that issuer.
+func (s *Store) GetNewestRevList(issuer *addr.ISD_AS) *cert.RevList {
+	s.revListLock.RLock()
+	defer s.revListLock.RUnlock()
+	var r *cert.RevList
+	ver, ok := s.maxRevListMap[*issuer]
+	if ok {
+		r = s.revListMap[*cert.NewKey(issuer, ver)]
+	}
+	return r
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// tempDirs creates a certificate and a cache directory.
+func tempDirs(t *testing.T) (string, string, func()) {
+	dir, err := ioutil.TempDir("", "trust_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	certDir, cacheDir := filepath.Join(dir, "certs"), filepath.Join(dir, "cache")
+	for _, d := range []string{certDir, cacheDir} {
+		if err = os.Mkdir(d, 0755); err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("Unable to create dir: %v", err)
+		}
+	}
+	return certDir, cacheDir, func() { os.RemoveAll(dir) }
+}
+
+func writeFile(t *testing.T, path string, j JSON) {
+	raw, err := j.JSON(true)
+	if err != nil {
+		t.Fatalf("Unable to pack object: %v", err)
+	}
+	if err = ioutil.WriteFile(path, raw, 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+}
+
+func Test_NewStore(t *testing.T) {
+	Convey("Loading the store", t, func() {
+		certDir, cacheDir, cleanup := tempDirs(t)
+		defer cleanup()
+		t_, _, chain := trustObjs(t)
+		ia, ver := chain.IAVer()
+		writeFile(t, filepath.Join(certDir, "ISD1-V2.trc"), t_)
+		Convey("Corrupt files are quarantined", func() {
+			corrupt := filepath.Join(certDir, "ISD1-AS10-V1.crt")
+			SoMsg("write", ioutil.WriteFile(corrupt, []byte("{"), 0644), ShouldBeNil)
+			s, err := NewStore(certDir, cacheDir, "cs1-10-1")
+			SoMsg("err", err, ShouldBeNil)
+			defer s.Close()
+			SoMsg("trc", s.GetTRC(1, 2), ShouldResemble, t_)
+			q, err := s.GetQuarantined()
+			SoMsg("q err", err, ShouldBeNil)
+			SoMsg("quarantined", len(q), ShouldEqual, 1)
+			SoMsg("source", q[0].Source, ShouldEqual, corrupt)
+		})
+		Convey("Cached files are moved to the database", func() {
+			cached := filepath.Join(cacheDir, "cs1-10-1-ISD1-AS10-V1.crt")
+			writeFile(t, cached, chain)
+			s, err := NewStore(certDir, cacheDir, "cs1-10-1")
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("chain", s.GetChain(ia, ver), ShouldResemble, chain)
+			_, err = os.Stat(cached)
+			SoMsg("removed", os.IsNotExist(err), ShouldBeTrue)
+			s.Close()
+			s, err = NewStore(certDir, cacheDir, "cs1-10-1")
+			SoMsg("reopen", err, ShouldBeNil)
+			defer s.Close()
+			SoMsg("reloaded", s.GetChain(ia, ver), ShouldResemble, chain)
+		})
+	})
+}
+
+func Test_EvictExpired(t *testing.T) {
+	Convey("Expired objects are evicted", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t_, signKey, chain := trustObjs(t)
+		ia, ver := chain.IAVer()
+		next := nextTRC(t_, signKey, t)
+		SoMsg("trc", s.AddTRC(t_, true), ShouldBeNil)
+		SoMsg("next", s.AddTRC(next, true), ShouldBeNil)
+		SoMsg("chain", s.AddChain(chain, true), ShouldBeNil)
+		Convey("Valid objects are kept", func() {
+			n, err := s.EvictExpired(time.Now())
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("evicted", n, ShouldEqual, 0)
+			SoMsg("chain", s.GetNewestChain(ia), ShouldEqual, chain)
+		})
+		Convey("After expiry, only the newest TRC is kept", func() {
+			exp := time.Unix(int64(t_.ExpirationTime)+1, 0)
+			n, err := s.EvictExpired(exp)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("evicted", n, ShouldEqual, 2)
+			SoMsg("chain", s.GetChain(ia, ver), ShouldBeNil)
+			SoMsg("newest chain", s.GetNewestChain(ia), ShouldBeNil)
+			SoMsg("trc", s.GetTRC(t_.ISD, t_.Version), ShouldBeNil)
+			SoMsg("newest trc", s.GetNewestTRC(t_.ISD), ShouldEqual, next)
+			s2, err := NewStore(s.certDir, s.cacheDir, s.eName)
+			SoMsg("reopen", err, ShouldBeNil)
+			defer s2.Close()
+			SoMsg("db chain", s2.GetChain(ia, ver), ShouldBeNil)
+			SoMsg("db trc", s2.GetTRC(t_.ISD, t_.Version), ShouldBeNil)
+		})
+	})
+}
+
+func Test_ExportImport(t *testing.T) {
+	Convey("Trust objects are exported and imported", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t_, _, chain := trustObjs(t)
+		ia, ver := chain.IAVer()
+		SoMsg("trc", s.AddTRC(t_, false), ShouldBeNil)
+		SoMsg("chain", s.AddChain(chain, false), ShouldBeNil)
+		dir, err := ioutil.TempDir("", "trust_export")
+		SoMsg("tmp", err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		n, err := s.Export(dir)
+		SoMsg("export err", err, ShouldBeNil)
+		SoMsg("exported", n, ShouldEqual, 2)
+		Convey("With verification, based on the base TRC", func() {
+			s2, cleanup2 := newTestStore(t)
+			defer cleanup2()
+			SoMsg("base", s2.AddTRC(t_, false), ShouldBeNil)
+			n, err := s2.Import(dir, true)
+			SoMsg("import err", err, ShouldBeNil)
+			SoMsg("imported", n, ShouldEqual, 2)
+			SoMsg("chain", s2.GetChain(ia, ver), ShouldResemble, chain)
+		})
+		Convey("Without a trusted TRC, the import is rejected", func() {
+			s2, cleanup2 := newTestStore(t)
+			defer cleanup2()
+			n, err := s2.Import(dir, true)
+			SoMsg("import err", err, ShouldNotBeNil)
+			SoMsg("imported", n, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains the SQLite schema of the TrustDB.
+
+package trustdb
+
+const (
+	// SchemaVersion is the version of the SQLite schema understood by this backend.
+	// Whenever changes to the schema are made, this version number should be increased
+	// to prevent data corruption between incompatible database schemas.
+	SchemaVersion = 1
+	// Schema is the SQLite database layout. Trust objects are stored in their uncompressed JSON
+	// encoding. The primary keys index the objects by ISD(-AS) and version.
+	Schema = `CREATE TABLE TRCs(
+		IsdID INTEGER NOT NULL,
+		Version INTEGER NOT NULL,
+		ExpirationTime INTEGER NOT NULL,
+		Data DATA NOT NULL,
+		PRIMARY KEY (IsdID, Version)
+	);
+	CREATE TABLE Chains(
+		IsdID INTEGER NOT NULL,
+		AsID INTEGER NOT NULL,
+		Version INTEGER NOT NULL,
+		ExpirationTime INTEGER NOT NULL,
+		Data DATA NOT NULL,
+		PRIMARY KEY (IsdID, AsID, Version)
+	);
+	CREATE TABLE RevLists(
+		IsdID INTEGER NOT NULL,
+		AsID INTEGER NOT NULL,
+		Version INTEGER NOT NULL,
+		Data DATA NOT NULL,
+		PRIMARY KEY (IsdID, AsID, Version)
+	);
+	CREATE TABLE Quarantine(
+		RowID INTEGER PRIMARY KEY AUTOINCREMENT,
+		Source TEXT NOT NULL,
+		Reason TEXT NOT NULL,
+		Time INTEGER NOT NULL,
+		Data DATA NOT NULL,
+		UNIQUE (Source, Data) ON CONFLICT IGNORE
+	);
+	CREATE INDEX TRCsExpiration ON TRCs(ExpirationTime);
+	CREATE INDEX ChainsExpiration ON Chains(ExpirationTime);`
+	TRCsTable       = "TRCs"
+	ChainsTable     = "Chains"
+	RevListsTable   = "RevLists"
+	QuarantineTable = "Quarantine"
+)
@@ -0,0 +1,374 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trustdb provides an SQLite backed database for trust objects, i.e.,
+// TRCs, certificate chains and revocation lists.
+//
+// Objects are only stored, not verified. Callers must verify objects before
+// inserting them. Objects that cannot be parsed when they are read from the
+// database are moved to the quarantine table, such that a single corrupt
+// object does not prevent the others from being loaded.
+package trustdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+// NewestVersion is the version used to request the newest version of an object.
+const NewestVersion = 0
+
+// busyTimeout is the time to wait for a lock held by another connection, e.g., by the
+// import/export tool, before failing with SQLITE_BUSY.
+const busyTimeout = 5 * time.Second
+
+// Quarantined is a trust object that could not be loaded.
+type Quarantined struct {
+	// Source describes where the object was found, e.g., the file name or the table.
+	Source string
+	// Reason describes why the object could not be loaded.
+	Reason string
+	// Time is the time the object was quarantined.
+	Time time.Time
+	// Data is the raw object.
+	Data common.RawBytes
+}
+
+func (q *Quarantined) String() string {
+	return fmt.Sprintf("Source: %s Reason: %s Time: %s Len: %d", q.Source, q.Reason,
+		q.Time, len(q.Data))
+}
+
+type DB struct {
+	db *sql.DB
+}
+
+// New returns a new TrustDB opening a database at the given path. If no database exists a new
+// database is created. If the schema version of the stored database is different from the one
+// in schema.go, an error is returned.
+func New(path string) (*DB, error) {
+	uri := fmt.Sprintf("%s?_busy_timeout=%d", path, busyTimeout/time.Millisecond)
+	sqlDB, err := sql.Open("sqlite3", uri)
+	if err != nil {
+		return nil, common.NewBasicError("Couldn't open SQLite database", err, "path", path)
+	}
+	// SQLite serializes writes anyway, and a single connection avoids lock contention
+	// between the connections of the pool.
+	sqlDB.SetMaxOpenConns(1)
+	db := &DB{db: sqlDB}
+	if err = db.setup(); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// setup creates the schema, if the database is new, and checks the schema version otherwise.
+func (db *DB) setup() error {
+	var version int
+	if err := db.db.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
+		return common.NewBasicError("Failed to check schema version", err)
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+	if version != 0 {
+		return common.NewBasicError("Database schema version mismatch", nil,
+			"expected", SchemaVersion, "have", version)
+	}
+	if _, err := db.db.Exec(Schema); err != nil {
+		return common.NewBasicError("Failed to set up SQLite database", err)
+	}
+	// Write schema version to database.
+	if _, err := db.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return common.NewBasicError("Failed to write schema version", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+// InsertTRC inserts the TRC, if no TRC with the same ISD and version exists. It returns the number
+// of inserted TRCs (0 or 1).
+func (db *DB) InsertTRC(t *trc.TRC) (int64, error) {
+	raw, err := t.JSON(false)
+	if err != nil {
+		return 0, common.NewBasicError("Unable to pack TRC", err, "trc", t.Key())
+	}
+	return db.exec(`INSERT OR IGNORE INTO TRCs (IsdID, Version, ExpirationTime, Data)
+		VALUES (?, ?, ?, ?)`, t.ISD, t.Version, t.ExpirationTime, raw)
+}
+
+// InsertChain inserts the certificate chain, if no chain with the same ISD-AS and version exists.
+// It returns the number of inserted chains (0 or 1).
+func (db *DB) InsertChain(chain *cert.Chain) (int64, error) {
+	raw, err := chain.JSON(false)
+	if err != nil {
+		return 0, common.NewBasicError("Unable to pack certificate chain", err,
+			"chain", chain.Key())
+	}
+	ia, ver := chain.IAVer()
+	return db.exec(`INSERT OR IGNORE INTO Chains (IsdID, AsID, Version, ExpirationTime, Data)
+		VALUES (?, ?, ?, ?, ?)`, ia.I, ia.A, ver, chain.Leaf.ExpirationTime, raw)
+}
+
+// InsertRevList inserts the revocation list, if no list with the same issuer and version exists.
+// It returns the number of inserted revocation lists (0 or 1).
+func (db *DB) InsertRevList(r *cert.RevList) (int64, error) {
+	raw, err := r.JSON(false)
+	if err != nil {
+		return 0, common.NewBasicError("Unable to pack revocation list", err, "revList", r.Key())
+	}
+	return db.exec(`INSERT OR IGNORE INTO RevLists (IsdID, AsID, Version, Data)
+		VALUES (?, ?, ?, ?)`, r.Issuer.I, r.Issuer.A, r.Version, raw)
+}
+
+// GetTRC returns the TRC of isd with version ver, or the newest one if ver is NewestVersion. It
+// returns nil, if the TRC is not in the database.
+func (db *DB) GetTRC(isd uint16, ver uint64) (*trc.TRC, error) {
+	query := `SELECT Data FROM TRCs WHERE IsdID = ? AND Version = ?`
+	args := []interface{}{isd, ver}
+	if ver == NewestVersion {
+		query = `SELECT Data FROM TRCs WHERE IsdID = ? ORDER BY Version DESC LIMIT 1`
+		args = args[:1]
+	}
+	raw, err := db.getRaw(query, args...)
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	return trc.TRCFromRaw(raw, false)
+}
+
+// GetChain returns the certificate chain of ia with version ver, or the newest one if ver is
+// NewestVersion. It returns nil, if the chain is not in the database.
+func (db *DB) GetChain(ia *addr.ISD_AS, ver uint64) (*cert.Chain, error) {
+	raw, err := db.getVersioned(ChainsTable, ia, ver)
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	return cert.ChainFromRaw(raw, false)
+}
+
+// GetRevList returns the revocation list of issuer with version ver, or the newest one if ver is
+// NewestVersion. It returns nil, if the revocation list is not in the database.
+func (db *DB) GetRevList(issuer *addr.ISD_AS, ver uint64) (*cert.RevList, error) {
+	raw, err := db.getVersioned(RevListsTable, issuer, ver)
+	if raw == nil || err != nil {
+		return nil, err
+	}
+	return cert.RevListFromRaw(raw, false)
+}
+
+// getVersioned returns the data of the object of ia with version ver, or the newest one if ver
+// is NewestVersion, from table.
+func (db *DB) getVersioned(table string, ia *addr.ISD_AS, ver uint64) (common.RawBytes, error) {
+	if ver == NewestVersion {
+		return db.getRaw(fmt.Sprintf(`SELECT Data FROM %s WHERE IsdID = ? AND AsID = ?
+			ORDER BY Version DESC LIMIT 1`, table), ia.I, ia.A)
+	}
+	return db.getRaw(fmt.Sprintf(`SELECT Data FROM %s WHERE IsdID = ? AND AsID = ?
+		AND Version = ?`, table), ia.I, ia.A, ver)
+}
+
+// getRaw returns the single data column selected by query, or nil if no row matches.
+func (db *DB) getRaw(query string, args ...interface{}) (common.RawBytes, error) {
+	var raw common.RawBytes
+	err := db.db.QueryRow(query, args...).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, common.NewBasicError("Failed to look up trust object", err)
+	}
+	return raw, nil
+}
+
+// GetAllTRCs returns all TRCs in the database. TRCs that cannot be parsed are quarantined.
+func (db *DB) GetAllTRCs() ([]*trc.TRC, error) {
+	var trcs []*trc.TRC
+	err := db.loadAll(TRCsTable, func(raw common.RawBytes) error {
+		t, err := trc.TRCFromRaw(raw, false)
+		if err == nil {
+			trcs = append(trcs, t)
+		}
+		return err
+	})
+	return trcs, err
+}
+
+// GetAllChains returns all certificate chains in the database. Chains that cannot be parsed are
+// quarantined.
+func (db *DB) GetAllChains() ([]*cert.Chain, error) {
+	var chains []*cert.Chain
+	err := db.loadAll(ChainsTable, func(raw common.RawBytes) error {
+		chain, err := cert.ChainFromRaw(raw, false)
+		if err == nil {
+			chains = append(chains, chain)
+		}
+		return err
+	})
+	return chains, err
+}
+
+// GetAllRevLists returns all revocation lists in the database. Revocation lists that cannot be
+// parsed are quarantined.
+func (db *DB) GetAllRevLists() ([]*cert.RevList, error) {
+	var revLists []*cert.RevList
+	err := db.loadAll(RevListsTable, func(raw common.RawBytes) error {
+		r, err := cert.RevListFromRaw(raw, false)
+		if err == nil {
+			revLists = append(revLists, r)
+		}
+		return err
+	})
+	return revLists, err
+}
+
+// loadAll calls parse for the data of every row of table. Rows for which parse fails are moved
+// to the quarantine table.
+func (db *DB) loadAll(table string, parse func(common.RawBytes) error) error {
+	rows, err := db.db.Query(fmt.Sprintf("SELECT RowID, Data FROM %s", table))
+	if err != nil {
+		return common.NewBasicError("Failed to look up trust objects", err, "table", table)
+	}
+	corrupt := make(map[int64]quarantineEntry)
+	for rows.Next() {
+		var rowID int64
+		var raw common.RawBytes
+		if err = rows.Scan(&rowID, &raw); err != nil {
+			rows.Close()
+			return common.NewBasicError("Failed to read trust object", err, "table", table)
+		}
+		if perr := parse(raw); perr != nil {
+			corrupt[rowID] = quarantineEntry{raw: raw, reason: perr.Error()}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return common.NewBasicError("Failed to read trust objects", err, "table", table)
+	}
+	rows.Close()
+	for rowID, e := range corrupt {
+		if err = db.quarantineRow(table, rowID, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type quarantineEntry struct {
+	raw    common.RawBytes
+	reason string
+}
+
+// quarantineRow moves the row of table to the quarantine table.
+func (db *DB) quarantineRow(table string, rowID int64, e quarantineEntry) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return common.NewBasicError("Failed to create transaction", err)
+	}
+	_, err = tx.Exec(`INSERT INTO Quarantine (Source, Reason, Time, Data) VALUES (?, ?, ?, ?)`,
+		table, e.reason, time.Now().Unix(), e.raw)
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE RowID = ?", table), rowID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return common.NewBasicError("Failed to quarantine trust object", err, "table", table)
+	}
+	if err = tx.Commit(); err != nil {
+		return common.NewBasicError("Failed to commit transaction", err)
+	}
+	return nil
+}
+
+// Quarantine stores a trust object that could not be loaded from source, e.g., a corrupt file,
+// together with the reason. The same data from the same source is only stored once.
+func (db *DB) Quarantine(source, reason string, raw common.RawBytes) error {
+	_, err := db.exec(`INSERT INTO Quarantine (Source, Reason, Time, Data) VALUES (?, ?, ?, ?)`,
+		source, reason, time.Now().Unix(), raw)
+	return err
+}
+
+// GetQuarantined returns all quarantined trust objects.
+func (db *DB) GetQuarantined() ([]*Quarantined, error) {
+	rows, err := db.db.Query(
+		"SELECT Source, Reason, Time, Data FROM Quarantine ORDER BY RowID")
+	if err != nil {
+		return nil, common.NewBasicError("Failed to look up quarantined objects", err)
+	}
+	defer rows.Close()
+	var res []*Quarantined
+	for rows.Next() {
+		q := &Quarantined{}
+		var ts int64
+		if err = rows.Scan(&q.Source, &q.Reason, &ts, &q.Data); err != nil {
+			return nil, common.NewBasicError("Failed to read quarantined object", err)
+		}
+		q.Time = time.Unix(ts, 0)
+		res = append(res, q)
+	}
+	return res, rows.Err()
+}
+
+// DeleteExpired deletes certificate chains that expired before now, TRCs that expired before now
+// unless they are the newest TRC of their ISD, and revocation lists that are superseded by a
+// newer version of the same issuer. It returns the number of deleted objects.
+func (db *DB) DeleteExpired(now time.Time) (int64, error) {
+	ts := now.Unix()
+	var total int64
+	stmts := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM Chains WHERE ExpirationTime < ?`, []interface{}{ts}},
+		{`DELETE FROM TRCs WHERE ExpirationTime < ? AND
+			Version < (SELECT MAX(t.Version) FROM TRCs t WHERE t.IsdID = TRCs.IsdID)`,
+			[]interface{}{ts}},
+		{`DELETE FROM RevLists WHERE Version < (SELECT MAX(r.Version) FROM RevLists r
+			WHERE r.IsdID = RevLists.IsdID AND r.AsID = RevLists.AsID)`, nil},
+	}
+	for _, s := range stmts {
+		n, err := db.exec(s.query, s.args...)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// exec executes the statement and returns the number of affected rows.
+func (db *DB) exec(query string, args ...interface{}) (int64, error) {
+	res, err := db.db.Exec(query, args...)
+	if err != nil {
+		return 0, common.NewBasicError("Failed to execute SQL statement", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, common.NewBasicError("Failed to get number of affected rows", err)
+	}
+	return n, nil
+}
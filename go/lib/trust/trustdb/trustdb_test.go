@@ -0,0 +1,206 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+var (
+	fnChain = "../../crypto/cert/testdata/ISD1-AS10-V1.crt"
+	fnTRC   = "../../crypto/cert/testdata/ISD1-V2.trc"
+)
+
+func setupDB(t *testing.T) (*DB, string) {
+	f, err := ioutil.TempFile("", "trustdb-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	db, err := New(f.Name())
+	if err != nil {
+		t.Fatal("Failed to open DB", "err", err)
+	}
+	return db, f.Name()
+}
+
+func loadObjs(t *testing.T) (*trc.TRC, *cert.Chain) {
+	raw, err := ioutil.ReadFile(fnTRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t_, err := trc.TRCFromRaw(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = ioutil.ReadFile(fnChain); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := cert.ChainFromRaw(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return t_, chain
+}
+
+func Test_InsertGet(t *testing.T) {
+	Convey("Trust objects are stored and indexed by ISD-AS and version", t, func() {
+		db, path := setupDB(t)
+		defer os.Remove(path)
+		defer db.Close()
+		t_, chain := loadObjs(t)
+		ia, ver := chain.IAVer()
+		r := &cert.RevList{Issuer: &addr.ISD_AS{I: 1, A: 13}, IssuingTime: 1, TRCVersion: 2,
+			Version: 1}
+		for _, insert := range []func() (int64, error){
+			func() (int64, error) { return db.InsertTRC(t_) },
+			func() (int64, error) { return db.InsertChain(chain) },
+			func() (int64, error) { return db.InsertRevList(r) },
+		} {
+			n, err := insert()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("inserted", n, ShouldEqual, 1)
+			n, err = insert()
+			SoMsg("dup err", err, ShouldBeNil)
+			SoMsg("dup inserted", n, ShouldEqual, 0)
+		}
+		Convey("Exact versions", func() {
+			gotTRC, err := db.GetTRC(t_.ISD, t_.Version)
+			SoMsg("trc err", err, ShouldBeNil)
+			SoMsg("trc", gotTRC, ShouldResemble, t_)
+			gotChain, err := db.GetChain(ia, ver)
+			SoMsg("chain err", err, ShouldBeNil)
+			SoMsg("chain", gotChain, ShouldResemble, chain)
+			gotR, err := db.GetRevList(r.Issuer, r.Version)
+			SoMsg("revList err", err, ShouldBeNil)
+			SoMsg("revList", gotR, ShouldResemble, r)
+		})
+		Convey("Newest versions", func() {
+			next := *r
+			next.Version = 2
+			_, err := db.InsertRevList(&next)
+			SoMsg("insert", err, ShouldBeNil)
+			gotR, err := db.GetRevList(r.Issuer, NewestVersion)
+			SoMsg("revList err", err, ShouldBeNil)
+			SoMsg("revList", gotR, ShouldResemble, &next)
+			gotTRC, err := db.GetTRC(t_.ISD, NewestVersion)
+			SoMsg("trc err", err, ShouldBeNil)
+			SoMsg("trc", gotTRC, ShouldResemble, t_)
+		})
+		Convey("Missing objects", func() {
+			gotTRC, err := db.GetTRC(t_.ISD+1, t_.Version)
+			SoMsg("trc err", err, ShouldBeNil)
+			SoMsg("trc", gotTRC, ShouldBeNil)
+			gotChain, err := db.GetChain(ia, ver+1)
+			SoMsg("chain err", err, ShouldBeNil)
+			SoMsg("chain", gotChain, ShouldBeNil)
+		})
+		Convey("Reopened database", func() {
+			db2, err := New(path)
+			SoMsg("open", err, ShouldBeNil)
+			defer db2.Close()
+			chains, err := db2.GetAllChains()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("chains", chains, ShouldResemble, []*cert.Chain{chain})
+		})
+	})
+}
+
+func Test_Quarantine(t *testing.T) {
+	Convey("Corrupt objects are quarantined", t, func() {
+		db, path := setupDB(t)
+		defer os.Remove(path)
+		defer db.Close()
+		t_, chain := loadObjs(t)
+		_, err := db.InsertTRC(t_)
+		SoMsg("insert trc", err, ShouldBeNil)
+		_, err = db.InsertChain(chain)
+		SoMsg("insert chain", err, ShouldBeNil)
+		_, err = db.exec("UPDATE Chains SET Data = ?", []byte("corrupt"))
+		SoMsg("corrupt", err, ShouldBeNil)
+		chains, err := db.GetAllChains()
+		SoMsg("err", err, ShouldBeNil)
+		SoMsg("chains", chains, ShouldBeEmpty)
+		trcs, err := db.GetAllTRCs()
+		SoMsg("trc err", err, ShouldBeNil)
+		SoMsg("trcs", len(trcs), ShouldEqual, 1)
+		q, err := db.GetQuarantined()
+		SoMsg("q err", err, ShouldBeNil)
+		SoMsg("quarantined", len(q), ShouldEqual, 1)
+		SoMsg("source", q[0].Source, ShouldEqual, ChainsTable)
+		SoMsg("data", string(q[0].Data), ShouldEqual, "corrupt")
+		Convey("Files are quarantined once", func() {
+			SoMsg("first", db.Quarantine("file.crt", "reason", []byte("x")), ShouldBeNil)
+			SoMsg("second", db.Quarantine("file.crt", "reason", []byte("x")), ShouldBeNil)
+			q, err := db.GetQuarantined()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("quarantined", len(q), ShouldEqual, 2)
+		})
+	})
+}
+
+func Test_DeleteExpired(t *testing.T) {
+	Convey("Expired and superseded objects are deleted", t, func() {
+		db, path := setupDB(t)
+		defer os.Remove(path)
+		defer db.Close()
+		t_, chain := loadObjs(t)
+		next := *t_
+		next.Version++
+		for _, x := range []*trc.TRC{t_, &next} {
+			_, err := db.InsertTRC(x)
+			SoMsg("insert trc", err, ShouldBeNil)
+		}
+		_, err := db.InsertChain(chain)
+		SoMsg("insert chain", err, ShouldBeNil)
+		issuer := &addr.ISD_AS{I: 1, A: 13}
+		for ver := uint64(1); ver <= 2; ver++ {
+			_, err = db.InsertRevList(&cert.RevList{Issuer: issuer, TRCVersion: 2, Version: ver})
+			SoMsg("insert revList", err, ShouldBeNil)
+		}
+		Convey("Before expiry, only superseded revocation lists are deleted", func() {
+			n, err := db.DeleteExpired(time.Unix(0, 0))
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("deleted", n, ShouldEqual, 1)
+			r, err := db.GetRevList(issuer, 1)
+			SoMsg("revList err", err, ShouldBeNil)
+			SoMsg("revList", r, ShouldBeNil)
+		})
+		Convey("After expiry, the newest TRC is kept", func() {
+			exp := chain.Leaf.ExpirationTime
+			if t_.ExpirationTime > exp {
+				exp = t_.ExpirationTime
+			}
+			n, err := db.DeleteExpired(time.Unix(int64(exp)+1, 0))
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("deleted", n, ShouldEqual, 3)
+			trcs, err := db.GetAllTRCs()
+			SoMsg("trc err", err, ShouldBeNil)
+			SoMsg("trcs", trcs, ShouldResemble, []*trc.TRC{&next})
+			chains, err := db.GetAllChains()
+			SoMsg("chain err", err, ShouldBeNil)
+			SoMsg("chains", chains, ShouldBeEmpty)
+		})
+	})
+}
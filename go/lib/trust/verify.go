@@ -0,0 +1,187 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"context"
+	"net"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/infra"
+)
+
+// Errors returned when a trust object is rejected by AddChainVerified,
+// AddTRCVerified or AddRevListVerified. Use common.GetErrorMsg to determine
+// the reason.
+const (
+	ErrMissingTRC     = "Verifying TRC not found"
+	ErrInactiveTRC    = "Verifying TRC not active"
+	ErrInvalidChain   = "Certificate chain verification failed"
+	ErrInvalidTRC     = "TRC verification failed"
+	ErrInvalidRevList = "Revocation list verification failed"
+	ErrRevokedChain   = "Certificate chain revoked"
+	ErrInvalidSegment = "Path segment verification failed"
+)
+
+// AddChainVerified adds a certificate chain to the store, after verifying it
+// against the TRC it was issued under. The TRC must be in the store, and
+// active. If write is true, the certificate chain is written to the database
+// (in case it does not already exist).
+func (s *Store) AddChainVerified(chain *cert.Chain, write bool) error {
+	if err := s.VerifyChain(chain); err != nil {
+		return err
+	}
+	return s.AddChain(chain, write)
+}
+
+// VerifyChain verifies a certificate chain against the TRC it was issued under,
+// which must be in the store, and active. The chain is rejected, if the newest
+// revocation list of its issuer in the store revokes the leaf or the core
+// certificate.
+func (s *Store) VerifyChain(chain *cert.Chain) error {
+	ia, ver := chain.IAVer()
+	t := s.GetTRC(uint16(ia.I), chain.Core.TRCVersion)
+	if t == nil {
+		return common.NewBasicError(ErrMissingTRC, nil, "chain", chain.Key(),
+			"trc", trc.NewKey(uint16(ia.I), chain.Core.TRCVersion))
+	}
+	if err := t.CheckActive(s.GetNewestTRC(uint16(ia.I))); err != nil {
+		return common.NewBasicError(ErrInactiveTRC, err, "chain", chain.Key(), "trc", t.Key())
+	}
+	if err := chain.Verify(ia, t); err != nil {
+		return common.NewBasicError(ErrInvalidChain, err, "ia", ia, "ver", ver,
+			"trc", t.Key())
+	}
+	return s.CheckRevoked(chain)
+}
+
+// CheckRevoked returns an error, if the leaf or the core certificate of the
+// chain is revoked by the newest revocation list of the issuer in the store.
+func (s *Store) CheckRevoked(chain *cert.Chain) error {
+	r := s.GetNewestRevList(chain.Leaf.Issuer)
+	if r == nil {
+		return nil
+	}
+	if err := r.CheckChain(chain); err != nil {
+		return common.NewBasicError(ErrRevokedChain, err, "chain", chain.Key())
+	}
+	return nil
+}
+
+// AddTRCVerified adds a TRC to the store, after verifying it against its
+// predecessor, which must be in the store. If the store does not contain any
+// TRC of the same ISD, the TRC must be cross-signed by an active TRC of another
+// ISD instead. The TRC must also be active, i.e., either the newest TRC of its
+// ISD, or its predecessor within the grace period. If the store already
+// contains a TRC with the same ISD and version, nothing is done. If write is
+// true, the TRC is written to the database (in case it does not already
+// exist).
+func (s *Store) AddTRCVerified(t *trc.TRC, write bool) error {
+	isd, ver := t.IsdVer()
+	if s.GetTRC(isd, ver) != nil {
+		return nil
+	}
+	if err := s.VerifyTRC(t); err != nil {
+		return err
+	}
+	return s.AddTRC(t, write)
+}
+
+// VerifyTRC verifies a TRC against its predecessor, which must be in the store,
+// and checks that it is active. The TRC of an ISD unknown to the store is
+// verified based on cross signatures instead.
+func (s *Store) VerifyTRC(t *trc.TRC) error {
+	isd, ver := t.IsdVer()
+	maxTRC := s.GetNewestTRC(isd)
+	if maxTRC == nil {
+		if err := s.verifyXSigned(t); err != nil {
+			return err
+		}
+	} else {
+		prev := s.GetTRC(isd, ver-1)
+		if prev == nil {
+			return common.NewBasicError(ErrMissingTRC, nil, "trc", t.Key(),
+				"prev", trc.NewKey(isd, ver-1))
+		}
+		if _, err := t.Verify(prev); err != nil {
+			return common.NewBasicError(ErrInvalidTRC, err, "trc", t.Key())
+		}
+	}
+	if maxTRC == nil || maxTRC.Version < ver {
+		maxTRC = t
+	}
+	if err := t.CheckActive(maxTRC); err != nil {
+		return common.NewBasicError(ErrInvalidTRC, err, "trc", t.Key())
+	}
+	return nil
+}
+
+// AddRevListVerified adds a revocation list to the store, after verifying it
+// against the TRC it was issued under. The TRC must be in the store, and
+// active. If the store already contains a revocation list with the same issuer
+// and version, nothing is done. If write is true, the revocation list is
+// written to the database (in case it does not already exist).
+func (s *Store) AddRevListVerified(r *cert.RevList, write bool) error {
+	if s.GetRevList(r.Issuer, r.Version) != nil {
+		return nil
+	}
+	if err := s.VerifyRevList(r); err != nil {
+		return err
+	}
+	return s.AddRevList(r, write)
+}
+
+// VerifyRevList verifies a revocation list against the TRC it was issued
+// under, which must be in the store, and active.
+func (s *Store) VerifyRevList(r *cert.RevList) error {
+	t := s.GetTRC(uint16(r.Issuer.I), r.TRCVersion)
+	if t == nil {
+		return common.NewBasicError(ErrMissingTRC, nil, "revList", r.Key(),
+			"trc", trc.NewKey(uint16(r.Issuer.I), r.TRCVersion))
+	}
+	if err := t.CheckActive(s.GetNewestTRC(t.ISD)); err != nil {
+		return common.NewBasicError(ErrInactiveTRC, err, "revList", r.Key(), "trc", t.Key())
+	}
+	if err := r.Verify(t); err != nil {
+		return common.NewBasicError(ErrInvalidRevList, err, "revList", r.Key(),
+			"trc", t.Key())
+	}
+	return nil
+}
+
+// VerifySegment verifies the signatures of all AS entries of a path segment.
+// The certificate chains of the signing ASes are fetched through
+// GetCertificate, i.e., missing trust objects are requested from hint.
+func (s *Store) VerifySegment(ctx context.Context, pseg *seg.PathSegment, hint net.Addr) error {
+	for i, ase := range pseg.ASEntries {
+		trail := []infra.TrustDescriptor{{
+			Type:         infra.ChainDescriptor,
+			IA:           *ase.IA(),
+			ChainVersion: ase.CertVer,
+			TRCVersion:   ase.TrcVer,
+		}}
+		crt, err := s.GetCertificate(ctx, trail, hint)
+		if err != nil {
+			return common.NewBasicError(ErrInvalidSegment, err, "ia", ase.IA(), "idx", i)
+		}
+		if err = pseg.VerifyASEntry(crt.SubjectSignKey, i); err != nil {
+			return common.NewBasicError(ErrInvalidSegment, err, "ia", ase.IA(), "idx", i)
+		}
+	}
+	return nil
+}
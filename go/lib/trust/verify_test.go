@@ -0,0 +1,187 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+var (
+	fnChain = "../crypto/cert/testdata/ISD1-AS10-V1.crt"
+	fnTRC   = "../crypto/cert/testdata/ISD1-V2.trc"
+
+	coreIA = addr.ISD_AS{I: 1, A: 13}
+)
+
+// trustObjs returns the test TRC (version 2) with a fresh online key for core
+// AS 1-13, and the test certificate chain, signed accordingly.
+func trustObjs(t *testing.T) (*trc.TRC, common.RawBytes, *cert.Chain) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubCoreRaw, privCoreRaw := []byte(pub), []byte(priv)
+	pub, priv, _ = ed25519.GenerateKey(nil)
+	pubTRCRaw, privTRCRaw := []byte(pub), []byte(priv)
+	now := uint64(time.Now().Unix())
+
+	t_ := loadTRC(fnTRC, t)
+	t_.CoreASes[coreIA].OnlineKey = pubTRCRaw
+	t_.CoreASes[coreIA].OnlineKeyAlg = crypto.Ed25519
+	t_.CreationTime = now - 1<<10
+	t_.ExpirationTime = now + 1<<20
+	t_.GracePeriod = 0
+
+	chain := loadChain(fnChain, t)
+	chain.Leaf.IssuingTime = now
+	chain.Leaf.ExpirationTime = now + 1<<20
+	chain.Leaf.Sign(privCoreRaw, crypto.Ed25519)
+	chain.Core.SubjectSignKey = pubCoreRaw
+	chain.Core.IssuingTime = now
+	chain.Core.ExpirationTime = now + 1<<20
+	chain.Core.Sign(privTRCRaw, crypto.Ed25519)
+	return t_, privTRCRaw, chain
+}
+
+// nextTRC returns the successor of prev, signed by core AS 1-13.
+func nextTRC(prev *trc.TRC, signKey common.RawBytes, t *testing.T) *trc.TRC {
+	next := loadTRC(fnTRC, t)
+	next.CoreASes[coreIA].OnlineKey = prev.CoreASes[coreIA].OnlineKey
+	next.CoreASes[coreIA].OnlineKeyAlg = prev.CoreASes[coreIA].OnlineKeyAlg
+	next.Version = prev.Version + 1
+	next.CreationTime = prev.CreationTime + prev.GracePeriod + 1
+	next.ExpirationTime = prev.ExpirationTime
+	next.Signatures = make(map[string]common.RawBytes)
+	if err := next.Sign(coreIA.String(), signKey, crypto.Ed25519); err != nil {
+		t.Fatalf("Unable to sign TRC: %v", err)
+	}
+	return next
+}
+
+func Test_AddChainVerified(t *testing.T) {
+	Convey("Adding verified certificate chains", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t_, _, chain := trustObjs(t)
+		Convey("Without the TRC, the chain is rejected", func() {
+			err := s.AddChainVerified(chain, false)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrMissingTRC)
+			SoMsg("chain", s.GetChain(chain.Leaf.Subject, 1), ShouldBeNil)
+		})
+		Convey("With the TRC", func() {
+			SoMsg("err", s.AddTRC(t_, false), ShouldBeNil)
+			Convey("A valid chain is added", func() {
+				SoMsg("err", s.AddChainVerified(chain, false), ShouldBeNil)
+				SoMsg("chain", s.GetChain(chain.Leaf.Subject, 1), ShouldEqual, chain)
+			})
+			Convey("A chain with an invalid signature is rejected", func() {
+				chain.Leaf.Comment = "Tampered"
+				err := s.AddChainVerified(chain, false)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidChain)
+				SoMsg("chain", s.GetChain(chain.Leaf.Subject, 1), ShouldBeNil)
+			})
+			Convey("A chain issued under an expired TRC is rejected", func() {
+				t_.ExpirationTime = t_.CreationTime + 1
+				err := s.AddChainVerified(chain, false)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInactiveTRC)
+			})
+		})
+	})
+}
+
+func Test_AddTRCVerified(t *testing.T) {
+	Convey("Adding verified TRCs", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		prev, signKey, _ := trustObjs(t)
+		next := nextTRC(prev, signKey, t)
+		Convey("Without the predecessor, the TRC is rejected", func() {
+			err := s.AddTRCVerified(next, false)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrMissingTRC)
+			SoMsg("trc", s.GetTRC(next.ISD, next.Version), ShouldBeNil)
+		})
+		Convey("With the predecessor", func() {
+			SoMsg("err", s.AddTRC(prev, false), ShouldBeNil)
+			Convey("A valid TRC is added", func() {
+				SoMsg("err", s.AddTRCVerified(next, false), ShouldBeNil)
+				SoMsg("trc", s.GetTRC(next.ISD, next.Version), ShouldEqual, next)
+				SoMsg("newest", s.GetNewestTRC(next.ISD), ShouldEqual, next)
+			})
+			Convey("A TRC with an invalid signature is rejected", func() {
+				next.Description = "Tampered"
+				err := s.AddTRCVerified(next, false)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidTRC)
+				SoMsg("trc", s.GetTRC(next.ISD, next.Version), ShouldBeNil)
+			})
+			Convey("An expired TRC is rejected", func() {
+				next.ExpirationTime = next.CreationTime + 1
+				next.Signatures = make(map[string]common.RawBytes)
+				next.Sign(coreIA.String(), signKey, crypto.Ed25519)
+				err := s.AddTRCVerified(next, false)
+				SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidTRC)
+			})
+		})
+	})
+}
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "trust_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	s, err := NewStore(dir, dir, "cs1-10-1")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Unable to create store: %v", err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func loadChain(filename string, t *testing.T) *cert.Chain {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", filename, err)
+	}
+	chain, err := cert.ChainFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading Certificate Chain from '%s': %v", filename, err)
+	}
+	return chain
+}
+
+func loadTRC(filename string, t *testing.T) *trc.TRC {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", filename, err)
+	}
+	t_, err := trc.TRCFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading TRC from '%s': %v", filename, err)
+	}
+	return t_
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+const ErrNoTrustPath = "No trust path found"
+
+// TrustPath returns a chain of TRCs from the newest TRC of ISD src to the newest TRC of ISD dst,
+// where each TRC is cross-signed by the core ASes of its predecessor in the chain. The first
+// element is the TRC of src, the last the TRC of dst. Only active TRCs are considered, and the
+// shortest chain is returned.
+func (s *Store) TrustPath(src, dst uint16) ([]*trc.TRC, error) {
+	trcs := s.activeTRCs()
+	if _, ok := trcs[src]; !ok {
+		return nil, common.NewBasicError(ErrMissingTRC, nil, "isd", src)
+	}
+	isds := make([]uint16, 0, len(trcs))
+	for isd := range trcs {
+		isds = append(isds, isd)
+	}
+	sort.Slice(isds, func(i, j int) bool { return isds[i] < isds[j] })
+	// Breadth-first search, prev maps each reached ISD to its predecessor on the path.
+	prev := map[uint16]uint16{src: src}
+	queue := []uint16{src}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		if curr == dst {
+			path := []*trc.TRC{trcs[dst]}
+			for isd := dst; isd != src; {
+				isd = prev[isd]
+				path = append([]*trc.TRC{trcs[isd]}, path...)
+			}
+			return path, nil
+		}
+		for _, isd := range isds {
+			if _, ok := prev[isd]; ok {
+				continue
+			}
+			if _, err := trcs[isd].Verify(trcs[curr]); err == nil {
+				prev[isd] = curr
+				queue = append(queue, isd)
+			}
+		}
+	}
+	return nil, common.NewBasicError(ErrNoTrustPath, nil, "src", src, "dst", dst)
+}
+
+// verifyXSigned verifies the TRC of an ISD that is not yet known to the store, based on the cross
+// signatures of an active TRC of another ISD in the store.
+func (s *Store) verifyXSigned(t *trc.TRC) error {
+	var err error
+	for _, trust := range s.activeTRCs() {
+		if !xSigned(t, trust) {
+			continue
+		}
+		if _, err = t.Verify(trust); err == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return common.NewBasicError(ErrInvalidTRC, err, "trc", t.Key())
+	}
+	return common.NewBasicError(ErrMissingTRC, nil, "trc", t.Key())
+}
+
+// activeTRCs returns the newest TRCs of all ISDs which are currently active.
+func (s *Store) activeTRCs() map[uint16]*trc.TRC {
+	trcs := make(map[uint16]*trc.TRC)
+	for _, t := range s.GetTRCList() {
+		if t.CheckActive(t) == nil {
+			trcs[t.ISD] = t
+		}
+	}
+	return trcs
+}
+
+// xSigned returns true if t carries a signature from any of the core ASes of trust.
+func xSigned(t, trust *trc.TRC) bool {
+	for ia := range trust.CoreASes {
+		if _, ok := t.Signatures[ia.String()]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trust
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+// newISDTRC returns an active TRC of the ISD with the single core AS isd-13, and
+// the online key of that core AS.
+func newISDTRC(isd uint16, t *testing.T) (*trc.TRC, common.RawBytes) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	now := uint64(time.Now().Unix())
+	t_ := loadTRC(fnTRC, t)
+	t_.ISD = isd
+	t_.CoreASes = map[addr.ISD_AS]*trc.CoreAS{
+		{I: int(isd), A: 13}: {OnlineKey: []byte(pub), OnlineKeyAlg: crypto.Ed25519},
+	}
+	t_.CreationTime = now - 1<<10
+	t_.ExpirationTime = now + 1<<20
+	t_.Signatures = nil
+	return t_, []byte(priv)
+}
+
+// xSign cross-signs t with the core AS of the ISD of trust.
+func xSign(t_, trust *trc.TRC, signKey common.RawBytes, t *testing.T) {
+	signer := addr.ISD_AS{I: int(trust.ISD), A: 13}
+	if err := t_.Sign(signer.String(), signKey, crypto.Ed25519); err != nil {
+		t.Fatalf("Unable to cross-sign TRC: %v", err)
+	}
+}
+
+func Test_TrustPath(t *testing.T) {
+	Convey("Trust paths are discovered correctly", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		// ISD 1 cross-signs ISD 2, which cross-signs ISD 3. ISD 4 is not cross-signed.
+		t1, k1 := newISDTRC(1, t)
+		t2, k2 := newISDTRC(2, t)
+		t3, _ := newISDTRC(3, t)
+		t4, _ := newISDTRC(4, t)
+		xSign(t2, t1, k1, t)
+		xSign(t3, t2, k2, t)
+		for _, t_ := range []*trc.TRC{t1, t2, t3, t4} {
+			SoMsg("add err", s.AddTRC(t_, false), ShouldBeNil)
+		}
+		Convey("Path to own ISD", func() {
+			path, err := s.TrustPath(1, 1)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("path", path, ShouldResemble, []*trc.TRC{t1})
+		})
+		Convey("Path over multiple ISDs", func() {
+			path, err := s.TrustPath(1, 3)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("path", path, ShouldResemble, []*trc.TRC{t1, t2, t3})
+		})
+		Convey("Cross signatures are not symmetric", func() {
+			_, err := s.TrustPath(3, 1)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrNoTrustPath)
+		})
+		Convey("No path to ISD without cross signatures", func() {
+			_, err := s.TrustPath(1, 4)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrNoTrustPath)
+		})
+		Convey("Expired TRCs are not part of a path", func() {
+			t2.ExpirationTime = t2.CreationTime + 1
+			_, err := s.TrustPath(1, 3)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrNoTrustPath)
+		})
+		Convey("Unknown source ISD", func() {
+			_, err := s.TrustPath(5, 1)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrMissingTRC)
+		})
+	})
+}
+
+func Test_AddTRCVerified_XSig(t *testing.T) {
+	Convey("TRCs of unknown ISDs are verified based on cross signatures", t, func() {
+		s, cleanup := newTestStore(t)
+		defer cleanup()
+		t1, k1 := newISDTRC(1, t)
+		t2, _ := newISDTRC(2, t)
+		SoMsg("add err", s.AddTRC(t1, false), ShouldBeNil)
+		Convey("A cross-signed TRC is added", func() {
+			xSign(t2, t1, k1, t)
+			SoMsg("err", s.AddTRCVerified(t2, false), ShouldBeNil)
+			SoMsg("trc", s.GetNewestTRC(2), ShouldEqual, t2)
+		})
+		Convey("A TRC without cross signatures is rejected", func() {
+			err := s.AddTRCVerified(t2, false)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrMissingTRC)
+			SoMsg("trc", s.GetNewestTRC(2), ShouldBeNil)
+		})
+		Convey("A TRC with an invalid cross signature is rejected", func() {
+			xSign(t2, t1, k1, t)
+			t2.Description = "Tampered"
+			err := s.AddTRCVerified(t2, false)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrInvalidTRC)
+			SoMsg("trc", s.GetNewestTRC(2), ShouldBeNil)
+		})
+	})
+}
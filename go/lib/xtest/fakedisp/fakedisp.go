@@ -0,0 +1,366 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakedisp defines an in-process dispatcher, for testing applications without a
+// running SCION network.
+//
+// The dispatcher listens on a ReliableSocket in a temporary directory. Packets sent by a
+// registered application are not forwarded on a path, but delivered directly to the
+// application registered for their destination address, in any ISD-AS. The first hop in the
+// ReliableSocket header is ignored. Packets to anycast SVC addresses are delivered to the
+// first application registered for the SVC address in the destination ISD-AS, packets to
+// multicast SVC addresses to all of them.
+//
+// A filter set with SetFilter decides the fate of each packet, which can be dropped, or held
+// back to be delivered after the next packet. InjectSCMP sends SCMP errors for a packet to its
+// sender.
+//
+// NewNetwork returns an snet.Network using the dispatcher, and a sciond.Service such as the
+// one in package fakesciond.
+package fakedisp
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/hpkt"
+	"github.com/scionproto/scion/go/lib/l4"
+	"github.com/scionproto/scion/go/lib/overlay"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/sock/reliable/regtable"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/spkt"
+)
+
+const (
+	ErrorNoSender = "No application registered for the source of the packet"
+	ErrorNotUDP   = "Not a SCION/UDP packet"
+)
+
+// writeTimeout bounds the time spent delivering a packet to an application.
+const writeTimeout = time.Second
+
+// Verdict is the decision of a Filter on a packet.
+type Verdict int
+
+const (
+	// Deliver delivers the packet to its destination.
+	Deliver Verdict = iota
+	// Drop silently discards the packet.
+	Drop
+	// Hold delays the packet until after the next delivered packet, reordering the two.
+	Hold
+)
+
+// Packet is a packet sent by an application.
+type Packet struct {
+	*spkt.ScnPkt
+	// Raw is the packet as sent by the application.
+	Raw common.RawBytes
+}
+
+// Filter is called on each packet sent by an application, before it is delivered.
+type Filter func(pkt *Packet) Verdict
+
+// app is an application registered with the dispatcher.
+type app struct {
+	conn *reliable.Conn
+	reg  *reliable.Registration
+}
+
+// Dispatcher is a fake dispatcher. It is safe for concurrent use.
+type Dispatcher struct {
+	dir      string
+	path     string
+	listener *reliable.Listener
+	table    *regtable.Table
+	mu       sync.Mutex
+	filter   Filter
+	held     []*Packet
+}
+
+// New starts a dispatcher on a ReliableSocket in a new temporary directory, which is removed by
+// Close.
+func New() (*Dispatcher, error) {
+	dir, err := ioutil.TempDir("", "fakedisp")
+	if err != nil {
+		return nil, common.NewBasicError("Unable to create socket directory", err)
+	}
+	path := filepath.Join(dir, "disp.sock")
+	l, err := reliable.Listen(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	d := &Dispatcher{
+		dir:      dir,
+		path:     path,
+		listener: l,
+		table:    regtable.New(),
+	}
+	go d.serve()
+	return d, nil
+}
+
+// Path returns the path of the ReliableSocket of the dispatcher.
+func (d *Dispatcher) Path() string {
+	return d.path
+}
+
+// SetFilter sets the filter applied to all future packets. A nil filter delivers all packets.
+func (d *Dispatcher) SetFilter(f Filter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.filter = f
+}
+
+// Release delivers the held packets.
+func (d *Dispatcher) Release() {
+	d.mu.Lock()
+	held := d.held
+	d.held = nil
+	d.mu.Unlock()
+	for _, pkt := range held {
+		d.route(pkt)
+	}
+}
+
+// Close stops accepting applications, and removes the temporary directory. Registered
+// applications stay connected.
+func (d *Dispatcher) Close() error {
+	err := d.listener.Close()
+	os.RemoveAll(d.dir)
+	return err
+}
+
+func (d *Dispatcher) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handleApp(conn)
+	}
+}
+
+// handleApp registers the application on conn, and then routes its packets until the
+// application closes the connection.
+func (d *Dispatcher) handleApp(conn *reliable.Conn) {
+	defer conn.Close()
+	buf := make(common.RawBytes, common.MaxMTU)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return
+	}
+	reg, err := reliable.ParseRegistration(buf[:n])
+	if err != nil {
+		log.Error("fakedisp: Invalid registration", "err", err)
+		return
+	}
+	a := &app{conn: conn, reg: reg}
+	reply := make(common.RawBytes, 2)
+	if err = d.table.Register(reg, a); err != nil {
+		log.Error("fakedisp: Unable to register application", "reg", reg, "err", err)
+		// A port of 0 tells the application that the registration failed.
+		conn.Write(reply)
+		return
+	}
+	defer d.table.Unregister(reg)
+	common.Order.PutUint16(reply, reg.Public.Port)
+	if _, err = conn.Write(reply); err != nil {
+		return
+	}
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		pkt := &Packet{
+			ScnPkt: &spkt.ScnPkt{
+				DstIA: &addr.ISD_AS{},
+				SrcIA: &addr.ISD_AS{},
+				Path:  &spath.Path{},
+			},
+			Raw: append(common.RawBytes(nil), buf[:n]...),
+		}
+		if err = hpkt.ParseScnPkt(pkt.ScnPkt, pkt.Raw); err != nil {
+			log.Warn("fakedisp: Dropping invalid packet", "reg", reg, "err", err)
+			continue
+		}
+		d.handlePacket(pkt)
+	}
+}
+
+// handlePacket applies the filter to pkt, and delivers it if the filter allows it. Held
+// packets are delivered after a delivered packet.
+func (d *Dispatcher) handlePacket(pkt *Packet) {
+	d.mu.Lock()
+	filter := d.filter
+	d.mu.Unlock()
+	verdict := Deliver
+	if filter != nil {
+		verdict = filter(pkt)
+	}
+	switch verdict {
+	case Drop:
+		return
+	case Hold:
+		d.mu.Lock()
+		d.held = append(d.held, pkt)
+		d.mu.Unlock()
+		return
+	}
+	d.route(pkt)
+	d.Release()
+}
+
+// route delivers pkt to the applications registered for its destination.
+func (d *Dispatcher) route(pkt *Packet) {
+	var apps []*app
+	switch hdr := pkt.L4.(type) {
+	case *l4.UDP:
+		apps = d.lookup(pkt.DstIA, pkt.DstHost, hdr.DstPort)
+	default:
+		log.Debug("fakedisp: Dropping non-UDP packet", "l4", pkt.L4)
+	}
+	for _, a := range apps {
+		a.deliver(pkt.Raw)
+	}
+}
+
+// lookup returns the applications a packet to port on host in ia is delivered to.
+func (d *Dispatcher) lookup(ia *addr.ISD_AS, host addr.HostAddr, port uint16) []*app {
+	svc, ok := host.(addr.HostSVC)
+	if !ok {
+		if a, ok := d.table.LookupUDP(ia, host, port).(*app); ok {
+			return []*app{a}
+		}
+		return nil
+	}
+	values := d.table.LookupSvc(ia, nil, svc)
+	if len(values) == 0 {
+		return nil
+	}
+	if !svc.IsMulticast() {
+		values = values[:1]
+	}
+	apps := make([]*app, len(values))
+	for i, v := range values {
+		apps[i] = v.(*app)
+	}
+	return apps
+}
+
+// lastHop is the overlay address packets are delivered from. Applications replying to a packet
+// send to it, which is ignored by the dispatcher.
+var lastHop = reliable.AppAddr{
+	Addr: addr.HostFromIP(net.IPv4(127, 0, 0, 1)),
+	Port: overlay.EndhostPort,
+}
+
+func (a *app) deliver(raw common.RawBytes) {
+	a.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := a.conn.WriteTo(raw, lastHop); err != nil {
+		log.Warn("fakedisp: Unable to deliver packet", "reg", a.reg, "err", err)
+	}
+}
+
+// InjectSCMP sends an SCMP error of type ct, with info, for the SCION/UDP packet pkt to the
+// sender of pkt. The sender has to be registered for SCMP errors. The SCMP error quotes the
+// common header, address header and UDP header of pkt, and has an empty path.
+func (d *Dispatcher) InjectSCMP(pkt *Packet, ct scmp.ClassType, info scmp.Info) error {
+	udp, ok := pkt.L4.(*l4.UDP)
+	if !ok {
+		return common.NewBasicError(ErrorNotUDP, nil, "l4", pkt.L4)
+	}
+	apps := d.lookup(pkt.SrcIA, pkt.SrcHost, udp.SrcPort)
+	if len(apps) == 0 || !apps[0].reg.SCMP {
+		return common.NewBasicError(ErrorNoSender, nil, "ia", pkt.SrcIA, "host", pkt.SrcHost,
+			"port", udp.SrcPort)
+	}
+	quotes, err := quoteBlocks(pkt.Raw)
+	if err != nil {
+		return err
+	}
+	pld := scmp.PldFromQuotes(ct, info, common.L4UDP, func(blk scmp.RawBlock) common.RawBytes {
+		return quotes[blk]
+	})
+	errPkt := &spkt.ScnPkt{
+		DstIA:   pkt.SrcIA,
+		SrcIA:   pkt.DstIA,
+		DstHost: pkt.SrcHost,
+		SrcHost: lastHop.Addr,
+		L4:      scmp.NewHdr(ct, pld.Len()),
+		Pld:     pld,
+	}
+	raw := make(common.RawBytes, common.MaxMTU)
+	n, err := hpkt.WriteScnPkt(errPkt, raw)
+	if err != nil {
+		return common.NewBasicError("Unable to write SCMP error", err)
+	}
+	apps[0].deliver(raw[:n])
+	return nil
+}
+
+// quoteBlocks returns the common, address, path and L4 headers of the raw SCION/UDP packet.
+func quoteBlocks(raw common.RawBytes) (map[scmp.RawBlock]common.RawBytes, error) {
+	cmnHdr, err := spkt.CmnHdrFromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	dstLen, err := addr.HostLen(cmnHdr.DstType)
+	if err != nil {
+		return nil, err
+	}
+	srcLen, err := addr.HostLen(cmnHdr.SrcType)
+	if err != nil {
+		return nil, err
+	}
+	addrLen := 2*addr.IABytes + int(dstLen) + int(srcLen)
+	addrEnd := spkt.CmnHdrLen + addrLen + (common.LineLen-addrLen%common.LineLen)%common.LineLen
+	hdrEnd := int(cmnHdr.HdrLen) * common.LineLen
+	if hdrEnd < addrEnd || len(raw) < hdrEnd+l4.UDPLen {
+		return nil, common.NewBasicError("Truncated packet", nil, "len", len(raw))
+	}
+	return map[scmp.RawBlock]common.RawBytes{
+		scmp.RawCmnHdr:  raw[:spkt.CmnHdrLen],
+		scmp.RawAddrHdr: raw[spkt.CmnHdrLen:addrEnd],
+		scmp.RawPathHdr: raw[addrEnd:hdrEnd],
+		scmp.RawL4Hdr:   raw[hdrEnd : hdrEnd+l4.UDPLen],
+	}, nil
+}
+
+// NewNetwork returns a network in ia, with applications registering with the dispatcher d, and
+// paths resolved through srvc.
+func NewNetwork(ia *addr.ISD_AS, d *Dispatcher, srvc sciond.Service) (*snet.Network, error) {
+	pr, err := pathmgr.New(srvc, &pathmgr.Timers{}, log.Root())
+	if err != nil {
+		return nil, common.NewBasicError("Unable to initialize path resolver", err)
+	}
+	network := snet.NewNetworkBasic(ia, "", d.Path())
+	network.SetPathResolver(pr)
+	return network, nil
+}
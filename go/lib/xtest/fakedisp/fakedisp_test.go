@@ -0,0 +1,142 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedisp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/overlay"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/xtest/fakesciond"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var (
+	ia1  = &addr.ISD_AS{I: 1, A: 10}
+	ia2  = &addr.ISD_AS{I: 1, A: 20}
+	host = addr.HostFromIP(net.IPv4(127, 0, 0, 1))
+)
+
+func TestDispatcher(t *testing.T) {
+	Convey("Given two connections in different ASes", t, func() {
+		d, err := New()
+		SoMsg("disp err", err, ShouldBeNil)
+		Reset(func() { d.Close() })
+		srvc := fakesciond.New()
+		srvc.SetPaths(ia1, ia2, fakesciond.NewPathEntry(host, overlay.EndhostPort,
+			sciond.PathInterface{RawIsdas: ia1.IAInt(), IfID: 1},
+			sciond.PathInterface{RawIsdas: ia2.IAInt(), IfID: 2}))
+		c1, c2 := listen(d, srvc, ia1), listen(d, srvc, ia2)
+		Reset(func() {
+			c1.Close()
+			c2.Close()
+		})
+		raddr := c2.LocalSnetAddr()
+		buf := make([]byte, 100)
+
+		Convey("A packet is delivered, and the reply on the reversed path", func() {
+			_, err := c1.WriteToSCION([]byte("ping"), raddr)
+			SoMsg("write err", err, ShouldBeNil)
+			n, from, err := c2.ReadFromSCION(buf)
+			SoMsg("read err", err, ShouldBeNil)
+			SoMsg("pld", string(buf[:n]), ShouldEqual, "ping")
+			SoMsg("src port", from.L4Port, ShouldEqual, c1.LocalSnetAddr().L4Port)
+			_, err = c2.WriteToSCION([]byte("pong"), from)
+			SoMsg("reply err", err, ShouldBeNil)
+			n, err = c1.Read(buf)
+			SoMsg("reply read err", err, ShouldBeNil)
+			SoMsg("reply pld", string(buf[:n]), ShouldEqual, "pong")
+		})
+		Convey("A dropped packet is not delivered", func() {
+			d.SetFilter(func(pkt *Packet) Verdict { return Drop })
+			_, err := c1.WriteToSCION([]byte("ping"), raddr)
+			SoMsg("write err", err, ShouldBeNil)
+			c2.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			_, err = c2.Read(buf)
+			SoMsg("read err", err, ShouldNotBeNil)
+		})
+		Convey("A held packet is delivered after the next packet", func() {
+			first := true
+			d.SetFilter(func(pkt *Packet) Verdict {
+				if first {
+					first = false
+					return Hold
+				}
+				return Deliver
+			})
+			for _, pld := range []string{"first", "second"} {
+				_, err := c1.WriteToSCION([]byte(pld), raddr)
+				SoMsg("write err", err, ShouldBeNil)
+			}
+			for _, pld := range []string{"second", "first"} {
+				n, err := c2.Read(buf)
+				SoMsg("read err", err, ShouldBeNil)
+				SoMsg("pld", string(buf[:n]), ShouldEqual, pld)
+			}
+		})
+		Convey("An injected revocation is reported to the sender and to SCIOND", func() {
+			rawRev, err := proto.PackRoot(&path_mgmt.RevInfo{IfID: 1, RawIsdas: ia1.IAInt()})
+			SoMsg("pack err", err, ShouldBeNil)
+			ct := scmp.ClassType{Class: scmp.C_Path, Type: scmp.T_P_RevokedIF}
+			d.SetFilter(func(pkt *Packet) Verdict {
+				info := scmp.NewInfoRevocation(0, 1, 1, false, rawRev)
+				SoMsg("inject err", d.InjectSCMP(pkt, ct, info), ShouldBeNil)
+				return Drop
+			})
+			_, err = c1.WriteToSCION([]byte("ping"), raddr)
+			SoMsg("write err", err, ShouldBeNil)
+			_, err = c1.Read(buf)
+			opErr, ok := err.(*snet.OpError)
+			SoMsg("op err", ok, ShouldBeTrue)
+			SoMsg("class", opErr.SCMP().Class, ShouldEqual, scmp.C_Path)
+			SoMsg("revocation", waitRevocation(srvc), ShouldBeTrue)
+		})
+	})
+}
+
+func listen(d *Dispatcher, srvc sciond.Service, ia *addr.ISD_AS) *snet.Conn {
+	network, err := NewNetwork(ia, d, srvc)
+	SoMsg("network err", err, ShouldBeNil)
+	conn, err := network.ListenSCION("udp4", &snet.Addr{IA: ia, Host: host})
+	SoMsg("listen err", err, ShouldBeNil)
+	return conn
+}
+
+// waitRevocation returns whether srvc is notified of a revocation within a second.
+func waitRevocation(srvc *fakesciond.Service) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if len(srvc.Revocations()) > 0 {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestQuoteBlocks(t *testing.T) {
+	Convey("Truncated packets are rejected", t, func() {
+		_, err := quoteBlocks(common.RawBytes{0, 0})
+		SoMsg("err", err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,399 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakesciond defines an in-process sciond.Service, for testing applications without a
+// running SCIOND.
+//
+// The replies of the service are scripted by the test. Paths are set per source and
+// destination ISD-AS with SetPaths, and NewPathEntry builds path entries with a valid
+// forwarding path. Valid revocations remove the paths containing the revoked interface.
+// Queries can be delayed with SetDelay, and made to fail with errors queued by AddErrors.
+//
+// All connectors returned by a service share its state, which can be changed by the test at
+// any time.
+package fakesciond
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+const ErrorClosed = "Connector closed"
+
+var _ sciond.Service = (*Service)(nil)
+
+// Service is a fake sciond.Service. It is safe for concurrent use.
+type Service struct {
+	sync.Mutex
+	paths      map[iaPair][]sciond.PathReplyEntry
+	asInfos    map[addr.IAInt]sciond.ASInfoReplyEntry
+	ifInfos    map[uint64]sciond.HostInfo
+	svcInfos   map[sciond.ServiceType][]sciond.HostInfo
+	delay      time.Duration
+	errs       []error
+	connectErr error
+	revResult  sciond.RevResult
+	revs       []*path_mgmt.RevInfo
+	pathReqs   int
+}
+
+type iaPair struct {
+	src, dst addr.IAInt
+}
+
+// New returns a service without any paths. Revocations are accepted as valid.
+func New() *Service {
+	return &Service{
+		paths:     make(map[iaPair][]sciond.PathReplyEntry),
+		asInfos:   make(map[addr.IAInt]sciond.ASInfoReplyEntry),
+		ifInfos:   make(map[uint64]sciond.HostInfo),
+		svcInfos:  make(map[sciond.ServiceType][]sciond.HostInfo),
+		revResult: sciond.RevValid,
+	}
+}
+
+// SetPaths sets the paths returned for requests from src to dst, replacing previous ones.
+func (s *Service) SetPaths(src, dst *addr.ISD_AS, entries ...sciond.PathReplyEntry) {
+	s.Lock()
+	defer s.Unlock()
+	s.paths[iaPair{src: src.IAInt(), dst: dst.IAInt()}] = entries
+}
+
+// SetASInfo sets the AS info returned for the ISD-AS of entry.
+func (s *Service) SetASInfo(entry sciond.ASInfoReplyEntry) {
+	s.Lock()
+	defer s.Unlock()
+	s.asInfos[entry.RawIsdas] = entry
+}
+
+// SetIFInfo sets the address of the border router owning interface ifid.
+func (s *Service) SetIFInfo(ifid uint64, info sciond.HostInfo) {
+	s.Lock()
+	defer s.Unlock()
+	s.ifInfos[ifid] = info
+}
+
+// SetSVCInfo sets the addresses of the services of type t.
+func (s *Service) SetSVCInfo(t sciond.ServiceType, infos ...sciond.HostInfo) {
+	s.Lock()
+	defer s.Unlock()
+	s.svcInfos[t] = infos
+}
+
+// SetDelay delays all future queries by d. Queries return a timeout error, if the deadline
+// of the connector is reached first.
+func (s *Service) SetDelay(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.delay = d
+}
+
+// AddErrors queues errs. Each of the next queries returns the next queued error, instead of
+// a reply.
+func (s *Service) AddErrors(errs ...error) {
+	s.Lock()
+	defer s.Unlock()
+	s.errs = append(s.errs, errs...)
+}
+
+// SetConnectError makes future calls to Connect and ConnectTimeout fail with err. A nil err
+// allows connecting again.
+func (s *Service) SetConnectError(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.connectErr = err
+}
+
+// SetRevResult sets the result returned for revocation notifications. Only if it is
+// sciond.RevValid, the paths containing the revoked interface are removed.
+func (s *Service) SetRevResult(r sciond.RevResult) {
+	s.Lock()
+	defer s.Unlock()
+	s.revResult = r
+}
+
+// Revocations returns the revocations the service was notified of, in order.
+func (s *Service) Revocations() []*path_mgmt.RevInfo {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*path_mgmt.RevInfo(nil), s.revs...)
+}
+
+// PathRequests returns the number of path requests the service answered, including failed
+// ones.
+func (s *Service) PathRequests() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.pathReqs
+}
+
+// Revoke removes the paths containing interface ifid of ia, and returns how many were
+// removed.
+func (s *Service) Revoke(ia *addr.ISD_AS, ifid uint64) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.revoke(ia, ifid)
+}
+
+func (s *Service) revoke(ia *addr.ISD_AS, ifid uint64) int {
+	n := 0
+	for k, entries := range s.paths {
+		var kept []sciond.PathReplyEntry
+		for _, e := range entries {
+			if containsIntf(e.Path.Interfaces, ia, ifid) {
+				n++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		s.paths[k] = kept
+	}
+	return n
+}
+
+func containsIntf(ifaces []sciond.PathInterface, ia *addr.ISD_AS, ifid uint64) bool {
+	for _, intf := range ifaces {
+		if intf.RawIsdas == ia.IAInt() && intf.IfID == ifid {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) Connect() (sciond.Connector, error) {
+	return s.ConnectTimeout(0)
+}
+
+// ConnectTimeout returns a new connector. The timeout is ignored.
+func (s *Service) ConnectTimeout(timeout time.Duration) (sciond.Connector, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.connectErr != nil {
+		return nil, s.connectErr
+	}
+	return &connector{srvc: s}, nil
+}
+
+// nextQuery returns the delay and the scripted error of the next query.
+func (s *Service) nextQuery() (time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+	var err error
+	if len(s.errs) > 0 {
+		err, s.errs = s.errs[0], s.errs[1:]
+	}
+	return s.delay, err
+}
+
+var _ sciond.Connector = (*connector)(nil)
+
+type connector struct {
+	sync.Mutex
+	srvc     *Service
+	deadline time.Time
+	closed   bool
+}
+
+// wait blocks for the delay of the service, and returns the scripted error of the query, if
+// any.
+func (c *connector) wait() error {
+	c.Lock()
+	deadline, closed := c.deadline, c.closed
+	c.Unlock()
+	if closed {
+		return common.NewBasicError(ErrorClosed, nil)
+	}
+	delay, err := c.srvc.nextQuery()
+	if !deadline.IsZero() && time.Until(deadline) < delay {
+		time.Sleep(time.Until(deadline))
+		return &net.OpError{Op: "read", Net: "unix", Err: timeoutError{}}
+	}
+	time.Sleep(delay)
+	return err
+}
+
+func (c *connector) Paths(dst, src *addr.ISD_AS, max uint16,
+	f sciond.PathReqFlags) (*sciond.PathReply, error) {
+
+	c.srvc.Lock()
+	c.srvc.pathReqs++
+	c.srvc.Unlock()
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	c.srvc.Lock()
+	defer c.srvc.Unlock()
+	entries := c.srvc.paths[iaPair{src: src.IAInt(), dst: dst.IAInt()}]
+	if len(entries) == 0 {
+		return &sciond.PathReply{ErrorCode: sciond.ErrorNoPaths}, nil
+	}
+	if max > 0 && len(entries) > int(max) {
+		entries = entries[:max]
+	}
+	return &sciond.PathReply{
+		ErrorCode: sciond.ErrorOk,
+		Entries:   append([]sciond.PathReplyEntry(nil), entries...),
+	}, nil
+}
+
+func (c *connector) ASInfo(ia *addr.ISD_AS) (*sciond.ASInfoReply, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	c.srvc.Lock()
+	defer c.srvc.Unlock()
+	reply := &sciond.ASInfoReply{}
+	if entry, ok := c.srvc.asInfos[ia.IAInt()]; ok {
+		reply.Entries = append(reply.Entries, entry)
+	}
+	return reply, nil
+}
+
+func (c *connector) IFInfo(ifs []uint64) (*sciond.IFInfoReply, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	c.srvc.Lock()
+	defer c.srvc.Unlock()
+	reply := &sciond.IFInfoReply{}
+	for ifid, info := range c.srvc.ifInfos {
+		if len(ifs) > 0 && !containsIFID(ifs, ifid) {
+			continue
+		}
+		reply.RawEntries = append(reply.RawEntries,
+			sciond.IFInfoReplyEntry{IfID: ifid, HostInfo: info})
+	}
+	sort.Slice(reply.RawEntries, func(i, j int) bool {
+		return reply.RawEntries[i].IfID < reply.RawEntries[j].IfID
+	})
+	return reply, nil
+}
+
+func containsIFID(ifs []uint64, ifid uint64) bool {
+	for _, other := range ifs {
+		if other == ifid {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *connector) SVCInfo(svcTypes []sciond.ServiceType) (*sciond.ServiceInfoReply, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	c.srvc.Lock()
+	defer c.srvc.Unlock()
+	if len(svcTypes) == 0 {
+		for t := range c.srvc.svcInfos {
+			svcTypes = append(svcTypes, t)
+		}
+		sort.Slice(svcTypes, func(i, j int) bool { return svcTypes[i] < svcTypes[j] })
+	}
+	reply := &sciond.ServiceInfoReply{}
+	for _, t := range svcTypes {
+		reply.Entries = append(reply.Entries, sciond.ServiceInfoReplyEntry{
+			ServiceType: t,
+			Ttl:         uint32(sciond.SVCInfoTTL / time.Second),
+			HostInfos:   append([]sciond.HostInfo(nil), c.srvc.svcInfos[t]...),
+		})
+	}
+	return reply, nil
+}
+
+func (c *connector) RevNotificationFromRaw(revInfo []byte) (*sciond.RevReply, error) {
+	ri, err := path_mgmt.NewRevInfoFromRaw(revInfo)
+	if err != nil {
+		return nil, err
+	}
+	return c.RevNotification(ri)
+}
+
+func (c *connector) RevNotification(revInfo *path_mgmt.RevInfo) (*sciond.RevReply, error) {
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	c.srvc.Lock()
+	defer c.srvc.Unlock()
+	c.srvc.revs = append(c.srvc.revs, revInfo)
+	if c.srvc.revResult == sciond.RevValid {
+		c.srvc.revoke(revInfo.IA(), revInfo.IfID)
+	}
+	return &sciond.RevReply{Result: c.srvc.revResult}, nil
+}
+
+func (c *connector) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *connector) SetDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// timeoutError is returned, wrapped in a *net.OpError, if a query exceeds the deadline of
+// its connector.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// NewPathEntry returns a path entry traversing the interfaces ifaces, which have to be pairs
+// of egress and ingress interfaces, as in replies of SCIOND. The forwarding path consists of a
+// single segment with valid offsets, but without hop field MACs. Packets on the path are sent
+// to the first hop host:port.
+func NewPathEntry(host addr.HostAddr, port uint16,
+	ifaces ...sciond.PathInterface) sciond.PathReplyEntry {
+
+	hops := len(ifaces)/2 + 1
+	raw := make(common.RawBytes, spath.InfoFieldLength+hops*spath.HopFieldLength)
+	info := &spath.InfoField{TsInt: uint32(time.Now().Unix()), Hops: uint8(hops)}
+	if len(ifaces) > 0 {
+		info.ISD = uint16(ifaces[0].ISD_AS().I)
+	}
+	info.Write(raw)
+	for i := 0; i < hops; i++ {
+		var in, out common.IFIDType
+		if i > 0 {
+			in = common.IFIDType(ifaces[2*i-1].IfID)
+		}
+		if i < hops-1 {
+			out = common.IFIDType(ifaces[2*i].IfID)
+		}
+		off := spath.InfoFieldLength + i*spath.HopFieldLength
+		spath.NewHopField(raw[off:off+spath.HopFieldLength], in, out)
+	}
+	return sciond.PathReplyEntry{
+		Path: sciond.FwdPathMeta{
+			FwdPath:    raw,
+			Mtu:        common.MinMTU,
+			Interfaces: append([]sciond.PathInterface(nil), ifaces...),
+		},
+		HostInfo: *sciond.HostInfoFromHostAddr(host, port),
+	}
+}
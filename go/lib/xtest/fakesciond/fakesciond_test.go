@@ -0,0 +1,134 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakesciond
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/overlay"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+var (
+	ia1 = &addr.ISD_AS{I: 1, A: 10}
+	ia2 = &addr.ISD_AS{I: 1, A: 20}
+	ia3 = &addr.ISD_AS{I: 1, A: 30}
+	br  = addr.HostFromIP(net.IPv4(127, 0, 0, 1))
+)
+
+func intf(ia *addr.ISD_AS, ifid uint64) sciond.PathInterface {
+	return sciond.PathInterface{RawIsdas: ia.IAInt(), IfID: ifid}
+}
+
+func TestPaths(t *testing.T) {
+	Convey("Given a service with two paths", t, func() {
+		srvc := New()
+		direct := NewPathEntry(br, overlay.EndhostPort, intf(ia1, 1), intf(ia2, 2))
+		transit := NewPathEntry(br, overlay.EndhostPort, intf(ia1, 3), intf(ia3, 4),
+			intf(ia3, 5), intf(ia2, 6))
+		srvc.SetPaths(ia1, ia2, direct, transit)
+		conn, err := srvc.Connect()
+		SoMsg("connect err", err, ShouldBeNil)
+		Convey("All paths are returned", func() {
+			reply, err := conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("code", reply.ErrorCode, ShouldEqual, sciond.ErrorOk)
+			SoMsg("entries", len(reply.Entries), ShouldEqual, 2)
+			SoMsg("requests", srvc.PathRequests(), ShouldEqual, 1)
+		})
+		Convey("The number of paths is limited by max", func() {
+			reply, err := conn.Paths(ia2, ia1, 1, sciond.PathReqFlags{})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("entries", len(reply.Entries), ShouldEqual, 1)
+		})
+		Convey("No paths are returned in the reverse direction", func() {
+			reply, err := conn.Paths(ia1, ia2, 5, sciond.PathReqFlags{})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("code", reply.ErrorCode, ShouldEqual, sciond.ErrorNoPaths)
+		})
+		Convey("A queued error is returned once", func() {
+			srvc.AddErrors(errors.New("scripted"))
+			_, err := conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			SoMsg("first err", err, ShouldNotBeNil)
+			_, err = conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			SoMsg("second err", err, ShouldBeNil)
+		})
+		Convey("A delay beyond the deadline times out", func() {
+			srvc.SetDelay(time.Second)
+			conn.SetDeadline(time.Now().Add(10 * time.Millisecond))
+			_, err := conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			opErr, ok := err.(*net.OpError)
+			SoMsg("op err", ok, ShouldBeTrue)
+			SoMsg("timeout", opErr.Timeout(), ShouldBeTrue)
+		})
+		Convey("A valid revocation removes the paths with the interface", func() {
+			reply, err := conn.RevNotification(&path_mgmt.RevInfo{IfID: 3, RawIsdas: ia1.IAInt()})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("result", reply.Result, ShouldEqual, sciond.RevValid)
+			SoMsg("revocations", len(srvc.Revocations()), ShouldEqual, 1)
+			paths, err := conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("entries", paths.Entries, ShouldResemble, []sciond.PathReplyEntry{direct})
+		})
+		Convey("An invalid revocation keeps the paths", func() {
+			srvc.SetRevResult(sciond.RevInvalid)
+			reply, err := conn.RevNotification(&path_mgmt.RevInfo{IfID: 3, RawIsdas: ia1.IAInt()})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("result", reply.Result, ShouldEqual, sciond.RevInvalid)
+			paths, err := conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("entries", len(paths.Entries), ShouldEqual, 2)
+		})
+		Convey("A closed connector returns errors", func() {
+			conn.Close()
+			_, err := conn.Paths(ia2, ia1, 5, sciond.PathReqFlags{})
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConnect(t *testing.T) {
+	Convey("Connecting fails with the scripted error", t, func() {
+		srvc := New()
+		srvc.SetConnectError(errors.New("scripted"))
+		_, err := srvc.Connect()
+		SoMsg("err", err, ShouldNotBeNil)
+		srvc.SetConnectError(nil)
+		_, err = srvc.ConnectTimeout(time.Second)
+		SoMsg("err after reset", err, ShouldBeNil)
+	})
+}
+
+func TestNewPathEntry(t *testing.T) {
+	Convey("The forwarding path has one hop field per AS", t, func() {
+		entry := NewPathEntry(br, overlay.EndhostPort, intf(ia1, 3), intf(ia3, 4),
+			intf(ia3, 5), intf(ia2, 6))
+		SoMsg("len", len(entry.Path.FwdPath), ShouldEqual,
+			spath.InfoFieldLength+3*spath.HopFieldLength)
+		path := spath.New(entry.Path.FwdPath)
+		SoMsg("offsets", path.InitOffsets(), ShouldBeNil)
+		SoMsg("reverse", path.Reverse(), ShouldBeNil)
+		SoMsg("next hop", entry.HostInfo.Host().String(), ShouldEqual, br.String())
+		SoMsg("port", entry.HostInfo.Port, ShouldEqual, overlay.EndhostPort)
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"path/filepath"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pathdb"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/topology"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+const (
+	ErrorAddr   = "Unable to load addresses"
+	ErrorPathDB = "Unable to open path database"
+	ErrorStore  = "Unable to load TrustStore"
+	ErrorTopo   = "Unable to load topology"
+
+	// PathDBSuffix is appended to the element ID to form the default path database file name.
+	PathDBSuffix = ".path.db"
+)
+
+type Conf struct {
+	// Topo contains the names of all local infrastructure elements, a map
+	// of interface IDs to routers, and the actual topology.
+	Topo *topology.Topo
+	// BindAddr is the local bind address.
+	BindAddr *snet.Addr
+	// PublicAddr is the public address.
+	PublicAddr *snet.Addr
+	// Store is the trust store, used to verify path segments.
+	Store *trust.Store
+	// PathDB stores registered and cached path segments.
+	PathDB *pathdb.DB
+	// CacheDir is the cache directory.
+	CacheDir string
+	// ConfDir is the configuration directory.
+	ConfDir string
+}
+
+// Load initializes the configuration by loading it from confDir. The path database is opened
+// at pathDBFile, or in cacheDir if pathDBFile is empty.
+func Load(id string, confDir string, cacheDir string, pathDBFile string) (*Conf, error) {
+	var err error
+	conf := &Conf{
+		ConfDir:  confDir,
+		CacheDir: cacheDir,
+	}
+	// load topology
+	path := filepath.Join(confDir, topology.CfgName)
+	if conf.Topo, err = topology.LoadFromFile(path); err != nil {
+		return nil, common.NewBasicError(ErrorTopo, err)
+	}
+	// load public and bind address
+	topoAddr, ok := conf.Topo.PS[id]
+	if !ok {
+		return nil, common.NewBasicError(ErrorAddr, nil, "err", "Element ID not found",
+			"id", id)
+	}
+	publicInfo := topoAddr.PublicAddrInfo(conf.Topo.Overlay)
+	conf.PublicAddr = &snet.Addr{IA: conf.Topo.ISD_AS, Host: addr.HostFromIP(publicInfo.IP),
+		L4Port: uint16(publicInfo.L4Port)}
+	bindInfo := topoAddr.BindAddrInfo(conf.Topo.Overlay)
+	tmpBind := &snet.Addr{IA: conf.Topo.ISD_AS, Host: addr.HostFromIP(bindInfo.IP),
+		L4Port: uint16(bindInfo.L4Port)}
+	if !tmpBind.EqAddr(conf.PublicAddr) {
+		conf.BindAddr = tmpBind
+	}
+	// load trust store
+	conf.Store, err = trust.NewStore(filepath.Join(confDir, "certs"), cacheDir, id)
+	if err != nil {
+		return nil, common.NewBasicError(ErrorStore, err)
+	}
+	// open path database
+	if pathDBFile == "" {
+		pathDBFile = filepath.Join(cacheDir, id+PathDBSuffix)
+	}
+	if conf.PathDB, err = pathdb.New(pathDBFile, "sqlite"); err != nil {
+		conf.Store.Close()
+		return nil, common.NewBasicError(ErrorPathDB, err, "file", pathDBFile)
+	}
+	return conf, nil
+}
+
+// CoreASes returns the core ASes of the local ISD, according to the newest TRC in the trust
+// store.
+func (c *Conf) CoreASes() []*addr.ISD_AS {
+	t := c.Store.GetNewestTRC(uint16(c.Topo.ISD_AS.I))
+	if t == nil {
+		return nil
+	}
+	return t.CoreASList()
+}
+
+// IsLocal returns whether ia is the local AS.
+func (c *Conf) IsLocal(ia *addr.ISD_AS) bool {
+	return c.Topo.ISD_AS.Eq(ia)
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Path server. It stores the path segments registered by the beacon servers
+// in the path database, and answers segment requests from it.
+//
+// A path server in a non-core AS stores the up segments of its AS. Requests
+// for other segments are forwarded to a core path server of the local ISD, and
+// the replies are cached. A core path server stores the down segments of the
+// ASes in its ISD and the core segments of its AS, and forwards requests for
+// segments of other ISDs to a core path server of the destination ISD. Down
+// segments and revocations registered at a core path server are synchronized
+// to the path servers of the other core ASes in the ISD.
+package main
+
+import (
+	"flag"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/infra/disp"
+	"github.com/scionproto/scion/go/lib/infra/messenger"
+	"github.com/scionproto/scion/go/lib/infra/middleware"
+	"github.com/scionproto/scion/go/lib/infra/transport"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/path_srv/conf"
+	"github.com/scionproto/scion/go/path_srv/metrics"
+)
+
+const (
+	initAttempts = 100
+	initInterval = time.Second
+	// reqTimeout bounds the handling of a single message, including the requests sent to
+	// other path servers and the trust objects fetched to verify segments.
+	reqTimeout = 5 * time.Second
+	// reqRate and reqBurst limit the messages handled per second for each peer.
+	reqRate  = 100
+	reqBurst = 200
+	// maxHandlers is the maximum number of concurrently handled messages of each type.
+	maxHandlers = 64
+)
+
+var (
+	id         = flag.String("id", "", "Element ID (Required. E.g. 'ps1-10-1')")
+	sciondPath = flag.String("sciond", "",
+		"SCIOND socket path (Optional if SCIOND_PATH is set)")
+	dispPath = flag.String("dispatcher", "/run/shm/dispatcher/default.sock",
+		"SCION Dispatcher path")
+	confDir  = flag.String("confd", "", "Configuration directory (Required)")
+	cacheDir = flag.String("cached", "gen-cache", "Caching directory")
+	pathDB   = flag.String("pathdb", "", "Path database file (Defaults to cached/<id>.path.db)")
+	prom     = flag.String("prom", "127.0.0.1:1283", "Address to export prometheus metrics on")
+	config   *conf.Conf
+)
+
+// main initializes the path server and serves requests.
+func main() {
+	flag.Parse()
+	if *id == "" {
+		log.Crit("No element ID specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+	liblog.Setup(*id)
+	defer liblog.LogPanicAndExit()
+	setupSignals()
+	var err error
+	if err = checkFlags(); err != nil {
+		fatal(err.Error())
+	}
+	if config, err = conf.Load(*id, *confDir, *cacheDir, *pathDB); err != nil {
+		fatal(err.Error())
+	}
+	metrics.Init(*id)
+	if err = metrics.Start(*prom); err != nil {
+		fatal("Unable to export prometheus metrics", "err", err)
+	}
+	// initialize snet with retries
+	if err = initSNET(initAttempts, initInterval); err != nil {
+		fatal("Unable to create local SCION Network context", "err", err)
+	}
+	conn, err := snet.ListenSCIONWithBindSVC("udp4", config.PublicAddr, config.BindAddr,
+		addr.SvcPS)
+	if err != nil {
+		fatal("Unable to listen on SCION", "err", err)
+	}
+	// Plain UDP is used, since the beacon servers and sciond do not speak RUDP.
+	dispatcher := disp.New(transport.NewUDP(conn), messenger.DefaultAdapter, log.Root())
+	msger := messenger.New(dispatcher, config.Store, log.Root())
+	if err = config.Store.StartResolvers(msger); err != nil {
+		fatal("Unable to start trust store resolvers", "err", err)
+	}
+	msger.Use(
+		middleware.Log(log.Root()),
+		middleware.Metrics(),
+		middleware.Recover(log.Root()),
+		middleware.RateLimit(reqRate, reqBurst),
+		middleware.Timeout(reqTimeout, nil),
+		middleware.ConcurrencyLimit(maxHandlers, nil),
+	)
+	regH := &segRegHandler{}
+	msger.AddHandler(messenger.SegReg, regH)
+	msger.AddHandler(messenger.SegSync, regH)
+	msger.AddHandler(messenger.SegRequest, &segReqHandler{})
+	msger.AddHandler(messenger.RevInfo, &revHandler{})
+	msger.ListenAndServe()
+}
+
+// checkFlags checks that all required flags are set.
+func checkFlags() error {
+	if *sciondPath == "" {
+		*sciondPath = os.Getenv("SCIOND_PATH")
+		if *sciondPath == "" {
+			flag.Usage()
+			return common.NewBasicError("No SCIOND path specified", nil)
+		}
+	}
+	if *confDir == "" {
+		flag.Usage()
+		return common.NewBasicError("No configuration directory specified", nil)
+	}
+	return nil
+}
+
+// initSNET initializes snet. The number of attempts is specified, as well as the sleep duration.
+// This is needed, since supervisord might take some time, until sciond is initialized.
+func initSNET(attempts int, sleep time.Duration) (err error) {
+	// Initialize SCION local networking module
+	for i := 0; i < attempts; i++ {
+		if err = snet.Init(config.PublicAddr.IA, *sciondPath, *dispPath); err == nil {
+			break
+		}
+		log.Error("Unable to initialize snet", "Retry interval", sleep, "err", err)
+		time.Sleep(sleep)
+	}
+	return err
+}
+
+// setupSignals handle signals.
+func setupSignals() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		log.Info("Received signal, exiting...", "signal", s)
+		liblog.Flush()
+		os.Exit(1)
+	}()
+}
+
+func fatal(msg string, args ...interface{}) {
+	log.Crit(msg, args...)
+	liblog.Flush()
+	os.Exit(1)
+}
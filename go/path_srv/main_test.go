@@ -0,0 +1,404 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/ctrl/cert_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/pathdb"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/topology"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/path_srv/conf"
+	"github.com/scionproto/scion/go/path_srv/metrics"
+	"github.com/scionproto/scion/go/proto"
+)
+
+var (
+	fnChain = "../lib/crypto/cert/testdata/ISD1-AS10-V1.crt"
+	fnTRC   = "../lib/crypto/cert/testdata/ISD1-V2.trc"
+
+	// ISD 1 has the core ASes 1-11, 1-12 and 1-13. The non-core AS 1-10 is a customer of 1-13,
+	// and 1-14 a customer of 1-11.
+	ia10 = &addr.ISD_AS{I: 1, A: 10}
+	ia11 = &addr.ISD_AS{I: 1, A: 11}
+	ia12 = &addr.ISD_AS{I: 1, A: 12}
+	ia13 = &addr.ISD_AS{I: 1, A: 13}
+	ia14 = &addr.ISD_AS{I: 1, A: 14}
+	// ISD 2 has the core AS 2-21, with customer 2-22.
+	ia21 = &addr.ISD_AS{I: 2, A: 21}
+	ia22 = &addr.ISD_AS{I: 2, A: 22}
+
+	// testEpoch is the hash tree epoch of the test revocations and hash tree roots.
+	testEpoch uint64
+	prevRoot  = common.RawBytes("previous hash tree root")
+	nextRoot  = common.RawBytes("next hash tree root")
+)
+
+// setupConf sets config to a configuration of the local AS ia, with an empty path database. The
+// trust store contains TRC 1v2 with the core ASes of ISD 1, and the certificate chains of 1-10
+// and 1-13, issued by 1-13. It returns the signing keys of 1-10 and 1-13.
+func setupConf(t *testing.T, ia *addr.ISD_AS) (map[addr.ISD_AS]common.RawBytes, func()) {
+	dir, err := ioutil.TempDir("", "path_srv_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	if err = os.Mkdir(filepath.Join(dir, "certs"), 0755); err != nil {
+		cleanup()
+		t.Fatalf("Unable to create dir: %v", err)
+	}
+	store, err := trust.NewStore(filepath.Join(dir, "certs"), dir, "ps-test")
+	if err != nil {
+		cleanup()
+		t.Fatalf("Unable to create store: %v", err)
+	}
+	db, err := pathdb.New(filepath.Join(dir, "path.db"), "sqlite")
+	if err != nil {
+		store.Close()
+		cleanup()
+		t.Fatalf("Unable to open path database: %v", err)
+	}
+	now := uint64(time.Now().Unix())
+	trcPub, trcPriv := genKeyPair(t)
+	corePub, corePriv := genKeyPair(t)
+	t_ := loadTRC(t)
+	for _, coreIA := range []*addr.ISD_AS{ia11, ia12, ia13} {
+		t_.CoreASes[*coreIA] = &trc.CoreAS{OnlineKey: trcPub, OnlineKeyAlg: crypto.Ed25519,
+			OfflineKey: trcPub, OfflineKeyAlg: crypto.Ed25519}
+	}
+	t_.CreationTime = now - 1<<10
+	t_.ExpirationTime = now + 1<<20
+	t_.GracePeriod = 0
+	store.AddTRC(t_, false)
+	keys := make(map[addr.ISD_AS]common.RawBytes)
+	for _, subject := range []*addr.ISD_AS{ia10, ia13} {
+		chain := loadChain(t)
+		chain.Core.SubjectSignKey = corePub
+		chain.Core.IssuingTime = now
+		chain.Core.ExpirationTime = now + 1<<20
+		chain.Core.Sign(trcPriv, crypto.Ed25519)
+		if subject.Eq(ia13) {
+			chain.Leaf = chain.Core.Copy()
+			chain.Leaf.CanIssue = false
+		}
+		pub, priv := genKeyPair(t)
+		chain.Leaf.Subject = subject.Copy()
+		chain.Leaf.SubjectSignKey = pub
+		chain.Leaf.IssuingTime = now
+		chain.Leaf.ExpirationTime = now + cert.DefaultLeafCertValidity
+		chain.Leaf.Sign(corePriv, crypto.Ed25519)
+		store.AddChain(chain, false)
+		keys[*subject] = priv
+	}
+	config = &conf.Conf{
+		Topo:   &topology.Topo{ISD_AS: ia.Copy(), Core: containsIA(t_.CoreASList(), ia)},
+		Store:  store,
+		PathDB: db,
+	}
+	return keys, func() {
+		store.Close()
+		cleanup()
+	}
+}
+
+func genKeyPair(t *testing.T) (common.RawBytes, common.RawBytes) {
+	pub, priv, err := crypto.GenKeyPair(crypto.Ed25519)
+	if err != nil {
+		t.Fatalf("Unable to generate key pair: %v", err)
+	}
+	return pub, priv
+}
+
+func loadChain(t *testing.T) *cert.Chain {
+	raw, err := ioutil.ReadFile(fnChain)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", fnChain, err)
+	}
+	chain, err := cert.ChainFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading Certificate Chain from '%s': %v", fnChain, err)
+	}
+	return chain
+}
+
+func loadTRC(t *testing.T) *trc.TRC {
+	raw, err := ioutil.ReadFile(fnTRC)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", fnTRC, err)
+	}
+	t_, err := trc.TRCFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading TRC from '%s': %v", fnTRC, err)
+	}
+	return t_
+}
+
+// newSeg returns a path segment through ias, created at ts. The hop entry of each AS has the
+// ingress interface 1, except in the first AS, and the egress interface 2, except in the last
+// AS. The AS entries contain the test hash tree roots, and are signed with the key of the AS
+// in keys, if any.
+func newSeg(t *testing.T, ts time.Time, keys map[addr.ISD_AS]common.RawBytes,
+	ias ...*addr.ISD_AS) *seg.PathSegment {
+
+	info := &spath.InfoField{TsInt: uint32(ts.Unix()), ISD: uint16(ias[0].I),
+		Hops: uint8(len(ias))}
+	pseg, err := seg.NewSeg(info)
+	if err != nil {
+		t.Fatalf("Unable to create segment: %v", err)
+	}
+	for i, ia := range ias {
+		var in, out common.IFIDType
+		inIA, outIA := &addr.ISD_AS{}, &addr.ISD_AS{}
+		if i > 0 {
+			in, inIA = 1, ias[i-1]
+		}
+		if i < len(ias)-1 {
+			out, outIA = 2, ias[i+1]
+		}
+		rawHop := make(common.RawBytes, spath.HopFieldLength)
+		spath.NewHopField(rawHop, in, out)
+		ase := &seg.ASEntry{
+			RawIA:  ia.IAInt(),
+			TrcVer: 2,
+			HopEntries: []*seg.HopEntry{{
+				RawInIA:     inIA.IAInt(),
+				RawOutIA:    outIA.IAInt(),
+				RawHopField: rawHop,
+			}},
+			HashTreeRoot: htRoot(ia),
+		}
+		key, ok := keys[*ia]
+		signType := proto.SignType_none
+		if ok {
+			ase.CertVer = 1
+			signType = proto.SignType_ed25519
+		}
+		if err = pseg.AddASEntry(ase, signType, nil); err != nil {
+			t.Fatalf("Unable to add AS entry: %v", err)
+		}
+		if ok {
+			if err = pseg.SignLastASEntry(key); err != nil {
+				t.Fatalf("Unable to sign AS entry: %v", err)
+			}
+		}
+	}
+	return pseg
+}
+
+// insertSeg adds an unexpired, unsigned segment of type segType through ias to the path
+// database.
+func insertSeg(t *testing.T, segType seg.Type, ias ...*addr.ISD_AS) *seg.PathSegment {
+	pseg := newSeg(t, time.Now(), nil, ias...)
+	if _, err := config.PathDB.Insert(pseg, []seg.Type{segType}); err != nil {
+		t.Fatalf("Unable to insert segment: %v", err)
+	}
+	return pseg
+}
+
+// segIDs returns the sorted types and IDs of the segments in segs, for comparison.
+func segIDs(t *testing.T, segs []*seg.Meta) []string {
+	var ids []string
+	for _, meta := range segs {
+		id, err := meta.Segment.ID()
+		if err != nil {
+			t.Fatalf("Unable to compute segment ID: %v", err)
+		}
+		ids = append(ids, meta.Type.String()+" "+id.String())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// addrStrs returns the sorted string representations of addrs, for comparison.
+func addrStrs(addrs []net.Addr) []string {
+	var strs []string
+	for _, a := range addrs {
+		strs = append(strs, a.String())
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+// metas returns the expected result segments, for comparison with segIDs.
+func metas(segType seg.Type, psegs ...*seg.PathSegment) []*seg.Meta {
+	var res []*seg.Meta
+	for _, pseg := range psegs {
+		res = append(res, &seg.Meta{Type: segType, Segment: *pseg})
+	}
+	return res
+}
+
+// The test hash tree of an AS has one leaf for each of the interfaces 1 and 2 in testEpoch.
+// Its connected root is computed with prevRoot.
+
+func htHash(a, b common.RawBytes) common.RawBytes {
+	h := sha256.Sum256(append(append(common.RawBytes(nil), a...), b...))
+	return h[:]
+}
+
+func htNonce(ia *addr.ISD_AS, ifID uint64) common.RawBytes {
+	return htHash(common.RawBytes(ia.String()), []byte{byte(ifID)})
+}
+
+func htLeaf(ia *addr.ISD_AS, ifID uint64) common.RawBytes {
+	b := make(common.RawBytes, 16)
+	common.Order.PutUint64(b[:8], ifID)
+	common.Order.PutUint64(b[8:], testEpoch%uint64(crypto.HashTreeTTL/crypto.HashTreeEpochTime))
+	return htHash(b, htNonce(ia, ifID))
+}
+
+func htRoot(ia *addr.ISD_AS) common.RawBytes {
+	return htHash(prevRoot, htHash(htLeaf(ia, 1), htLeaf(ia, 2)))
+}
+
+// newRev returns a valid revocation of interface ifID (1 or 2) of ia in testEpoch.
+func newRev(ia *addr.ISD_AS, ifID uint64) *path_mgmt.RevInfo {
+	sibling := path_mgmt.SiblingHash{IsLeft: true, Hash: htLeaf(ia, 1)}
+	if ifID == 1 {
+		sibling = path_mgmt.SiblingHash{IsLeft: false, Hash: htLeaf(ia, 2)}
+	}
+	return &path_mgmt.RevInfo{
+		IfID:     ifID,
+		Epoch:    testEpoch,
+		Nonce:    htNonce(ia, ifID),
+		Siblings: []path_mgmt.SiblingHash{sibling},
+		PrevRoot: prevRoot,
+		NextRoot: nextRoot,
+		RawIsdas: ia.IAInt(),
+		HashType: path_mgmt.HashTypeSHA256,
+		TreeTTL:  uint32(crypto.HashTreeTTL.Seconds()),
+	}
+}
+
+var _ infra.Messenger = (*mockMessenger)(nil)
+
+// mockMessenger records the destinations of the messages sent by the path server. Segment
+// requests are answered with reply.
+type mockMessenger struct {
+	reply *path_mgmt.SegReply
+	reqs  []net.Addr
+	revs  []net.Addr
+	syncs []net.Addr
+}
+
+func (m *mockMessenger) GetTRC(context.Context, *cert_mgmt.TRCReq, net.Addr,
+	uint64) (*cert_mgmt.TRC, error) {
+
+	return nil, common.NewBasicError("Not implemented", nil)
+}
+
+func (m *mockMessenger) SendTRC(context.Context, *cert_mgmt.TRC, net.Addr, uint64) error {
+	return nil
+}
+
+func (m *mockMessenger) GetCertChain(context.Context, *cert_mgmt.ChainReq, net.Addr,
+	uint64) (*cert_mgmt.Chain, error) {
+
+	return nil, common.NewBasicError("Not implemented", nil)
+}
+
+func (m *mockMessenger) SendCertChain(context.Context, *cert_mgmt.Chain, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) GetPaths(_ context.Context, _ *path_mgmt.SegReq, a net.Addr,
+	_ uint64) (*path_mgmt.SegReply, error) {
+
+	m.reqs = append(m.reqs, a)
+	if m.reply == nil {
+		return &path_mgmt.SegReply{}, nil
+	}
+	return m.reply, nil
+}
+
+func (m *mockMessenger) SendSegReply(context.Context, *path_mgmt.SegReply, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) SendSegReg(context.Context, *path_mgmt.SegReg, net.Addr, uint64) error {
+	return nil
+}
+
+func (m *mockMessenger) SendSegSync(_ context.Context, _ *path_mgmt.SegSync, a net.Addr,
+	_ uint64) error {
+
+	m.syncs = append(m.syncs, a)
+	return nil
+}
+
+func (m *mockMessenger) SendRev(_ context.Context, _ *path_mgmt.RevInfo, a net.Addr,
+	_ uint64) error {
+
+	m.revs = append(m.revs, a)
+	return nil
+}
+
+func (m *mockMessenger) SendIfStateReq(context.Context, *path_mgmt.IFStateReq, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) SendIfStateInfos(context.Context, *path_mgmt.IFStateInfos, net.Addr,
+	uint64) error {
+
+	return nil
+}
+
+func (m *mockMessenger) AddHandler(string, infra.Handler) {}
+
+func (m *mockMessenger) ListenAndServe() {}
+
+func (m *mockMessenger) CloseServer() error {
+	return nil
+}
+
+// newRequest returns a request for msg from peer, handled with m.
+func newRequest(m *mockMessenger, msg proto.Cerealizable, peer net.Addr) *infra.Request {
+	ctx := context.WithValue(context.Background(), infra.MessengerContextKey, m)
+	return infra.NewRequest(ctx, msg, nil, peer, 0)
+}
+
+func TestMain(m *testing.M) {
+	l := log.Root()
+	l.SetHandler(log.DiscardHandler())
+	metrics.Init("test")
+	testEpoch = crypto.GetCurrentHashTreeEpoch()
+	os.Exit(m.Run())
+}
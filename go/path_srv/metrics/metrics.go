@@ -0,0 +1,91 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics defines and exports path server metrics to be scraped
+// by prometheus.
+package metrics
+
+import (
+	"net"
+	"net/http"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/infra/middleware"
+	"github.com/scionproto/scion/go/lib/prom"
+)
+
+// Declare prometheus metrics to export.
+var (
+	// SegsRegistered counts the path segments added to the path database, by
+	// segment type, and SegsRejected the rejected segments, by reason.
+	SegsRegistered *prometheus.CounterVec
+	SegsRejected   *prometheus.CounterVec
+	// SegReqs counts the answered segment requests, by whether they were
+	// forwarded to a core path server. SegReqErrors counts the requests that
+	// could not be answered.
+	SegReqs      *prometheus.CounterVec
+	SegReqErrors prometheus.Counter
+	// RevsProcessed counts the accepted revocations, and SegsRevoked the path
+	// segments removed because of them.
+	RevsProcessed prometheus.Counter
+	SegsRevoked   prometheus.Counter
+)
+
+// Ensure all metrics are registered.
+func Init(elem string) {
+	namespace := "ps"
+	constLabels := prometheus.Labels{"elem": elem}
+
+	newC := func(name, help string) prometheus.Counter {
+		c := prom.NewCounter(namespace, "", name, help, constLabels)
+		prometheus.MustRegister(c)
+		return c
+	}
+	newCVec := func(name, help string, lNames []string) *prometheus.CounterVec {
+		v := prom.NewCounterVec(namespace, "", name, help, constLabels, lNames)
+		prometheus.MustRegister(v)
+		return v
+	}
+	SegsRegistered = newCVec("segs_registered_total",
+		"Number of path segments registered.", []string{"type"})
+	SegsRejected = newCVec("segs_rejected_total",
+		"Number of path segments rejected.", []string{"reason"})
+	SegReqs = newCVec("seg_reqs_total", "Number of segment requests answered.",
+		[]string{"forwarded"})
+	SegReqErrors = newC("seg_req_errors_total",
+		"Number of segment requests that could not be answered.")
+	RevsProcessed = newC("revs_processed_total", "Number of revocations processed.")
+	SegsRevoked = newC("segs_revoked_total",
+		"Number of path segments removed because of revocations.")
+	middleware.InitMetrics(namespace, constLabels)
+}
+
+func init() {
+	http.Handle("/metrics", promhttp.Handler())
+}
+
+// Start exposes the prometheus metrics on addr.
+func Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return common.NewBasicError("Unable to bind prometheus metrics port", err)
+	}
+	log.Info("Exporting prometheus metrics", "addr", addr)
+	go http.Serve(ln, nil)
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/path_srv/metrics"
+)
+
+// revHandler handles revocations sent by border routers, beacon servers and other path
+// servers.
+type revHandler struct{}
+
+func (h *revHandler) Handle(r *infra.Request) {
+	rev, ok := r.Message.(*path_mgmt.RevInfo)
+	m, mOk := r.Context().Value(infra.MessengerContextKey).(infra.Messenger)
+	if !ok || !mOk {
+		log.Error("Unable to handle revocation", "msg", r.Message)
+		return
+	}
+	ctx, cancelF := context.WithTimeout(r.Context(), reqTimeout)
+	defer cancelF()
+	// Only revocations from within the local AS are forwarded, other core path servers
+	// already got them from their own AS.
+	peer, ok := r.Peer.(*snet.Addr)
+	processRev(ctx, m, rev, ok && config.IsLocal(peer.IA))
+}
+
+// processRev removes all path segments containing the revoked interface from the path
+// database. If forward is set and the local AS is a core AS, the revocation is forwarded to
+// the path servers of the other core ASes of the ISD.
+//
+// The hash tree proof of the revocation is verified against the hash tree roots in the AS
+// entries of the stored path segments containing the interface. Revocations that cannot be
+// verified, including those for interfaces not contained in any stored segment, are dropped and
+// not forwarded.
+func processRev(ctx context.Context, m infra.Messenger, rev *path_mgmt.RevInfo, forward bool) {
+	if !crypto.VerifyHashTreeEpoch(rev.Epoch) {
+		log.Debug("Ignoring revocation with expired epoch", "rev", rev)
+		return
+	}
+	if err := config.PathDB.VerifyRev(rev); err != nil {
+		log.Warn("Dropping unverifiable revocation", "rev", rev, "err", err)
+		return
+	}
+	n, err := config.PathDB.DeleteWithIntf(query.IntfSpec{IA: rev.IA(), IfID: rev.IfID})
+	if err != nil {
+		log.Error("Unable to remove revoked path segments", "rev", rev, "err", err)
+		return
+	}
+	log.Debug("Processed revocation", "rev", rev, "removed", n)
+	metrics.RevsProcessed.Inc()
+	metrics.SegsRevoked.Add(float64(n))
+	if !forward || !config.Topo.Core || !config.IsLocal(rev.IA()) {
+		return
+	}
+	for _, a := range otherCorePSes() {
+		if err := m.SendRev(ctx, rev, a, 0); err != nil {
+			log.Error("Unable to forward revocation", "addr", a, "err", err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func TestProcessRev(t *testing.T) {
+	Convey("Given a path server in core AS 1-13 with cached segments", t, func() {
+		_, cleanup := setupConf(t, ia13)
+		defer cleanup()
+		m := &mockMessenger{}
+		ctx := context.Background()
+		core := metas(seg.CoreSegment, insertSeg(t, seg.CoreSegment, ia11, ia13))
+		down := metas(seg.DownSegment, insertSeg(t, seg.DownSegment, ia13, ia10))
+		otherCores := addrStrs([]net.Addr{psAddr(ia11), psAddr(ia12)})
+		tests := []struct {
+			desc      string
+			rev       func() *path_mgmt.RevInfo
+			forward   bool
+			revoked   bool
+			forwarded bool
+		}{
+			{"Local revocations are forwarded",
+				func() *path_mgmt.RevInfo { return newRev(ia13, 1) }, true, true, true},
+			{"Revocations are only forwarded if requested",
+				func() *path_mgmt.RevInfo { return newRev(ia13, 1) }, false, true, false},
+			{"Remote revocations are not forwarded",
+				func() *path_mgmt.RevInfo { return newRev(ia11, 2) }, true, true, false},
+			{"Revocations with expired epoch are dropped",
+				func() *path_mgmt.RevInfo {
+					rev := newRev(ia13, 1)
+					rev.Epoch -= 2
+					return rev
+				}, true, false, false},
+			{"Revocations with invalid proof are dropped",
+				func() *path_mgmt.RevInfo {
+					rev := newRev(ia13, 1)
+					rev.Nonce = htNonce(ia13, 2)
+					return rev
+				}, true, false, false},
+			{"Revocations with proofs of another AS are dropped",
+				func() *path_mgmt.RevInfo {
+					rev := newRev(ia11, 1)
+					rev.RawIsdas = ia13.IAInt()
+					return rev
+				}, true, false, false},
+			{"Revocations with unknown hash type are dropped",
+				func() *path_mgmt.RevInfo {
+					rev := newRev(ia13, 1)
+					rev.HashType = 1
+					return rev
+				}, true, false, false},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				processRev(ctx, m, test.rev(), test.forward)
+				expected := core
+				if test.revoked {
+					expected = nil
+				}
+				SoMsg("core", segIDs(t, storedSegs(t, seg.CoreSegment)), ShouldResemble,
+					segIDs(t, expected))
+				SoMsg("down", segIDs(t, storedSegs(t, seg.DownSegment)), ShouldResemble,
+					segIDs(t, down))
+				if test.forwarded {
+					SoMsg("revs", addrStrs(m.revs), ShouldResemble, otherCores)
+				} else {
+					SoMsg("revs", m.revs, ShouldBeEmpty)
+				}
+			})
+		}
+		Convey("Revocations of interfaces not in any segment are dropped", func() {
+			rev := newRev(ia13, 1)
+			rev.IfID = 5
+			processRev(ctx, m, rev, true)
+			SoMsg("core", segIDs(t, storedSegs(t, seg.CoreSegment)), ShouldResemble,
+				segIDs(t, core))
+			SoMsg("revs", m.revs, ShouldBeEmpty)
+		})
+		Convey("Revocations sent from the local AS are forwarded", func() {
+			peer := &snet.Addr{IA: ia13, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))}
+			(&revHandler{}).Handle(newRequest(m, newRev(ia13, 1), peer))
+			SoMsg("core", storedSegs(t, seg.CoreSegment), ShouldBeEmpty)
+			SoMsg("revs", addrStrs(m.revs), ShouldResemble, otherCores)
+		})
+	})
+}
+
+func TestVerifyRev(t *testing.T) {
+	Convey("Given a path database with a segment through 1-13", t, func() {
+		_, cleanup := setupConf(t, ia13)
+		defer cleanup()
+		insertSeg(t, seg.CoreSegment, ia11, ia13)
+		Convey("A valid revocation is verified", func() {
+			SoMsg("err", config.PathDB.VerifyRev(newRev(ia13, 1)), ShouldBeNil)
+		})
+		Convey("A revocation of an unknown interface cannot be verified", func() {
+			rev := newRev(ia13, 2)
+			err := config.PathDB.VerifyRev(rev)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, pathdb.ErrNoHashTreeRoot)
+		})
+		Convey("A revocation with a wrong sibling is invalid", func() {
+			rev := newRev(ia13, 1)
+			rev.Siblings[0].Hash = htLeaf(ia13, 1)
+			err := config.PathDB.VerifyRev(rev)
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, path_mgmt.ErrInvalidProof)
+		})
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/path_srv/metrics"
+)
+
+// segRegHandler handles segment registrations from the local beacon server, and segment
+// synchronizations from the path servers of the other core ASes of the ISD.
+type segRegHandler struct{}
+
+func (h *segRegHandler) Handle(r *infra.Request) {
+	m, ok := r.Context().Value(infra.MessengerContextKey).(infra.Messenger)
+	if !ok {
+		log.Error("Unable to handle segment registration, no messenger", "msg", r.Message)
+		return
+	}
+	var recs *path_mgmt.SegRecs
+	sync := false
+	switch msg := r.Message.(type) {
+	case *path_mgmt.SegReg:
+		recs = msg.SegRecs
+	case *path_mgmt.SegSync:
+		recs, sync = msg.SegRecs, true
+	default:
+		log.Error("Unable to handle segment registration, wrong type", "msg", r.Message)
+		return
+	}
+	if recs == nil {
+		return
+	}
+	ctx, cancelF := context.WithTimeout(r.Context(), reqTimeout)
+	defer cancelF()
+	log.Debug("Received segment registration", "peer", r.Peer, "sync", sync,
+		"segs", len(recs.Recs), "revs", len(recs.RevInfos))
+	var downSegs []*seg.Meta
+	for _, meta := range recs.Recs {
+		if !addSeg(ctx, meta, r.Peer) {
+			continue
+		}
+		if meta.Type == seg.DownSegment {
+			downSegs = append(downSegs, meta)
+		}
+	}
+	for _, rev := range recs.RevInfos {
+		processRev(ctx, m, rev, !sync)
+	}
+	// Down segments registered by the local beacon server are synchronized to the other core
+	// path servers, so that each of them can answer requests for all down segments of the ISD.
+	if !sync && len(downSegs) > 0 && config.Topo.Core {
+		msg := &path_mgmt.SegSync{SegRecs: &path_mgmt.SegRecs{Recs: downSegs}}
+		for _, a := range otherCorePSes() {
+			if err := m.SendSegSync(ctx, msg, a, 0); err != nil {
+				log.Error("Unable to send segment synchronization", "addr", a, "err", err)
+			}
+		}
+	}
+}
+
+// addSeg parses, verifies and inserts the segment in m into the path database. It returns
+// whether the segment was accepted.
+func addSeg(ctx context.Context, m *seg.Meta, hint net.Addr) bool {
+	pseg := &m.Segment
+	if err := pseg.ParseRaw(); err != nil {
+		log.Warn("Dropping invalid path segment", "err", err)
+		metrics.SegsRejected.WithLabelValues("invalid").Inc()
+		return false
+	}
+	if !unexpired(pseg, time.Now()) {
+		log.Debug("Dropping expired path segment", "seg", pseg)
+		metrics.SegsRejected.WithLabelValues("expired").Inc()
+		return false
+	}
+	if err := config.Store.VerifySegment(ctx, pseg, hint); err != nil {
+		log.Warn("Dropping unverifiable path segment", "seg", pseg, "err", err)
+		metrics.SegsRejected.WithLabelValues("unverified").Inc()
+		return false
+	}
+	if _, err := config.PathDB.Insert(pseg, []seg.Type{m.Type}); err != nil {
+		log.Error("Unable to insert path segment", "seg", pseg, "err", err)
+		metrics.SegsRejected.WithLabelValues("db").Inc()
+		return false
+	}
+	metrics.SegsRegistered.WithLabelValues(m.Type.String()).Inc()
+	return true
+}
+
+// unexpired returns whether pseg is still valid at now.
+func unexpired(pseg *seg.PathSegment, now time.Time) bool {
+	exp, err := pseg.Expiry()
+	return err == nil && now.Before(exp)
+}
+
+// otherCorePSes returns the path service addresses of all core ASes of the local ISD, except
+// the local AS.
+func otherCorePSes() []net.Addr {
+	var addrs []net.Addr
+	for _, ia := range config.CoreASes() {
+		if !config.IsLocal(ia) {
+			addrs = append(addrs, &snet.Addr{IA: ia, Host: addr.SvcPS})
+		}
+	}
+	return addrs
+}
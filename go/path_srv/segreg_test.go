@@ -0,0 +1,91 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// storedSegs returns the unexpired segments of type segType in the path database.
+func storedSegs(t *testing.T, segType seg.Type) []*seg.Meta {
+	segs, err := getSegs(segType, nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to get segments: %v", err)
+	}
+	return segs
+}
+
+func TestSegRegHandler(t *testing.T) {
+	Convey("Given a path server in core AS 1-13", t, func() {
+		keys, cleanup := setupConf(t, ia13)
+		defer cleanup()
+		m := &mockMessenger{}
+		h := &segRegHandler{}
+		local := &snet.Addr{IA: ia13, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))}
+		remote := &snet.Addr{IA: ia11, Host: addr.HostFromIP(net.IPv4(127, 0, 0, 1))}
+		down := newSeg(t, time.Now(), keys, ia13, ia10)
+		recs := &path_mgmt.SegRecs{Recs: metas(seg.DownSegment, down)}
+		otherCores := addrStrs([]net.Addr{psAddr(ia11), psAddr(ia12)})
+		Convey("Registered down segments are stored and synchronized", func() {
+			h.Handle(newRequest(m, &path_mgmt.SegReg{SegRecs: recs}, local))
+			SoMsg("stored", segIDs(t, storedSegs(t, seg.DownSegment)), ShouldResemble,
+				segIDs(t, recs.Recs))
+			SoMsg("syncs", addrStrs(m.syncs), ShouldResemble, otherCores)
+		})
+		Convey("Synchronized down segments are stored, but not synchronized again", func() {
+			h.Handle(newRequest(m, &path_mgmt.SegSync{SegRecs: recs}, remote))
+			SoMsg("stored", segIDs(t, storedSegs(t, seg.DownSegment)), ShouldResemble,
+				segIDs(t, recs.Recs))
+			SoMsg("syncs", m.syncs, ShouldBeEmpty)
+		})
+		Convey("Expired segments are dropped", func() {
+			expired := newSeg(t, time.Now().Add(-24*time.Hour), keys, ia13, ia10)
+			recs.Recs = metas(seg.DownSegment, expired)
+			h.Handle(newRequest(m, &path_mgmt.SegReg{SegRecs: recs}, local))
+			SoMsg("stored", storedSegs(t, seg.DownSegment), ShouldBeEmpty)
+			SoMsg("syncs", m.syncs, ShouldBeEmpty)
+		})
+		Convey("Segments with invalid signatures are dropped", func() {
+			keys[*ia10] = keys[*ia13]
+			recs.Recs = metas(seg.DownSegment, newSeg(t, time.Now(), keys, ia13, ia10))
+			h.Handle(newRequest(m, &path_mgmt.SegReg{SegRecs: recs}, local))
+			SoMsg("stored", storedSegs(t, seg.DownSegment), ShouldBeEmpty)
+			SoMsg("syncs", m.syncs, ShouldBeEmpty)
+		})
+		Convey("Revocations are processed, and forwarded unless synchronized", func() {
+			insertSeg(t, seg.CoreSegment, ia11, ia13)
+			revRecs := &path_mgmt.SegRecs{RevInfos: []*path_mgmt.RevInfo{newRev(ia13, 1)}}
+			Convey("Registration", func() {
+				h.Handle(newRequest(m, &path_mgmt.SegReg{SegRecs: revRecs}, local))
+				SoMsg("stored", storedSegs(t, seg.CoreSegment), ShouldBeEmpty)
+				SoMsg("revs", addrStrs(m.revs), ShouldResemble, otherCores)
+			})
+			Convey("Synchronization", func() {
+				h.Handle(newRequest(m, &path_mgmt.SegSync{SegRecs: revRecs}, remote))
+				SoMsg("stored", storedSegs(t, seg.CoreSegment), ShouldBeEmpty)
+				SoMsg("revs", m.revs, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/path_srv/metrics"
+)
+
+const (
+	ErrorNoCorePS = "No core path server to forward request to"
+)
+
+// segReqHandler answers segment requests from the path database. Segments that are not in
+// the path database are requested from a core path server, unless the request is cache-only.
+type segReqHandler struct{}
+
+func (h *segReqHandler) Handle(r *infra.Request) {
+	req, ok := r.Message.(*path_mgmt.SegReq)
+	m, mOk := r.Context().Value(infra.MessengerContextKey).(infra.Messenger)
+	if !ok || !mOk {
+		log.Error("Unable to handle segment request", "msg", r.Message)
+		return
+	}
+	log.Debug("Received segment request", "req", req, "peer", r.Peer)
+	ctx, cancelF := context.WithTimeout(r.Context(), reqTimeout)
+	defer cancelF()
+	var segs []*seg.Meta
+	var forwarded bool
+	var err error
+	if config.Topo.Core {
+		segs, forwarded, err = coreSegs(ctx, m, req)
+	} else {
+		segs, forwarded, err = nonCoreSegs(ctx, m, req)
+	}
+	if err != nil {
+		log.Error("Unable to answer segment request", "req", req, "err", err)
+		metrics.SegReqErrors.Inc()
+		return
+	}
+	reply := &path_mgmt.SegReply{Req: req, Recs: &path_mgmt.SegRecs{Recs: segs}}
+	if err = m.SendSegReply(ctx, reply, r.Peer, r.ID); err != nil {
+		log.Error("Unable to send segment reply", "peer", r.Peer, "err", err)
+		metrics.SegReqErrors.Inc()
+		return
+	}
+	metrics.SegReqs.WithLabelValues(strconv.FormatBool(forwarded)).Inc()
+}
+
+// nonCoreSegs returns the up segments of the local AS, together with the core and down
+// segments to reach the destination. Core and down segments are cached from previous replies
+// of the core path servers. If none are cached, they are requested from the core path server
+// at the start of an up segment.
+func nonCoreSegs(ctx context.Context, m infra.Messenger,
+	req *path_mgmt.SegReq) ([]*seg.Meta, bool, error) {
+
+	ups, err := getSegs(seg.UpSegment, nil, []*addr.ISD_AS{config.Topo.ISD_AS})
+	if err != nil {
+		return nil, false, err
+	}
+	dst := req.DstIA()
+	if dst.I == config.Topo.ISD_AS.I && isCore(dst) {
+		if hasStart(ups, dst) {
+			// dst is reachable with an up segment alone.
+			return ups, false, nil
+		}
+		cores, err := coreSegsBetween([]*addr.ISD_AS{dst}, startIAs(ups))
+		if err != nil {
+			return nil, false, err
+		}
+		if len(cores) > 0 || req.Flags.CacheOnly {
+			return append(ups, cores...), false, nil
+		}
+	} else {
+		downs, err := getSegs(seg.DownSegment, nil, []*addr.ISD_AS{dst})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(downs) > 0 || req.Flags.CacheOnly {
+			cores, err := coreSegsBetween(startIAs(downs), startIAs(ups))
+			if err != nil {
+				return nil, false, err
+			}
+			return append(append(ups, cores...), downs...), false, nil
+		}
+	}
+	if len(ups) == 0 {
+		return nil, false, common.NewBasicError(ErrorNoCorePS, nil, "reason", "no up segments")
+	}
+	ps := &snet.Addr{IA: ups[0].Segment.ASEntries[0].IA(), Host: addr.SvcPS}
+	fetched, err := fetchSegs(ctx, m, dst, ps)
+	if err != nil {
+		return nil, true, err
+	}
+	return append(ups, fetched...), true, nil
+}
+
+// coreSegs returns the down segments to reach the destination, together with the core
+// segments from the start of the down segments to the local AS. Requests for destinations in
+// other ISDs are forwarded to a core path server of the destination ISD, unless they are
+// cache-only.
+func coreSegs(ctx context.Context, m infra.Messenger,
+	req *path_mgmt.SegReq) ([]*seg.Meta, bool, error) {
+
+	local := []*addr.ISD_AS{config.Topo.ISD_AS}
+	dst := req.DstIA()
+	if dst.I == config.Topo.ISD_AS.I {
+		if isCore(dst) {
+			segs, err := getSegs(seg.CoreSegment, []*addr.ISD_AS{dst}, local)
+			return segs, false, err
+		}
+		downs, err := getSegs(seg.DownSegment, nil, []*addr.ISD_AS{dst})
+		if err != nil {
+			return nil, false, err
+		}
+		cores, err := coreSegsBetween(startIAs(downs), local)
+		if err != nil {
+			return nil, false, err
+		}
+		return append(cores, downs...), false, nil
+	}
+	// The core segments to the destination ISD are registered by the local beacon server.
+	cores, err := getSegs(seg.CoreSegment, nil, local)
+	if err != nil {
+		return nil, false, err
+	}
+	var remoteCores []*seg.Meta
+	for _, meta := range cores {
+		if meta.Segment.ASEntries[0].IA().I == dst.I {
+			remoteCores = append(remoteCores, meta)
+		}
+	}
+	if hasStart(remoteCores, dst) {
+		return filterStartingAt(remoteCores, []*addr.ISD_AS{dst}), false, nil
+	}
+	downs, err := getSegs(seg.DownSegment, nil, []*addr.ISD_AS{dst})
+	if err != nil {
+		return nil, false, err
+	}
+	forwarded := false
+	if len(downs) == 0 && !req.Flags.CacheOnly {
+		if len(remoteCores) == 0 {
+			return nil, false, common.NewBasicError(ErrorNoCorePS, nil, "isd", dst.I)
+		}
+		ps := &snet.Addr{IA: remoteCores[0].Segment.ASEntries[0].IA(), Host: addr.SvcPS}
+		if downs, err = fetchSegs(ctx, m, dst, ps); err != nil {
+			return nil, true, err
+		}
+		forwarded = true
+	}
+	return append(filterStartingAt(remoteCores, startIAs(downs)), downs...), forwarded, nil
+}
+
+// fetchSegs requests the segments to dst from the path server at ps. The segments in the
+// reply are verified and added to the path database. All accepted segments are returned.
+func fetchSegs(ctx context.Context, m infra.Messenger, dst *addr.ISD_AS,
+	ps net.Addr) ([]*seg.Meta, error) {
+
+	req := &path_mgmt.SegReq{
+		RawSrcIA: config.Topo.ISD_AS.IAInt(),
+		RawDstIA: dst.IAInt(),
+	}
+	log.Debug("Forwarding segment request", "req", req, "addr", ps)
+	reply, err := m.GetPaths(ctx, req, ps, 0)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Recs == nil {
+		return nil, nil
+	}
+	var segs []*seg.Meta
+	for _, meta := range reply.Recs.Recs {
+		if addSeg(ctx, meta, ps) {
+			segs = append(segs, meta)
+		}
+	}
+	for _, rev := range reply.Recs.RevInfos {
+		processRev(ctx, m, rev, false)
+	}
+	return segs, nil
+}
+
+// getSegs returns the unexpired segments of type t in the path database, which start at one
+// of startsAt and end at one of endsAt. Empty lists match all ASes.
+func getSegs(t seg.Type, startsAt, endsAt []*addr.ISD_AS) ([]*seg.Meta, error) {
+	res, err := config.PathDB.Get(&query.Params{
+		SegTypes: []seg.Type{t},
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var segs []*seg.Meta
+	for _, r := range res {
+		if !unexpired(r.Seg, now) {
+			continue
+		}
+		segs = append(segs, &seg.Meta{Type: t, Segment: *r.Seg})
+	}
+	return segs, nil
+}
+
+// coreSegsBetween returns the unexpired core segments, which start at one of startsAt and end
+// at one of endsAt. Unlike getSegs, empty lists match no AS.
+func coreSegsBetween(startsAt, endsAt []*addr.ISD_AS) ([]*seg.Meta, error) {
+	if len(startsAt) == 0 || len(endsAt) == 0 {
+		return nil, nil
+	}
+	return getSegs(seg.CoreSegment, startsAt, endsAt)
+}
+
+// startIAs returns the distinct first ASes of segs.
+func startIAs(segs []*seg.Meta) []*addr.ISD_AS {
+	var ias []*addr.ISD_AS
+	for _, meta := range segs {
+		ia := meta.Segment.ASEntries[0].IA()
+		if !containsIA(ias, ia) {
+			ias = append(ias, ia)
+		}
+	}
+	return ias
+}
+
+// filterStartingAt returns the segments in segs, which start at one of ias.
+func filterStartingAt(segs []*seg.Meta, ias []*addr.ISD_AS) []*seg.Meta {
+	var res []*seg.Meta
+	for _, meta := range segs {
+		if containsIA(ias, meta.Segment.ASEntries[0].IA()) {
+			res = append(res, meta)
+		}
+	}
+	return res
+}
+
+func hasStart(segs []*seg.Meta, ia *addr.ISD_AS) bool {
+	return containsIA(startIAs(segs), ia)
+}
+
+func containsIA(ias []*addr.ISD_AS, ia *addr.ISD_AS) bool {
+	for _, other := range ias {
+		if other.Eq(ia) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCore returns whether ia is a core AS of the local ISD.
+func isCore(ia *addr.ISD_AS) bool {
+	return containsIA(config.CoreASes(), ia)
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func newSegReq(dst *addr.ISD_AS, cacheOnly bool) *path_mgmt.SegReq {
+	req := &path_mgmt.SegReq{RawSrcIA: config.Topo.ISD_AS.IAInt(), RawDstIA: dst.IAInt()}
+	req.Flags.CacheOnly = cacheOnly
+	return req
+}
+
+func psAddr(ia *addr.ISD_AS) net.Addr {
+	return &snet.Addr{IA: ia, Host: addr.SvcPS}
+}
+
+func TestNonCoreSegs(t *testing.T) {
+	Convey("Given a path server in non-core AS 1-10", t, func() {
+		_, cleanup := setupConf(t, ia10)
+		defer cleanup()
+		m := &mockMessenger{}
+		ctx := context.Background()
+		Convey("Without up segments, requests cannot be forwarded", func() {
+			_, _, err := nonCoreSegs(ctx, m, newSegReq(ia14, false))
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorNoCorePS)
+			SoMsg("reqs", m.reqs, ShouldBeEmpty)
+		})
+		Convey("With cached segments", func() {
+			up := insertSeg(t, seg.UpSegment, ia13, ia10)
+			core := insertSeg(t, seg.CoreSegment, ia11, ia13)
+			down := insertSeg(t, seg.DownSegment, ia11, ia14)
+			ups := metas(seg.UpSegment, up)
+			cores := metas(seg.CoreSegment, core)
+			downs := metas(seg.DownSegment, down)
+			tests := []struct {
+				desc      string
+				dst       *addr.ISD_AS
+				cacheOnly bool
+				expected  []*seg.Meta
+				reqs      []net.Addr
+			}{
+				{"An up segment reaches its core AS", ia13, false, ups, nil},
+				{"Other core ASes are reached with core segments", ia11, false,
+					append(ups, cores...), nil},
+				{"Non-core ASes are reached with core and down segments", ia14, false,
+					append(append(ups, cores...), downs...), nil},
+				{"Missing segments are requested from the core AS of an up segment", ia12,
+					false, ups, []net.Addr{psAddr(ia13)}},
+				{"Missing segments are not requested for cache-only requests", ia12, true,
+					ups, nil},
+			}
+			for _, test := range tests {
+				Convey(test.desc, func() {
+					segs, forwarded, err := nonCoreSegs(ctx, m, newSegReq(test.dst,
+						test.cacheOnly))
+					SoMsg("err", err, ShouldBeNil)
+					SoMsg("segs", segIDs(t, segs), ShouldResemble, segIDs(t, test.expected))
+					SoMsg("forwarded", forwarded, ShouldEqual, len(test.reqs) > 0)
+					SoMsg("reqs", m.reqs, ShouldResemble, test.reqs)
+				})
+			}
+		})
+	})
+}
+
+func TestCoreSegs(t *testing.T) {
+	Convey("Given a path server in core AS 1-13 with cached segments", t, func() {
+		_, cleanup := setupConf(t, ia13)
+		defer cleanup()
+		m := &mockMessenger{}
+		ctx := context.Background()
+		core := insertSeg(t, seg.CoreSegment, ia11, ia13)
+		down := insertSeg(t, seg.DownSegment, ia11, ia14)
+		remoteCore := insertSeg(t, seg.CoreSegment, ia21, ia13)
+		cores := metas(seg.CoreSegment, core)
+		downs := metas(seg.DownSegment, down)
+		tests := []struct {
+			desc      string
+			dst       *addr.ISD_AS
+			cacheOnly bool
+			expected  []*seg.Meta
+			reqs      []net.Addr
+		}{
+			{"Local core ASes are reached with core segments", ia11, false, cores, nil},
+			{"Local core ASes without core segments are not reachable", ia12, false,
+				nil, nil},
+			{"Local non-core ASes are reached with core and down segments", ia14, false,
+				append(cores, downs...), nil},
+			{"Remote core ASes are reached with core segments", ia21, false,
+				metas(seg.CoreSegment, remoteCore), nil},
+			{"Remote non-core ASes are requested from the remote core AS", ia22, false,
+				nil, []net.Addr{psAddr(ia21)}},
+			{"Remote non-core ASes are not requested for cache-only requests", ia22, true,
+				nil, nil},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				segs, forwarded, err := coreSegs(ctx, m, newSegReq(test.dst, test.cacheOnly))
+				SoMsg("err", err, ShouldBeNil)
+				SoMsg("segs", segIDs(t, segs), ShouldResemble, segIDs(t, test.expected))
+				SoMsg("forwarded", forwarded, ShouldEqual, len(test.reqs) > 0)
+				SoMsg("reqs", m.reqs, ShouldResemble, test.reqs)
+			})
+		}
+		Convey("Requests for ISDs without core segments cannot be forwarded", func() {
+			_, _, err := coreSegs(ctx, m, newSegReq(&addr.ISD_AS{I: 3, A: 30}, false))
+			SoMsg("err", common.GetErrorMsg(err), ShouldEqual, ErrorNoCorePS)
+			SoMsg("reqs", m.reqs, ShouldBeEmpty)
+		})
+	})
+}
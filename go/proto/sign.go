@@ -16,6 +16,7 @@ package proto
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/scionproto/scion/go/lib/common"
@@ -23,6 +24,34 @@ import (
 	"github.com/scionproto/scion/go/lib/util"
 )
 
+// signAlgos maps the sign types to the names of the signature algorithms in lib/crypto.
+var signAlgos = map[SignType]string{
+	SignType_ed25519:   crypto.Ed25519,
+	SignType_ecdsap256: crypto.ECDSAP256,
+	SignType_ecdsap384: crypto.ECDSAP384,
+}
+
+// SignTypeFromAlgo returns the sign type for the signature algorithm algo, as used in
+// certificates.
+func SignTypeFromAlgo(algo string) (SignType, error) {
+	for t, name := range signAlgos {
+		if strings.EqualFold(name, algo) {
+			return t, nil
+		}
+	}
+	return SignType_none, common.NewBasicError("Unsupported signature algorithm", nil,
+		"algo", algo)
+}
+
+// SignAlgo returns the name of the signature algorithm of t, as used by lib/crypto.
+func (t SignType) SignAlgo() (string, error) {
+	algo, ok := signAlgos[t]
+	if !ok {
+		return "", common.NewBasicError("Unsupported SignType", nil, "type", t)
+	}
+	return algo, nil
+}
+
 var _ Cerealizable = (*SignS)(nil)
 
 type SignS struct {
@@ -52,30 +81,42 @@ func (s *SignS) Copy() *SignS {
 }
 
 func (s *SignS) Sign(key, message common.RawBytes) (common.RawBytes, error) {
-	switch s.Type {
-	case SignType_none:
+	return s.SignWith(crypto.NewKeySigner(key), message)
+}
+
+// SignWith creates the signature over message with signer.
+func (s *SignS) SignWith(signer crypto.Signer, message common.RawBytes) (common.RawBytes, error) {
+	if s.Type == SignType_none {
 		return nil, nil
-	case SignType_ed25519:
-		return crypto.Sign(message, key, crypto.Ed25519)
 	}
-	return nil, common.NewBasicError("SignS.Sign: Unsupported SignType", nil, "type", s.Type)
+	algo, err := s.Type.SignAlgo()
+	if err != nil {
+		return nil, common.NewBasicError("SignS.Sign: Unsupported SignType", nil, "type", s.Type)
+	}
+	return signer.Sign(message, algo)
 }
 
 func (s *SignS) SignAndSet(key, message common.RawBytes) error {
+	return s.SignAndSetWith(crypto.NewKeySigner(key), message)
+}
+
+// SignAndSetWith sets the timestamp, and the signature over message created by signer.
+func (s *SignS) SignAndSetWith(signer crypto.Signer, message common.RawBytes) error {
 	var err error
 	s.Timestamp = uint64(time.Now().Unix())
-	s.Signature, err = s.Sign(key, message)
+	s.Signature, err = s.SignWith(signer, message)
 	return err
 }
 
 func (s *SignS) Verify(key, message common.RawBytes) error {
-	switch s.Type {
-	case SignType_none:
+	if s.Type == SignType_none {
 		return nil
-	case SignType_ed25519:
-		return crypto.Verify(message, s.Signature, key, crypto.Ed25519)
 	}
-	return common.NewBasicError("SignS.Verify: Unsupported SignType", nil, "type", s.Type)
+	algo, err := s.Type.SignAlgo()
+	if err != nil {
+		return common.NewBasicError("SignS.Verify: Unsupported SignType", nil, "type", s.Type)
+	}
+	return crypto.Verify(message, s.Signature, key, algo)
 }
 
 func (s *SignS) Pack() common.RawBytes {
@@ -0,0 +1,228 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/infra"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/lib/topology"
+	"github.com/scionproto/scion/go/proto"
+)
+
+// svcTTL is the TTL of service info entries, in seconds.
+const svcTTL = 60
+
+// APIServer serves the SCIOND API on a reliable UNIX socket.
+type APIServer struct {
+	listener *reliable.Listener
+	msger    infra.Messenger
+}
+
+func NewAPIServer(path string, msger infra.Messenger) (*APIServer, error) {
+	l, err := reliable.Listen(path)
+	if err != nil {
+		return nil, err
+	}
+	return &APIServer{listener: l, msger: msger}, nil
+}
+
+// Serve accepts client connections until the listener is closed. Each client is served in its
+// own goroutine.
+func (s *APIServer) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer liblog.LogPanicAndExit()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *APIServer) Close() error {
+	return s.listener.Close()
+}
+
+// handleConn answers the requests of a single client. Each request is handled in its own
+// goroutine, so that slow path requests do not delay the other requests of the client. Replies
+// carry the ID of their request and may be sent out of order, writes to the connection are
+// serialized.
+func (s *APIServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	var writeLock sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		req := &sciond.Pld{}
+		if err := proto.ParseFromReader(req, proto.SCIONDMsg_TypeID, conn); err != nil {
+			// This includes clients closing the connection.
+			log.Debug("Closing API connection", "err", err)
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer liblog.LogPanicAndExit()
+			defer wg.Done()
+			reply := s.handle(req)
+			raw, err := proto.PackRoot(reply)
+			if err != nil {
+				log.Error("Unable to pack API reply", "reply", reply, "err", err)
+				return
+			}
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			if _, err = conn.Write(raw); err != nil {
+				log.Error("Unable to send API reply", "err", err)
+				// Unblock the reader, the connection is unusable.
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// handle returns the reply to req. Unsupported requests are answered with an empty reply of
+// type unset, so that the client does not wait for a reply in vain.
+func (s *APIServer) handle(req *sciond.Pld) *sciond.Pld {
+	reply := &sciond.Pld{Id: req.Id}
+	switch req.Which {
+	case proto.SCIONDMsg_Which_pathReq:
+		reply.Which = proto.SCIONDMsg_Which_pathReply
+		ctx, cancelF := context.WithTimeout(context.Background(), pathReqTimeout)
+		defer cancelF()
+		reply.PathReply = getPaths(ctx, s.msger, &req.PathReq)
+	case proto.SCIONDMsg_Which_asInfoReq:
+		reply.Which = proto.SCIONDMsg_Which_asInfoReply
+		reply.AsInfoReply = asInfo(req.AsInfoReq.Isdas.IA())
+	case proto.SCIONDMsg_Which_ifInfoRequest:
+		reply.Which = proto.SCIONDMsg_Which_ifInfoReply
+		reply.IfInfoReply = ifInfo(req.IfInfoRequest.IfIDs)
+	case proto.SCIONDMsg_Which_serviceInfoRequest:
+		reply.Which = proto.SCIONDMsg_Which_serviceInfoReply
+		reply.ServiceInfoReply = svcInfo(req.ServiceInfoRequest.ServiceTypes)
+	case proto.SCIONDMsg_Which_revNotification:
+		reply.Which = proto.SCIONDMsg_Which_revReply
+		reply.RevReply.Result = processRev(req.RevNotification.RevInfo)
+	default:
+		log.Warn("Unsupported API request", "type", req.Which)
+		reply.Which = proto.SCIONDMsg_Which_unset
+	}
+	return reply
+}
+
+// asInfo answers an AS info request. An unset ia refers to the local AS. The MTU is only
+// known for the local AS.
+func asInfo(ia *addr.ISD_AS) sciond.ASInfoReply {
+	entry := sciond.ASInfoReplyEntry{RawIsdas: ia.IAInt(), IsCore: config.IsCore(ia)}
+	if (ia.I == 0 && ia.A == 0) || config.Topo.ISD_AS.Eq(ia) {
+		entry.RawIsdas = config.Topo.ISD_AS.IAInt()
+		entry.Mtu = uint16(config.Topo.MTU)
+		entry.IsCore = config.Topo.Core
+	}
+	return sciond.ASInfoReply{Entries: []sciond.ASInfoReplyEntry{entry}}
+}
+
+// ifInfo returns the internal addresses of the border routers owning the interfaces in
+// ifids. If ifids is empty, all interfaces are returned.
+func ifInfo(ifids []uint64) sciond.IFInfoReply {
+	var reply sciond.IFInfoReply
+	for ifid, info := range config.Topo.IFInfoMap {
+		if len(ifids) > 0 && !containsIFID(ifids, uint64(ifid)) {
+			continue
+		}
+		reply.RawEntries = append(reply.RawEntries, sciond.IFInfoReplyEntry{
+			IfID:     uint64(ifid),
+			HostInfo: *brHostInfo(info),
+		})
+	}
+	sort.Slice(reply.RawEntries, func(i, j int) bool {
+		return reply.RawEntries[i].IfID < reply.RawEntries[j].IfID
+	})
+	return reply
+}
+
+func containsIFID(ifids []uint64, ifid uint64) bool {
+	for _, other := range ifids {
+		if other == ifid {
+			return true
+		}
+	}
+	return false
+}
+
+// brHostInfo returns the internal address of the border router owning interface info.
+func brHostInfo(info topology.IFInfo) *sciond.HostInfo {
+	a := info.InternalAddr.PublicAddrInfo(config.Topo.Overlay)
+	return sciond.HostInfoFromHostAddr(addr.HostFromIP(a.IP), uint16(a.L4Port))
+}
+
+// svcInfo returns the addresses of the infrastructure services of the types in svcTypes. If
+// svcTypes is empty, all service types are returned.
+func svcInfo(svcTypes []sciond.ServiceType) sciond.ServiceInfoReply {
+	if len(svcTypes) == 0 {
+		svcTypes = []sciond.ServiceType{sciond.SvcBS, sciond.SvcPS, sciond.SvcCS,
+			sciond.SvcBR, sciond.SvcSB}
+	}
+	var reply sciond.ServiceInfoReply
+	for _, t := range svcTypes {
+		entry := sciond.ServiceInfoReplyEntry{ServiceType: t, Ttl: svcTTL}
+		if t == sciond.SvcBR {
+			for _, name := range config.Topo.BRNames {
+				ifids := config.Topo.BR[name].IFIDs
+				if len(ifids) == 0 {
+					continue
+				}
+				info := config.Topo.IFInfoMap[ifids[0]]
+				entry.HostInfos = append(entry.HostInfos, *brHostInfo(info))
+			}
+		} else {
+			svcs, names := svcMap(t)
+			for _, name := range names {
+				ta := svcs[name]
+				a := ta.PublicAddrInfo(config.Topo.Overlay)
+				entry.HostInfos = append(entry.HostInfos,
+					*sciond.HostInfoFromHostAddr(addr.HostFromIP(a.IP), uint16(a.L4Port)))
+			}
+		}
+		reply.Entries = append(reply.Entries, entry)
+	}
+	return reply
+}
+
+// svcMap returns the topology entries of service type t, and their names.
+func svcMap(t sciond.ServiceType) (map[string]topology.TopoAddr, []string) {
+	switch t {
+	case sciond.SvcBS:
+		return config.Topo.BS, config.Topo.BSNames
+	case sciond.SvcPS:
+		return config.Topo.PS, config.Topo.PSNames
+	case sciond.SvcCS:
+		return config.Topo.CS, config.Topo.CSNames
+	case sciond.SvcSB:
+		return config.Topo.SB, config.Topo.SBNames
+	}
+	return nil, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file combines up, core and down segments into end-to-end forwarding paths, following
+// python/lib/path_combinator.py. Shortcut and peering paths are not built yet.
+
+package main
+
+import (
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+// combPath is an end-to-end path, together with the time its first segment expires.
+type combPath struct {
+	meta   sciond.FwdPathMeta
+	expiry time.Time
+}
+
+// combine builds the forwarding path traversing up, core and down, in this order. Any of the
+// segments may be nil. It returns nil, if the segments are not connected.
+func combine(up, core, down *seg.PathSegment) (*combPath, error) {
+	if !connected(up, core, down) {
+		return nil, nil
+	}
+	p := &combPath{}
+	var raw common.RawBytes
+	mtu := 0
+	segs := []struct {
+		seg        *seg.PathSegment
+		up         bool
+		xoverStart bool
+		xoverEnd   bool
+	}{
+		{up, true, false, core != nil || down != nil},
+		{core, true, up != nil, down != nil},
+		{down, false, up != nil || core != nil, false},
+	}
+	for _, s := range segs {
+		if s.seg == nil {
+			continue
+		}
+		segRaw, segMTU, err := copySegment(s.seg, s.up, s.xoverStart, s.xoverEnd)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, segRaw...)
+		mtu = minMTU(mtu, segMTU)
+		exp, err := s.seg.Expiry()
+		if err != nil {
+			return nil, err
+		}
+		if p.expiry.IsZero() || exp.Before(p.expiry) {
+			p.expiry = exp
+		}
+	}
+	var upCore []*seg.ASEntry
+	if up != nil {
+		upCore = append(upCore, reversed(up.ASEntries)...)
+	}
+	if core != nil {
+		upCore = append(upCore, reversed(core.ASEntries)...)
+	}
+	ifaces, err := interfaces(upCore, true)
+	if err != nil {
+		return nil, err
+	}
+	if down != nil {
+		downIfaces, err := interfaces(down.ASEntries, false)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = append(ifaces, downIfaces...)
+	}
+	p.meta = sciond.FwdPathMeta{FwdPath: raw, Mtu: uint16(mtu), Interfaces: ifaces}
+	return p, nil
+}
+
+// connected returns whether the segments can be joined, i.e., whether up and down start at
+// the ends of core. If core is nil, up and down must start at the same AS.
+func connected(up, core, down *seg.PathSegment) bool {
+	if core != nil {
+		if up != nil && !core.ASEntries[core.MaxAEIdx()].IA().Eq(up.ASEntries[0].IA()) {
+			return false
+		}
+		return down == nil || core.ASEntries[0].IA().Eq(down.ASEntries[0].IA())
+	}
+	return up == nil || down == nil || up.ASEntries[0].IA().Eq(down.ASEntries[0].IA())
+}
+
+// copySegment returns the info field and the hop fields of pseg, in the order they are
+// traversed, with the up and crossover flags set. It also returns the MTU of the segment.
+func copySegment(pseg *seg.PathSegment, up, xoverStart, xoverEnd bool) (common.RawBytes,
+	int, error) {
+
+	info, err := pseg.InfoF()
+	if err != nil {
+		return nil, 0, err
+	}
+	info.Up = up
+	info.Hops = uint8(len(pseg.ASEntries))
+	raw := make(common.RawBytes, spath.InfoFieldLength+len(pseg.ASEntries)*spath.HopFieldLength)
+	info.Write(raw)
+	mtu := 0
+	for i, ase := range pseg.ASEntries {
+		if i != 0 {
+			// The ingress MTU of the first AS entry is irrelevant, since its ingress interface
+			// is not traversed.
+			mtu = minMTU(mtu, int(ase.HopEntries[0].InMTU))
+		}
+		mtu = minMTU(mtu, int(ase.MTU))
+		// The hop fields are traversed in reverse order on up segments.
+		idx := i
+		if up {
+			idx = len(pseg.ASEntries) - 1 - i
+		}
+		off := spath.InfoFieldLength + idx*spath.HopFieldLength
+		// Copy the hop field, so that setting the flags does not modify the segment.
+		b := raw[off : off+spath.HopFieldLength]
+		copy(b, ase.HopEntries[0].RawHopField)
+		hopF, err := spath.HopFFromRaw(b)
+		if err != nil {
+			return nil, 0, err
+		}
+		hopF.Xover = (xoverStart && off == spath.InfoFieldLength) ||
+			(xoverEnd && off == len(raw)-spath.HopFieldLength)
+		hopF.Write()
+	}
+	return raw, mtu, nil
+}
+
+// interfaces returns the interfaces traversed on the AS entries ases. If up is set, ases are
+// traversed from egress to ingress interface, i.e., they are listed in reverse.
+func interfaces(ases []*seg.ASEntry, up bool) ([]sciond.PathInterface, error) {
+	var ifaces []sciond.PathInterface
+	add := func(ase *seg.ASEntry, ifid common.IFIDType) {
+		if ifid != 0 {
+			ifaces = append(ifaces, sciond.PathInterface{RawIsdas: ase.RawIA, IfID: uint64(ifid)})
+		}
+	}
+	for i, ase := range ases {
+		hopF, err := ase.HopEntries[0].HopField()
+		if err != nil {
+			return nil, err
+		}
+		if up {
+			add(ase, hopF.Egress)
+			if i != len(ases)-1 {
+				add(ase, hopF.Ingress)
+			}
+		} else {
+			if i != 0 {
+				add(ase, hopF.Ingress)
+			}
+			add(ase, hopF.Egress)
+		}
+	}
+	return ifaces, nil
+}
+
+func reversed(ases []*seg.ASEntry) []*seg.ASEntry {
+	res := make([]*seg.ASEntry, len(ases))
+	for i, ase := range ases {
+		res[len(ases)-1-i] = ase
+	}
+	return res
+}
+
+// minMTU returns the smaller of two MTUs, ignoring MTUs below the SCION minimum. 0 means no
+// MTU is known.
+func minMTU(a, b int) int {
+	if b < common.MinMTU {
+		return a
+	}
+	if a < common.MinMTU || b < a {
+		return b
+	}
+	return a
+}
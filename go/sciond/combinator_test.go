@@ -0,0 +1,407 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/pathdb"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spath"
+	"github.com/scionproto/scion/go/lib/topology"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/proto"
+	"github.com/scionproto/scion/go/sciond/conf"
+)
+
+var (
+	fnTRC = "../lib/crypto/cert/testdata/ISD1-V2.trc"
+
+	// ISD 1 has the core ASes 1-11, 1-12 and 1-13. The non-core AS 1-10 is a customer of 1-13,
+	// 1-14 a customer of 1-11, and 1-15 a customer of 1-13.
+	ia10 = &addr.ISD_AS{I: 1, A: 10}
+	ia11 = &addr.ISD_AS{I: 1, A: 11}
+	ia12 = &addr.ISD_AS{I: 1, A: 12}
+	ia13 = &addr.ISD_AS{I: 1, A: 13}
+	ia14 = &addr.ISD_AS{I: 1, A: 14}
+	ia15 = &addr.ISD_AS{I: 1, A: 15}
+)
+
+// setupConf sets config to a configuration of the local AS ia, with an empty path database. The
+// trust store contains TRC 1v2 with the core ASes of ISD 1.
+func setupConf(t *testing.T, ia *addr.ISD_AS) func() {
+	dir, err := ioutil.TempDir("", "sciond_test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	if err = os.Mkdir(filepath.Join(dir, "certs"), 0755); err != nil {
+		cleanup()
+		t.Fatalf("Unable to create dir: %v", err)
+	}
+	store, err := trust.NewStore(filepath.Join(dir, "certs"), dir, "sd-test")
+	if err != nil {
+		cleanup()
+		t.Fatalf("Unable to create store: %v", err)
+	}
+	db, err := pathdb.New(filepath.Join(dir, "path.db"), "sqlite")
+	if err != nil {
+		store.Close()
+		cleanup()
+		t.Fatalf("Unable to open path database: %v", err)
+	}
+	raw, err := ioutil.ReadFile(fnTRC)
+	if err != nil {
+		t.Fatalf("Unable to load raw from '%s': %v", fnTRC, err)
+	}
+	t_, err := trc.TRCFromRaw(raw, false)
+	if err != nil {
+		t.Fatalf("Error loading TRC from '%s': %v", fnTRC, err)
+	}
+	t_.CoreASes = make(map[addr.ISD_AS]*trc.CoreAS)
+	for _, coreIA := range []*addr.ISD_AS{ia11, ia12, ia13} {
+		t_.CoreASes[*coreIA] = &trc.CoreAS{}
+	}
+	store.AddTRC(t_, false)
+	config = &conf.Conf{
+		Topo:   &topology.Topo{ISD_AS: ia.Copy(), Core: t_.CoreASes[*ia] != nil},
+		Store:  store,
+		PathDB: db,
+	}
+	pathCache.Flush()
+	return func() {
+		store.Close()
+		cleanup()
+	}
+}
+
+// newSeg returns an unsigned path segment through ias, created at ts. The interface of an AS
+// towards a neighboring AS has the AS number of the neighbor as interface ID. The MTU of each AS
+// is 1500, except for the AS entries with an index in lowMTU, which have the MTU 1400.
+func newSeg(t *testing.T, ts time.Time, lowMTU map[int]bool,
+	ias ...*addr.ISD_AS) *seg.PathSegment {
+
+	info := &spath.InfoField{TsInt: uint32(ts.Unix()), ISD: uint16(ias[0].I),
+		Hops: uint8(len(ias))}
+	pseg, err := seg.NewSeg(info)
+	if err != nil {
+		t.Fatalf("Unable to create segment: %v", err)
+	}
+	for i, ia := range ias {
+		var in, out common.IFIDType
+		inIA, outIA := &addr.ISD_AS{}, &addr.ISD_AS{}
+		if i > 0 {
+			inIA = ias[i-1]
+			in = common.IFIDType(inIA.A)
+		}
+		if i < len(ias)-1 {
+			outIA = ias[i+1]
+			out = common.IFIDType(outIA.A)
+		}
+		rawHop := make(common.RawBytes, spath.HopFieldLength)
+		spath.NewHopField(rawHop, in, out)
+		mtu := uint16(1500)
+		if lowMTU[i] {
+			mtu = 1400
+		}
+		ase := &seg.ASEntry{
+			RawIA:  ia.IAInt(),
+			TrcVer: 2,
+			MTU:    mtu,
+			HopEntries: []*seg.HopEntry{{
+				RawInIA:     inIA.IAInt(),
+				RawOutIA:    outIA.IAInt(),
+				RawHopField: rawHop,
+				InMTU:       mtu,
+			}},
+		}
+		if err = pseg.AddASEntry(ase, proto.SignType_none, nil); err != nil {
+			t.Fatalf("Unable to add AS entry: %v", err)
+		}
+	}
+	return pseg
+}
+
+// insertSeg adds an unexpired segment of type segType through ias to the path database.
+func insertSeg(t *testing.T, segType seg.Type, ias ...*addr.ISD_AS) *seg.PathSegment {
+	pseg := newSeg(t, time.Now(), nil, ias...)
+	if _, err := config.PathDB.Insert(pseg, []seg.Type{segType}); err != nil {
+		t.Fatalf("Unable to insert segment: %v", err)
+	}
+	return pseg
+}
+
+// hopFs parses the info field and hop fields of a raw forwarding path segment.
+func hopFs(t *testing.T, raw common.RawBytes) (*spath.InfoField, []*spath.HopField) {
+	info, err := spath.InfoFFromRaw(raw)
+	if err != nil {
+		t.Fatalf("Unable to parse info field: %v", err)
+	}
+	var hops []*spath.HopField
+	for off := spath.InfoFieldLength; off < len(raw); off += spath.HopFieldLength {
+		hopF, err := spath.HopFFromRaw(raw[off:])
+		if err != nil {
+			t.Fatalf("Unable to parse hop field: %v", err)
+		}
+		hops = append(hops, hopF)
+	}
+	return info, hops
+}
+
+// ifStrs returns ifaces as strings, for comparison.
+func ifStrs(ifaces []sciond.PathInterface) []string {
+	var strs []string
+	for _, iface := range ifaces {
+		strs = append(strs, iface.String())
+	}
+	return strs
+}
+
+func TestCopySegment(t *testing.T) {
+	Convey("Given a segment from 1-13 to 1-10", t, func() {
+		pseg := newSeg(t, time.Now(), map[int]bool{1: true}, ia13, ia10)
+		Convey("Traversed as up segment, the hop fields are reversed", func() {
+			raw, mtu, err := copySegment(pseg, true, false, true)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("len", len(raw), ShouldEqual,
+				spath.InfoFieldLength+2*spath.HopFieldLength)
+			SoMsg("mtu", mtu, ShouldEqual, 1400)
+			info, hops := hopFs(t, raw)
+			SoMsg("up", info.Up, ShouldBeTrue)
+			SoMsg("hops", info.Hops, ShouldEqual, uint8(2))
+			SoMsg("first ingress", hops[0].Ingress, ShouldEqual, common.IFIDType(13))
+			SoMsg("first xover", hops[0].Xover, ShouldBeFalse)
+			SoMsg("last egress", hops[1].Egress, ShouldEqual, common.IFIDType(10))
+			SoMsg("last xover", hops[1].Xover, ShouldBeTrue)
+		})
+		Convey("Traversed as down segment, the hop fields keep their order", func() {
+			raw, _, err := copySegment(pseg, false, true, false)
+			SoMsg("err", err, ShouldBeNil)
+			info, hops := hopFs(t, raw)
+			SoMsg("up", info.Up, ShouldBeFalse)
+			SoMsg("first egress", hops[0].Egress, ShouldEqual, common.IFIDType(10))
+			SoMsg("first xover", hops[0].Xover, ShouldBeTrue)
+			SoMsg("last ingress", hops[1].Ingress, ShouldEqual, common.IFIDType(13))
+			SoMsg("last xover", hops[1].Xover, ShouldBeFalse)
+		})
+		Convey("The segment is not modified", func() {
+			copySegment(pseg, true, true, true)
+			for i, ase := range pseg.ASEntries {
+				hopF, err := ase.HopEntries[0].HopField()
+				SoMsg("err", err, ShouldBeNil)
+				SoMsg(fmt.Sprintf("xover %d", i), hopF.Xover, ShouldBeFalse)
+			}
+			info, err := pseg.InfoF()
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("up", info.Up, ShouldBeFalse)
+		})
+		Convey("The ingress MTU of the first AS entry is ignored", func() {
+			pseg.ASEntries[0].HopEntries[0].InMTU = 1300
+			_, mtu, err := copySegment(pseg, true, false, false)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("mtu", mtu, ShouldEqual, 1400)
+		})
+	})
+}
+
+func TestInterfaces(t *testing.T) {
+	Convey("Given a segment from 1-11 through 1-13 to 1-10", t, func() {
+		pseg := newSeg(t, time.Now(), nil, ia11, ia13, ia10)
+		Convey("Down segments are traversed in order", func() {
+			ifaces, err := interfaces(pseg.ASEntries, false)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("ifaces", ifStrs(ifaces), ShouldResemble,
+				[]string{"1-11#13", "1-13#11", "1-13#10", "1-10#13"})
+		})
+		Convey("Up segments are traversed in reverse", func() {
+			ifaces, err := interfaces(reversed(pseg.ASEntries), true)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("ifaces", ifStrs(ifaces), ShouldResemble,
+				[]string{"1-10#13", "1-13#10", "1-13#11", "1-11#13"})
+		})
+	})
+}
+
+func TestConnected(t *testing.T) {
+	Convey("Given segments of a non-core AS 1-10", t, func() {
+		now := time.Now()
+		up := newSeg(t, now, nil, ia13, ia10)
+		core := newSeg(t, now, nil, ia11, ia13)
+		down := newSeg(t, now, nil, ia11, ia14)
+		localDown := newSeg(t, now, nil, ia13, ia15)
+		tests := []struct {
+			desc           string
+			up, core, down *seg.PathSegment
+			expected       bool
+		}{
+			{"Up, core and down segments are connected at both ends", up, core, down, true},
+			{"Up and core segments are connected", up, core, nil, true},
+			{"Core and down segments are connected", nil, core, down, true},
+			{"Up and down segments starting at the same AS are connected", up, nil,
+				localDown, true},
+			{"Up and down segments starting at different ASes are not connected", up, nil,
+				down, false},
+			{"A core segment not ending at the up segment is not connected", localDown, core,
+				down, false},
+			{"A core segment not starting at the down segment is not connected", up, core,
+				localDown, false},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				SoMsg("connected", connected(test.up, test.core, test.down), ShouldEqual,
+					test.expected)
+			})
+		}
+	})
+}
+
+func TestCombine(t *testing.T) {
+	Convey("Given segments of a non-core AS 1-10", t, func() {
+		now := time.Now()
+		up := newSeg(t, now, nil, ia13, ia10)
+		core := newSeg(t, now.Add(-time.Hour), map[int]bool{0: true}, ia11, ia13)
+		down := newSeg(t, now, nil, ia11, ia14)
+		localDown := newSeg(t, now, nil, ia13, ia15)
+		Convey("Up, core and down segments are combined", func() {
+			p, err := combine(up, core, down)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("path", p, ShouldNotBeNil)
+			SoMsg("ifaces", ifStrs(p.meta.Interfaces), ShouldResemble, []string{"1-10#13",
+				"1-13#10", "1-13#11", "1-11#13", "1-11#14", "1-14#11"})
+			SoMsg("mtu", p.meta.Mtu, ShouldEqual, uint16(1400))
+			coreExp, _ := core.Expiry()
+			SoMsg("expiry", p.expiry, ShouldResemble, coreExp)
+			segLen := spath.InfoFieldLength + 2*spath.HopFieldLength
+			raw := p.meta.FwdPath
+			SoMsg("len", len(raw), ShouldEqual, 3*segLen)
+			upInfo, upHops := hopFs(t, raw[:segLen])
+			coreInfo, coreHops := hopFs(t, raw[segLen:2*segLen])
+			downInfo, downHops := hopFs(t, raw[2*segLen:])
+			SoMsg("up flags", []bool{upInfo.Up, coreInfo.Up, downInfo.Up}, ShouldResemble,
+				[]bool{true, true, false})
+			SoMsg("up xover", []bool{upHops[0].Xover, upHops[1].Xover}, ShouldResemble,
+				[]bool{false, true})
+			SoMsg("core xover", []bool{coreHops[0].Xover, coreHops[1].Xover},
+				ShouldResemble, []bool{true, true})
+			SoMsg("down xover", []bool{downHops[0].Xover, downHops[1].Xover},
+				ShouldResemble, []bool{true, false})
+		})
+		Convey("Up and down segments are combined without core segment", func() {
+			p, err := combine(up, nil, localDown)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("path", p, ShouldNotBeNil)
+			SoMsg("ifaces", ifStrs(p.meta.Interfaces), ShouldResemble,
+				[]string{"1-10#13", "1-13#10", "1-13#15", "1-15#13"})
+			SoMsg("mtu", p.meta.Mtu, ShouldEqual, uint16(1500))
+		})
+		Convey("A single up segment is not crossed over", func() {
+			p, err := combine(up, nil, nil)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("ifaces", ifStrs(p.meta.Interfaces), ShouldResemble,
+				[]string{"1-10#13", "1-13#10"})
+			_, hops := hopFs(t, p.meta.FwdPath)
+			SoMsg("xover", []bool{hops[0].Xover, hops[1].Xover}, ShouldResemble,
+				[]bool{false, false})
+		})
+		Convey("Segments that are not connected are not combined", func() {
+			p, err := combine(up, nil, down)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("path", p, ShouldBeNil)
+		})
+	})
+}
+
+func TestResolve(t *testing.T) {
+	Convey("Given a non-core AS 1-10 with cached segments", t, func() {
+		cleanup := setupConf(t, ia10)
+		defer cleanup()
+		insertSeg(t, seg.UpSegment, ia13, ia10)
+		insertSeg(t, seg.CoreSegment, ia11, ia13)
+		insertSeg(t, seg.DownSegment, ia11, ia14)
+		insertSeg(t, seg.DownSegment, ia13, ia15)
+		tests := []struct {
+			desc     string
+			dst      *addr.ISD_AS
+			expected [][]string
+		}{
+			{"The core AS of the up segment is reached with the up segment", ia13,
+				[][]string{{"1-10#13", "1-13#10"}}},
+			{"Other core ASes are reached with up and core segments", ia11,
+				[][]string{{"1-10#13", "1-13#10", "1-13#11", "1-11#13"}}},
+			{"Core ASes without core segments are not reachable", ia12, nil},
+			{"Non-core ASes are reached with up, core and down segments", ia14,
+				[][]string{{"1-10#13", "1-13#10", "1-13#11", "1-11#13", "1-11#14",
+					"1-14#11"}}},
+			{"Non-core ASes below the same core AS are reached with up and down segments",
+				ia15, [][]string{{"1-10#13", "1-13#10", "1-13#15", "1-15#13"}}},
+			{"Wildcard ASes are reached through all core ASes, shortest path first",
+				&addr.ISD_AS{I: 1, A: 0}, [][]string{{"1-10#13", "1-13#10"},
+					{"1-10#13", "1-13#10", "1-13#11", "1-11#13"}}},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				paths, err := resolve(test.dst)
+				SoMsg("err", err, ShouldBeNil)
+				var ifaces [][]string
+				for _, p := range paths {
+					ifaces = append(ifaces, ifStrs(p.meta.Interfaces))
+				}
+				SoMsg("paths", ifaces, ShouldResemble, test.expected)
+			})
+		}
+	})
+	Convey("Given a core AS 1-13 with cached segments", t, func() {
+		cleanup := setupConf(t, ia13)
+		defer cleanup()
+		insertSeg(t, seg.CoreSegment, ia11, ia13)
+		insertSeg(t, seg.DownSegment, ia11, ia14)
+		insertSeg(t, seg.DownSegment, ia13, ia15)
+		tests := []struct {
+			desc     string
+			dst      *addr.ISD_AS
+			expected [][]string
+		}{
+			{"Core ASes are reached with core segments", ia11,
+				[][]string{{"1-13#11", "1-11#13"}}},
+			{"Remote non-core ASes are reached with core and down segments", ia14,
+				[][]string{{"1-13#11", "1-11#13", "1-11#14", "1-14#11"}}},
+			{"Local non-core ASes are reached with down segments", ia15,
+				[][]string{{"1-13#15", "1-15#13"}}},
+			{"Non-core ASes without down segments are not reachable", ia10, nil},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				paths, err := resolve(test.dst)
+				SoMsg("err", err, ShouldBeNil)
+				var ifaces [][]string
+				for _, p := range paths {
+					ifaces = append(ifaces, ifStrs(p.meta.Interfaces))
+				}
+				SoMsg("paths", ifaces, ShouldResemble, test.expected)
+			})
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"net"
+	"path/filepath"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pathdb"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/topology"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+const (
+	ErrorAddr   = "Invalid address"
+	ErrorPathDB = "Unable to open path database"
+	ErrorStore  = "Unable to load TrustStore"
+	ErrorTopo   = "Unable to load topology"
+
+	// PathDBSuffix is appended to the element ID to form the default path database file name.
+	PathDBSuffix = ".path.db"
+)
+
+type Conf struct {
+	// Topo contains the names of all local infrastructure elements, a map
+	// of interface IDs to routers, and the actual topology.
+	Topo *topology.Topo
+	// PublicAddr is the address used to talk to the infrastructure services. The port is
+	// assigned by the dispatcher.
+	PublicAddr *snet.Addr
+	// Store is the trust store, used to verify path segments.
+	Store *trust.Store
+	// PathDB caches the path segments received from the path server.
+	PathDB *pathdb.DB
+	// CacheDir is the cache directory.
+	CacheDir string
+	// ConfDir is the configuration directory.
+	ConfDir string
+}
+
+// Load initializes the configuration by loading it from confDir. The path database is opened
+// at pathDBFile, or in cacheDir if pathDBFile is empty. Control traffic is sent from ip.
+func Load(id, confDir, cacheDir, pathDBFile, ip string) (*Conf, error) {
+	var err error
+	conf := &Conf{
+		ConfDir:  confDir,
+		CacheDir: cacheDir,
+	}
+	// load topology
+	path := filepath.Join(confDir, topology.CfgName)
+	if conf.Topo, err = topology.LoadFromFile(path); err != nil {
+		return nil, common.NewBasicError(ErrorTopo, err)
+	}
+	// parse public address
+	pubIP := net.ParseIP(ip)
+	if pubIP == nil {
+		return nil, common.NewBasicError(ErrorAddr, nil, "ip", ip)
+	}
+	conf.PublicAddr = &snet.Addr{IA: conf.Topo.ISD_AS, Host: addr.HostFromIP(pubIP)}
+	// load trust store
+	conf.Store, err = trust.NewStore(filepath.Join(confDir, "certs"), cacheDir, id)
+	if err != nil {
+		return nil, common.NewBasicError(ErrorStore, err)
+	}
+	// open path database
+	if pathDBFile == "" {
+		pathDBFile = filepath.Join(cacheDir, id+PathDBSuffix)
+	}
+	if conf.PathDB, err = pathdb.New(pathDBFile, "sqlite"); err != nil {
+		conf.Store.Close()
+		return nil, common.NewBasicError(ErrorPathDB, err, "file", pathDBFile)
+	}
+	return conf, nil
+}
+
+// IsCore returns whether ia is a core AS, according to the newest TRC of its ISD in the trust
+// store.
+func (c *Conf) IsCore(ia *addr.ISD_AS) bool {
+	if c.Topo.ISD_AS.Eq(ia) {
+		return c.Topo.Core
+	}
+	t := c.Store.GetNewestTRC(uint16(ia.I))
+	if t == nil {
+		return false
+	}
+	for _, core := range t.CoreASList() {
+		if core.Eq(ia) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// SCION daemon. It serves the SCIOND API (see lib/sciond) on a reliable UNIX
+// socket, so that applications can query paths and information about the
+// local AS.
+//
+// Path segments are requested from the local path server, verified, and
+// cached in a path database. End-to-end paths are combined from up, core and
+// down segments. Interface and service information is taken from the
+// topology.
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/infra/disp"
+	"github.com/scionproto/scion/go/lib/infra/messenger"
+	"github.com/scionproto/scion/go/lib/infra/middleware"
+	"github.com/scionproto/scion/go/lib/infra/transport"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/sciond/conf"
+)
+
+const (
+	DefaultAPIPath = "/run/shm/sciond/default.sock"
+	// reqTimeout bounds the handling of a single message received from the infrastructure.
+	reqTimeout = 5 * time.Second
+	// reqRate and reqBurst limit the messages handled per second for each peer.
+	reqRate  = 50
+	reqBurst = 100
+	// maxHandlers is the maximum number of concurrently handled messages of each type.
+	maxHandlers = 16
+)
+
+var (
+	id      = flag.String("id", "", "Element ID (Required. E.g. 'sd1-10')")
+	apiPath = flag.String("api", DefaultAPIPath, "SCIOND API socket path")
+	ip      = flag.String("addr", "127.0.0.1",
+		"Local IP address used to communicate with the infrastructure services")
+	dispPath = flag.String("dispatcher", "/run/shm/dispatcher/default.sock",
+		"SCION Dispatcher path")
+	confDir  = flag.String("confd", "", "Configuration directory (Required)")
+	cacheDir = flag.String("cached", "gen-cache", "Caching directory")
+	pathDB   = flag.String("pathdb", "", "Path database file (Defaults to cached/<id>.path.db)")
+	config   *conf.Conf
+)
+
+// main initializes the SCION daemon and serves API requests.
+func main() {
+	flag.Parse()
+	if *id == "" {
+		log.Crit("No element ID specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+	liblog.Setup(*id)
+	defer liblog.LogPanicAndExit()
+	setupSignals()
+	var err error
+	if err = checkFlags(); err != nil {
+		fatal(err.Error())
+	}
+	if config, err = conf.Load(*id, *confDir, *cacheDir, *pathDB, *ip); err != nil {
+		fatal(err.Error())
+	}
+	// SCIOND only talks to the local infrastructure services, so no path resolver is needed.
+	network := snet.NewNetworkBasic(config.PublicAddr.IA, *apiPath, *dispPath)
+	conn, err := network.ListenSCION("udp4", config.PublicAddr)
+	if err != nil {
+		fatal("Unable to listen on SCION", "err", err)
+	}
+	dispatcher := disp.New(transport.NewUDP(conn), messenger.DefaultAdapter, log.Root())
+	msger := messenger.New(dispatcher, config.Store, log.Root())
+	if err = config.Store.StartResolvers(msger); err != nil {
+		fatal("Unable to start trust store resolvers", "err", err)
+	}
+	msger.Use(
+		middleware.Log(log.Root()),
+		middleware.Recover(log.Root()),
+		middleware.RateLimit(reqRate, reqBurst),
+		middleware.Timeout(reqTimeout, nil),
+		middleware.ConcurrencyLimit(maxHandlers, nil),
+	)
+	go func() {
+		defer liblog.LogPanicAndExit()
+		msger.ListenAndServe()
+	}()
+	if err = os.MkdirAll(filepath.Dir(*apiPath), 0755); err != nil {
+		fatal("Unable to create API socket directory", "err", err)
+	}
+	// Remove a stale socket of a previous run.
+	os.Remove(*apiPath)
+	api, err := NewAPIServer(*apiPath, msger)
+	if err != nil {
+		fatal("Unable to listen on API socket", "path", *apiPath, "err", err)
+	}
+	log.Info("Serving SCIOND API", "path", *apiPath)
+	if err = api.Serve(); err != nil {
+		fatal("API server failed", "err", err)
+	}
+}
+
+// checkFlags checks that all required flags are set.
+func checkFlags() error {
+	if *confDir == "" {
+		flag.Usage()
+		return common.NewBasicError("No configuration directory specified", nil)
+	}
+	return nil
+}
+
+// setupSignals handle signals.
+func setupSignals() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		log.Info("Received signal, exiting...", "signal", s)
+		os.Remove(*apiPath)
+		liblog.Flush()
+		os.Exit(1)
+	}()
+}
+
+func fatal(msg string, args ...interface{}) {
+	log.Crit(msg, args...)
+	liblog.Flush()
+	os.Exit(1)
+}
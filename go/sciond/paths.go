@@ -0,0 +1,319 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/ctrl/path_mgmt"
+	"github.com/scionproto/scion/go/lib/ctrl/seg"
+	"github.com/scionproto/scion/go/lib/infra"
+	"github.com/scionproto/scion/go/lib/pathdb/query"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	// pathReqTimeout bounds the time spent answering a path request, including the segment
+	// request to the local path server.
+	pathReqTimeout = 2 * time.Second
+	// maxPathCacheTTL is the maximum time combined paths are cached. Cached paths are also
+	// dropped once their first segment expires, and on revocations.
+	maxPathCacheTTL = 5 * time.Minute
+)
+
+// pathCache maps destination ISD-ASes to the paths combined for them.
+var pathCache = cache.New(maxPathCacheTTL, time.Minute)
+
+// getPaths answers a path request. Paths are combined from the segments in the path database.
+// If there are none, the segments are requested from the local path server first.
+func getPaths(ctx context.Context, msger infra.Messenger, req *sciond.PathReq) sciond.PathReply {
+	dst := req.Dst.IA()
+	log.Debug("Paths requested", "dst", dst, "flags", req.Flags)
+	if req.Flags.Sibra {
+		log.Warn("Requesting SIBRA paths is not supported", "dst", dst)
+		return sciond.PathReply{ErrorCode: sciond.ErrorInternal}
+	}
+	if req.Flags.Flush {
+		pathCache.Flush()
+	}
+	local := config.Topo.ISD_AS
+	if local.Eq(dst) || (dst.I == local.I && dst.A == 0 && config.Topo.Core) {
+		// Either the destination is the local AS, or any core AS of the local ISD and the
+		// local AS is a core AS.
+		entry := sciond.PathReplyEntry{Path: sciond.FwdPathMeta{Mtu: uint16(config.Topo.MTU)}}
+		return sciond.PathReply{Entries: []sciond.PathReplyEntry{entry}}
+	}
+	var paths []*combPath
+	if cached, ok := pathCache.Get(dst.String()); ok {
+		paths = cached.([]*combPath)
+	} else {
+		var err error
+		if paths, err = resolve(dst); err == nil && len(paths) == 0 {
+			if err = fetchSegs(ctx, msger, dst); err == nil {
+				paths, err = resolve(dst)
+			}
+		}
+		if err != nil {
+			log.Error("Unable to get paths", "dst", dst, "err", err)
+			if ctx.Err() == context.DeadlineExceeded {
+				return sciond.PathReply{ErrorCode: sciond.ErrorPSTimeout}
+			}
+			return sciond.PathReply{ErrorCode: sciond.ErrorInternal}
+		}
+		if len(paths) == 0 {
+			return sciond.PathReply{ErrorCode: sciond.ErrorNoPaths}
+		}
+		cachePaths(dst, paths)
+	}
+	if req.MaxPaths > 0 && len(paths) > int(req.MaxPaths) {
+		paths = paths[:req.MaxPaths]
+	}
+	reply := sciond.PathReply{}
+	for _, p := range paths {
+		entry := sciond.PathReplyEntry{Path: p.meta}
+		if ifaces := p.meta.Interfaces; len(ifaces) > 0 {
+			info, ok := config.Topo.IFInfoMap[common.IFIDType(ifaces[0].IfID)]
+			if !ok {
+				log.Warn("Unknown first hop interface", "path", p.meta)
+				continue
+			}
+			entry.HostInfo = *brHostInfo(info)
+		}
+		reply.Entries = append(reply.Entries, entry)
+	}
+	return reply
+}
+
+// cachePaths caches the paths to dst until the first of them expires.
+func cachePaths(dst *addr.ISD_AS, paths []*combPath) {
+	ttl := maxPathCacheTTL
+	for _, p := range paths {
+		if t := time.Until(p.expiry); t < ttl {
+			ttl = t
+		}
+	}
+	if ttl > 0 {
+		pathCache.Set(dst.String(), paths, ttl)
+	}
+}
+
+// resolve combines the unexpired segments in the path database into paths to dst, sorted by
+// length.
+func resolve(dst *addr.ISD_AS) ([]*combPath, error) {
+	local := config.Topo.ISD_AS
+	dstCore := dst.A == 0 || config.IsCore(dst)
+	var combs [][3]*seg.PathSegment
+	switch {
+	case config.Topo.Core && dstCore:
+		cores, err := getSegs(seg.CoreSegment, startsAt(dst), []*addr.ISD_AS{local})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range filterISD(cores, dst) {
+			combs = append(combs, [3]*seg.PathSegment{nil, c, nil})
+		}
+	case config.Topo.Core:
+		downs, err := getSegs(seg.DownSegment, nil, []*addr.ISD_AS{dst})
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range downs {
+			if d.ASEntries[0].IA().Eq(local) {
+				combs = append(combs, [3]*seg.PathSegment{nil, nil, d})
+				continue
+			}
+			cores, err := getSegs(seg.CoreSegment, []*addr.ISD_AS{d.ASEntries[0].IA()},
+				[]*addr.ISD_AS{local})
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range cores {
+				combs = append(combs, [3]*seg.PathSegment{nil, c, d})
+			}
+		}
+	default:
+		ups, err := getSegs(seg.UpSegment, nil, []*addr.ISD_AS{local})
+		if err != nil {
+			return nil, err
+		}
+		var downs []*seg.PathSegment
+		if !dstCore {
+			if downs, err = getSegs(seg.DownSegment, nil, []*addr.ISD_AS{dst}); err != nil {
+				return nil, err
+			}
+		}
+		for _, u := range ups {
+			upStart := u.ASEntries[0].IA()
+			if dstCore {
+				if dst.I == upStart.I && (dst.A == 0 || dst.Eq(upStart)) {
+					combs = append(combs, [3]*seg.PathSegment{u, nil, nil})
+				}
+				cores, err := getSegs(seg.CoreSegment, startsAt(dst), []*addr.ISD_AS{upStart})
+				if err != nil {
+					return nil, err
+				}
+				for _, c := range filterISD(cores, dst) {
+					combs = append(combs, [3]*seg.PathSegment{u, c, nil})
+				}
+				continue
+			}
+			for _, d := range downs {
+				downStart := d.ASEntries[0].IA()
+				if downStart.Eq(upStart) {
+					combs = append(combs, [3]*seg.PathSegment{u, nil, d})
+					continue
+				}
+				cores, err := getSegs(seg.CoreSegment, []*addr.ISD_AS{downStart},
+					[]*addr.ISD_AS{upStart})
+				if err != nil {
+					return nil, err
+				}
+				for _, c := range cores {
+					combs = append(combs, [3]*seg.PathSegment{u, c, d})
+				}
+			}
+		}
+	}
+	var paths []*combPath
+	for _, c := range combs {
+		p, err := combine(c[0], c[1], c[2])
+		if err != nil {
+			log.Warn("Unable to combine segments", "err", err)
+			continue
+		}
+		if p != nil {
+			paths = append(paths, p)
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i].meta.Interfaces) < len(paths[j].meta.Interfaces)
+	})
+	return paths, nil
+}
+
+// startsAt returns the StartsAt query parameter for segments starting at dst. A wildcard AS
+// matches all ASes, filterISD has to be used on the result.
+func startsAt(dst *addr.ISD_AS) []*addr.ISD_AS {
+	if dst.A == 0 {
+		return nil
+	}
+	return []*addr.ISD_AS{dst}
+}
+
+// filterISD returns the segments in segs starting in the ISD of dst.
+func filterISD(segs []*seg.PathSegment, dst *addr.ISD_AS) []*seg.PathSegment {
+	var res []*seg.PathSegment
+	for _, s := range segs {
+		if s.ASEntries[0].IA().I == dst.I {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// getSegs returns the unexpired segments of type t in the path database, which start at one
+// of startsAt and end at one of endsAt. Empty lists match all ASes.
+func getSegs(t seg.Type, startsAt, endsAt []*addr.ISD_AS) ([]*seg.PathSegment, error) {
+	res, err := config.PathDB.Get(&query.Params{
+		SegTypes: []seg.Type{t},
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var segs []*seg.PathSegment
+	for _, r := range res {
+		if exp, err := r.Seg.Expiry(); err == nil && now.Before(exp) {
+			segs = append(segs, r.Seg)
+		}
+	}
+	return segs, nil
+}
+
+// fetchSegs requests the segments to dst from the local path server. The segments in the reply
+// are verified and added to the path database.
+func fetchSegs(ctx context.Context, msger infra.Messenger, dst *addr.ISD_AS) error {
+	ps := &snet.Addr{IA: config.Topo.ISD_AS, Host: addr.SvcPS}
+	req := &path_mgmt.SegReq{RawSrcIA: config.Topo.ISD_AS.IAInt(), RawDstIA: dst.IAInt()}
+	log.Debug("Requesting segments", "req", req, "addr", ps)
+	reply, err := msger.GetPaths(ctx, req, ps, 0)
+	if err != nil {
+		return err
+	}
+	if reply.Recs == nil {
+		return nil
+	}
+	for _, m := range reply.Recs.Recs {
+		pseg := &m.Segment
+		if err := pseg.ParseRaw(); err != nil {
+			log.Warn("Dropping invalid path segment", "err", err)
+			continue
+		}
+		if err := config.Store.VerifySegment(ctx, pseg, ps); err != nil {
+			log.Warn("Dropping unverifiable path segment", "seg", pseg, "err", err)
+			continue
+		}
+		if _, err := config.PathDB.Insert(pseg, []seg.Type{m.Type}); err != nil {
+			log.Error("Unable to insert path segment", "seg", pseg, "err", err)
+		}
+	}
+	for _, rev := range reply.Recs.RevInfos {
+		processRev(rev)
+	}
+	return nil
+}
+
+// processRev removes the path segments containing the revoked interface from the path
+// database, and drops all cached paths. The hash tree proof of the revocation is verified
+// against the hash tree roots in the AS entries of the stored path segments containing the
+// interface. If no such segment is stored, the revocation cannot be verified and is ignored.
+func processRev(rev *path_mgmt.RevInfo) sciond.RevResult {
+	if rev == nil {
+		return sciond.RevInvalid
+	}
+	if !crypto.VerifyHashTreeEpoch(rev.Epoch) {
+		log.Debug("Ignoring revocation with expired epoch", "rev", rev)
+		return sciond.RevStale
+	}
+	if err := config.PathDB.VerifyRev(rev); err != nil {
+		switch common.GetErrorMsg(err) {
+		case path_mgmt.ErrInvalidProof, path_mgmt.ErrUnknownHashType,
+			path_mgmt.ErrInvalidTreeTTL:
+			log.Warn("Ignoring invalid revocation", "rev", rev, "err", err)
+			return sciond.RevInvalid
+		}
+		log.Debug("Ignoring unverifiable revocation", "rev", rev, "err", err)
+		return sciond.RevUnknown
+	}
+	n, err := config.PathDB.DeleteWithIntf(query.IntfSpec{IA: rev.IA(), IfID: rev.IfID})
+	if err != nil {
+		log.Error("Unable to remove revoked path segments", "rev", rev, "err", err)
+		return sciond.RevUnknown
+	}
+	log.Debug("Processed revocation", "rev", rev, "removed", n)
+	pathCache.Flush()
+	return sciond.RevValid
+}
@@ -0,0 +1,347 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements a local HTTP/JSON API to inspect and change the state
+// of the SIG at runtime.
+//
+// The following requests are supported:
+//
+//	GET    /sig/ases                     List remote ASes with their nets, SIGs and session.
+//	GET    /sig/ases/<ia>                Show a remote AS.
+//	PUT    /sig/ases/<ia>                Add a remote AS.
+//	DELETE /sig/ases/<ia>                Remove a remote AS.
+//	POST   /sig/ases/<ia>/nets           Add a net, e.g. {"Net": "10.0.0.0/8"}.
+//	DELETE /sig/ases/<ia>/nets?net=<net> Remove a net.
+//	PUT    /sig/ases/<ia>/sigs/<id>      Add or update a remote SIG, e.g. {"Addr": "10.0.0.1"}.
+//	                                     CtrlPort and EncapPort default to the standard ports.
+//	DELETE /sig/ases/<ia>/sigs/<id>      Remove a remote SIG.
+//	GET    /sig/ingress                  List ingress workers and their reassembly lists.
+//
+// The API is not authenticated, it is thus only served on loopback addresses
+// or UNIX sockets (e.g. -api unix:/run/shm/sig/api.sock). To prevent web pages
+// from using browsers on the host to access the API (e.g. by cross-site
+// requests or DNS rebinding), requests must address the API by a loopback IP
+// address or localhost, requests from web pages must have a loopback origin,
+// and request bodies must be of type application/json.
+//
+// Changes made through the API are not persisted, and are partially reverted
+// when the config file is reloaded on SIGHUP: ASes and nets that are not in
+// the config file are removed, whereas SIGs added through the API are kept
+// (like SIGs from discovery).
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/sig/base"
+	"github.com/scionproto/scion/go/sig/ingress"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+const (
+	prefix = "/sig/"
+	// unixPrefix marks API addresses that are UNIX socket paths.
+	unixPrefix = "unix:"
+)
+
+const (
+	ErrorNotLoopback = "API address is not a loopback address"
+)
+
+var apiAddr = flag.String("api", "",
+	"Loopback address or UNIX socket to serve the status and control API on "+
+		"(e.g. 127.0.0.1:1282 or unix:/run/shm/sig/api.sock, disabled if empty). "+
+		"Changes made through the API are partially reverted on SIGHUP")
+
+// Start serves the API on the address specified by the -api flag, if any.
+func Start() error {
+	if *apiAddr == "" {
+		return nil
+	}
+	ln, err := listen(*apiAddr)
+	if err != nil {
+		return common.NewBasicError("Unable to bind API address", err)
+	}
+	log.Info("Serving status and control API", "addr", *apiAddr)
+	go func() {
+		defer liblog.LogPanicAndExit()
+		if err := http.Serve(ln, NewHandler()); err != nil {
+			log.Error("Serving API failed", "err", err)
+		}
+	}()
+	return nil
+}
+
+// listen listens on a, which is either a UNIX socket path prefixed with
+// unixPrefix, or a TCP address with a loopback IP.
+func listen(a string) (net.Listener, error) {
+	if strings.HasPrefix(a, unixPrefix) {
+		path := strings.TrimPrefix(a, unixPrefix)
+		// Remove a stale socket left behind by a previous run.
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+	host, _, err := net.SplitHostPort(a)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return nil, common.NewBasicError(ErrorNotLoopback, nil, "addr", a)
+	}
+	return net.Listen("tcp", a)
+}
+
+// NewHandler returns the handler for the API.
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix, handle)
+	return mux
+}
+
+// SigReq is the body of a request to add or update a remote SIG.
+type SigReq struct {
+	Addr      net.IP
+	CtrlPort  int
+	EncapPort int
+}
+
+// NetReq is the body of a request to add a net.
+type NetReq struct {
+	Net string
+}
+
+// Error is the body of the reply to a failed request.
+type Error struct {
+	Error string
+}
+
+// httpError is an error with the corresponding HTTP status code.
+type httpError struct {
+	code int
+	err  error
+}
+
+func newHTTPError(code int, msg string, err error, logCtx ...interface{}) *httpError {
+	return &httpError{code: code, err: common.NewBasicError(msg, err, logCtx...)}
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+	var result interface{}
+	herr := checkOrigin(r)
+	switch {
+	case herr != nil:
+	case len(parts) == 1 && parts[0] == "ingress":
+		if herr = checkMethod(r, http.MethodGet); herr == nil {
+			result = ingress.Workers()
+		}
+	case len(parts) == 1 && parts[0] == "ases":
+		if herr = checkMethod(r, http.MethodGet); herr == nil {
+			result = base.Map.Status()
+		}
+	case len(parts) >= 2 && parts[0] == "ases":
+		result, herr = handleAS(r, parts[1], parts[2:])
+	default:
+		herr = newHTTPError(http.StatusNotFound, "Unknown resource", nil, "path", r.URL.Path)
+	}
+	if herr != nil {
+		log.Debug("API request failed", "method", r.Method, "path", r.URL.Path,
+			"err", herr.err)
+		reply(w, herr.code, &Error{Error: herr.err.Error()})
+		return
+	}
+	reply(w, http.StatusOK, result)
+}
+
+func handleAS(r *http.Request, iaStr string, parts []string) (interface{}, *httpError) {
+	ia, err := addr.IAFromString(iaStr)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "Unable to parse IA", err, "ia", iaStr)
+	}
+	if len(parts) == 0 {
+		switch r.Method {
+		case http.MethodPut:
+			ae, err := base.Map.AddIA(ia)
+			if err != nil {
+				return nil, newHTTPError(http.StatusBadRequest, "Unable to add IA", err)
+			}
+			return ae.Status(), nil
+		case http.MethodDelete:
+			if base.Map.ASEntry(ia) == nil {
+				return nil, newHTTPError(http.StatusNotFound, "Unknown IA", nil, "ia", ia)
+			}
+			if err := base.Map.DelIA(ia); err != nil {
+				return nil, newHTTPError(http.StatusInternalServerError,
+					"Unable to delete IA", err)
+			}
+			return nil, nil
+		}
+	}
+	ae := base.Map.ASEntry(ia)
+	if ae == nil {
+		return nil, newHTTPError(http.StatusNotFound, "Unknown IA", nil, "ia", ia)
+	}
+	switch {
+	case len(parts) == 0:
+		if herr := checkMethod(r, http.MethodGet); herr != nil {
+			return nil, herr
+		}
+		return ae.Status(), nil
+	case len(parts) == 1 && parts[0] == "nets":
+		return handleNets(r, ae)
+	case len(parts) == 2 && parts[0] == "sigs":
+		return handleSig(r, ae, siginfo.SigIdType(parts[1]))
+	}
+	return nil, newHTTPError(http.StatusNotFound, "Unknown resource", nil, "path", r.URL.Path)
+}
+
+func handleNets(r *http.Request, ae *base.ASEntry) (interface{}, *httpError) {
+	if herr := checkMethod(r, http.MethodPost, http.MethodDelete); herr != nil {
+		return nil, herr
+	}
+	var netStr string
+	if r.Method == http.MethodPost {
+		req := &NetReq{}
+		if herr := decode(r, req); herr != nil {
+			return nil, herr
+		}
+		netStr = req.Net
+	} else {
+		netStr = r.URL.Query().Get("net")
+	}
+	_, ipnet, err := net.ParseCIDR(netStr)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "Unable to parse net", err,
+			"net", netStr)
+	}
+	if r.Method == http.MethodPost {
+		err = ae.AddNet(ipnet)
+	} else {
+		err = ae.DelNet(ipnet)
+	}
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "Unable to change net", err)
+	}
+	return ae.Status(), nil
+}
+
+func handleSig(r *http.Request, ae *base.ASEntry, id siginfo.SigIdType) (interface{},
+	*httpError) {
+	if herr := checkMethod(r, http.MethodPut, http.MethodDelete); herr != nil {
+		return nil, herr
+	}
+	if r.Method == http.MethodDelete {
+		if err := ae.DelSig(id); err != nil {
+			return nil, newHTTPError(http.StatusNotFound, "Unable to delete SIG", err)
+		}
+		return ae.Status(), nil
+	}
+	req := &SigReq{CtrlPort: sigcmn.DefaultCtrlPort, EncapPort: sigcmn.DefaultEncapPort}
+	if herr := decode(r, req); herr != nil {
+		return nil, herr
+	}
+	// SIGs added through the API are not static, so that they are not removed
+	// when the config file is reloaded.
+	if err := ae.AddSig(id, req.Addr, req.CtrlPort, req.EncapPort, false); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "Unable to add SIG", err)
+	}
+	return ae.Status(), nil
+}
+
+// checkOrigin rejects requests that do not address the API by a loopback
+// address, and requests from web pages that were not loaded from one.
+func checkOrigin(r *http.Request) *httpError {
+	if !isLoopback(r.Host) {
+		return newHTTPError(http.StatusForbidden, "Host is not a loopback address", nil,
+			"host", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !isLoopback(u.Host) {
+			return newHTTPError(http.StatusForbidden, "Origin is not a loopback address", nil,
+				"origin", origin)
+		}
+	}
+	return nil
+}
+
+// isLoopback returns true if host, with an optional port, is a loopback IP
+// address or localhost.
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func checkMethod(r *http.Request, methods ...string) *httpError {
+	for _, m := range methods {
+		if r.Method == m {
+			return nil
+		}
+	}
+	return newHTTPError(http.StatusMethodNotAllowed, "Method not allowed", nil,
+		"method", r.Method, "allowed", methods)
+}
+
+func decode(r *http.Request, v interface{}) *httpError {
+	ct := r.Header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(ct); err != nil || mt != "application/json" {
+		return newHTTPError(http.StatusUnsupportedMediaType,
+			"Request body is not of type application/json", err, "type", ct)
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newHTTPError(http.StatusBadRequest, "Unable to parse request body", err)
+	}
+	return nil
+}
+
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if v == nil {
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Error("Unable to write API reply", "err", err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+)
+
+// doReq sends a request to the handler, as sent by a local client. hdrs are
+// pairs of header names and values overriding the defaults, "Host" sets the
+// request host.
+func doReq(method, path, body string, hdrs ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Host = "127.0.0.1:1282"
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		if hdrs[i] == "Host" {
+			req.Host = hdrs[i+1]
+		} else {
+			req.Header.Set(hdrs[i], hdrs[i+1])
+		}
+	}
+	rec := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	Convey("Listing ASes without any configured returns an empty list", t, func() {
+		rec := doReq(http.MethodGet, "/sig/ases", "")
+		SoMsg("code", rec.Code, ShouldEqual, http.StatusOK)
+		var ases []interface{}
+		SoMsg("err", json.Unmarshal(rec.Body.Bytes(), &ases), ShouldBeNil)
+		SoMsg("ases", ases, ShouldBeEmpty)
+	})
+	Convey("Listing ingress workers without any running returns an empty list", t, func() {
+		rec := doReq(http.MethodGet, "/sig/ingress", "")
+		SoMsg("code", rec.Code, ShouldEqual, http.StatusOK)
+		SoMsg("body", strings.TrimSpace(rec.Body.String()), ShouldEqual, "[]")
+	})
+	Convey("Errors are returned with the corresponding status code", t, func() {
+		tests := []struct {
+			desc   string
+			method string
+			path   string
+			code   int
+		}{
+			{"Unknown resource", http.MethodGet, "/sig/foo", http.StatusNotFound},
+			{"Invalid method", http.MethodPost, "/sig/ases", http.StatusMethodNotAllowed},
+			{"Invalid IA", http.MethodGet, "/sig/ases/foo", http.StatusBadRequest},
+			{"Unknown IA", http.MethodGet, "/sig/ases/1-10", http.StatusNotFound},
+			{"Delete unknown IA", http.MethodDelete, "/sig/ases/1-10", http.StatusNotFound},
+			{"Net of unknown IA", http.MethodDelete, "/sig/ases/1-10/nets?net=10.0.0.0/8",
+				http.StatusNotFound},
+			{"Wildcard IA", http.MethodPut, "/sig/ases/0-10", http.StatusBadRequest},
+		}
+		for _, test := range tests {
+			Convey(test.desc, func() {
+				rec := doReq(test.method, test.path, "")
+				SoMsg("code", rec.Code, ShouldEqual, test.code)
+				e := &Error{}
+				SoMsg("err", json.Unmarshal(rec.Body.Bytes(), e), ShouldBeNil)
+				SoMsg("msg", e.Error, ShouldNotBeEmpty)
+			})
+		}
+	})
+}
+
+func TestCheckOrigin(t *testing.T) {
+	Convey("Requests addressing the API by a loopback address are accepted", t, func() {
+		for _, host := range []string{"127.0.0.1:1282", "[::1]:1282", "localhost:1282",
+			"localhost", "127.0.0.1"} {
+			rec := doReq(http.MethodGet, "/sig/ases", "", "Host", host)
+			SoMsg(host, rec.Code, ShouldEqual, http.StatusOK)
+		}
+	})
+	Convey("Requests addressing the API by another name are rejected", t, func() {
+		for _, host := range []string{"attacker.example:1282", "192.0.2.1:1282", ""} {
+			rec := doReq(http.MethodGet, "/sig/ases", "", "Host", host)
+			SoMsg(host, rec.Code, ShouldEqual, http.StatusForbidden)
+		}
+	})
+	Convey("Requests from web pages are only accepted from loopback origins", t, func() {
+		rec := doReq(http.MethodGet, "/sig/ases", "", "Origin", "http://127.0.0.1:8080")
+		SoMsg("loopback", rec.Code, ShouldEqual, http.StatusOK)
+		rec = doReq(http.MethodDelete, "/sig/ases/1-10", "", "Origin", "http://attacker.example")
+		SoMsg("other", rec.Code, ShouldEqual, http.StatusForbidden)
+	})
+	Convey("Request bodies must be of type application/json", t, func() {
+		for ct, code := range map[string]int{
+			"text/plain":                      http.StatusUnsupportedMediaType,
+			"":                                http.StatusUnsupportedMediaType,
+			"application/json; charset=utf-8": 0,
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/sig/ases/1-10/nets",
+				strings.NewReader(`{"Net":"0.0.0.0/0"}`))
+			req.Header.Set("Content-Type", ct)
+			nr := &NetReq{}
+			herr := decode(req, nr)
+			if code == 0 {
+				SoMsg(ct, herr, ShouldBeNil)
+				SoMsg("net", nr.Net, ShouldEqual, "0.0.0.0/0")
+			} else {
+				SoMsg(ct, herr, ShouldNotBeNil)
+				SoMsg(ct+" code", herr.code, ShouldEqual, code)
+			}
+		}
+	})
+}
+
+func TestListen(t *testing.T) {
+	Convey("Loopback addresses are accepted", t, func() {
+		for _, a := range []string{"127.0.0.1:0", "[::1]:0"} {
+			ln, err := listen(a)
+			SoMsg(a, err, ShouldBeNil)
+			if ln != nil {
+				ln.Close()
+			}
+		}
+	})
+	Convey("Other addresses are rejected", t, func() {
+		for _, a := range []string{"0.0.0.0:0", "[::]:0", "192.0.2.1:0", ":0"} {
+			_, err := listen(a)
+			SoMsg(a, common.GetErrorMsg(err), ShouldEqual, ErrorNotLoopback)
+		}
+		_, err := listen("localhost")
+		SoMsg("no port", err, ShouldNotBeNil)
+	})
+	Convey("UNIX sockets are only accessible by the owner", t, func() {
+		dir, err := ioutil.TempDir("", "sig_api")
+		SoMsg("tmpdir", err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "api.sock")
+		ln, err := listen(unixPrefix + path)
+		SoMsg("err", err, ShouldBeNil)
+		fi, err := os.Stat(path)
+		SoMsg("stat", err, ShouldBeNil)
+		SoMsg("mode", fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		Convey("A stale socket is replaced", func() {
+			ln.(*net.UnixListener).SetUnlinkOnClose(false)
+			ln.Close()
+			ln, err = listen(unixPrefix + path)
+			SoMsg("err", err, ShouldBeNil)
+		})
+		ln.Close()
+	})
+}
+
+func TestMain(m *testing.M) {
+	l := log.Root()
+	l.SetHandler(log.DiscardHandler())
+	os.Exit(m.Run())
+}
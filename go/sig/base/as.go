@@ -16,13 +16,11 @@ package base
 
 import (
 	"fmt"
-	"io"
 	"net"
 	"sync"
 	"time"
 
 	log "github.com/inconshreveable/log15"
-	"github.com/vishvananda/netlink"
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
@@ -45,8 +43,7 @@ type ASEntry struct {
 	IAString   string
 	Session    *egress.Session
 	DevName    string
-	tunLink    netlink.Link
-	tunIO      io.ReadWriteCloser
+	tun        xnet.Tun
 	sigMgrStop chan struct{}
 	log.Logger
 }
@@ -71,6 +68,8 @@ func newASEntry(ia *addr.ISD_AS) (*ASEntry, error) {
 func (ae *ASEntry) ReloadConfig(cfg *config.ASEntry) bool {
 	ae.Lock()
 	defer ae.Unlock()
+	ae.Session.SetFECGroup(cfg.FECGroup)
+	ae.Session.SetMultipath(cfg.Multipath)
 	// Method calls first to prevent skips due to logical short-circuit
 	s := ae.addNewSIGS(cfg.Sigs)
 	s = ae.delOldSIGS(cfg.Sigs) && s
@@ -118,7 +117,7 @@ func (ae *ASEntry) AddNet(ipnet *net.IPNet) error {
 }
 
 func (ae *ASEntry) addNet(ipnet *net.IPNet) error {
-	if ae.tunLink == nil {
+	if ae.tun == nil {
 		// Ensure that the network setup is done, as otherwise route entries can't be added.
 		if err := ae.setupNet(); err != nil {
 			return err
@@ -128,7 +127,7 @@ func (ae *ASEntry) addNet(ipnet *net.IPNet) error {
 	if _, ok := ae.Nets[key]; ok {
 		return nil
 	}
-	ne, err := newNetEntry(ae.tunLink, ipnet)
+	ne, err := newNetEntry(ae.tun, ipnet)
 	if err != nil {
 		return err
 	}
@@ -149,7 +148,6 @@ func (ae *ASEntry) delNet(ipnet *net.IPNet) error {
 	key := ipnet.String()
 	ne, ok := ae.Nets[key]
 	if !ok {
-		ae.Unlock()
 		return common.NewBasicError("DelNet: no network found", nil, "ia", ae.IA, "net", ipnet)
 	}
 	delete(ae.Nets, key)
@@ -269,15 +267,15 @@ func (ae *ASEntry) Cleanup() error {
 	// Clean up sigMgr goroutine.
 	ae.sigMgrStop <- struct{}{}
 	// Clean up the egress dispatcher.
-	if err := ae.tunIO.Close(); err != nil {
+	if err := ae.tun.Close(); err != nil {
 		ae.Error("Error closing TUN io", "dev", ae.DevName, "err", err)
 	}
 	// Clean up sessions, and associated workers.
 	ae.cleanSessions()
-	// The operating system also removes the routes when deleting the link.
-	if err := netlink.LinkDel(ae.tunLink); err != nil {
+	// Deleting the device also removes the routes.
+	if err := ae.tun.Delete(); err != nil {
 		// Only return this error, as it's the only critical one.
-		return common.NewBasicError("Error removing TUN link", err,
+		return common.NewBasicError("Error removing TUN device", err,
 			"ia", ae.IA, "dev", ae.DevName)
 	}
 	return nil
@@ -291,12 +289,12 @@ func (ae *ASEntry) cleanSessions() {
 
 func (ae *ASEntry) setupNet() error {
 	var err error
-	ae.tunLink, ae.tunIO, err = xnet.ConnectTun(ae.DevName)
+	ae.tun, err = xnet.Provider.ConnectTun(ae.DevName)
 	if err != nil {
 		return err
 	}
 	ae.Info("Network setup done")
-	go egress.NewDispatcher(ae.DevName, ae.tunIO, ae.Session).Run()
+	go egress.NewDispatcher(ae.DevName, ae.tun, ae.Session).Run()
 	go ae.sigMgr()
 	ae.Session.Start()
 	return nil
@@ -27,7 +27,12 @@ import (
 
 var Map = newASMap()
 
-// ASMap is not concurrency safe against multiple writers.
+// writeLock serializes changes to the ASMap, which are made both when the config
+// is reloaded and through the status API.
+var writeLock sync.Mutex
+
+// ASMap is safe for concurrent use, as long as it is only modified through
+// ReloadConfig, AddIA and DelIA.
 type ASMap sync.Map
 
 func newASMap() *ASMap {
@@ -65,6 +70,8 @@ func (am *ASMap) Range(f func(key addr.IAInt, value *ASEntry) bool) {
 }
 
 func (am *ASMap) ReloadConfig(cfg *config.Cfg) bool {
+	writeLock.Lock()
+	defer writeLock.Unlock()
 	// Method calls first to prevent skips due to logical short-circuit
 	s := am.addNewIAs(cfg)
 	return am.delOldIAs(cfg) && s
@@ -76,7 +83,7 @@ func (am *ASMap) addNewIAs(cfg *config.Cfg) bool {
 	for iaVal, cfgEntry := range cfg.ASes {
 		ia := iaVal.Copy()
 		log.Info("ReloadConfig: Adding AS...", "ia", ia)
-		ae, err := am.AddIA(ia)
+		ae, err := am.addIA(ia)
 		if err != nil {
 			log.Error("ReloadConfig: Adding AS failed", "err", err)
 			s = false
@@ -96,7 +103,7 @@ func (am *ASMap) delOldIAs(cfg *config.Cfg) bool {
 		if _, ok := cfg.ASes[*ia]; !ok {
 			log.Info("ReloadConfig: Deleting AS...", "ia", ia)
 			// Deletion also handles session/tun device cleanup
-			err := am.DelIA(ia)
+			err := am.delIA(ia)
 			if err != nil {
 				log.Error("ReloadConfig: Deleting AS failed", "err", err)
 				s = false
@@ -111,6 +118,12 @@ func (am *ASMap) delOldIAs(cfg *config.Cfg) bool {
 
 // AddIA idempotently adds an entry for a remote IA.
 func (am *ASMap) AddIA(ia *addr.ISD_AS) (*ASEntry, error) {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	return am.addIA(ia)
+}
+
+func (am *ASMap) addIA(ia *addr.ISD_AS) (*ASEntry, error) {
 	if ia.I == 0 || ia.A == 0 {
 		// A 0 for either ISD or AS indicates a wildcard, and not a specific ISD-AS.
 		return nil, common.NewBasicError("AddIA: ISD and AS must not be 0", nil, "ia", ia)
@@ -130,6 +143,12 @@ func (am *ASMap) AddIA(ia *addr.ISD_AS) (*ASEntry, error) {
 
 // DelIA removes an entry for a remote IA.
 func (am *ASMap) DelIA(ia *addr.ISD_AS) error {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	return am.delIA(ia)
+}
+
+func (am *ASMap) delIA(ia *addr.ISD_AS) error {
 	key := ia.IAInt()
 	ae, ok := am.Load(key)
 	if !ok {
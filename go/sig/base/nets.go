@@ -17,34 +17,23 @@ package base
 import (
 	"net"
 
-	"github.com/vishvananda/netlink"
-
-	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/sig/xnet"
 )
 
 type NetEntry struct {
-	Net   *net.IPNet
-	Route *netlink.Route
+	Net *net.IPNet
+	tun xnet.Tun
 }
 
-func newNetEntry(link netlink.Link, ipnet *net.IPNet) (*NetEntry, error) {
-	ne := &NetEntry{Net: ipnet, Route: xnet.NewRoute(link, ipnet)}
+func newNetEntry(tun xnet.Tun, ipnet *net.IPNet) (*NetEntry, error) {
+	ne := &NetEntry{Net: ipnet, tun: tun}
 	return ne, ne.setup()
 }
 
 func (ne *NetEntry) setup() error {
-	if err := netlink.RouteAdd(ne.Route); err != nil {
-		return common.NewBasicError("Unable to add route for remote network", err,
-			"route", ne.Route)
-	}
-	return nil
+	return ne.tun.AddRoute(ne.Net)
 }
 
 func (ne *NetEntry) Cleanup() error {
-	if err := netlink.RouteDel(ne.Route); err != nil {
-		return common.NewBasicError("Unable to delete route for remote network", err,
-			"route", ne.Route)
-	}
-	return nil
+	return ne.tun.DelRoute(ne.Net)
 }
@@ -37,7 +37,13 @@ func PollReqHdlr() {
 			continue
 		}
 		//log.Debug("PollReqHdlr: got PollReq", "src", rpld.Addr, "pld", req)
-		spld, err := mgmt.NewPld(rpld.Id, mgmt.NewPollRep(sigcmn.MgmtAddr, req.Session))
+		// Support FEC with up to MaxFECGroup frames per parity frame.
+		fecGroup := req.FecGroup
+		if fecGroup > sigcmn.MaxFECGroup {
+			fecGroup = sigcmn.MaxFECGroup
+		}
+		spld, err := mgmt.NewPld(rpld.Id,
+			mgmt.NewPollRep(sigcmn.MgmtAddr, req.Session, fecGroup))
 		if err != nil {
 			log.Error("PollReqHdlr: Error creating SIGCtrl payload", "err", err)
 			break
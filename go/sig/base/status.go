@@ -0,0 +1,80 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/sig/egress"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+// ASStatus is a snapshot of the state of an ASEntry.
+type ASStatus struct {
+	IA      string
+	DevName string
+	Nets    []string
+	Sigs    []*SigStatus
+	Session *egress.SessionStatus
+}
+
+// SigStatus is a snapshot of the state of a remote SIG.
+type SigStatus struct {
+	Id        siginfo.SigIdType
+	Addr      string
+	CtrlPort  int
+	EncapPort int
+	// Static is true if the SIG is from the config file.
+	Static    bool
+	FailCount uint16
+}
+
+// Status returns the status of all ASEntries, sorted by IA.
+func (am *ASMap) Status() []*ASStatus {
+	var keys []addr.IAInt
+	entries := make(map[addr.IAInt]*ASEntry)
+	am.Range(func(key addr.IAInt, ae *ASEntry) bool {
+		keys = append(keys, key)
+		entries[key] = ae
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	statuses := make([]*ASStatus, 0, len(keys))
+	for _, key := range keys {
+		statuses = append(statuses, entries[key].Status())
+	}
+	return statuses
+}
+
+// Status returns a snapshot of the entry's state.
+func (ae *ASEntry) Status() *ASStatus {
+	ae.RLock()
+	defer ae.RUnlock()
+	s := &ASStatus{IA: ae.IAString, DevName: ae.DevName, Session: ae.Session.Status()}
+	for key := range ae.Nets {
+		s.Nets = append(s.Nets, key)
+	}
+	sort.Strings(s.Nets)
+	ae.Sigs.Range(func(id siginfo.SigIdType, sig *siginfo.Sig) bool {
+		s.Sigs = append(s.Sigs, &SigStatus{
+			Id: id, Addr: sig.Host.String(), CtrlPort: sig.CtrlL4Port,
+			EncapPort: sig.EncapL4Port, Static: sig.Static, FailCount: sig.FailCount(),
+		})
+		return true
+	})
+	sort.Slice(s.Sigs, func(i, j int) bool { return s.Sigs[i].Id < s.Sigs[j].Id })
+	return s
+}
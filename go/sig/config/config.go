@@ -23,6 +23,7 @@ import (
 
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/sigcmn"
 	"github.com/scionproto/scion/go/sig/siginfo"
 )
 
@@ -55,7 +56,15 @@ func Parse(b common.RawBytes) (*Cfg, error) {
 		return nil, common.NewBasicError("Unable to parse SIG config", err)
 	}
 	// Populate IDs
-	for _, as := range cfg.ASes {
+	for ia, as := range cfg.ASes {
+		if as.FECGroup > sigcmn.MaxFECGroup {
+			return nil, common.NewBasicError("FEC group size too large", nil,
+				"ia", ia, "max", sigcmn.MaxFECGroup, "actual", as.FECGroup)
+		}
+		if as.Multipath > sigcmn.MaxMultipath {
+			return nil, common.NewBasicError("Too many multipath paths", nil,
+				"ia", ia, "max", sigcmn.MaxMultipath, "actual", as.Multipath)
+		}
 		for id := range as.Sigs {
 			sig := as.Sigs[id]
 			sig.Id = id
@@ -67,6 +76,14 @@ func Parse(b common.RawBytes) (*Cfg, error) {
 type ASEntry struct {
 	Nets []*IPNet
 	Sigs SIGSet
+	// FECGroup is the number of data frames per FEC parity frame sent to the
+	// remote AS. 0 (the default) disables FEC.
+	FECGroup uint8
+	// Multipath is the maximum number of paths to stripe frames across, weighted
+	// by their estimated capacity. 0 or 1 (the default) sends all frames on a
+	// single path. The remote SIG must be run with a reordering window (see the
+	// -reorderwindow flag) to reassemble striped frames.
+	Multipath uint8
 }
 
 // IPNet is custom type of net.IPNet, to allow custom unmarshalling.
@@ -0,0 +1,228 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/xtest/fakesciond"
+	"github.com/scionproto/scion/go/lib/xtest/p2p"
+	"github.com/scionproto/scion/go/sig/ingress"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/siginfo"
+	"github.com/scionproto/scion/go/sig/xnet/memtun"
+)
+
+const b2bTimeout = time.Second
+
+var (
+	localIA  = &addr.ISD_AS{I: 1, A: 10}
+	remoteIA = &addr.ISD_AS{I: 1, A: 11}
+)
+
+var _ sigcmn.DataConn = (*frameConn)(nil)
+
+// frameConn is a sigcmn.DataConn exchanging frames with its peer via a
+// p2p.Conn. The peer sees the local address as source of the frames. Frames
+// for which drop returns true are lost.
+type frameConn struct {
+	*p2p.Conn
+	local   *snet.Addr
+	mu      sync.Mutex
+	drop    func(raw common.RawBytes) bool
+	dropped int32
+}
+
+func (c *frameConn) ReadFromSCION(b []byte) (int, *snet.Addr, error) {
+	n, a, err := c.ReadFrom(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, a.(*snet.Addr), nil
+}
+
+func (c *frameConn) WriteToSCION(b []byte, raddr *snet.Addr) (int, error) {
+	c.mu.Lock()
+	drop := c.drop
+	c.mu.Unlock()
+	if drop != nil && drop(b) {
+		atomic.AddInt32(&c.dropped, 1)
+		return len(b), nil
+	}
+	return c.WriteTo(b, c.local)
+}
+
+func (c *frameConn) setDrop(drop func(raw common.RawBytes) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop = drop
+}
+
+// dropAfterParity returns a drop function that loses the n-th data frame sent
+// after the first FEC parity frame, i.e. once the remote SIG uses FEC.
+func dropAfterParity(n int) func(raw common.RawBytes) bool {
+	seenParity := false
+	cnt := 0
+	return func(raw common.RawBytes) bool {
+		if common.Order.Uint16(raw[6:8]) == sigcmn.FECParityIndex {
+			seenParity = true
+			return false
+		}
+		if !seenParity {
+			return false
+		}
+		cnt++
+		return cnt == n
+	}
+}
+
+// b2b connects the data plane of an egress session directly to an ingress
+// dispatcher, via a frameConn. It does not run two full SIGs: there is no
+// control plane, session monitoring or path selection, and the session uses a
+// single static path to a static remote SIG. Packets written to hostA are
+// encapsulated by the egress worker, and the decapsulated packets are received
+// from hostB.
+type b2b struct {
+	sess  *Session
+	conn  *frameConn
+	hostA io.ReadWriter
+	recvd chan common.RawBytes
+}
+
+func newB2B() *b2b {
+	sigcmn.IA = localIA
+	sigcmn.Host = addr.HostFromIP(net.IPv4(10, 0, 0, 1))
+	egressConn, ingressConn := p2p.New()
+	h := &b2b{
+		conn:  &frameConn{Conn: egressConn, local: sigcmn.EncapSnetAddr()},
+		recvd: make(chan common.RawBytes, memtun.PktBufferSize),
+	}
+	pathEntry := fakesciond.NewPathEntry(addr.HostFromIP(net.IPv4(10, 0, 0, 254)), 30041,
+		sciond.PathInterface{RawIsdas: localIA.IAInt(), IfID: 1},
+		sciond.PathInterface{RawIsdas: remoteIA.IAInt(), IfID: 2})
+	remoteSig := siginfo.NewSig(remoteIA, "remote", addr.HostFromIP(net.IPv4(10, 0, 1, 1)),
+		sigcmn.DefaultCtrlPort, sigcmn.DefaultEncapPort, true)
+	h.sess = &Session{
+		Logger:        log.Root(),
+		IA:            remoteIA,
+		pathMTUs:      newPathMTUs(),
+		conn:          h.conn,
+		workerStopped: make(chan struct{}),
+	}
+	h.sess.currRemote.Store(&RemoteInfo{
+		Sig: remoteSig, sessPath: newSessPath("path", &pathEntry)})
+	h.sess.healthy.Store(true)
+	h.sess.currStripe.Store((*stripe)(nil))
+	h.sess.ring = ringbuf.New(64, nil, "egress",
+		prometheus.Labels{"ringId": remoteIA.String(), "sessId": h.sess.SessId.String()})
+	p := memtun.New()
+	tunA, _ := p.ConnectTun("a")
+	tunB, _ := p.ConnectTun("b")
+	h.hostA = p.Tun("a").Host()
+	go NewDispatcher("a", tunA, h.sess).Run()
+	go NewWorker(h.sess, h.sess.Logger).Run()
+	go ingress.Serve(&frameConn{Conn: ingressConn, local: remoteSig.EncapSnetAddr()}, tunB)
+	go func() {
+		hostB := p.Tun("b").Host()
+		for {
+			b := make(common.RawBytes, 2*common.MaxMTU)
+			n, err := hostB.Read(b)
+			if err != nil {
+				return
+			}
+			h.recvd <- b[:n]
+		}
+	}()
+	return h
+}
+
+// send writes pkts to the host side of the egress TUN device.
+func (h *b2b) send(pkts []common.RawBytes) {
+	for _, pkt := range pkts {
+		h.hostA.Write(pkt)
+	}
+}
+
+// recv returns the packets received on the host side of the ingress TUN
+// device, until n packets were received or the timeout expires.
+func (h *b2b) recv(n int) []common.RawBytes {
+	var pkts []common.RawBytes
+	timeout := time.After(b2bTimeout)
+	for len(pkts) < n {
+		select {
+		case pkt := <-h.recvd:
+			pkts = append(pkts, pkt)
+		case <-timeout:
+			return pkts
+		}
+	}
+	return pkts
+}
+
+// mkPkts returns IPv4 packets of the specified lengths, with the DF flag not
+// set. The first payload byte is set to the packet's index.
+func mkPkts(lens ...int) []common.RawBytes {
+	pkts := make([]common.RawBytes, len(lens))
+	for i, l := range lens {
+		pkts[i] = mkIPv4Pkt(l, false)
+		pkts[i][ipv4HdrLen] = byte(i)
+	}
+	return pkts
+}
+
+func TestEgressToIngress(t *testing.T) {
+	h := newB2B()
+	Convey("Packets are delivered to the remote host in order", t, func() {
+		pkts := mkPkts(100, 1000, 60, 1500, 2000, 40, 700)
+		h.send(pkts)
+		SoMsg("pkts", h.recv(len(pkts)), ShouldResemble, pkts)
+	})
+	Convey("A lost frame is recovered using FEC", t, func() {
+		atomic.StoreUint32(&h.sess.fecGroup, 3)
+		h.conn.setDrop(dropAfterParity(2))
+		lens := make([]int, 16)
+		for i := range lens {
+			lens[i] = 1000
+		}
+		pkts := mkPkts(lens...)
+		h.send(pkts)
+		SoMsg("pkts", h.recv(len(pkts)), ShouldResemble, pkts)
+		SoMsg("dropped", atomic.LoadInt32(&h.conn.dropped), ShouldEqual, 1)
+	})
+}
+
+func TestMain(m *testing.M) {
+	l := log.Root()
+	l.SetHandler(log.DiscardHandler())
+	metrics.Init("test")
+	Init()
+	os.Exit(m.Run())
+}
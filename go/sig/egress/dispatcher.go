@@ -105,6 +105,11 @@ BatchLoop:
 				ed.Debug("EgressDispatcher: unable to find session")
 				continue
 			}
+			if ed.tooBig(sess, buf) {
+				// Release buffer back to free buffer pool
+				egressFreePkts.Write(ringbuf.EntryList{buf}, true)
+				continue
+			}
 			sess.ring.Write(ringbuf.EntryList{buf}, true)
 			ed.updateMetrics(remoteIAInt, sess.SessId, length)
 		}
@@ -116,6 +121,30 @@ func (ed *egressDispatcher) chooseSess(b common.RawBytes) *Session {
 	return ed.sess
 }
 
+// tooBig checks if b is larger than the effective MTU of the session's
+// current path. If so, and the sender can be asked to send smaller packets, an
+// ICMP packet too big error is written back to the TUN device, and true is
+// returned to indicate that b must be dropped.
+func (ed *egressDispatcher) tooBig(sess *Session, b common.RawBytes) bool {
+	mtu := sess.MaxPktSize()
+	if mtu == 0 || len(b) <= mtu {
+		return false
+	}
+	icmp, err := newPktTooBig(b, mtu)
+	if err != nil {
+		ed.Error("EgressDispatcher: unable to create ICMP packet too big", "err", err)
+		return false
+	}
+	if icmp == nil {
+		return false
+	}
+	metrics.PktsTooBig.WithLabelValues(sess.IA.String(), sess.SessId.String()).Inc()
+	if _, err := ed.devIO.Write(icmp); err != nil {
+		ed.Error("EgressDispatcher: unable to write ICMP packet too big", "err", err)
+	}
+	return true
+}
+
 func (ed *egressDispatcher) updateMetrics(remoteIA addr.IAInt, sessId mgmt.SessionType, read int) {
 	key := metrics.CtrPairKey{RemoteIA: remoteIA, SessId: sessId}
 	counters, ok := ed.pktsRecvCounters[key]
@@ -0,0 +1,109 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+//   FEC parity frames are sent after every group of N data frames. They carry
+//   the sequence number of the first data frame in the group, and the index
+//   is set to FECParityIndex. The FEC header contains the XOR of the lengths
+//   and indexes of the data frames, and the group size. It is followed by the
+//   XOR of the data frame payloads (i.e. without the SIG frame header), each
+//   zero-padded to the length of the longest one. Any single lost data frame
+//   of a group can thus be recovered.
+//
+//   0B       1        2        3        4        5        6        7
+//   +--------+--------+--------+--------+--------+--------+--------+--------+
+//   | Sess Id|      Epoch      |    Sequence number       |  Parity Index   |
+//   +--------+--------+--------+--------+--------+--------+--------+--------+
+//   |   Length XOR    |    Index XOR    |  Group |       (reserved)         |
+//   +--------+--------+--------+--------+--------+--------+--------+--------+
+
+// fecEncoder accumulates the parity of a group of data frames.
+type fecEncoder struct {
+	groupSize int
+	epoch     uint16
+	firstSeq  uint32
+	count     int
+	lenXor    uint16
+	idxXor    uint16
+	pldLen    int
+	b         common.RawBytes
+}
+
+func newFECEncoder() *fecEncoder {
+	return &fecEncoder{b: make(common.RawBytes, common.MaxMTU)}
+}
+
+// reset starts a new group of the specified size.
+func (e *fecEncoder) reset(groupSize int) {
+	e.groupSize = groupSize
+	e.count = 0
+}
+
+// add adds a data frame to the current group. Returns true if the group is
+// complete, and the parity frame should be sent.
+func (e *fecEncoder) add(raw common.RawBytes, epoch uint16, seq uint32, idx uint16) bool {
+	if e.groupSize == 0 {
+		return false
+	}
+	if e.count > 0 && (epoch != e.epoch || seq != e.firstSeq+uint32(e.count)) {
+		// The sequence number was reset, start a new group.
+		e.count = 0
+	}
+	pld := raw[sigcmn.SIGHdrSize:]
+	parity := e.b[sigcmn.SIGHdrSize+sigcmn.FECHdrSize:]
+	if e.count == 0 {
+		e.epoch = epoch
+		e.firstSeq = seq
+		e.lenXor = 0
+		e.idxXor = 0
+		e.pldLen = 0
+	}
+	if len(pld) > e.pldLen {
+		// Zero the parity bytes not covered by the previous frames.
+		for i := e.pldLen; i < len(pld); i++ {
+			parity[i] = 0
+		}
+		e.pldLen = len(pld)
+	}
+	for i := range pld {
+		parity[i] ^= pld[i]
+	}
+	e.lenXor ^= uint16(len(raw))
+	e.idxXor ^= idx
+	e.count++
+	return e.count == e.groupSize
+}
+
+// parityFrame returns the parity frame for the current group, and starts a
+// new group.
+func (e *fecEncoder) parityFrame(sessId mgmt.SessionType) common.RawBytes {
+	e.b[0] = uint8(sessId)
+	common.Order.PutUint16(e.b[1:3], e.epoch)
+	common.Order.PutUintN(e.b[3:6], uint64(e.firstSeq), 3)
+	common.Order.PutUint16(e.b[6:8], sigcmn.FECParityIndex)
+	fecHdr := e.b[sigcmn.SIGHdrSize:]
+	common.Order.PutUint16(fecHdr[0:2], e.lenXor)
+	common.Order.PutUint16(fecHdr[2:4], e.idxXor)
+	fecHdr[4] = uint8(e.count)
+	fecHdr[5], fecHdr[6], fecHdr[7] = 0, 0, 0
+	e.count = 0
+	return e.b[:sigcmn.SIGHdrSize+sigcmn.FECHdrSize+e.pldLen]
+}
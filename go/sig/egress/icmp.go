@@ -0,0 +1,138 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/util"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+const (
+	ipv4HdrLen = 20
+	ipv6HdrLen = 40
+	icmpHdrLen = 8
+	// Maximum sizes of generated ICMP errors (RFC 1812 4.3.2.3, RFC 4443 2.4(c)).
+	icmpv4MaxLen = 576
+	icmpv6MaxLen = 1280
+	// Minimum MTUs that can be reported to an IPv4/IPv6 sender (RFC 791, RFC 8200).
+	ipv4MinMTU = 68
+	ipv6MinMTU = 1280
+
+	ipv4FlagDF           = 0x40
+	ipProtoICMPv4        = 1
+	ipProtoICMPv6        = 58
+	icmpv4TypeDstUnreach = 3
+	icmpv4CodeFragNeeded = 4
+	icmpv6TypePktTooBig  = 2
+	icmpHopLimit         = 64
+)
+
+// newPktTooBig creates an ICMPv4 "fragmentation needed" or ICMPv6 "packet too
+// big" error for pkt, reporting mtu as the maximum packet size towards the
+// packet's destination. If pkt does not warrant such an error (e.g. an IPv4
+// packet without the DF flag set, or an MTU below the IPv6 minimum), nil is
+// returned, and the packet should be forwarded as normal.
+func newPktTooBig(pkt common.RawBytes, mtu int) (common.RawBytes, error) {
+	if len(pkt) == 0 {
+		return nil, common.NewBasicError("Empty packet", nil)
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		return newPktTooBigV4(pkt, mtu)
+	case 6:
+		return newPktTooBigV6(pkt, mtu)
+	}
+	return nil, common.NewBasicError("Unsupported IP version", nil, "version", pkt[0]>>4)
+}
+
+func newPktTooBigV4(pkt common.RawBytes, mtu int) (common.RawBytes, error) {
+	if len(pkt) < ipv4HdrLen {
+		return nil, common.NewBasicError("Truncated IPv4 packet", nil, "len", len(pkt))
+	}
+	if pkt[6]&ipv4FlagDF == 0 || mtu < ipv4MinMTU {
+		// The frame encapsulation will split the packet across multiple frames.
+		return nil, nil
+	}
+	srcIP := net.IP(pkt[12:16])
+	dstIP := net.IP(pkt[16:20])
+	if localIP := sigcmn.Host.IP().To4(); localIP != nil {
+		dstIP = localIP
+	}
+	quoteLen := len(pkt)
+	if max := icmpv4MaxLen - ipv4HdrLen - icmpHdrLen; quoteLen > max {
+		quoteLen = max
+	}
+	b := make(common.RawBytes, ipv4HdrLen+icmpHdrLen+quoteLen)
+	// IPv4 header
+	b[0] = 0x45
+	common.Order.PutUint16(b[2:4], uint16(len(b)))
+	b[8] = icmpHopLimit
+	b[9] = ipProtoICMPv4
+	copy(b[12:16], dstIP)
+	copy(b[16:20], srcIP)
+	common.Order.PutUint16(b[10:12], util.Checksum(b[:ipv4HdrLen]))
+	// ICMPv4 header
+	icmp := b[ipv4HdrLen:]
+	icmp[0] = icmpv4TypeDstUnreach
+	icmp[1] = icmpv4CodeFragNeeded
+	common.Order.PutUint16(icmp[6:8], uint16(mtu))
+	copy(icmp[icmpHdrLen:], pkt[:quoteLen])
+	common.Order.PutUint16(icmp[2:4], util.Checksum(icmp))
+	return b, nil
+}
+
+func newPktTooBigV6(pkt common.RawBytes, mtu int) (common.RawBytes, error) {
+	if len(pkt) < ipv6HdrLen {
+		return nil, common.NewBasicError("Truncated IPv6 packet", nil, "len", len(pkt))
+	}
+	if mtu < ipv6MinMTU {
+		// IPv6 senders can't be told to go below the minimum MTU, so rely on
+		// the frame encapsulation to split the packet instead.
+		return nil, nil
+	}
+	srcIP := net.IP(pkt[8:24])
+	dstIP := net.IP(pkt[24:40])
+	if localIP := sigcmn.Host.IP(); localIP.To4() == nil && localIP.To16() != nil {
+		dstIP = localIP.To16()
+	}
+	quoteLen := len(pkt)
+	if max := icmpv6MaxLen - ipv6HdrLen - icmpHdrLen; quoteLen > max {
+		quoteLen = max
+	}
+	icmpLen := icmpHdrLen + quoteLen
+	b := make(common.RawBytes, ipv6HdrLen+icmpLen)
+	// IPv6 header
+	b[0] = 0x60
+	common.Order.PutUint16(b[4:6], uint16(icmpLen))
+	b[6] = ipProtoICMPv6
+	b[7] = icmpHopLimit
+	copy(b[8:24], dstIP)
+	copy(b[24:40], srcIP)
+	// ICMPv6 header
+	icmp := b[ipv6HdrLen:]
+	icmp[0] = icmpv6TypePktTooBig
+	common.Order.PutUint32(icmp[4:8], uint32(mtu))
+	copy(icmp[icmpHdrLen:], pkt[:quoteLen])
+	// The ICMPv6 checksum covers a pseudo-header of the source and
+	// destination addresses, the upper-layer length and the next header.
+	pseudo := make(common.RawBytes, 8)
+	common.Order.PutUint32(pseudo[0:4], uint32(icmpLen))
+	pseudo[7] = ipProtoICMPv6
+	common.Order.PutUint16(icmp[2:4], util.Checksum(b[8:40], pseudo, icmp))
+	return b, nil
+}
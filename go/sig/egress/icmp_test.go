@@ -0,0 +1,171 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+// inetChecksum computes the Internet checksum (RFC 1071) over the concatenation of bufs. It
+// is 0 for data that includes a correct checksum.
+func inetChecksum(bufs ...common.RawBytes) uint16 {
+	var b common.RawBytes
+	for _, buf := range bufs {
+		b = append(b, buf...)
+	}
+	if len(b)%2 != 0 {
+		b = append(b, 0)
+	}
+	var sum uint32
+	for i := 0; i < len(b); i += 2 {
+		sum += uint32(common.Order.Uint16(b[i:]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+func mkIPv4Pkt(l int, df bool) common.RawBytes {
+	pkt := make(common.RawBytes, l)
+	pkt[0] = 0x45
+	common.Order.PutUint16(pkt[2:4], uint16(l))
+	if df {
+		pkt[6] = ipv4FlagDF
+	}
+	pkt[9] = 17
+	copy(pkt[12:16], net.IPv4(192, 168, 1, 1).To4())
+	copy(pkt[16:20], net.IPv4(192, 168, 2, 1).To4())
+	for i := ipv4HdrLen; i < l; i++ {
+		pkt[i] = byte(i)
+	}
+	return pkt
+}
+
+func mkIPv6Pkt(l int) common.RawBytes {
+	pkt := make(common.RawBytes, l)
+	pkt[0] = 0x60
+	common.Order.PutUint16(pkt[4:6], uint16(l-ipv6HdrLen))
+	pkt[6] = 17
+	copy(pkt[8:24], net.ParseIP("2001:db8:1::1"))
+	copy(pkt[24:40], net.ParseIP("2001:db8:2::1"))
+	for i := ipv6HdrLen; i < l; i++ {
+		pkt[i] = byte(i)
+	}
+	return pkt
+}
+
+func TestNewPktTooBigV4(t *testing.T) {
+	Convey("Given a SIG with an IPv4 address", t, func() {
+		sigcmn.Host = addr.HostFromIP(net.IPv4(10, 0, 0, 1))
+		Convey("A packet with DF set gets a fragmentation needed error", func() {
+			pkt := mkIPv4Pkt(1400, true)
+			b, err := newPktTooBig(pkt, 1200)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("len", len(b), ShouldEqual, icmpv4MaxLen)
+			SoMsg("total len", common.Order.Uint16(b[2:4]), ShouldEqual, len(b))
+			SoMsg("proto", b[9], ShouldEqual, ipProtoICMPv4)
+			SoMsg("ip checksum", inetChecksum(b[:ipv4HdrLen]), ShouldEqual, 0)
+			SoMsg("src", net.IP(b[12:16]).Equal(net.IPv4(10, 0, 0, 1)), ShouldBeTrue)
+			SoMsg("dst", net.IP(b[16:20]).Equal(net.IPv4(192, 168, 1, 1)), ShouldBeTrue)
+			icmp := b[ipv4HdrLen:]
+			SoMsg("type", icmp[0], ShouldEqual, icmpv4TypeDstUnreach)
+			SoMsg("code", icmp[1], ShouldEqual, icmpv4CodeFragNeeded)
+			SoMsg("mtu", common.Order.Uint16(icmp[6:8]), ShouldEqual, 1200)
+			SoMsg("icmp checksum", inetChecksum(icmp), ShouldEqual, 0)
+			SoMsg("quote", icmp[icmpHdrLen:], ShouldResemble,
+				pkt[:icmpv4MaxLen-ipv4HdrLen-icmpHdrLen])
+		})
+		Convey("A small packet is quoted completely", func() {
+			pkt := mkIPv4Pkt(101, true)
+			b, err := newPktTooBig(pkt, 100)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("len", len(b), ShouldEqual, ipv4HdrLen+icmpHdrLen+len(pkt))
+			SoMsg("quote", b[ipv4HdrLen+icmpHdrLen:], ShouldResemble, pkt)
+			SoMsg("icmp checksum", inetChecksum(b[ipv4HdrLen:]), ShouldEqual, 0)
+		})
+		Convey("A packet without DF set is fragmented instead", func() {
+			b, err := newPktTooBig(mkIPv4Pkt(1400, false), 1200)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("icmp", b, ShouldBeNil)
+		})
+		Convey("An MTU below the IPv4 minimum is not reported", func() {
+			b, err := newPktTooBig(mkIPv4Pkt(1400, true), ipv4MinMTU-1)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("icmp", b, ShouldBeNil)
+		})
+		Convey("A truncated packet is rejected", func() {
+			_, err := newPktTooBig(mkIPv4Pkt(1400, true)[:ipv4HdrLen-1], 1200)
+			SoMsg("err", err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestNewPktTooBigV6(t *testing.T) {
+	Convey("Given a SIG with an IPv6 address", t, func() {
+		sigcmn.Host = addr.HostFromIP(net.ParseIP("2001:db8:3::1"))
+		Convey("A packet gets a packet too big error", func() {
+			pkt := mkIPv6Pkt(1500)
+			b, err := newPktTooBig(pkt, 1400)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("len", len(b), ShouldEqual, icmpv6MaxLen)
+			SoMsg("payload len", common.Order.Uint16(b[4:6]), ShouldEqual,
+				icmpv6MaxLen-ipv6HdrLen)
+			SoMsg("next hdr", b[6], ShouldEqual, ipProtoICMPv6)
+			SoMsg("src", net.IP(b[8:24]).Equal(net.ParseIP("2001:db8:3::1")), ShouldBeTrue)
+			SoMsg("dst", net.IP(b[24:40]).Equal(net.ParseIP("2001:db8:1::1")), ShouldBeTrue)
+			icmp := b[ipv6HdrLen:]
+			SoMsg("type", icmp[0], ShouldEqual, icmpv6TypePktTooBig)
+			SoMsg("mtu", common.Order.Uint32(icmp[4:8]), ShouldEqual, 1400)
+			SoMsg("quote", icmp[icmpHdrLen:], ShouldResemble,
+				pkt[:icmpv6MaxLen-ipv6HdrLen-icmpHdrLen])
+			pseudo := make(common.RawBytes, 8)
+			common.Order.PutUint32(pseudo[0:4], uint32(len(icmp)))
+			pseudo[7] = ipProtoICMPv6
+			SoMsg("checksum", inetChecksum(b[8:40], pseudo, icmp), ShouldEqual, 0)
+		})
+		Convey("An odd-sized quote has a valid checksum", func() {
+			b, err := newPktTooBig(mkIPv6Pkt(ipv6HdrLen+9), ipv6MinMTU)
+			SoMsg("err", err, ShouldBeNil)
+			icmp := b[ipv6HdrLen:]
+			pseudo := make(common.RawBytes, 8)
+			common.Order.PutUint32(pseudo[0:4], uint32(len(icmp)))
+			pseudo[7] = ipProtoICMPv6
+			SoMsg("checksum", inetChecksum(b[8:40], pseudo, icmp), ShouldEqual, 0)
+		})
+		Convey("An MTU below the IPv6 minimum is not reported", func() {
+			b, err := newPktTooBig(mkIPv6Pkt(1500), ipv6MinMTU-1)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("icmp", b, ShouldBeNil)
+		})
+		Convey("An IPv4 SIG address is not used as source", func() {
+			sigcmn.Host = addr.HostFromIP(net.IPv4(10, 0, 0, 1))
+			b, err := newPktTooBig(mkIPv6Pkt(1500), 1400)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("src", net.IP(b[8:24]).Equal(net.ParseIP("2001:db8:2::1")), ShouldBeTrue)
+		})
+	})
+	Convey("Packets with an unknown IP version are rejected", t, func() {
+		_, err := newPktTooBig(common.RawBytes{0x50, 0, 0, 0}, 1400)
+		SoMsg("err", err, ShouldNotBeNil)
+	})
+}
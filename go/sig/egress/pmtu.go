@@ -0,0 +1,153 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/scmp"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// pmtuExpiration is how long a learned path MTU is used before the MTU
+// reported by sciond is tried again (RFC 1191 recommends 10 minutes).
+const pmtuExpiration = 10 * time.Minute
+
+type pathMTU struct {
+	mtu     uint16
+	learned time.Time
+}
+
+// pathMTUs tracks the effective MTU of paths, as learned from SCMP oversize
+// packet errors. It is safe for concurrent use.
+type pathMTUs struct {
+	sync.RWMutex
+	m map[pathmgr.PathKey]pathMTU
+}
+
+func newPathMTUs() *pathMTUs {
+	return &pathMTUs{m: make(map[pathmgr.PathKey]pathMTU)}
+}
+
+// get returns the learned MTU for the specified path, or 0 if none is known.
+func (p *pathMTUs) get(key pathmgr.PathKey) uint16 {
+	p.RLock()
+	defer p.RUnlock()
+	e, ok := p.m[key]
+	if !ok || time.Since(e.learned) > pmtuExpiration {
+		return 0
+	}
+	return e.mtu
+}
+
+// update lowers the learned MTU for the specified path, whose MTU reported by
+// sciond is pathMtu. As SCMP errors are not authenticated, MTUs below
+// common.MinMTU are rejected, and MTUs not below pathMtu are ignored. Returns
+// true if the learned MTU was changed.
+func (p *pathMTUs) update(key pathmgr.PathKey, mtu, pathMtu uint16) (bool, error) {
+	if mtu < common.MinMTU {
+		return false, common.NewBasicError("Path MTU below minimum MTU", nil,
+			"mtu", mtu, "min", common.MinMTU)
+	}
+	if mtu >= pathMtu {
+		return false, nil
+	}
+	p.Lock()
+	defer p.Unlock()
+	e, ok := p.m[key]
+	if ok && time.Since(e.learned) <= pmtuExpiration && e.mtu <= mtu {
+		return false, nil
+	}
+	p.m[key] = pathMTU{mtu: mtu, learned: time.Now()}
+	return true, nil
+}
+
+// expire removes entries that have expired, or whose paths are no longer in aps.
+func (p *pathMTUs) expire(aps pathmgr.AppPathSet) {
+	p.Lock()
+	defer p.Unlock()
+	for key, e := range p.m {
+		if _, ok := aps[key]; !ok || time.Since(e.learned) > pmtuExpiration {
+			delete(p.m, key)
+		}
+	}
+}
+
+// readSCMP reads from the session's (otherwise write-only) connection, and
+// updates the learned path MTUs from any SCMP oversize packet errors.
+func (s *Session) readSCMP() {
+	defer liblog.LogPanicAndExit()
+	b := make(common.RawBytes, common.MaxMTU)
+	for {
+		n, raddr, err := s.conn.ReadFromSCION(b)
+		if err == nil {
+			s.Debug("Unexpected packet on egress conn", "src", raddr, "raw", b[:n])
+			continue
+		}
+		opErr, ok := err.(*snet.OpError)
+		if !ok {
+			select {
+			case <-s.sessMonStop:
+				// The session is shutting down, and the conn has been closed.
+				return
+			default:
+			}
+			s.Error("Error reading from egress conn", "err", err)
+			continue
+		}
+		if err := s.handleSCMP(opErr.SCMP(), b[:n]); err != nil {
+			s.Error("Error handling SCMP message", "src", raddr, "err", err)
+		}
+	}
+}
+
+func (s *Session) handleSCMP(hdr *scmp.Hdr, raw common.RawBytes) error {
+	ct := scmp.ClassType{Class: hdr.Class, Type: hdr.Type}
+	if ct != (scmp.ClassType{Class: scmp.C_Routing, Type: scmp.T_R_OversizePkt}) {
+		s.Debug("Ignoring SCMP message", "ct", ct)
+		return nil
+	}
+	pld, err := scmp.PldFromRaw(raw, ct)
+	if err != nil {
+		return err
+	}
+	info, ok := pld.Info.(*scmp.InfoPktSize)
+	if !ok {
+		return common.NewBasicError("Unexpected SCMP info type", nil,
+			"type", common.TypeOf(pld.Info))
+	}
+	// Find the path the oversized packet was sent on, by matching the quoted
+	// path header against the paths in the pool.
+	for key, ap := range s.pool.Load().APS {
+		if !bytes.Equal(ap.Entry.Path.FwdPath, pld.PathHdr) {
+			continue
+		}
+		changed, err := s.pathMTUs.update(key, info.MTU, ap.Entry.Path.Mtu)
+		if err != nil {
+			return err
+		}
+		if changed {
+			s.Info("Learned path MTU", "path", key, "mtu", info.MTU, "size", info.Size)
+		}
+		return nil
+	}
+	return common.NewBasicError("SCMP oversize packet error for unknown path", nil,
+		"info", info)
+}
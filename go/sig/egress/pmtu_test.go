@@ -0,0 +1,75 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/pathmgr"
+)
+
+func TestPathMTUs(t *testing.T) {
+	Convey("Given path MTUs", t, func() {
+		p := newPathMTUs()
+		Convey("Unknown paths have no MTU", func() {
+			SoMsg("mtu", p.get("a"), ShouldEqual, 0)
+		})
+		update := func(key pathmgr.PathKey, mtu uint16) bool {
+			changed, err := p.update(key, mtu, 1472)
+			SoMsg("err", err, ShouldBeNil)
+			return changed
+		}
+		Convey("The MTU is lowered, but not raised", func() {
+			SoMsg("first", update("a", 1400), ShouldBeTrue)
+			SoMsg("lower", update("a", 1300), ShouldBeTrue)
+			SoMsg("higher", update("a", 1350), ShouldBeFalse)
+			SoMsg("equal", update("a", 1300), ShouldBeFalse)
+			SoMsg("mtu", p.get("a"), ShouldEqual, 1300)
+			SoMsg("other path", p.get("b"), ShouldEqual, 0)
+		})
+		Convey("MTUs below the minimum MTU are rejected", func() {
+			changed, err := p.update("a", common.MinMTU-1, 1472)
+			SoMsg("err", err, ShouldNotBeNil)
+			SoMsg("changed", changed, ShouldBeFalse)
+			SoMsg("mtu", p.get("a"), ShouldEqual, 0)
+		})
+		Convey("MTUs not below the path MTU are ignored", func() {
+			SoMsg("equal", update("a", 1472), ShouldBeFalse)
+			SoMsg("higher", update("a", 9000), ShouldBeFalse)
+			SoMsg("mtu", p.get("a"), ShouldEqual, 0)
+		})
+		Convey("Expired MTUs are ignored, and can be raised", func() {
+			p.m["a"] = pathMTU{mtu: 1300, learned: time.Now().Add(-pmtuExpiration - time.Second)}
+			SoMsg("expired", p.get("a"), ShouldEqual, 0)
+			SoMsg("higher", update("a", 1400), ShouldBeTrue)
+			SoMsg("mtu", p.get("a"), ShouldEqual, 1400)
+		})
+		Convey("expire removes expired entries and entries of removed paths", func() {
+			update("a", 1400)
+			update("b", 1400)
+			p.m["c"] = pathMTU{mtu: 1300, learned: time.Now().Add(-pmtuExpiration - time.Second)}
+			p.expire(pathmgr.AppPathSet{"a": nil, "c": nil})
+			SoMsg("a", p.get("a"), ShouldEqual, 1400)
+			_, ok := p.m["b"]
+			SoMsg("b", ok, ShouldBeFalse)
+			_, ok = p.m["c"]
+			SoMsg("c", ok, ShouldBeFalse)
+		})
+	})
+}
@@ -24,7 +24,6 @@ import (
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/pathmgr"
-	"github.com/scionproto/scion/go/lib/pktdisp"
 	"github.com/scionproto/scion/go/lib/ringbuf"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/sig/mgmt"
@@ -45,9 +44,23 @@ type Session struct {
 	// *RemoteInfo
 	currRemote atomic.Value
 	// bool
-	healthy        atomic.Value
+	healthy atomic.Value
+	// effective MTUs of paths, learned from SCMP errors
+	pathMTUs *pathMTUs
+	// the maximum size of a packet that can be sent without splitting it
+	// across frames, as determined by the worker. Accessed atomically.
+	maxPktSize uint32
+	// the FEC group size requested from the remote SIG, and the group size
+	// negotiated with it (0 if FEC is disabled). Accessed atomically.
+	fecRequested uint32
+	fecGroup     uint32
+	// the maximum number of paths to stripe frames across (0 or 1 disables
+	// multipath striping). Accessed atomically.
+	multipath uint32
+	// *stripe, nil unless frames are currently striped across multiple paths.
+	currStripe     atomic.Value
 	ring           *ringbuf.Ring
-	conn           *snet.Conn
+	conn           sigcmn.DataConn
 	sessMonStop    chan struct{}
 	sessMonStopped chan struct{}
 	workerStopped  chan struct{}
@@ -57,22 +70,22 @@ func NewSession(dstIA *addr.ISD_AS, sessId mgmt.SessionType,
 	sigMap *siginfo.SigMap, logger log.Logger) (*Session, error) {
 	var err error
 	s := &Session{
-		Logger: logger.New("sessId", sessId),
-		IA:     dstIA,
-		SessId: sessId,
-		sigMap: sigMap,
+		Logger:   logger.New("sessId", sessId),
+		IA:       dstIA,
+		SessId:   sessId,
+		sigMap:   sigMap,
+		pathMTUs: newPathMTUs(),
 	}
 	if s.pool, err = sigcmn.PathMgr.Watch(sigcmn.IA, s.IA); err != nil {
 		return nil, err
 	}
 	s.currRemote.Store((*RemoteInfo)(nil))
 	s.healthy.Store(false)
+	s.currStripe.Store((*stripe)(nil))
 	s.ring = ringbuf.New(64, nil, "egress",
 		prometheus.Labels{"ringId": dstIA.String(), "sessId": sessId.String()})
 	// Not using a fixed local port, as this is for outgoing data only.
 	s.conn, err = snet.ListenSCION("udp4", &snet.Addr{IA: sigcmn.IA, Host: sigcmn.Host})
-	// spawn a PktDispatcher to log any unexpected messages received on a write-only connection.
-	go pktdisp.PktDispatcher(s.conn, pktdisp.DispLogger)
 	s.sessMonStop = make(chan struct{})
 	s.sessMonStopped = make(chan struct{})
 	s.workerStopped = make(chan struct{})
@@ -80,6 +93,9 @@ func NewSession(dstIA *addr.ISD_AS, sessId mgmt.SessionType,
 }
 
 func (s *Session) Start() {
+	// Read SCMP errors (and log any unexpected messages) received on the
+	// otherwise write-only connection.
+	go s.readSCMP()
 	go newSessMonitor(s).run()
 	go NewWorker(s, s.Logger).Run()
 }
@@ -110,6 +126,41 @@ func (s *Session) Healthy() bool {
 	return s.healthy.Load().(bool)
 }
 
+// MaxPktSize returns the largest packet that fits into a single frame on the
+// session's current path, or 0 if it is not yet known.
+func (s *Session) MaxPktSize() int {
+	return int(atomic.LoadUint32(&s.maxPktSize))
+}
+
+// SetFECGroup sets the FEC group size to request from remote SIGs. 0
+// disables FEC for the session.
+func (s *Session) SetFECGroup(n uint8) {
+	atomic.StoreUint32(&s.fecRequested, uint32(n))
+}
+
+// FECGroup returns the FEC group size negotiated with the current remote SIG,
+// or 0 if FEC is disabled.
+func (s *Session) FECGroup() int {
+	return int(atomic.LoadUint32(&s.fecGroup))
+}
+
+// SetMultipath sets the maximum number of paths to stripe frames across. 0 or
+// 1 disables multipath striping, i.e. only the current remote path is used.
+func (s *Session) SetMultipath(n uint8) {
+	atomic.StoreUint32(&s.multipath, uint32(n))
+}
+
+// Multipath returns the maximum number of paths to stripe frames across.
+func (s *Session) Multipath() int {
+	return int(atomic.LoadUint32(&s.multipath))
+}
+
+// activeStripe returns the paths frames are currently striped across, or nil
+// if only the current remote path is used.
+func (s *Session) activeStripe() *stripe {
+	return s.currStripe.Load().(*stripe)
+}
+
 type RemoteInfo struct {
 	Sig      *siginfo.Sig
 	sessPath *sessPath
@@ -15,6 +15,7 @@
 package egress
 
 import (
+	"sync/atomic"
 	"time"
 
 	log "github.com/inconshreveable/log15"
@@ -60,11 +61,21 @@ type sessMonitor struct {
 	updateMsgId mgmt.MsgIdType
 	// the last time a PollRep was received.
 	lastReply time.Time
+	// the outstanding PollReqs, by message id, used to measure the RTT of
+	// each path for multipath striping.
+	probes map[mgmt.MsgIdType]*probe
+}
+
+// probe is a PollReq sent on a specific path.
+type probe struct {
+	sp   *sessPath
+	sent time.Time
 }
 
 func newSessMonitor(sess *Session) *sessMonitor {
 	return &sessMonitor{
 		Logger: sess.Logger, sess: sess, pool: sess.pool, sessPathPool: make(sessPathPool),
+		probes: make(map[mgmt.MsgIdType]*probe),
 	}
 }
 
@@ -86,8 +97,12 @@ Top:
 			break Top
 		case <-reqTick.C:
 			// Update paths and sigs
-			sm.sessPathPool.update(sm.pool.Load().APS)
+			aps := sm.pool.Load().APS
+			sm.sessPathPool.update(aps)
+			sm.sess.pathMTUs.expire(aps)
+			sm.expireProbes()
 			sm.updateRemote()
+			sm.updateStripe()
 			sm.sendReq()
 		case rpld := <-regc:
 			sm.handleRep(rpld)
@@ -177,13 +192,35 @@ func (sm *sessMonitor) sendReq() {
 	if sm.smRemote == nil || sm.smRemote.Sig == nil || sm.smRemote.sessPath == nil {
 		return
 	}
-	now := time.Now()
-	msgId := mgmt.MsgIdType(now.UnixNano())
+	msgId := sm.newMsgId()
 	if sm.needUpdate {
 		sm.updateMsgId = msgId
 		sm.Debug("sessMonitor: trying new remote", "msgId", msgId, "remote", sm.smRemote)
 	}
-	spld, err := mgmt.NewPld(msgId, mgmt.NewPollReq(sigcmn.MgmtAddr, sm.sess.SessId))
+	sm.sendPoll(msgId, sm.smRemote.sessPath)
+	if sm.needUpdate || sm.sess.Multipath() < 2 {
+		return
+	}
+	// Probe the other paths that frames can be striped across.
+	for _, sp := range sm.sessPathPool.best(sm.sess.Multipath(), sm.smRemote.sessPath)[1:] {
+		sm.sendPoll(sm.newMsgId(), sp)
+	}
+}
+
+// newMsgId returns a message id based on the current time, which is unique
+// among the outstanding PollReqs.
+func (sm *sessMonitor) newMsgId() mgmt.MsgIdType {
+	msgId := mgmt.MsgIdType(time.Now().UnixNano())
+	for _, ok := sm.probes[msgId]; ok; _, ok = sm.probes[msgId] {
+		msgId++
+	}
+	return msgId
+}
+
+// sendPoll sends a PollReq to the current remote SIG over the specified path.
+func (sm *sessMonitor) sendPoll(msgId mgmt.MsgIdType, sp *sessPath) {
+	fecGroup := uint8(atomic.LoadUint32(&sm.sess.fecRequested))
+	spld, err := mgmt.NewPld(msgId, mgmt.NewPollReq(sigcmn.MgmtAddr, sm.sess.SessId, fecGroup))
 	if err != nil {
 		sm.Error("sessMonitor: Error creating SIGCtrl payload", "err", err)
 		return
@@ -204,12 +241,13 @@ func (sm *sessMonitor) sendReq() {
 		return
 	}
 	raddr := sm.smRemote.Sig.CtrlSnetAddr()
-	raddr.Path = spath.New(sm.smRemote.sessPath.pathEntry.Path.FwdPath)
+	raddr.Path = spath.New(sp.pathEntry.Path.FwdPath)
 	if err := raddr.Path.InitOffsets(); err != nil {
 		sm.Error("sessMonitor: Error initializing path offsets", "err", err)
 	}
-	raddr.NextHopHost = sm.smRemote.sessPath.pathEntry.HostInfo.Host()
-	raddr.NextHopPort = sm.smRemote.sessPath.pathEntry.HostInfo.Port
+	raddr.NextHopHost = sp.pathEntry.HostInfo.Host()
+	raddr.NextHopPort = sp.pathEntry.HostInfo.Port
+	sm.probes[msgId] = &probe{sp: sp, sent: time.Now()}
 	// XXX(kormat): if this blocks, both the sessMon and egress worker
 	// goroutines will block. Can't just use SetWriteDeadline, as both
 	// goroutines write to it.
@@ -219,8 +257,47 @@ func (sm *sessMonitor) sendReq() {
 	}
 }
 
+// expireProbes removes the PollReqs that have not been answered in time. The
+// paths they were sent on (other than the current remote path, which is
+// handled by updateRemote) are considered to have failed.
+func (sm *sessMonitor) expireProbes() {
+	for msgId, p := range sm.probes {
+		if time.Since(p.sent) <= tout {
+			continue
+		}
+		delete(sm.probes, msgId)
+		if sm.smRemote == nil || p.sp != sm.smRemote.sessPath {
+			p.sp.fail()
+		}
+	}
+}
+
+// updateStripe selects the paths that frames are striped across, if
+// multipath striping is enabled. These are the current remote path, and the
+// other paths with the fewest failures that have recently answered a PollReq.
+func (sm *sessMonitor) updateStripe() {
+	var st *stripe
+	if n := sm.sess.Multipath(); n > 1 && !sm.needUpdate {
+		var sps []*sessPath
+		for _, sp := range sm.sessPathPool.best(n, sm.smRemote.sessPath) {
+			if sp.healthy() {
+				sps = append(sps, sp)
+			}
+		}
+		if len(sps) > 1 && sps[0] == sm.smRemote.sessPath {
+			st = newStripe(sps)
+		}
+	}
+	if old := sm.sess.activeStripe(); !st.equal(old) {
+		if !st.samePaths(old) {
+			sm.Info("sessMonitor: updating stripe", "paths", st)
+		}
+		sm.sess.currStripe.Store(st)
+	}
+}
+
 func (sm *sessMonitor) handleRep(rpld *disp.RegPld) {
-	_, ok := rpld.P.(*mgmt.PollRep)
+	rep, ok := rpld.P.(*mgmt.PollRep)
 	if !ok {
 		sm.Error("sessMonitor: non-SIGPollRep payload received",
 			"src", rpld.Addr, "type", common.TypeOf(rpld.P), "pld", rpld.P)
@@ -231,6 +308,15 @@ func (sm *sessMonitor) handleRep(rpld *disp.RegPld) {
 			"expected", sm.sess.IA, "actual", rpld.Addr.IA)
 		return
 	}
+	sm.updateFEC(rep.FecGroup)
+	if p, ok := sm.probes[rpld.Id]; ok {
+		delete(sm.probes, rpld.Id)
+		p.sp.reply(time.Since(p.sent))
+		if sm.smRemote != nil && p.sp != sm.smRemote.sessPath {
+			// Replies on other paths say nothing about the current remote path.
+			return
+		}
+	}
 	sm.lastReply = time.Now()
 	if sm.needUpdate && sm.updateMsgId == rpld.Id {
 		// Only update the session's RemoteInfo if we get a response matching
@@ -241,3 +327,15 @@ func (sm *sessMonitor) handleRep(rpld *disp.RegPld) {
 		sm.sess.healthy.Store(true)
 	}
 }
+
+// updateFEC sets the session's FEC group size from the size supported by the
+// remote SIG, which is never larger than the one requested.
+func (sm *sessMonitor) updateFEC(supported uint8) {
+	n := atomic.LoadUint32(&sm.sess.fecRequested)
+	if uint32(supported) < n {
+		n = uint32(supported)
+	}
+	if old := atomic.SwapUint32(&sm.sess.fecGroup, n); old != n {
+		sm.Info("sessMonitor: FEC group size changed", "old", old, "new", n)
+	}
+}
@@ -17,6 +17,7 @@ package egress
 import (
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	//log "github.com/inconshreveable/log15"
@@ -46,6 +47,30 @@ func (spp sessPathPool) get(currKey pathmgr.PathKey) *sessPath {
 	return sp
 }
 
+// best returns up to n paths, starting with first (if specified), followed by
+// the paths with the fewest failures.
+func (spp sessPathPool) best(n int, first *sessPath) []*sessPath {
+	var sps []*sessPath
+	for _, sp := range spp {
+		if sp != first {
+			sps = append(sps, sp)
+		}
+	}
+	sort.Slice(sps, func(i, j int) bool {
+		if sps[i].failCount != sps[j].failCount {
+			return sps[i].failCount < sps[j].failCount
+		}
+		return sps[i].key < sps[j].key
+	})
+	if first != nil {
+		sps = append([]*sessPath{first}, sps...)
+	}
+	if len(sps) > n {
+		sps = sps[:n]
+	}
+	return sps
+}
+
 func (spp sessPathPool) update(aps pathmgr.AppPathSet) {
 	// Remove any old entries that aren't present in the update.
 	for key := range spp {
@@ -70,6 +95,10 @@ type sessPath struct {
 	pathEntry *sciond.PathReplyEntry
 	lastFail  time.Time
 	failCount uint16
+	// the last time a PollRep was received on this path, and the smoothed
+	// RTT of the PollReqs sent on it.
+	lastReply time.Time
+	srtt      time.Duration
 }
 
 func newSessPath(key pathmgr.PathKey, pathEntry *sciond.PathReplyEntry) *sessPath {
@@ -83,6 +112,21 @@ func (sp *sessPath) fail() {
 	}
 }
 
+// reply updates the path's smoothed RTT with a new sample (RFC 6298).
+func (sp *sessPath) reply(rtt time.Duration) {
+	if sp.lastReply.IsZero() {
+		sp.srtt = rtt
+	} else {
+		sp.srtt = (7*sp.srtt + rtt) / 8
+	}
+	sp.lastReply = time.Now()
+}
+
+// healthy returns true if a PollRep was received on the path recently.
+func (sp *sessPath) healthy() bool {
+	return !sp.lastReply.IsZero() && time.Since(sp.lastReply) <= tout
+}
+
 func (sp *sessPath) expireFails() {
 	if time.Since(sp.lastFail) > pathFailExpiration {
 		sp.failCount /= 2
@@ -0,0 +1,82 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+// SessionStatus is a snapshot of the state of a session.
+type SessionStatus struct {
+	SessId  mgmt.SessionType
+	Healthy bool
+	// Sig is the id of the remote SIG currently used, empty if none.
+	Sig        siginfo.SigIdType
+	Path       *PathStatus
+	MaxPktSize int
+	FECGroup   int
+	Multipath  int
+	// Stripe contains the paths frames are currently striped across, if any.
+	Stripe []*PathStatus `json:",omitempty"`
+}
+
+// PathStatus describes a path used by a session.
+type PathStatus struct {
+	// Key is the hex-encoded path key.
+	Key  string
+	Path string
+	// MTU is the effective MTU of the path, including any MTU learned from
+	// SCMP errors.
+	MTU    uint16
+	Weight int `json:",omitempty"`
+}
+
+// Status returns a snapshot of the session's state.
+func (s *Session) Status() *SessionStatus {
+	ss := &SessionStatus{
+		SessId:     s.SessId,
+		Healthy:    s.Healthy(),
+		MaxPktSize: s.MaxPktSize(),
+		FECGroup:   s.FECGroup(),
+		Multipath:  s.Multipath(),
+	}
+	if remote := s.Remote(); remote != nil {
+		if remote.Sig != nil {
+			ss.Sig = remote.Sig.Id
+		}
+		if remote.sessPath != nil {
+			ss.Path = s.pathStatus(remote.sessPath.key, remote.sessPath.pathEntry)
+		}
+	}
+	if st := s.activeStripe(); st != nil {
+		for _, p := range st.paths {
+			ps := s.pathStatus(p.key, p.pathEntry)
+			ps.Weight = p.weight
+			ss.Stripe = append(ss.Stripe, ps)
+		}
+	}
+	return ss
+}
+
+func (s *Session) pathStatus(key pathmgr.PathKey, pathEntry *sciond.PathReplyEntry) *PathStatus {
+	ps := &PathStatus{Key: key.String(), Path: pathEntry.Path.String(), MTU: pathEntry.Path.Mtu}
+	if mtu := s.pathMTUs.get(key); mtu != 0 && mtu < ps.MTU {
+		ps.MTU = mtu
+	}
+	return ps
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+)
+
+// stripe is the set of paths that a session using multipath striping
+// distributes its frames over. Each path is weighted by its estimated
+// capacity. A stripe is immutable once created.
+type stripe struct {
+	paths []*stripePath
+}
+
+type stripePath struct {
+	key       pathmgr.PathKey
+	pathEntry *sciond.PathReplyEntry
+	weight    int
+}
+
+// newStripe creates a stripe from the specified paths, which must all have
+// a measured RTT.
+func newStripe(sps []*sessPath) *stripe {
+	st := &stripe{}
+	for _, sp := range sps {
+		st.paths = append(st.paths, &stripePath{
+			key: sp.key, pathEntry: sp.pathEntry, weight: capacityWeight(sp),
+		})
+	}
+	return st
+}
+
+// capacityWeight estimates the capacity of a path as the number of bytes that
+// can be sent per millisecond with one packet in flight, i.e., MTU / RTT.
+func capacityWeight(sp *sessPath) int {
+	rttMs := float64(sp.srtt) / float64(time.Millisecond)
+	if rttMs < 1 {
+		rttMs = 1
+	}
+	w := int(float64(sp.pathEntry.Path.Mtu) / rttMs)
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// samePaths returns true if both stripes contain the same paths, in the same
+// order, regardless of their weights.
+func (st *stripe) samePaths(other *stripe) bool {
+	if st == nil || other == nil {
+		return st == other
+	}
+	if len(st.paths) != len(other.paths) {
+		return false
+	}
+	for i := range st.paths {
+		if st.paths[i].key != other.paths[i].key ||
+			st.paths[i].pathEntry != other.paths[i].pathEntry {
+			return false
+		}
+	}
+	return true
+}
+
+// equal returns true if both stripes contain the same paths with the same
+// weights.
+func (st *stripe) equal(other *stripe) bool {
+	if !st.samePaths(other) {
+		return false
+	}
+	if st == nil {
+		return true
+	}
+	for i := range st.paths {
+		if st.paths[i].weight != other.paths[i].weight {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *stripe) String() string {
+	if st == nil {
+		return "<nil>"
+	}
+	parts := make([]string, len(st.paths))
+	for i, p := range st.paths {
+		parts[i] = fmt.Sprintf("%s (weight %d)", p.key, p.weight)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// stripeSched distributes frames over the paths of a stripe in proportion to
+// their weights, using smooth weighted round-robin. This interleaves the
+// paths as evenly as possible, which keeps the reordering the remote SIG has
+// to deal with low.
+type stripeSched struct {
+	st      *stripe
+	current []int
+}
+
+// reset starts scheduling frames over the paths of st.
+func (s *stripeSched) reset(st *stripe) {
+	s.st = st
+	s.current = s.current[:0]
+	if st != nil {
+		s.current = append(s.current, make([]int, len(st.paths))...)
+	}
+}
+
+// next returns the path to send the next frame on, or nil if there is no
+// stripe.
+func (s *stripeSched) next() *stripePath {
+	if s.st == nil || len(s.st.paths) == 0 {
+		return nil
+	}
+	total, best := 0, 0
+	for i, p := range s.st.paths {
+		s.current[i] += p.weight
+		total += p.weight
+		if s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	s.current[best] -= total
+	return s.st.paths[best]
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/pathmgr"
+	"github.com/scionproto/scion/go/lib/sciond"
+)
+
+func mkSessPath(key string, mtu uint16, srtt time.Duration) *sessPath {
+	pe := &sciond.PathReplyEntry{Path: sciond.FwdPathMeta{Mtu: mtu}}
+	sp := newSessPath(pathmgr.PathKey(key), pe)
+	sp.srtt = srtt
+	return sp
+}
+
+func TestStripe(t *testing.T) {
+	Convey("Paths are weighted by MTU / RTT", t, func() {
+		st := newStripe([]*sessPath{
+			mkSessPath("a", 1500, 10*time.Millisecond),
+			mkSessPath("b", 1500, 30*time.Millisecond),
+			mkSessPath("c", 1000, 100*time.Microsecond),
+		})
+		SoMsg("a", st.paths[0].weight, ShouldEqual, 150)
+		SoMsg("b", st.paths[1].weight, ShouldEqual, 50)
+		SoMsg("c (RTT below 1ms)", st.paths[2].weight, ShouldEqual, 1000)
+	})
+	Convey("Frames are distributed in proportion to the weights", t, func() {
+		st := &stripe{paths: []*stripePath{
+			{key: "a", weight: 3}, {key: "b", weight: 1},
+		}}
+		var sched stripeSched
+		sched.reset(st)
+		var keys []pathmgr.PathKey
+		for i := 0; i < 8; i++ {
+			keys = append(keys, sched.next().key)
+		}
+		SoMsg("keys", keys, ShouldResemble,
+			[]pathmgr.PathKey{"a", "a", "b", "a", "a", "a", "b", "a"})
+	})
+	Convey("A nil stripe schedules no paths", t, func() {
+		var sched stripeSched
+		sched.reset(nil)
+		SoMsg("next", sched.next(), ShouldBeNil)
+	})
+	Convey("Stripes with the same paths but different weights", t, func() {
+		pe := &sciond.PathReplyEntry{}
+		st1 := &stripe{paths: []*stripePath{{key: "a", pathEntry: pe, weight: 3}}}
+		st2 := &stripe{paths: []*stripePath{{key: "a", pathEntry: pe, weight: 1}}}
+		SoMsg("samePaths", st1.samePaths(st2), ShouldBeTrue)
+		SoMsg("equal", st1.equal(st2), ShouldBeFalse)
+		SoMsg("nil", st1.samePaths(nil), ShouldBeFalse)
+	})
+}
@@ -15,15 +15,19 @@
 package egress
 
 import (
+	"sync/atomic"
 	"time"
 
 	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/scionproto/scion/go/lib/common"
 	"github.com/scionproto/scion/go/lib/l4"
 	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/lib/pathmgr"
 	"github.com/scionproto/scion/go/lib/ringbuf"
 	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/lib/spath"
 	"github.com/scionproto/scion/go/lib/spkt"
 	"github.com/scionproto/scion/go/lib/util"
@@ -53,15 +57,28 @@ const (
 	MinSpace   = 16
 	SigHdrLen  = 8
 	MaxSeq     = (1 << 24) - 1
+	// minFrameLen is the length of the smallest frame the worker sends,
+	// leaving room for MinSpace bytes after the SIG header.
+	minFrameLen = SigHdrLen + MinSpace
 )
 
 type worker struct {
 	log.Logger
 	iaString      string
 	sess          *Session
+	currRemote    *RemoteInfo
 	currSig       *siginfo.Sig
 	currPathEntry *sciond.PathReplyEntry
+	currMtu       uint16
 	frameSentCtrs metrics.CtrPair
+	paritySentCtr prometheus.Counter
+	// FEC group size that the current frame was sized for.
+	fecGroup int
+	fec      *fecEncoder
+	// the stripe the current frame was sized for, and the MTUs of its paths
+	// at that time.
+	sched      stripeSched
+	stripeMtus []uint16
 
 	epoch uint16
 	seq   uint32
@@ -77,7 +94,10 @@ func NewWorker(sess *Session, logger log.Logger) *worker {
 			Pkts:  metrics.FramesSent.WithLabelValues(sess.IA.String(), sess.SessId.String()),
 			Bytes: metrics.FrameBytesSent.WithLabelValues(sess.IA.String(), sess.SessId.String()),
 		},
+		paritySentCtr: metrics.FECParityFramesSent.WithLabelValues(sess.IA.String(),
+			sess.SessId.String()),
 		pkts: make(ringbuf.EntryList, 0, egressBufPkts),
+		fec:  newFECEncoder(),
 	}
 }
 
@@ -96,13 +116,22 @@ TopLoop:
 		if fEmpty {
 			// Cover the case where no packets have arrived in a while, and the
 			// current path is stale.
-			w.resetFrame(f)
+			if err := w.resetFrame(f); err != nil {
+				w.Error("Unable to size frame", "err", err)
+			}
 		} else if len(w.pkts) == 0 {
 			// Didn't read any new packets, send partial frame.
 			if err := w.write(f); err != nil {
 				w.Error("Error sending frame", "err", err)
 			}
 			continue TopLoop
+		} else if w.needReset() {
+			// The session has moved to a different path or stripe, or the
+			// path MTU has changed. Send the partial frame on the path it was sized for,
+			// so that the following frames are sized for the new path.
+			if err := w.write(f); err != nil {
+				w.Error("Error sending frame", "err", err)
+			}
 		}
 		// Process buffered packets.
 		for i := range w.pkts {
@@ -157,7 +186,11 @@ func (w *worker) read(block bool) bool {
 func (w *worker) write(f *frame) error {
 	// TODO(kormat): consider looking for an updated path here, and switching
 	// to it if the mtu isn't smaller than the current one.
-	defer w.resetFrame(f)
+	defer func() {
+		if err := w.resetFrame(f); err != nil {
+			w.Error("Unable to size frame", "err", err)
+		}
+	}()
 	if w.currPathEntry == nil {
 		// FIXME(kormat): add some metrics to track this.
 		return nil
@@ -166,24 +199,38 @@ func (w *worker) write(f *frame) error {
 		// FIXME(kormat): add some metrics to track this.
 		return nil
 	}
+	pathEntry := w.currPathEntry
+	if st := w.sess.activeStripe(); st != w.sched.st && st.samePaths(w.sched.st) {
+		// Only the weights of the stripe's paths have changed.
+		w.sched.reset(st)
+	}
+	if p := w.sched.next(); p != nil {
+		pathEntry = p.pathEntry
+	}
 	snetAddr := w.currSig.EncapSnetAddr()
-	snetAddr.Path = spath.New(w.currPathEntry.Path.FwdPath)
+	snetAddr.Path = spath.New(pathEntry.Path.FwdPath)
 	if err := snetAddr.Path.InitOffsets(); err != nil {
 		return common.NewBasicError("Error initializing path offsets", err)
 	}
-	snetAddr.NextHopHost = w.currPathEntry.HostInfo.Host()
-	snetAddr.NextHopPort = w.currPathEntry.HostInfo.Port
+	snetAddr.NextHopHost = pathEntry.HostInfo.Host()
+	snetAddr.NextHopPort = pathEntry.HostInfo.Port
 
 	if w.seq == 0 {
 		w.epoch = uint16(time.Now().Unix() & 0xFFFF)
 	}
 	f.writeHdr(w.sess.SessId, w.epoch, w.seq)
+	seq := w.seq
 	// Update sequence number for next packet
 	w.seq += 1
 	if w.seq > MaxSeq {
 		w.seq = 0
 	}
 	bytesWritten, err := w.sess.conn.WriteToSCION(f.raw(), snetAddr)
+	// Add the frame to the FEC group even if sending failed, as the parity
+	// frame might still allow the remote SIG to recover it.
+	if fecErr := w.addFEC(f, seq, snetAddr); fecErr != nil {
+		w.Error("Error sending FEC parity frame", "err", fecErr)
+	}
 	if err != nil {
 		return common.NewBasicError("Egress write error", err)
 	}
@@ -192,25 +239,112 @@ func (w *worker) write(f *frame) error {
 	return nil
 }
 
-func (w *worker) resetFrame(f *frame) {
+// addFEC adds the frame to the current FEC group, and sends the group's parity
+// frame once the group is complete.
+func (w *worker) addFEC(f *frame, seq uint32, snetAddr *snet.Addr) error {
+	if w.fecGroup != w.fec.groupSize {
+		w.fec.reset(w.fecGroup)
+	}
+	if !w.fec.add(f.raw(), w.epoch, seq, f.idx) {
+		return nil
+	}
+	bytesWritten, err := w.sess.conn.WriteToSCION(w.fec.parityFrame(w.sess.SessId), snetAddr)
+	if err != nil {
+		return common.NewBasicError("Egress FEC parity write error", err)
+	}
+	w.paritySentCtr.Inc()
+	w.frameSentCtrs.Bytes.Add(float64(bytesWritten))
+	return nil
+}
+
+// needReset returns true if the session's remote, stripe or FEC group size has
+// changed since the current frame was sized, or if a lower MTU has been learned
+// for one of the paths it can be sent on.
+func (w *worker) needReset() bool {
+	remote := w.sess.Remote()
+	if remote != w.currRemote || w.sess.FECGroup() != w.fecGroup ||
+		!w.sess.activeStripe().samePaths(w.sched.st) {
+		return true
+	}
+	if w.sched.st != nil {
+		for i, p := range w.sched.st.paths {
+			if w.effectiveMtu(p.key, p.pathEntry) < w.stripeMtus[i] {
+				return true
+			}
+		}
+	}
+	return remote != nil && remote.sessPath != nil &&
+		w.effectiveMtu(remote.sessPath.key, remote.sessPath.pathEntry) < w.currMtu
+}
+
+// effectiveMtu returns the MTU of the specified path, taking into account any
+// MTU learned from SCMP errors.
+func (w *worker) effectiveMtu(key pathmgr.PathKey, pathEntry *sciond.PathReplyEntry) uint16 {
+	mtu := pathEntry.Path.Mtu
+	if pmtu := w.sess.pathMTUs.get(key); pmtu != 0 && pmtu < mtu {
+		mtu = pmtu
+	}
+	return mtu
+}
+
+// resetFrame sizes the frame for the session's current path and stripe. If
+// the frame would be smaller than minFrameLen, an error is returned and the
+// current path is cleared, so that frames are dropped until the next reset.
+func (w *worker) resetFrame(f *frame) error {
 	var mtu uint16 = common.MinMTU
-	var addrLen, pathLen uint16
+	var addrLen, pathLen int
 	remote := w.sess.Remote()
+	w.currRemote = remote
 	if remote != nil {
 		w.currSig = remote.Sig
 		if w.currSig != nil {
-			addrLen = uint16(spkt.AddrHdrLen(w.currSig.Host, sigcmn.Host))
+			addrLen = spkt.AddrHdrLen(w.currSig.Host, sigcmn.Host)
 		}
 		if remote.sessPath != nil {
 			w.currPathEntry = remote.sessPath.pathEntry
+			mtu = w.effectiveMtu(remote.sessPath.key, remote.sessPath.pathEntry)
+		} else if w.currPathEntry != nil {
+			mtu = w.currPathEntry.Path.Mtu
 		}
 		if w.currPathEntry != nil {
-			mtu = w.currPathEntry.Path.Mtu
-			pathLen = uint16(len(w.currPathEntry.Path.FwdPath))
+			pathLen = len(w.currPathEntry.Path.FwdPath)
 		}
 	}
+	w.currMtu = mtu
 	// FIXME(kormat): to do this properly, need to account for any ext headers.
-	f.reset(mtu - spkt.CmnHdrLen - addrLen - pathLen - l4.UDPLen)
+	frameLen := int(mtu) - spkt.CmnHdrLen - addrLen - pathLen - l4.UDPLen
+	w.sched.reset(w.sess.activeStripe())
+	w.stripeMtus = w.stripeMtus[:0]
+	if w.sched.st != nil {
+		// Frames can be sent on any path of the stripe, so size them to fit
+		// the most constrained one.
+		for _, p := range w.sched.st.paths {
+			pmtu := w.effectiveMtu(p.key, p.pathEntry)
+			w.stripeMtus = append(w.stripeMtus, pmtu)
+			l := int(pmtu) - spkt.CmnHdrLen - addrLen - len(p.pathEntry.Path.FwdPath) -
+				l4.UDPLen
+			if l < frameLen {
+				frameLen = l
+			}
+		}
+	}
+	w.fecGroup = w.sess.FECGroup()
+	if w.fecGroup > 0 {
+		// Leave space for the FEC header, so that parity frames fit the MTU.
+		frameLen -= sigcmn.FECHdrSize
+	}
+	if frameLen < minFrameLen {
+		f.reset(minFrameLen)
+		w.currPathEntry = nil
+		atomic.StoreUint32(&w.sess.maxPktSize, 0)
+		return common.NewBasicError("Path MTU too small for SIG frames", nil,
+			"mtu", mtu, "frameLen", frameLen, "min", minFrameLen)
+	}
+	f.reset(frameLen)
+	// Let the egress dispatcher know the largest packet that still fits into
+	// a single frame.
+	atomic.StoreUint32(&w.sess.maxPktSize, uint32(frameLen-sigcmn.SIGHdrSize-PktLenSize))
+	return nil
 }
 
 type frame struct {
@@ -223,8 +357,8 @@ func newFrame() *frame {
 	return &frame{b: make(common.RawBytes, common.MaxMTU), offset: sigcmn.SIGHdrSize}
 }
 
-func (f *frame) reset(mtu uint16) {
-	f.b = f.b[:int(mtu)]
+func (f *frame) reset(frameLen int) {
+	f.b = f.b[:frameLen]
 	f.idx = 0
 	f.offset = sigcmn.SIGHdrSize
 }
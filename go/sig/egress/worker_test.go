@@ -0,0 +1,75 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package egress
+
+import (
+	"net"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/l4"
+	"github.com/scionproto/scion/go/lib/sciond"
+	"github.com/scionproto/scion/go/lib/spkt"
+	"github.com/scionproto/scion/go/lib/xtest/fakesciond"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/siginfo"
+)
+
+func TestResetFrame(t *testing.T) {
+	Convey("Given a worker for a session with a single path", t, func() {
+		sigcmn.Host = addr.HostFromIP(net.IPv4(10, 0, 0, 1))
+		pathEntry := fakesciond.NewPathEntry(addr.HostFromIP(net.IPv4(10, 0, 0, 254)), 30041,
+			sciond.PathInterface{RawIsdas: localIA.IAInt(), IfID: 1},
+			sciond.PathInterface{RawIsdas: remoteIA.IAInt(), IfID: 2})
+		remoteSig := siginfo.NewSig(remoteIA, "remote", addr.HostFromIP(net.IPv4(10, 0, 1, 1)),
+			sigcmn.DefaultCtrlPort, sigcmn.DefaultEncapPort, true)
+		sess := &Session{Logger: log.Root(), IA: remoteIA, pathMTUs: newPathMTUs()}
+		sess.currRemote.Store(&RemoteInfo{Sig: remoteSig,
+			sessPath: newSessPath("path", &pathEntry)})
+		sess.currStripe.Store((*stripe)(nil))
+		w := &worker{Logger: sess.Logger, sess: sess, fec: newFECEncoder()}
+		f := newFrame()
+		Convey("The frame is sized for the path MTU", func() {
+			pathEntry.Path.Mtu = 1472
+			err := w.resetFrame(f)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("len", len(f.b), ShouldEqual, 1472-spkt.CmnHdrLen-
+				spkt.AddrHdrLen(remoteSig.Host, sigcmn.Host)-len(pathEntry.Path.FwdPath)-l4.UDPLen)
+			SoMsg("maxPktSize", sess.MaxPktSize(), ShouldEqual,
+				len(f.b)-sigcmn.SIGHdrSize-PktLenSize)
+		})
+		Convey("A learned MTU below the minimum MTU is not used", func() {
+			pathEntry.Path.Mtu = common.MinMTU
+			_, err := sess.pathMTUs.update("path", 100, pathEntry.Path.Mtu)
+			SoMsg("update err", err, ShouldNotBeNil)
+			err = w.resetFrame(f)
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("mtu", w.currMtu, ShouldEqual, common.MinMTU)
+		})
+		Convey("A path MTU too small for a frame is an error, and frames are dropped", func() {
+			pathEntry.Path.Mtu = 64
+			err := w.resetFrame(f)
+			SoMsg("err", err, ShouldNotBeNil)
+			SoMsg("len", len(f.b), ShouldEqual, minFrameLen)
+			SoMsg("path", w.currPathEntry, ShouldBeNil)
+			SoMsg("maxPktSize", sess.MaxPktSize(), ShouldEqual, 0)
+			SoMsg("process err", w.processPkt(f, make(common.RawBytes, 100)), ShouldBeNil)
+		})
+	})
+}
@@ -43,7 +43,7 @@ const (
 )
 
 var (
-	extConn            *snet.Conn
+	extConn            sigcmn.DataConn
 	tunIO              io.ReadWriteCloser
 	freeFrames         *ringbuf.Ring
 	framesRecvCounters map[metrics.CtrPairKey]metrics.CtrPair
@@ -53,36 +53,35 @@ var (
 // source ISD-AS -> source host Addr -> Sess Id and hands it off to the
 // appropriate Worker, starting a new one if none currently exists.
 type Dispatcher struct {
-	laddr   *snet.Addr
 	workers map[string]*Worker
 }
 
 func Init() error {
-	freeFrames = ringbuf.New(freeFramesCap, func() interface{} {
-		return NewFrameBuf()
-	}, "ingress", prometheus.Labels{"ringId": "freeFrames", "sessId": ""})
-	framesRecvCounters = make(map[metrics.CtrPairKey]metrics.CtrPair)
-	d := &Dispatcher{
-		laddr:   sigcmn.EncapSnetAddr(),
-		workers: make(map[string]*Worker),
-	}
-	return d.Run()
-}
-
-func (d *Dispatcher) Run() error {
-	var err error
-	extConn, err = snet.ListenSCION("udp4", d.laddr)
+	conn, err := snet.ListenSCION("udp4", sigcmn.EncapSnetAddr())
 	if err != nil {
 		return common.NewBasicError("Unable to initialize extConn", err)
 	}
-	_, tunIO, err = xnet.ConnectTun(tunDevName)
+	tun, err := xnet.Provider.ConnectTun(tunDevName)
 	if err != nil {
 		return common.NewBasicError("Unable to connect to tunIO", err)
 	}
-	d.read()
+	Serve(conn, tun)
 	return nil
 }
 
+// Serve reads the frames received on conn, and writes the decapsulated packets
+// to tun. It returns once conn is closed.
+func Serve(conn sigcmn.DataConn, tun io.ReadWriteCloser) {
+	freeFrames = ringbuf.New(freeFramesCap, func() interface{} {
+		return NewFrameBuf()
+	}, "ingress", prometheus.Labels{"ringId": "freeFrames", "sessId": ""})
+	framesRecvCounters = make(map[metrics.CtrPairKey]metrics.CtrPair)
+	extConn = conn
+	tunIO = tun
+	d := &Dispatcher{workers: make(map[string]*Worker)}
+	d.read()
+}
+
 func (d *Dispatcher) read() {
 	frames := make(ringbuf.EntryList, 64)
 	lastCleanup := time.Now()
@@ -91,6 +90,14 @@ func (d *Dispatcher) read() {
 		for i := 0; i < n; i++ {
 			frame := frames[i].(*FrameBuf)
 			read, src, err := extConn.ReadFromSCION(frame.raw)
+			if err == io.EOF {
+				// The conn was closed, stop all workers.
+				for _, f := range frames[i:n] {
+					f.(*FrameBuf).Release()
+				}
+				d.stop()
+				return
+			}
 			if err != nil {
 				log.Error("IngressDispatcher: Unable to read from external ingress", "err", err)
 				frame.Release()
@@ -119,6 +126,7 @@ func (d *Dispatcher) dispatch(frame *FrameBuf, src *snet.Addr) {
 	if !ok {
 		worker = NewWorker(src, frame.sessId)
 		d.workers[dispatchStr] = worker
+		workerReg.Store(dispatchStr, worker)
 		go worker.Run()
 	}
 	worker.markedForCleanup = false
@@ -130,6 +138,7 @@ func (d *Dispatcher) cleanup() {
 	for key, worker := range d.workers {
 		if worker.markedForCleanup {
 			delete(d.workers, key)
+			workerReg.Delete(key)
 			go worker.Stop()
 		} else {
 			worker.markedForCleanup = true
@@ -137,6 +146,15 @@ func (d *Dispatcher) cleanup() {
 	}
 }
 
+// stop stops and releases all workers.
+func (d *Dispatcher) stop() {
+	for key, worker := range d.workers {
+		delete(d.workers, key)
+		workerReg.Delete(key)
+		go worker.Stop()
+	}
+}
+
 func updateMetrics(remoteIA addr.IAInt, sessId mgmt.SessionType, read int) {
 	key := metrics.CtrPairKey{RemoteIA: remoteIA, SessId: sessId}
 	counters, ok := framesRecvCounters[key]
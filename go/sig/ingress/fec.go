@@ -0,0 +1,222 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+)
+
+// fecHistoryLen is the number of recent data frames kept for FEC recovery.
+const fecHistoryLen = 2 * sigcmn.MaxFECGroup
+
+// fecFrame is a copy of the parts of a data frame needed for FEC recovery.
+type fecFrame struct {
+	frameLen int
+	index    int
+	pld      common.RawBytes
+}
+
+// fecDecoder recovers lost data frames using the FEC parity frames sent by the
+// egress SIG (see egress/fec.go for the format). As a parity frame follows the
+// data frames of its group, data frames after a gap are held back in a
+// reorderBuf until the missing frame has been recovered, or is considered
+// lost. Data frames are thus passed on to the reassembly list in order.
+type fecDecoder struct {
+	epoch int
+	snd   sender
+	// first is the sequence number of the first data frame seen. Groups
+	// starting before it cannot be recovered.
+	first int
+	// minWindow is the reordering window configured for the reassembly list.
+	minWindow int
+	// groupSize is the size of the last FEC group seen.
+	groupSize int
+	reorder   *reorderBuf
+	// history contains copies of recent data frames.
+	history map[int]*fecFrame
+}
+
+// newFECDecoder creates a decoder that takes over the frames held back by
+// reorder, if any. Otherwise, frames are held back for at most reorderTimeout.
+func newFECDecoder(epoch int, snd sender, reorder *reorderBuf,
+	reorderTimeout time.Duration) *fecDecoder {
+
+	d := &fecDecoder{
+		epoch:   epoch,
+		snd:     snd,
+		first:   -1,
+		history: make(map[int]*fecFrame),
+	}
+	if reorder == nil {
+		reorder = newReorderBuf(0, reorderTimeout)
+	}
+	d.minWindow = reorder.window
+	d.reorder = reorder
+	d.reorder.skipCtr = metrics.FramesUnrecoverable
+	if d.reorder.next >= 0 {
+		d.first = d.reorder.next
+	}
+	d.setWindow()
+	return d
+}
+
+// push adds a data frame, and returns the data frames that can now be passed
+// on to the reassembly list.
+func (d *fecDecoder) push(frame *FrameBuf) []*FrameBuf {
+	if d.first < 0 {
+		d.first = frame.seqNr
+	}
+	d.record(frame)
+	return d.reorder.push(frame)
+}
+
+// parity handles a parity frame, and returns the data frames that can now be
+// passed on to the reassembly list.
+func (d *fecDecoder) parity(frame *FrameBuf) []*FrameBuf {
+	defer frame.Release()
+	metrics.FECParityFramesRecv.Inc()
+	if frame.frameLen < sigcmn.SIGHdrSize+sigcmn.FECHdrSize {
+		log.Error("FEC parity frame too short", "epoch", d.epoch, "frame", frame.String())
+		return nil
+	}
+	fecHdr := frame.raw[sigcmn.SIGHdrSize:]
+	d.groupSize = int(fecHdr[4])
+	d.setWindow()
+	groupStart := frame.seqNr
+	if d.first < 0 || groupStart < d.first {
+		return nil
+	}
+	missing := -1
+	for seqNr := groupStart; seqNr < groupStart+d.groupSize; seqNr++ {
+		if _, ok := d.history[seqNr]; ok {
+			continue
+		}
+		if missing >= 0 {
+			// More than one frame is missing, nothing to recover.
+			return d.reorder.drain()
+		}
+		missing = seqNr
+	}
+	if missing < d.reorder.next {
+		// Either no frame is missing, or it was already considered lost.
+		return nil
+	}
+	recovered := d.recover(frame, missing)
+	if recovered == nil {
+		return nil
+	}
+	metrics.FramesRecovered.Inc()
+	return d.push(recovered)
+}
+
+// recover reconstructs the missing data frame from the parity frame and the
+// other data frames of the group.
+func (d *fecDecoder) recover(parity *FrameBuf, missing int) *FrameBuf {
+	fecHdr := parity.raw[sigcmn.SIGHdrSize:]
+	frameLen := int(common.Order.Uint16(fecHdr[0:2]))
+	index := int(common.Order.Uint16(fecHdr[2:4]))
+	pld := append(common.RawBytes(nil),
+		parity.raw[sigcmn.SIGHdrSize+sigcmn.FECHdrSize:parity.frameLen]...)
+	for seqNr := parity.seqNr; seqNr < parity.seqNr+d.groupSize; seqNr++ {
+		if seqNr == missing {
+			continue
+		}
+		f := d.history[seqNr]
+		if len(f.pld) > len(pld) {
+			log.Error("FEC parity frame shorter than data frame", "epoch", d.epoch,
+				"seqNr", seqNr)
+			return nil
+		}
+		frameLen ^= f.frameLen
+		index ^= f.index
+		for i := range f.pld {
+			pld[i] ^= f.pld[i]
+		}
+	}
+	if frameLen < sigcmn.SIGHdrSize || frameLen-sigcmn.SIGHdrSize > len(pld) {
+		log.Error("Invalid length for FEC recovered frame", "epoch", d.epoch,
+			"seqNr", missing, "len", frameLen)
+		return nil
+	}
+	bufs := make(ringbuf.EntryList, 1)
+	if n, _ := freeFrames.Read(bufs, false); n != 1 {
+		log.Warn("No free frame buffer for FEC recovered frame", "epoch", d.epoch,
+			"seqNr", missing)
+		return nil
+	}
+	frame := bufs[0].(*FrameBuf)
+	frame.sessId = parity.sessId
+	frame.raw[0] = uint8(parity.sessId)
+	common.Order.PutUint16(frame.raw[1:3], uint16(d.epoch))
+	common.Order.PutUintN(frame.raw[3:6], uint64(missing), 3)
+	common.Order.PutUint16(frame.raw[6:8], uint16(index))
+	copy(frame.raw[sigcmn.SIGHdrSize:], pld[:frameLen-sigcmn.SIGHdrSize])
+	frame.frameLen = frameLen
+	frame.initFromHdr(d.snd)
+	return frame
+}
+
+// setWindow sets the number of data frames to hold back while waiting for a
+// missing frame to be recovered.
+func (d *fecDecoder) setWindow() {
+	window := sigcmn.MaxFECGroup
+	if d.groupSize > 0 {
+		window = 2 * d.groupSize
+	}
+	if window < d.minWindow {
+		window = d.minWindow
+	}
+	d.reorder.window = window
+}
+
+// record keeps a copy of the data frame for recovering other frames of its
+// group.
+func (d *fecDecoder) record(frame *FrameBuf) {
+	if _, ok := d.history[frame.seqNr]; ok {
+		return
+	}
+	var f *fecFrame
+	if old, ok := d.history[frame.seqNr-fecHistoryLen]; ok {
+		// Reuse the oldest entry.
+		delete(d.history, frame.seqNr-fecHistoryLen)
+		f = old
+	} else {
+		f = &fecFrame{}
+	}
+	if len(d.history) >= 2*fecHistoryLen {
+		// Sequence numbers were skipped, so some entries were never reused.
+		for seqNr := range d.history {
+			if seqNr <= frame.seqNr-fecHistoryLen {
+				delete(d.history, seqNr)
+			}
+		}
+	}
+	f.frameLen = frame.frameLen
+	f.index = frame.index
+	f.pld = append(f.pld[:0], frame.raw[sigcmn.SIGHdrSize:frame.frameLen]...)
+	d.history[frame.seqNr] = f
+}
+
+// releaseAll releases all held data frames.
+func (d *fecDecoder) releaseAll() {
+	d.reorder.releaseAll()
+}
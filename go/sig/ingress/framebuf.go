@@ -23,6 +23,7 @@ import (
 	"github.com/scionproto/scion/go/lib/ringbuf"
 	"github.com/scionproto/scion/go/lib/util"
 	"github.com/scionproto/scion/go/sig/mgmt"
+	"github.com/scionproto/scion/go/sig/sigcmn"
 )
 
 const (
@@ -83,6 +84,27 @@ func (fb *FrameBuf) Reset() {
 	fb.snd = nil
 }
 
+// initFromHdr sets the metadata of the FrameBuf from the SIG frame header, and
+// returns the epoch of the frame.
+func (fb *FrameBuf) initFromHdr(snd sender) int {
+	epoch := int(common.Order.Uint16(fb.raw[1:3]))
+	fb.seqNr = int(common.Order.UintN(fb.raw[3:6], 3))
+	fb.index = int(common.Order.Uint16(fb.raw[6:8]))
+	fb.snd = snd
+	// If index == 1 then we can be sure that there is no fragment at the beginning
+	// of the frame.
+	fb.fragNProcessed = fb.index == 1
+	// If index == 0 then we can be sure that there are no complete packets in this
+	// frame.
+	fb.completePktsProcessed = fb.index == 0
+	return epoch
+}
+
+// isParity returns true if the frame is an FEC parity frame.
+func (fb *FrameBuf) isParity() bool {
+	return fb.index == sigcmn.FECParityIndex
+}
+
 // Release reset the FrameBuf and releases it back to the ringbuf (if set).
 func (fb *FrameBuf) Release() {
 	fb.Reset()
@@ -0,0 +1,138 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/scionproto/scion/go/sig/metrics"
+)
+
+// reorderBuf holds back data frames received after a gap in the sequence
+// numbers, so that they can be passed on to the reassembly list in order once
+// the missing frames arrive. This allows tolerating the reordering caused by
+// remote SIGs striping frames across multiple paths, as well as waiting for
+// frames to be recovered by FEC. If a gap is not filled within timeout (see
+// expire), or before the newest held frame is more than window frames past
+// it, the missing frames are considered lost and skipped.
+type reorderBuf struct {
+	window int
+	// timeout is the maximum time frames are held back for a gap. 0 means no
+	// limit.
+	timeout time.Duration
+	// next is the sequence number of the next data frame to pass on, or -1 if
+	// no data frame has been seen yet.
+	next int
+	held map[int]*FrameBuf
+	// gapSince is the time the current gap was first seen, if frames are held.
+	gapSince time.Time
+	// skipCtr, if set, counts the frames considered lost.
+	skipCtr prometheus.Counter
+}
+
+func newReorderBuf(window int, timeout time.Duration) *reorderBuf {
+	return &reorderBuf{window: window, timeout: timeout, next: -1,
+		held: make(map[int]*FrameBuf)}
+}
+
+// push adds a data frame, and returns the data frames that can now be passed
+// on to the reassembly list.
+func (r *reorderBuf) push(frame *FrameBuf) []*FrameBuf {
+	if r.next < 0 {
+		r.next = frame.seqNr
+	}
+	if frame.seqNr < r.next {
+		// Let the reassembly list deal with old frames.
+		return []*FrameBuf{frame}
+	}
+	if _, ok := r.held[frame.seqNr]; ok {
+		metrics.FramesDuplicated.Inc()
+		frame.Release()
+		return nil
+	}
+	if frame.seqNr != r.next {
+		metrics.FramesReordered.Inc()
+	}
+	r.held[frame.seqNr] = frame
+	return r.drain()
+}
+
+// drain returns the held data frames up to the next gap. If the gap is too
+// old to still be filled, the missing frames are considered lost and skipped.
+func (r *reorderBuf) drain() []*FrameBuf {
+	var frames []*FrameBuf
+	prevNext := r.next
+	for len(r.held) > 0 {
+		for frame, ok := r.held[r.next]; ok; frame, ok = r.held[r.next] {
+			delete(r.held, r.next)
+			frames = append(frames, frame)
+			r.next++
+		}
+		minHeld, maxHeld := -1, -1
+		for seqNr := range r.held {
+			if minHeld < 0 || seqNr < minHeld {
+				minHeld = seqNr
+			}
+			if seqNr > maxHeld {
+				maxHeld = seqNr
+			}
+		}
+		if minHeld < 0 || maxHeld-r.next <= r.window {
+			break
+		}
+		if r.skipCtr != nil {
+			r.skipCtr.Add(float64(minHeld - r.next))
+		}
+		r.next = minHeld
+	}
+	switch {
+	case len(r.held) == 0:
+		r.gapSince = time.Time{}
+	case r.gapSince.IsZero() || r.next != prevNext:
+		r.gapSince = time.Now()
+	}
+	return frames
+}
+
+// expire skips the current gap if it has not been filled within the timeout,
+// and returns the held data frames that can then be passed on to the
+// reassembly list. This prevents a lost frame from holding back later frames
+// indefinitely if too few frames follow it to exceed the window.
+func (r *reorderBuf) expire(now time.Time) []*FrameBuf {
+	if len(r.held) == 0 || r.timeout == 0 || now.Sub(r.gapSince) < r.timeout {
+		return nil
+	}
+	minHeld := -1
+	for seqNr := range r.held {
+		if minHeld < 0 || seqNr < minHeld {
+			minHeld = seqNr
+		}
+	}
+	if r.skipCtr != nil {
+		r.skipCtr.Add(float64(minHeld - r.next))
+	}
+	r.next = minHeld
+	return r.drain()
+}
+
+// releaseAll releases all held data frames.
+func (r *reorderBuf) releaseAll() {
+	for seqNr, frame := range r.held {
+		delete(r.held, seqNr)
+		frame.Release()
+	}
+}
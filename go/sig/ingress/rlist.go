@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"container/list"
 	"fmt"
+	"time"
 
 	log "github.com/inconshreveable/log15"
 
@@ -37,11 +38,22 @@ type ReassemblyList struct {
 	markedForDeletion bool
 	entries           *list.List
 	buf               *bytes.Buffer
+	// reorder is set if frames can be received out of order, until the first FEC
+	// parity frame has been received.
+	reorder        *reorderBuf
+	reorderTimeout time.Duration
+	// fec is set once the first FEC parity frame has been received.
+	fec *fecDecoder
 }
 
 // NewReassemblyList returns a ReassemblyList object for the given epoch and with
-// given maximum capacity.
-func NewReassemblyList(epoch int, capacity int, s sender) *ReassemblyList {
+// given maximum capacity. If reorderWindow is greater than 0, frames received out
+// of order are held back until either the missing frames are received,
+// reorderWindow later frames have been received, or reorderTimeout has passed
+// (see Flush). The timeout also applies to frames held back for FEC recovery.
+func NewReassemblyList(epoch int, capacity int, reorderWindow int,
+	reorderTimeout time.Duration, s sender) *ReassemblyList {
+
 	list := &ReassemblyList{
 		epoch:             epoch,
 		capacity:          capacity,
@@ -49,15 +61,62 @@ func NewReassemblyList(epoch int, capacity int, s sender) *ReassemblyList {
 		markedForDeletion: false,
 		entries:           list.New(),
 		buf:               bytes.NewBuffer(make(common.RawBytes, 0, frameBufCap)),
+		reorderTimeout:    reorderTimeout,
+	}
+	if reorderWindow > 0 {
+		list.reorder = newReorderBuf(reorderWindow, reorderTimeout)
 	}
 	return list
 }
 
 // Insert inserts a frame into the reassembly list.
+// If FEC is in use, lost frames are first recovered using the FEC parity frames, see
+// fecDecoder. Otherwise, if a reordering window is set, frames are first put back
+// in order, see reorderBuf.
 // After inserting the frame at the correct position, Insert tries to reassemble packets
 // that involve the newly added frame. Completely processed frames get removed from the
 // list and released to the pool of frame buffers.
 func (l *ReassemblyList) Insert(frame *FrameBuf) {
+	if frame.isParity() {
+		if l.fec == nil {
+			l.fec = newFECDecoder(l.epoch, l.snd, l.reorder, l.reorderTimeout)
+			l.reorder = nil
+		}
+		l.insertAll(l.fec.parity(frame))
+		return
+	}
+	if l.fec != nil {
+		l.insertAll(l.fec.push(frame))
+		return
+	}
+	if l.reorder != nil {
+		l.insertAll(l.reorder.push(frame))
+		return
+	}
+	l.insert(frame)
+}
+
+// Flush passes on the frames held back for a gap that has not been filled
+// within the reordering timeout. Returns true if frames are still held back.
+func (l *ReassemblyList) Flush(now time.Time) bool {
+	reorder := l.reorder
+	if l.fec != nil {
+		reorder = l.fec.reorder
+	}
+	if reorder == nil {
+		return false
+	}
+	l.insertAll(reorder.expire(now))
+	return len(reorder.held) > 0
+}
+
+func (l *ReassemblyList) insertAll(frames []*FrameBuf) {
+	for _, frame := range frames {
+		l.insert(frame)
+	}
+}
+
+func (l *ReassemblyList) insert(frame *FrameBuf) {
 	// If this is the first frame, write all complete packets to the wire and
 	// add the frame to the reassembly list if it contains a fragment at the end.
 	if l.entries.Len() == 0 {
@@ -217,6 +276,18 @@ func (l *ReassemblyList) removeProcessed() {
 	}
 }
 
+// close releases all frames, including those held back for reordering or FEC
+// recovery.
+func (l *ReassemblyList) close() {
+	l.removeAll()
+	if l.reorder != nil {
+		l.reorder.releaseAll()
+	}
+	if l.fec != nil {
+		l.fec.releaseAll()
+	}
+}
+
 func (l *ReassemblyList) removeAll() {
 	l.removeBefore(nil)
 }
@@ -0,0 +1,98 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/go/sig/mgmt"
+)
+
+// workerReg contains the running workers, keyed by their dispatch string. It is
+// only used to report their status, as the dispatcher keeps its own map.
+var workerReg sync.Map
+
+// WorkerStatus is a snapshot of the state of an ingress worker. As the
+// reassembly lists are only accessed by the worker's goroutine, the snapshot is
+// taken periodically by the worker itself, at the time indicated by Updated.
+type WorkerStatus struct {
+	Remote  string
+	SessId  mgmt.SessionType
+	Updated time.Time
+	Rlists  []RlistStatus
+}
+
+// RlistStatus is a snapshot of the state of a reassembly list.
+type RlistStatus struct {
+	Epoch int
+	// Frames is the number of frames in the list, waiting for packets to be
+	// completed. FirstSeqNr and LastSeqNr are -1 if it is 0.
+	Frames     int
+	FirstSeqNr int
+	LastSeqNr  int
+	// Held is the number of frames held back for reordering or FEC recovery.
+	Held int
+	FEC  bool
+}
+
+// Workers returns the status of all running ingress workers.
+func Workers() []*WorkerStatus {
+	statuses := []*WorkerStatus{}
+	workerReg.Range(func(key, value interface{}) bool {
+		statuses = append(statuses, value.(*Worker).Status())
+		return true
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Remote != statuses[j].Remote {
+			return statuses[i].Remote < statuses[j].Remote
+		}
+		return statuses[i].SessId < statuses[j].SessId
+	})
+	return statuses
+}
+
+// Status returns the last snapshot of the worker's state.
+func (w *Worker) Status() *WorkerStatus {
+	return w.status.Load().(*WorkerStatus)
+}
+
+// updateStatus takes a new snapshot of the worker's state. It must only be
+// called from the worker's goroutine.
+func (w *Worker) updateStatus() {
+	s := &WorkerStatus{Remote: w.Remote.String(), SessId: w.SessId, Updated: time.Now()}
+	for _, rlist := range w.rlists {
+		s.Rlists = append(s.Rlists, rlist.status())
+	}
+	sort.Slice(s.Rlists, func(i, j int) bool { return s.Rlists[i].Epoch < s.Rlists[j].Epoch })
+	w.status.Store(s)
+}
+
+func (l *ReassemblyList) status() RlistStatus {
+	s := RlistStatus{Epoch: l.epoch, Frames: l.entries.Len(), FirstSeqNr: -1, LastSeqNr: -1}
+	if l.entries.Len() > 0 {
+		s.FirstSeqNr = l.entries.Front().Value.(*FrameBuf).seqNr
+		s.LastSeqNr = l.entries.Back().Value.(*FrameBuf).seqNr
+	}
+	if l.reorder != nil {
+		s.Held = len(l.reorder.held)
+	}
+	if l.fec != nil {
+		s.Held = len(l.fec.reorder.held)
+		s.FEC = true
+	}
+	return s
+}
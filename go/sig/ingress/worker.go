@@ -15,6 +15,8 @@
 package ingress
 
 import (
+	"flag"
+	"sync/atomic"
 	"time"
 
 	log "github.com/inconshreveable/log15"
@@ -35,6 +37,11 @@ const (
 	rlistCleanUpInterval = 1 * time.Second
 )
 
+var reorderWindow = flag.Int("reorderwindow", 0, "number of frames to hold back to "+
+	"tolerate reordering, e.g. from remote SIGs using multipath striping (0 disables)")
+var reorderTimeout = flag.Duration("reordertimeout", 200*time.Millisecond, "maximum time "+
+	"frames are held back waiting for missing frames, should be a few path RTTs (0 disables)")
+
 type sender interface {
 	send(common.RawBytes) error
 }
@@ -48,6 +55,12 @@ type Worker struct {
 	rlists           map[int]*ReassemblyList
 	markedForCleanup bool
 	sentCtrs         metrics.CtrPair
+	// *WorkerStatus
+	status atomic.Value
+	// holding is 1 if any reassembly list holds back frames, 0 otherwise.
+	holding int32
+	// done is closed when Run returns.
+	done chan struct{}
 }
 
 func NewWorker(remote *snet.Addr, sessId mgmt.SessionType) *Worker {
@@ -63,6 +76,7 @@ func NewWorker(remote *snet.Addr, sessId mgmt.SessionType) *Worker {
 		SessId: sessId,
 		Ring:   ringbuf.New(64, nil, "ingress", ringLabels),
 		rlists: make(map[int]*ReassemblyList),
+		done:   make(chan struct{}),
 		sentCtrs: metrics.CtrPair{
 			Pkts: metrics.PktsSent.WithLabelValues(remote.IA.String(),
 				sessId.String()),
@@ -70,6 +84,7 @@ func NewWorker(remote *snet.Addr, sessId mgmt.SessionType) *Worker {
 				sessId.String()),
 		},
 	}
+	worker.updateStatus()
 	return worker
 }
 
@@ -81,23 +96,32 @@ func (w *Worker) Stop() {
 func (w *Worker) Run() {
 	defer liblog.LogPanicAndExit()
 	w.Info("IngressWorker starting")
+	defer close(w.done)
+	if *reorderTimeout > 0 {
+		go w.flushTicker()
+	}
 	frames := make(ringbuf.EntryList, 64)
 	lastCleanup := time.Now()
 	for {
 		// This might block indefinitely, thus cleanup will be deferred. However,
 		// this is not an issue, since if there is nothing to read we also don't need
-		// to do any cleanup.
+		// to do any cleanup. While frames are held back, flushTicker wakes the
+		// worker up.
 		n, _ := w.Ring.Read(frames, true)
 		if n < 0 {
 			break
 		}
 		for i := 0; i < n; i++ {
-			frame := frames[i].(*FrameBuf)
-			w.processFrame(frame)
+			// Entries written by flushTicker are nil.
+			if frame, ok := frames[i].(*FrameBuf); ok {
+				w.processFrame(frame)
+			}
 			frames[i] = nil
 		}
+		w.flush()
 		if time.Since(lastCleanup) >= rlistCleanUpInterval {
 			w.cleanup()
+			w.updateStatus()
 			lastCleanup = time.Now()
 		}
 	}
@@ -108,29 +132,51 @@ func (w *Worker) Run() {
 // packets to the wire and then adding the frame to the corresponding reassembly
 // list if needed.
 func (w *Worker) processFrame(frame *FrameBuf) {
-	epoch := int(common.Order.Uint16(frame.raw[1:3]))
-	seqNr := int(common.Order.UintN(frame.raw[3:6], 3))
-	index := int(common.Order.Uint16(frame.raw[6:8]))
-	frame.seqNr = seqNr
-	frame.index = index
-	frame.snd = w
-	//w.Debug("Received Frame", "seqNr", seqNr, "index", index, "epoch", epoch,
+	epoch := frame.initFromHdr(w)
+	//w.Debug("Received Frame", "seqNr", frame.seqNr, "index", frame.index, "epoch", epoch,
 	//	"len", frame.frameLen)
-	// If index == 1 then we can be sure that there is no fragment at the beginning
-	// of the frame.
-	frame.fragNProcessed = index == 1
-	// If index == 0 then we can be sure that there are no complete packets in this
-	// frame.
-	frame.completePktsProcessed = index == 0
 	// Add to frame buf reassembly list.
 	rlist := w.getRlist(epoch)
 	rlist.Insert(frame)
 }
 
+// flush passes on the frames held back for longer than the reordering timeout,
+// and records whether frames are still held back.
+func (w *Worker) flush() {
+	var holding int32
+	now := time.Now()
+	for _, rlist := range w.rlists {
+		if rlist.Flush(now) {
+			holding = 1
+		}
+	}
+	atomic.StoreInt32(&w.holding, holding)
+}
+
+// flushTicker wakes up the worker periodically while frames are held back, so
+// that they are flushed even if no further frames are received.
+func (w *Worker) flushTicker() {
+	defer liblog.LogPanicAndExit()
+	ticker := time.NewTicker(*reorderTimeout / 2)
+	defer ticker.Stop()
+	wakeup := make(ringbuf.EntryList, 1)
+	for {
+		select {
+		case <-ticker.C:
+			if atomic.LoadInt32(&w.holding) != 0 {
+				w.Ring.Write(wakeup, false)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
 func (w *Worker) getRlist(epoch int) *ReassemblyList {
 	rlist, ok := w.rlists[epoch]
 	if !ok {
-		rlist = NewReassemblyList(epoch, reassemblyListCap, w)
+		rlist = NewReassemblyList(epoch, reassemblyListCap, *reorderWindow, *reorderTimeout,
+			w)
 		w.rlists[epoch] = rlist
 	}
 	rlist.markedForDeletion = false
@@ -144,7 +190,7 @@ func (w *Worker) cleanup() {
 			// Remove the reassembly list from the map and then release all frames
 			// back to the bufpool.
 			delete(w.rlists, epoch)
-			go rlist.removeAll()
+			go rlist.close()
 		} else {
 			// Mark the reassembly list for deletion. If it is not accessed between now
 			// and the next cleanup interval, it will be removed.
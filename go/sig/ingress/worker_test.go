@@ -0,0 +1,241 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingress
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/ringbuf"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/util"
+	"github.com/scionproto/scion/go/sig/metrics"
+	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/xnet/memtun"
+)
+
+const testTimeout = 100 * time.Millisecond
+
+// mkFrames encapsulates pkts into SIG frames of (at most) frameLen bytes,
+// using the same framing as the egress worker.
+func mkFrames(pkts []common.RawBytes, frameLen int, epoch uint16) []common.RawBytes {
+	var frames []common.RawBytes
+	var f common.RawBytes
+	var idx uint16
+	flush := func() {
+		common.Order.PutUint16(f[1:3], epoch)
+		common.Order.PutUintN(f[3:6], uint64(len(frames)), 3)
+		common.Order.PutUint16(f[6:8], idx)
+		frames = append(frames, f)
+		f = make(common.RawBytes, sigcmn.SIGHdrSize, frameLen)
+		idx = 0
+	}
+	f = make(common.RawBytes, sigcmn.SIGHdrSize, frameLen)
+	for _, pkt := range pkts {
+		f = append(f, make(common.RawBytes, util.CalcPadding(len(f), 8))...)
+		if idx == 0 {
+			idx = uint16(len(f) / 8)
+		}
+		f = append(f, 0, 0)
+		common.Order.PutUint16(f[len(f)-2:], uint16(len(pkt)))
+		for rest := pkt; len(rest) > 0; {
+			n := copy(f[len(f):cap(f)], rest)
+			f = f[:len(f)+n]
+			rest = rest[n:]
+			if cap(f)-len(f) < 16 {
+				flush()
+			}
+		}
+	}
+	if len(f) > sigcmn.SIGHdrSize {
+		flush()
+	}
+	return frames
+}
+
+// addParity adds an FEC parity frame after every group of n data frames.
+func addParity(frames []common.RawBytes, n int) []common.RawBytes {
+	var out []common.RawBytes
+	for start := 0; start < len(frames); start += n {
+		end := start + n
+		if end > len(frames) {
+			end = len(frames)
+		}
+		hdrLen := sigcmn.SIGHdrSize + sigcmn.FECHdrSize
+		parity := make(common.RawBytes, hdrLen)
+		copy(parity, frames[start][:sigcmn.SIGHdrSize])
+		common.Order.PutUint16(parity[6:8], sigcmn.FECParityIndex)
+		var lenXor, idxXor uint16
+		for _, f := range frames[start:end] {
+			out = append(out, f)
+			lenXor ^= uint16(len(f))
+			idxXor ^= common.Order.Uint16(f[6:8])
+			pld := f[sigcmn.SIGHdrSize:]
+			if len(parity) < hdrLen+len(pld) {
+				parity = append(parity, make(common.RawBytes, hdrLen+len(pld)-len(parity))...)
+			}
+			for i := range pld {
+				parity[hdrLen+i] ^= pld[i]
+			}
+		}
+		common.Order.PutUint16(parity[8:10], lenXor)
+		common.Order.PutUint16(parity[10:12], idxXor)
+		parity[12] = uint8(end - start)
+		out = append(out, parity)
+	}
+	return out
+}
+
+func mkPkt(l int, fill byte) common.RawBytes {
+	pkt := make(common.RawBytes, l)
+	for i := range pkt {
+		pkt[i] = fill
+	}
+	return pkt
+}
+
+func setupWorker() (*Worker, io.ReadWriter) {
+	p := memtun.New()
+	tun, _ := p.ConnectTun(tunDevName)
+	tunIO = tun
+	remote := &snet.Addr{IA: &addr.ISD_AS{I: 1, A: 10}, Host: addr.HostFromIP(nil)}
+	return NewWorker(remote, 0), p.Tun(tunDevName).Host()
+}
+
+func feed(w *Worker, frames []common.RawBytes) {
+	bufs := make(ringbuf.EntryList, 1)
+	for _, raw := range frames {
+		// Frames are released back to freeFrames once processed.
+		freeFrames.Read(bufs, true)
+		frame := bufs[0].(*FrameBuf)
+		frame.frameLen = copy(frame.raw, raw)
+		w.processFrame(frame)
+	}
+}
+
+func readPkts(host io.Reader, n int) []common.RawBytes {
+	var pkts []common.RawBytes
+	c := make(chan common.RawBytes)
+	go func() {
+		for i := 0; i < n; i++ {
+			b := make(common.RawBytes, common.MaxMTU)
+			l, err := host.Read(b)
+			if err != nil {
+				break
+			}
+			c <- b[:l]
+		}
+		close(c)
+	}()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case pkt, ok := <-c:
+			if !ok {
+				return pkts
+			}
+			pkts = append(pkts, pkt)
+		case <-timeout:
+			return pkts
+		}
+	}
+}
+
+func TestWorker(t *testing.T) {
+	Convey("Setup", t, func() {
+		w, host := setupWorker()
+		pkts := []common.RawBytes{mkPkt(100, 1), mkPkt(1000, 2), mkPkt(50, 3), mkPkt(2000, 4)}
+		frames := mkFrames(pkts, 512, 1)
+		Convey("Packets are reassembled from in-order frames", func() {
+			feed(w, frames)
+			SoMsg("pkts", readPkts(host, len(pkts)), ShouldResemble, pkts)
+		})
+		Convey("Packets spanning a lost frame are dropped", func() {
+			// Frame 1 only contains part of the second packet.
+			feed(w, append(frames[:1:1], frames[2:]...))
+			out := readPkts(host, len(pkts))
+			SoMsg("first pkt", out[0], ShouldResemble, pkts[0])
+			SoMsg("later pkts", out[1:], ShouldResemble, pkts[2:])
+		})
+		Convey("With a reordering window", func() {
+			*reorderWindow = 2
+			Reset(func() { *reorderWindow = 0 })
+			Convey("Reordered frames are reassembled", func() {
+				reordered := []common.RawBytes{frames[0], frames[2], frames[1], frames[3],
+					frames[5], frames[4], frames[6]}
+				feed(w, reordered)
+				SoMsg("pkts", readPkts(host, len(pkts)), ShouldResemble, pkts)
+			})
+			Convey("A lost frame is skipped once the window is exceeded", func() {
+				feed(w, append(frames[:1:1], frames[2:]...))
+				out := readPkts(host, len(pkts))
+				SoMsg("first pkt", out[0], ShouldResemble, pkts[0])
+				SoMsg("later pkts", out[1:], ShouldResemble, pkts[2:])
+			})
+		})
+		Convey("A lost frame is skipped after the reordering timeout", func() {
+			*reorderWindow = 16
+			*reorderTimeout = 20 * time.Millisecond
+			Reset(func() {
+				*reorderWindow = 0
+				*reorderTimeout = 200 * time.Millisecond
+			})
+			go w.Run()
+			Reset(w.Stop)
+			// No further frames follow the lost frame 1, so the window is never exceeded.
+			bufs := make(ringbuf.EntryList, 1)
+			for _, raw := range append(frames[:1:1], frames[2:]...) {
+				freeFrames.Read(bufs, true)
+				frame := bufs[0].(*FrameBuf)
+				frame.frameLen = copy(frame.raw, raw)
+				w.Ring.Write(bufs, true)
+			}
+			out := readPkts(host, len(pkts))
+			SoMsg("pkts", out, ShouldResemble, append(pkts[:1:1], pkts[2:]...))
+		})
+		Convey("A lost frame is recovered with FEC", func() {
+			// Data frames 0-2 form the first FEC group, frames 3-5 the second.
+			// FEC is only used once the first parity frame is received.
+			fecFrames := addParity(frames, 3)
+			// Drop frame 4, which only contains part of the last packet.
+			feed(w, append(fecFrames[:5:5], fecFrames[6:]...))
+			SoMsg("pkts", readPkts(host, len(pkts)), ShouldResemble, pkts)
+		})
+		Convey("Two lost frames in the same FEC group are not recovered", func() {
+			fecFrames := addParity(frames, 3)
+			// Drop frames 3 and 4, which only contain parts of the last packet.
+			feed(w, append(fecFrames[:4:4], fecFrames[6:]...))
+			SoMsg("pkts", readPkts(host, len(pkts)), ShouldResemble, pkts[:3])
+		})
+	})
+}
+
+func TestMain(m *testing.M) {
+	l := log.Root()
+	l.SetHandler(log.DiscardHandler())
+	metrics.Init("test")
+	freeFrames = ringbuf.New(freeFramesCap, func() interface{} {
+		return NewFrameBuf()
+	}, "ingress", prometheus.Labels{"ringId": "freeFrames", "sessId": ""})
+	os.Exit(m.Run())
+}
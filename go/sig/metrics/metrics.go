@@ -51,6 +51,14 @@ var (
 	FramesDiscarded    prometheus.Counter
 	FramesTooOld       prometheus.Counter
 	FramesDuplicated   prometheus.Counter
+	FramesReordered    prometheus.Counter
+	PktsTooBig         *prometheus.CounterVec
+	// FEC metrics. The recovery rate is FramesRecovered / (FramesRecovered +
+	// FramesUnrecoverable).
+	FECParityFramesSent *prometheus.CounterVec
+	FECParityFramesRecv prometheus.Counter
+	FramesRecovered     prometheus.Counter
+	FramesUnrecoverable prometheus.Counter
 )
 
 // Ensure all metrics are registered.
@@ -89,6 +97,17 @@ func Init(elem string) {
 	FramesDiscarded = newC("frames_discarded_total", "Number of frames discarded.")
 	FramesTooOld = newC("frames_too_old_total", "Number of frames that are too old.")
 	FramesDuplicated = newC("frames_duplicated_total", "Number of duplicate frames.")
+	FramesReordered = newC("frames_reordered_total",
+		"Number of frames received out of order, and held back for reordering.")
+	PktsTooBig = newCVec("pkts_too_big_total",
+		"Number of packets dropped with an ICMP packet too big error.", iaLabels)
+	FECParityFramesSent = newCVec("fec_parity_frames_sent_total",
+		"Number of FEC parity frames sent.", iaLabels)
+	FECParityFramesRecv = newC("fec_parity_frames_recv_total",
+		"Number of FEC parity frames received.")
+	FramesRecovered = newC("frames_recovered_total", "Number of lost frames recovered by FEC.")
+	FramesUnrecoverable = newC("frames_unrecoverable_total",
+		"Number of lost frames that could not be recovered by FEC.")
 
 	// Initialize ringbuf metrics.
 	ringbuf.InitMetrics("sig", constLabels, []string{"ringId", "sessId"})
@@ -28,10 +28,14 @@ var _ proto.Cerealizable = (*poll)(nil)
 type poll struct {
 	Addr    *Addr
 	Session SessionType
+	// FecGroup is the number of data frames per FEC parity frame. In a
+	// PollReq it is the group size requested by the egress SIG, in a PollRep
+	// the group size the ingress SIG supports. 0 means FEC is disabled.
+	FecGroup uint8
 }
 
-func newPoll(a *Addr, s SessionType) *poll {
-	return &poll{Addr: a, Session: s}
+func newPoll(a *Addr, s SessionType, fecGroup uint8) *poll {
+	return &poll{Addr: a, Session: s, FecGroup: fecGroup}
 }
 
 func (p *poll) ProtoId() proto.ProtoIdType {
@@ -43,21 +47,21 @@ func (p *poll) Write(b common.RawBytes) (int, error) {
 }
 
 func (p *poll) String() string {
-	return fmt.Sprintf("%s Session: %s", p.Addr, p.Session)
+	return fmt.Sprintf("%s Session: %s FecGroup: %d", p.Addr, p.Session, p.FecGroup)
 }
 
 type PollReq struct {
 	*poll
 }
 
-func NewPollReq(a *Addr, s SessionType) *PollReq {
-	return &PollReq{newPoll(a, s)}
+func NewPollReq(a *Addr, s SessionType, fecGroup uint8) *PollReq {
+	return &PollReq{newPoll(a, s, fecGroup)}
 }
 
 type PollRep struct {
 	*poll
 }
 
-func NewPollRep(a *Addr, s SessionType) *PollRep {
-	return &PollRep{newPoll(a, s)}
+func NewPollRep(a *Addr, s SessionType, fecGroup uint8) *PollRep {
+	return &PollRep{newPoll(a, s, fecGroup)}
 }
@@ -29,6 +29,7 @@ import (
 	"github.com/scionproto/scion/go/lib/addr"
 	"github.com/scionproto/scion/go/lib/common"
 	liblog "github.com/scionproto/scion/go/lib/log"
+	"github.com/scionproto/scion/go/sig/api"
 	"github.com/scionproto/scion/go/sig/base"
 	"github.com/scionproto/scion/go/sig/config"
 	"github.com/scionproto/scion/go/sig/disp"
@@ -36,6 +37,7 @@ import (
 	"github.com/scionproto/scion/go/sig/ingress"
 	"github.com/scionproto/scion/go/sig/metrics"
 	"github.com/scionproto/scion/go/sig/sigcmn"
+	"github.com/scionproto/scion/go/sig/xnet"
 )
 
 var sighup chan os.Signal
@@ -92,6 +94,9 @@ func main() {
 		fatal("Unable to load config on startup")
 	}
 	go reloadOnSIGHUP(*cfgPath)
+	if err := api.Start(); err != nil {
+		fatal("Unable to start status and control API", "err", err)
+	}
 
 	// Spawn ingress Dispatcher.
 	if err := ingress.Init(); err != nil {
@@ -119,6 +124,9 @@ func checkPerms() error {
 	if user.Uid == "0" {
 		return common.NewBasicError("Running as root is not allowed for security reasons", nil)
 	}
+	if !xnet.Provider.Privileged() {
+		return nil
+	}
 	caps, err := capability.NewPid(0)
 	if err != nil {
 		return common.NewBasicError("Error retrieving capabilities", err)
@@ -33,6 +33,16 @@ const (
 	DefaultEncapPort = 10080
 	MaxPort          = (1 << 16) - 1
 	SIGHdrSize       = 8
+	// FECHdrSize is the size of the FEC header following the SIG frame header
+	// in parity frames.
+	FECHdrSize = 8
+	// FECParityIndex is the SIG frame index used to mark FEC parity frames.
+	FECParityIndex = 0xFFFF
+	// MaxFECGroup is the maximum number of data frames per FEC parity frame.
+	MaxFECGroup = 32
+	// MaxMultipath is the maximum number of paths a session can stripe frames
+	// across.
+	MaxMultipath = 8
 )
 
 var (
@@ -51,6 +61,14 @@ var (
 	MgmtAddr *mgmt.Addr
 )
 
+// DataConn is the connection SIG frames are sent and received on. It is implemented by
+// *snet.Conn, and allows exchanging frames over other transports, e.g., in tests.
+type DataConn interface {
+	ReadFromSCION(b []byte) (int, *snet.Addr, error)
+	WriteToSCION(b []byte, raddr *snet.Addr) (int, error)
+	Close() error
+}
+
 func Init(ia *addr.ISD_AS, ip net.IP) error {
 	var err error
 	IA = ia
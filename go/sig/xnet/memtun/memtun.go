@@ -0,0 +1,209 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memtun defines an in-memory xnet.TunProvider, where packets are
+// exchanged between the SIG and the (simulated) host via channels. It does not
+// require any privileges, and is intended for testing.
+package memtun
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/sig/xnet"
+)
+
+const (
+	// Number of packets that can fit into Tun buffers until the writer blocks
+	PktBufferSize = 64
+)
+
+var _ xnet.TunProvider = (*Provider)(nil)
+
+// Provider keeps track of the in-memory TUN devices it created.
+type Provider struct {
+	mu   sync.Mutex
+	tuns map[string]*Tun
+}
+
+func New() *Provider {
+	return &Provider{tuns: make(map[string]*Tun)}
+}
+
+// ConnectTun returns the device called name, creating it if it doesn't exist
+// yet.
+func (p *Provider) ConnectTun(name string) (xnet.Tun, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.tuns[name]; ok {
+		return t, nil
+	}
+	t := newTun(p, name)
+	p.tuns[name] = t
+	return t, nil
+}
+
+func (p *Provider) Privileged() bool {
+	return false
+}
+
+// Tun returns the device called name, or nil if it doesn't exist.
+func (p *Provider) Tun(name string) *Tun {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tuns[name]
+}
+
+func (p *Provider) delete(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.tuns, name)
+}
+
+var _ xnet.Tun = (*Tun)(nil)
+
+// Tun is an in-memory TUN device. Read and Write are used by the SIG, while
+// the host side of the device is accessible via Host.
+type Tun struct {
+	p    *Provider
+	name string
+	// Packets written by the SIG, to be read by the host.
+	toHost chan common.RawBytes
+	// Packets written by the host, to be read by the SIG.
+	fromHost  chan common.RawBytes
+	closed    chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	routes    map[string]*net.IPNet
+}
+
+func newTun(p *Provider, name string) *Tun {
+	return &Tun{
+		p:        p,
+		name:     name,
+		toHost:   make(chan common.RawBytes, PktBufferSize),
+		fromHost: make(chan common.RawBytes, PktBufferSize),
+		closed:   make(chan struct{}),
+		routes:   make(map[string]*net.IPNet),
+	}
+}
+
+func (t *Tun) Read(b []byte) (int, error) {
+	return read(b, t.fromHost, t.closed)
+}
+
+func (t *Tun) Write(b []byte) (int, error) {
+	return write(b, t.toHost, t.closed)
+}
+
+func (t *Tun) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+func (t *Tun) Name() string {
+	return t.name
+}
+
+func (t *Tun) AddRoute(dst *net.IPNet) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := dst.String()
+	if _, ok := t.routes[key]; ok {
+		return common.NewBasicError("Route already exists", nil, "dev", t.name, "dst", dst)
+	}
+	t.routes[key] = dst
+	return nil
+}
+
+func (t *Tun) DelRoute(dst *net.IPNet) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := dst.String()
+	if _, ok := t.routes[key]; !ok {
+		return common.NewBasicError("Route not found", nil, "dev", t.name, "dst", dst)
+	}
+	delete(t.routes, key)
+	return nil
+}
+
+func (t *Tun) Delete() error {
+	t.mu.Lock()
+	t.routes = make(map[string]*net.IPNet)
+	t.mu.Unlock()
+	t.p.delete(t.name)
+	return nil
+}
+
+// Routes returns the networks currently routed via the device.
+func (t *Tun) Routes() []*net.IPNet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	routes := make([]*net.IPNet, 0, len(t.routes))
+	for _, r := range t.routes {
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+// Routed returns true if ip is covered by a route via the device.
+func (t *Tun) Routed(ip net.IP) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range t.routes {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Host returns the host side of the device. Packets written to it can be read
+// by the SIG, and packets written by the SIG can be read from it.
+func (t *Tun) Host() io.ReadWriter {
+	return &hostEnd{t: t}
+}
+
+type hostEnd struct {
+	t *Tun
+}
+
+func (h *hostEnd) Read(b []byte) (int, error) {
+	return read(b, h.t.toHost, h.t.closed)
+}
+
+func (h *hostEnd) Write(b []byte) (int, error) {
+	return write(b, h.t.fromHost, h.t.closed)
+}
+
+func read(b []byte, c <-chan common.RawBytes, closed <-chan struct{}) (int, error) {
+	select {
+	case pkt := <-c:
+		return copy(b, pkt), nil
+	case <-closed:
+		return 0, io.EOF
+	}
+}
+
+func write(b []byte, c chan<- common.RawBytes, closed <-chan struct{}) (int, error) {
+	pkt := append(common.RawBytes(nil), b...)
+	select {
+	case c <- pkt:
+		return len(b), nil
+	case <-closed:
+		return 0, common.NewBasicError("memtun device closed", nil)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtun
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTun(t *testing.T) {
+	Convey("Setup", t, func() {
+		p := New()
+		xtun, err := p.ConnectTun("scion-1-10")
+		SoMsg("connect err", err, ShouldBeNil)
+		tun := p.Tun("scion-1-10")
+		SoMsg("tun", tun, ShouldEqual, xtun)
+		b := make([]byte, 16)
+		Convey("Reconnecting returns the same device", func() {
+			xtun2, err := p.ConnectTun("scion-1-10")
+			SoMsg("err", err, ShouldBeNil)
+			SoMsg("tun", xtun2, ShouldEqual, xtun)
+		})
+		Convey("SIG to host", func() {
+			_, err := tun.Write([]byte{1, 2, 3})
+			SoMsg("write err", err, ShouldBeNil)
+			n, err := tun.Host().Read(b)
+			SoMsg("read err", err, ShouldBeNil)
+			SoMsg("read", b[:n], ShouldResemble, []byte{1, 2, 3})
+		})
+		Convey("Host to SIG", func() {
+			_, err := tun.Host().Write([]byte{4, 5})
+			SoMsg("write err", err, ShouldBeNil)
+			n, err := tun.Read(b)
+			SoMsg("read err", err, ShouldBeNil)
+			SoMsg("read", b[:n], ShouldResemble, []byte{4, 5})
+		})
+		Convey("Read after close returns EOF", func() {
+			SoMsg("close err", tun.Close(), ShouldBeNil)
+			_, err := tun.Read(b)
+			SoMsg("read err", err, ShouldEqual, io.EOF)
+			_, err = tun.Write(b)
+			SoMsg("write err", err, ShouldNotBeNil)
+		})
+		Convey("Routes", func() {
+			_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+			SoMsg("add err", tun.AddRoute(ipnet), ShouldBeNil)
+			SoMsg("add dup err", tun.AddRoute(ipnet), ShouldNotBeNil)
+			SoMsg("routes", tun.Routes(), ShouldResemble, []*net.IPNet{ipnet})
+			SoMsg("routed", tun.Routed(net.ParseIP("10.1.2.3")), ShouldBeTrue)
+			SoMsg("not routed", tun.Routed(net.ParseIP("192.168.1.1")), ShouldBeFalse)
+			SoMsg("del err", tun.DelRoute(ipnet), ShouldBeNil)
+			SoMsg("del missing err", tun.DelRoute(ipnet), ShouldNotBeNil)
+			SoMsg("routes after del", tun.Routes(), ShouldBeEmpty)
+		})
+		Convey("Delete removes the device", func() {
+			tun.Close()
+			SoMsg("delete err", tun.Delete(), ShouldBeNil)
+			SoMsg("tun", p.Tun("scion-1-10"), ShouldBeNil)
+		})
+	})
+}
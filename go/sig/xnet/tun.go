@@ -0,0 +1,47 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xnet
+
+import (
+	"io"
+	"net"
+)
+
+// Provider is the TunProvider used by the SIG to create its TUN devices.
+var Provider TunProvider = NetlinkProvider{}
+
+// TunProvider creates TUN devices. It allows the SIG data plane to run on top
+// of something other than kernel TUN devices (e.g., in unprivileged tests).
+type TunProvider interface {
+	// ConnectTun creates (or opens) the TUN device name, and brings it up.
+	ConnectTun(name string) (Tun, error)
+	// Privileged returns true if the provider requires CAP_NET_ADMIN.
+	Privileged() bool
+}
+
+// Tun is a TUN device. Packets routed to the device by the host can be read
+// from it, and packets written to it are delivered to the host.
+type Tun interface {
+	io.ReadWriteCloser
+	// Name returns the name of the device.
+	Name() string
+	// AddRoute routes the network dst via the device.
+	AddRoute(dst *net.IPNet) error
+	// DelRoute removes the route for the network dst via the device.
+	DelRoute(dst *net.IPNet) error
+	// Delete removes the device, and all routes via it. Close must be called
+	// first.
+	Delete() error
+}
@@ -33,6 +33,23 @@ const (
 	SIGTxQlen    = 1000
 )
 
+// NetlinkProvider is the default TunProvider. It creates kernel TUN devices,
+// and manages routes via netlink, which requires CAP_NET_ADMIN.
+type NetlinkProvider struct{}
+
+func (NetlinkProvider) ConnectTun(name string) (Tun, error) {
+	link, tunIO, err := ConnectTun(name)
+	if err != nil {
+		return nil, err
+	}
+	return &netlinkTun{ReadWriteCloser: tunIO, name: name, link: link}, nil
+}
+
+func (NetlinkProvider) Privileged() bool {
+	return true
+}
+
+// ConnectTun creates (or opens) interface name, and then sets its state to up
 // ConnectTun creates (or opens) interface name, and then sets its state to up
 func ConnectTun(name string) (netlink.Link, io.ReadWriteCloser, error) {
 	tun, err := water.New(water.Config{
@@ -72,3 +89,41 @@ func NewRoute(link netlink.Link, dest *net.IPNet) *netlink.Route {
 		Priority: SIGRPriority, Table: SIGRTable,
 	}
 }
+
+var _ Tun = (*netlinkTun)(nil)
+
+type netlinkTun struct {
+	io.ReadWriteCloser
+	name string
+	link netlink.Link
+}
+
+func (t *netlinkTun) Name() string {
+	return t.name
+}
+
+func (t *netlinkTun) AddRoute(dst *net.IPNet) error {
+	route := NewRoute(t.link, dst)
+	if err := netlink.RouteAdd(route); err != nil {
+		return common.NewBasicError("Unable to add route for remote network", err,
+			"route", route)
+	}
+	return nil
+}
+
+func (t *netlinkTun) DelRoute(dst *net.IPNet) error {
+	route := NewRoute(t.link, dst)
+	if err := netlink.RouteDel(route); err != nil {
+		return common.NewBasicError("Unable to delete route for remote network", err,
+			"route", route)
+	}
+	return nil
+}
+
+func (t *netlinkTun) Delete() error {
+	// The operating system also removes the routes when deleting the link.
+	if err := netlink.LinkDel(t.link); err != nil {
+		return common.NewBasicError("Error removing TUN link", err, "dev", t.name)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/lib/util"
+)
+
+func runChain(args []string) {
+	runSub("chain", "core | issue | verify", map[string]func([]string){
+		"core":   runChainCore,
+		"issue":  runChainIssue,
+		"verify": runChainVerify,
+	}, args)
+}
+
+// certFlags are the flags describing the subject of a new certificate.
+type certFlags struct {
+	signPub  *string
+	signAlgo *string
+	encPub   *string
+	validity *time.Duration
+	version  *uint64
+	comment  *string
+}
+
+func newCertFlags(fs *flag.FlagSet) *certFlags {
+	return &certFlags{
+		signPub:  fs.String("signpub", "", "Public signing key file of the subject (Required)"),
+		signAlgo: fs.String("signalgo", crypto.Ed25519, "Algorithm of the signing key"),
+		encPub:   fs.String("encpub", "", "Public encryption key file of the subject"),
+		validity: fs.Duration("validity", Year, "Validity period, capped by the issuer"),
+		version:  fs.Uint64("version", 1, "Certificate version"),
+		comment:  fs.String("comment", "", "Certificate comment"),
+	}
+}
+
+// newCert creates an unsigned certificate for subject, which expires at the latest at maxExp.
+func (f *certFlags) newCert(subject, issuer *addr.ISD_AS, trcVer, maxExp uint64) *cert.Certificate {
+	now := timestamp(time.Now())
+	exp := now + uint64(f.validity.Seconds())
+	if exp > maxExp {
+		exp = maxExp
+	}
+	c := &cert.Certificate{
+		Comment:        *f.comment,
+		ExpirationTime: exp,
+		Issuer:         issuer.Copy(),
+		IssuingTime:    now,
+		SignAlgorithm:  *f.signAlgo,
+		Subject:        subject.Copy(),
+		SubjectSignKey: loadPubKey(*f.signPub),
+		TRCVersion:     trcVer,
+		Version:        *f.version,
+	}
+	if *f.encPub != "" {
+		c.EncAlgorithm = crypto.Curve25519xSalsa20Poly1305
+		c.SubjectEncKey = loadPubKey(*f.encPub)
+	}
+	return c
+}
+
+// runChainCore creates the core certificate of a core AS, signed with its online root key. The
+// core certificate is the issuer certificate of all chains issued by the core AS.
+func runChainCore(args []string) {
+	fs := newFlagSet("chain core", "-trc FILE -as ISD-AS -key FILE -signpub FILE -out FILE")
+	trcFile := fs.String("trc", "", "TRC containing the core AS (Required)")
+	iaStr := fs.String("as", "", "Core AS (Required)")
+	keyFile := fs.String("key", "", "Online root key file of the core AS (Required)")
+	passFile := fs.String("passfile", "", "Password file of an encrypted key file")
+	out := fs.String("out", "", "Output certificate file (Required)")
+	cf := newCertFlags(fs)
+	fs.Parse(args)
+	required(fs, *trcFile, *iaStr, *keyFile, *cf.signPub, *out)
+	t := loadTRC(*trcFile)
+	ia := parseIA(*iaStr)
+	coreAS, ok := t.CoreASes[*ia]
+	if !ok {
+		fatal("%s is not a core AS of %s", ia, t)
+	}
+	c := cf.newCert(ia, ia, t.Version, t.ExpirationTime)
+	c.CanIssue = true
+	signer, err := trust.LoadSigner(*keyFile, loadPassword(*passFile))
+	if err != nil {
+		fatal("Unable to load key: %s", err)
+	}
+	if err = c.SignWith(signer, coreAS.OnlineKeyAlg); err != nil {
+		fatal("Unable to sign core certificate: %s", err)
+	}
+	raw, err := c.JSON(true)
+	if err != nil {
+		fatal("Unable to pack core certificate: %s", err)
+	}
+	writeFile(*out, raw, 0644)
+	fmt.Printf("Created core certificate %s, expires %s\n", c,
+		util.TimeToString(c.ExpirationTime))
+}
+
+// runChainIssue issues a certificate chain. The leaf certificate is signed with the core signing
+// key of the issuer, whose core certificate is taken from a core certificate or chain file.
+func runChainIssue(args []string) {
+	fs := newFlagSet("chain issue", "-core FILE -key FILE -as ISD-AS -signpub FILE -out FILE")
+	coreFile := fs.String("core", "", "Core certificate or chain file of the issuer (Required)")
+	keyFile := fs.String("key", "", "Core signing key file of the issuer (Required)")
+	passFile := fs.String("passfile", "", "Password file of an encrypted key file")
+	iaStr := fs.String("as", "", "Subject AS (Required)")
+	out := fs.String("out", "", "Output chain file (Required)")
+	cf := newCertFlags(fs)
+	fs.Parse(args)
+	required(fs, *coreFile, *keyFile, *iaStr, *cf.signPub, *out)
+	core := loadCoreCert(*coreFile)
+	if !core.CanIssue {
+		fatal("Core certificate %s cannot issue certificates", core)
+	}
+	leaf := cf.newCert(parseIA(*iaStr), core.Subject, core.TRCVersion, core.ExpirationTime)
+	signer, err := trust.LoadSigner(*keyFile, loadPassword(*passFile))
+	if err != nil {
+		fatal("Unable to load key: %s", err)
+	}
+	if err = leaf.SignWith(signer, core.SignAlgorithm); err != nil {
+		fatal("Unable to sign leaf certificate: %s", err)
+	}
+	if err = leaf.VerifySignature(core.SubjectSignKey, core.SignAlgorithm); err != nil {
+		fatal("Signing key does not match core certificate: %s", err)
+	}
+	chain := &cert.Chain{Leaf: leaf, Core: core}
+	raw, err := chain.JSON(true)
+	if err != nil {
+		fatal("Unable to pack certificate chain: %s", err)
+	}
+	writeFile(*out, raw, 0644)
+	fmt.Printf("Issued %s, expires %s\n", chain, util.TimeToString(leaf.ExpirationTime))
+}
+
+// runChainVerify verifies a certificate chain against the TRC of the issuer's ISD.
+func runChainVerify(args []string) {
+	fs := newFlagSet("chain verify", "-chain FILE -trc FILE [-as ISD-AS]")
+	chainFile := fs.String("chain", "", "Chain file to verify (Required)")
+	trcFile := fs.String("trc", "", "TRC of the issuing ISD (Required)")
+	iaStr := fs.String("as", "", "Expected subject (Default: subject of the leaf certificate)")
+	fs.Parse(args)
+	required(fs, *chainFile, *trcFile)
+	chain, t := loadChain(*chainFile), loadTRC(*trcFile)
+	subject := chain.Leaf.Subject
+	if *iaStr != "" {
+		subject = parseIA(*iaStr)
+	}
+	if err := chain.Verify(subject, t); err != nil {
+		fatal("Verification of %s against %s failed: %s", chain, t, err)
+	}
+	fmt.Printf("%s verified against %s\n", chain, t)
+}
+
+// loadCoreCert loads the core certificate from either a certificate or a chain file.
+func loadCoreCert(file string) *cert.Certificate {
+	raw := readFile(file)
+	if chain, err := cert.ChainFromRaw(raw, false); err == nil && chain.Core != nil {
+		return chain.Core
+	}
+	c, err := cert.CertificateFromRaw(raw)
+	if err != nil {
+		fatal("Unable to parse core certificate %s: %s", file, err)
+	}
+	return c
+}
+
+// loadPubKey reads a base64 encoded public key from file.
+func loadPubKey(file string) common.RawBytes {
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(readFile(file))))
+	if err != nil {
+		fatal("Unable to parse public key %s: %s", file, err)
+	}
+	return key
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto"
+)
+
+// runKeygen writes a new key pair to OUT.key and OUT.pub. The public key is written base64
+// encoded, as it appears in TRCs and certificates.
+func runKeygen(args []string) {
+	fs := newFlagSet("keygen", "-out PREFIX [flags]")
+	algo := fs.String("algo", crypto.Ed25519, fmt.Sprintf("Key algorithm (%s)",
+		strings.Join(append(crypto.SignAlgos(), crypto.Curve25519xSalsa20Poly1305), ", ")))
+	out := fs.String("out", "", "Prefix of the key files (Required)")
+	passFile := fs.String("passfile", "", "Encrypt the private key with this password file")
+	fs.Parse(args)
+	required(fs, *out)
+	pub, priv, err := genKeyPair(strings.ToLower(*algo))
+	if err != nil {
+		fatal("Unable to generate key pair: %s", err)
+	}
+	var rawPriv common.RawBytes
+	if password := loadPassword(*passFile); password != nil {
+		if rawPriv, err = crypto.EncryptKey(priv, password); err != nil {
+			fatal("Unable to encrypt private key: %s", err)
+		}
+	} else {
+		rawPriv = common.RawBytes(base64.StdEncoding.EncodeToString(priv))
+	}
+	writeFile(*out+".key", rawPriv, 0600)
+	writeFile(*out+".pub", []byte(base64.StdEncoding.EncodeToString(pub)), 0644)
+	fmt.Printf("Wrote %s key pair to %s.key and %s.pub\n", *algo, *out, *out)
+}
+
+// genKeyPair returns the public and the private key of a new key pair. In addition to the
+// signing algorithms, it supports the encryption algorithm of the AS decryption key.
+func genKeyPair(algo string) (common.RawBytes, common.RawBytes, error) {
+	if algo != crypto.Curve25519xSalsa20Poly1305 {
+		return crypto.GenKeyPair(algo)
+	}
+	var pub, priv [32]byte
+	if _, err := rand.Read(priv[:]); err != nil {
+		return nil, nil, err
+	}
+	curve25519.ScalarBaseMult(&pub, &priv)
+	return pub[:], priv[:], nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tool for offline TRC and certificate ceremonies. It creates keys, TRCs,
+// certificate chains and revocation lists, adds core AS signatures to TRCs,
+// verifies them, and pretty-prints plain and lz4 compressed trust objects:
+//
+//	scion-pki keygen -algo ed25519 -out ISD1/AS10/online-root
+//	scion-pki trc create -template ISD1.json -out ISD1-V1.trc
+//	scion-pki trc sign -trc ISD1-V1.trc -as 1-10 -key ISD1/AS10/online-root.key
+//	scion-pki trc verify -trc ISD1-V2.trc -prev ISD1-V1.trc
+//	scion-pki chain core -trc ISD1-V1.trc -as 1-10 -key online-root.key \
+//		-signpub core-sig.pub -out ISD1-AS10-core.cert
+//	scion-pki chain issue -core ISD1-AS10-core.cert -key core-sig.key -as 1-11 \
+//		-signpub as-sig.pub -encpub as-decrypt.pub -out ISD1-AS11-V1.crt
+//	scion-pki chain verify -chain ISD1-AS11-V1.crt -trc ISD1-V1.trc
+//	scion-pki revlist create -trc ISD1-V1.trc -as 1-10 -revoke ISD1-AS11-V1.crt \
+//		-out ISD1-AS10-V1.crl
+//	scion-pki revlist sign -revlist ISD1-AS10-V1.crl -trc ISD1-V1.trc -key online-root.key
+//	scion-pki show -lz4 chain.lz4
+//
+// Signed revocation lists are distributed by placing them in the certs directory of the
+// issuer's certificate server, or by importing them with the trustdb tool.
+//
+// Private keys are written base64 encoded, or encrypted if -passfile is given.
+// Any key file accepted by the infrastructure (see crypto.NewSigner) can be
+// used for signing.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+)
+
+// Year is the default validity period of TRCs and certificates.
+const Year = 365 * 24 * time.Hour
+
+type command struct {
+	run  func(args []string)
+	help string
+}
+
+var commands = map[string]command{
+	"keygen":  {runKeygen, "Generate a key pair"},
+	"trc":     {runTRC, "Create, sign and verify TRCs (create | sign | verify)"},
+	"chain":   {runChain, "Issue and verify certificate chains (core | issue | verify)"},
+	"revlist": {runRevList, "Create, sign and verify revocation lists (create | sign | verify)"},
+	"show":    {runShow, "Pretty-print TRCs, certificates and revocation lists"},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s COMMAND [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range []string{"keygen", "trc", "chain", "revlist", "show"} {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s COMMAND -h' for the flags of a command.\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	cmd.run(os.Args[2:])
+}
+
+// runSub dispatches to the subcommand named by the first argument.
+func runSub(name, synopsis string, subs map[string]func([]string), args []string) {
+	if len(args) > 0 {
+		if run, ok := subs[args[0]]; ok {
+			run(args[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s %s %s [flags]\n", os.Args[0], name, synopsis)
+	os.Exit(2)
+}
+
+// newFlagSet returns a flag set for the command, which prints usage with the given synopsis.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n", os.Args[0], name, synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// required exits with usage, if one of the values is empty.
+func required(fs *flag.FlagSet, values ...string) {
+	for _, v := range values {
+		if v == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func readFile(file string) common.RawBytes {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		fatal("Unable to read file: %s", err)
+	}
+	return raw
+}
+
+func writeFile(file string, raw []byte, perm os.FileMode) {
+	if err := ioutil.WriteFile(file, raw, perm); err != nil {
+		fatal("Unable to write file: %s", err)
+	}
+}
+
+// loadPassword reads the key password from file. An empty file name means no password.
+func loadPassword(file string) []byte {
+	if file == "" {
+		return nil
+	}
+	return bytes.TrimRight(readFile(file), "\r\n")
+}
+
+func parseIA(s string) *addr.ISD_AS {
+	ia, err := addr.IAFromString(s)
+	if err != nil {
+		fatal("Invalid ISD-AS %q: %s", s, err)
+	}
+	return ia
+}
+
+func loadTRC(file string) *trc.TRC {
+	t, err := trc.TRCFromRaw(readFile(file), false)
+	if err != nil {
+		fatal("Unable to parse TRC %s: %s", file, err)
+	}
+	return t
+}
+
+func writeTRC(file string, t *trc.TRC) {
+	raw, err := t.JSON(true)
+	if err != nil {
+		fatal("Unable to pack TRC: %s", err)
+	}
+	writeFile(file, raw, 0644)
+}
+
+func loadChain(file string) *cert.Chain {
+	chain, err := cert.ChainFromRaw(readFile(file), false)
+	if err == nil && (chain.Leaf == nil || chain.Core == nil) {
+		err = common.NewBasicError("Missing certificate", nil)
+	}
+	if err != nil {
+		fatal("Unable to parse certificate chain %s: %s", file, err)
+	}
+	return chain
+}
+
+// timestamp returns the unix timestamp of t in seconds.
+func timestamp(t time.Time) uint64 {
+	return uint64(t.Unix())
+}
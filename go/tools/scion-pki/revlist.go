@@ -0,0 +1,174 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+func runRevList(args []string) {
+	runSub("revlist", "create | sign | verify", map[string]func([]string){
+		"create": runRevListCreate,
+		"sign":   runRevListSign,
+		"verify": runRevListVerify,
+	}, args)
+}
+
+// fileList is a flag that can be given multiple times.
+type fileList []string
+
+func (l *fileList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// runRevListCreate creates an unsigned revocation list. It contains the entries of the previous
+// list, if given, and an entry for each revoked certificate. Revoking a chain revokes its leaf
+// certificate, core certificates are revoked by revoking the core certificate file.
+func runRevListCreate(args []string) {
+	fs := newFlagSet("revlist create", "-trc FILE -as ISD-AS -revoke FILE... -out FILE [flags]")
+	trcFile := fs.String("trc", "", "TRC containing the issuer (Required)")
+	iaStr := fs.String("as", "", "Issuing core AS (Required)")
+	prevFile := fs.String("prev", "", "Previous revocation list of the issuer")
+	version := fs.Uint64("version", 0, "Revocation list version (Default: previous version + 1)")
+	out := fs.String("out", "", "Output revocation list file (Required)")
+	var revoke fileList
+	fs.Var(&revoke, "revoke", "Certificate or chain file to revoke, can be repeated")
+	fs.Parse(args)
+	required(fs, *trcFile, *iaStr, *out)
+	t := loadTRC(*trcFile)
+	ia := parseIA(*iaStr)
+	if _, ok := t.CoreASes[*ia]; !ok {
+		fatal("%s is not a core AS of %s", ia, t)
+	}
+	now := timestamp(time.Now())
+	r := &cert.RevList{Issuer: ia, IssuingTime: now, TRCVersion: t.Version, Version: 1}
+	if *prevFile != "" {
+		prev := loadRevList(*prevFile)
+		if !prev.Issuer.Eq(ia) {
+			fatal("Previous revocation list %s is not issued by %s", prev, ia)
+		}
+		r.Entries = prev.Entries
+		r.Version = prev.Version + 1
+	}
+	if *version != 0 {
+		r.Version = *version
+	}
+	if len(revoke) == 0 && len(r.Entries) == 0 {
+		fatal("No certificates to revoke")
+	}
+	for _, file := range revoke {
+		c := loadRevokedCert(file)
+		if !c.Issuer.Eq(ia) {
+			fatal("%s is not issued by %s", c, ia)
+		}
+		if r.Revokes(c) != nil {
+			continue
+		}
+		r.Entries = append(r.Entries,
+			&cert.RevEntry{Subject: c.Subject.Copy(), Version: c.Version, RevocationTime: now})
+	}
+	writeRevList(*out, r)
+	fmt.Printf("Created %s with %d entries\n", r, len(r.Entries))
+}
+
+// runRevListSign signs a revocation list with the online root key of the issuer, and checks the
+// signature against the TRC.
+func runRevListSign(args []string) {
+	fs := newFlagSet("revlist sign", "-revlist FILE -trc FILE -key FILE [flags]")
+	revListFile := fs.String("revlist", "", "Revocation list file to sign (Required)")
+	trcFile := fs.String("trc", "", "TRC containing the issuer (Required)")
+	keyFile := fs.String("key", "", "Online root key file of the issuer (Required)")
+	passFile := fs.String("passfile", "", "Password file of an encrypted key file")
+	out := fs.String("out", "", "Output file (Default: overwrite the revocation list file)")
+	fs.Parse(args)
+	required(fs, *revListFile, *trcFile, *keyFile)
+	r, t := loadRevList(*revListFile), loadTRC(*trcFile)
+	coreAS, ok := t.CoreASes[*r.Issuer]
+	if !ok {
+		fatal("%s is not a core AS of %s", r.Issuer, t)
+	}
+	signer, err := trust.LoadSigner(*keyFile, loadPassword(*passFile))
+	if err != nil {
+		fatal("Unable to load key: %s", err)
+	}
+	if err = r.SignWith(signer, coreAS.OnlineKeyAlg); err != nil {
+		fatal("Unable to sign %s: %s", r, err)
+	}
+	if err = r.Verify(t); err != nil {
+		fatal("Verification of %s against %s failed: %s", r, t, err)
+	}
+	if *out == "" {
+		*out = *revListFile
+	}
+	writeRevList(*out, r)
+	fmt.Printf("Signed %s\n", r)
+}
+
+// runRevListVerify verifies a revocation list against the TRC of the issuer's ISD.
+func runRevListVerify(args []string) {
+	fs := newFlagSet("revlist verify", "-revlist FILE -trc FILE")
+	revListFile := fs.String("revlist", "", "Revocation list file to verify (Required)")
+	trcFile := fs.String("trc", "", "TRC of the issuing ISD (Required)")
+	fs.Parse(args)
+	required(fs, *revListFile, *trcFile)
+	r, t := loadRevList(*revListFile), loadTRC(*trcFile)
+	if err := r.Verify(t); err != nil {
+		fatal("Verification of %s against %s failed: %s", r, t, err)
+	}
+	fmt.Printf("%s verified against %s\n", r, t)
+}
+
+func loadRevList(file string) *cert.RevList {
+	r, err := cert.RevListFromRaw(readFile(file), false)
+	if err == nil && r.Issuer == nil {
+		err = common.NewBasicError("Missing issuer", nil)
+	}
+	if err != nil {
+		fatal("Unable to parse revocation list %s: %s", file, err)
+	}
+	return r
+}
+
+func writeRevList(file string, r *cert.RevList) {
+	raw, err := r.JSON(true)
+	if err != nil {
+		fatal("Unable to pack revocation list: %s", err)
+	}
+	writeFile(file, raw, 0644)
+}
+
+// loadRevokedCert loads the leaf certificate of a chain file, or a single certificate.
+func loadRevokedCert(file string) *cert.Certificate {
+	raw := readFile(file)
+	if chain, err := cert.ChainFromRaw(raw, false); err == nil && chain.Leaf != nil {
+		return chain.Leaf
+	}
+	c, err := cert.CertificateFromRaw(raw)
+	if err != nil || c.Subject == nil {
+		fatal("Unable to parse certificate %s: %v", file, err)
+	}
+	return c
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/crypto/cert"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/lib/util"
+)
+
+// decoder parses raw into a trust object. It returns nil, if raw does not contain an object of
+// its type.
+type decoder func(raw common.RawBytes, lz4 bool) trust.JSON
+
+// decoders are tried in order. A chain has no top-level fields of the other objects, and the
+// other objects are told apart by their mandatory fields.
+var decoders = []decoder{
+	func(raw common.RawBytes, lz4 bool) trust.JSON {
+		if c, err := cert.ChainFromRaw(raw, lz4); err == nil && c.Leaf != nil && c.Core != nil {
+			return c
+		}
+		return nil
+	},
+	func(raw common.RawBytes, lz4 bool) trust.JSON {
+		if t, err := trc.TRCFromRaw(raw, lz4); err == nil && t.CoreASes != nil {
+			return t
+		}
+		return nil
+	},
+	func(raw common.RawBytes, lz4 bool) trust.JSON {
+		if r, err := cert.RevListFromRaw(raw, lz4); err == nil && r.Issuer != nil {
+			return r
+		}
+		return nil
+	},
+	func(raw common.RawBytes, lz4 bool) trust.JSON {
+		if lz4 {
+			// Single certificates are never compressed.
+			return nil
+		}
+		if c, err := cert.CertificateFromRaw(raw); err == nil && c.Subject != nil {
+			return c
+		}
+		return nil
+	},
+}
+
+// runShow pretty-prints TRCs, certificate chains, certificates and revocation lists. Compressed
+// objects, as sent in control messages, are decompressed if -lz4 is given.
+func runShow(args []string) {
+	fs := newFlagSet("show", "[-lz4] FILE...")
+	lz4 := fs.Bool("lz4", false, "Files contain the lz4 compressed form")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, file := range fs.Args() {
+		raw := readFile(file)
+		if *lz4 && len(raw) < 4 {
+			fatal("%s: lz4 block too short", file)
+		}
+		obj := decode(raw, *lz4)
+		if obj == nil {
+			fatal("%s: Unknown trust object", file)
+		}
+		out, err := obj.JSON(true)
+		if err != nil {
+			fatal("%s: Unable to pack %s: %s", file, obj, err)
+		}
+		fmt.Printf("%s: %s\n", file, summary(obj))
+		fmt.Printf("%s\n", out)
+	}
+}
+
+func decode(raw common.RawBytes, lz4 bool) trust.JSON {
+	for _, d := range decoders {
+		if obj := d(raw, lz4); obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+// summary returns a one-line description of obj, including its validity period.
+func summary(obj trust.JSON) string {
+	switch o := obj.(type) {
+	case *trc.TRC:
+		return fmt.Sprintf("%s, %d core ASes, quorum %d, %d signatures, valid %s - %s", o,
+			len(o.CoreASes), o.QuorumTRC, len(o.Signatures), util.TimeToString(o.CreationTime),
+			util.TimeToString(o.ExpirationTime))
+	case *cert.Chain:
+		return fmt.Sprintf("%s, issued by %s, valid %s - %s", o, o.Leaf.Issuer,
+			util.TimeToString(o.Leaf.IssuingTime), util.TimeToString(o.Leaf.ExpirationTime))
+	case *cert.Certificate:
+		return fmt.Sprintf("%s, valid %s - %s", o, util.TimeToString(o.IssuingTime),
+			util.TimeToString(o.ExpirationTime))
+	case *cert.RevList:
+		return fmt.Sprintf("%s, %d entries, issued %s", o, len(o.Entries),
+			util.TimeToString(o.IssuingTime))
+	}
+	return fmt.Sprintf("%s", obj)
+}
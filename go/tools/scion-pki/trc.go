@@ -0,0 +1,145 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/crypto/trc"
+	"github.com/scionproto/scion/go/lib/trust"
+	"github.com/scionproto/scion/go/lib/util"
+)
+
+func runTRC(args []string) {
+	runSub("trc", "create | sign | verify", map[string]func([]string){
+		"create": runTRCCreate,
+		"sign":   runTRCSign,
+		"verify": runTRCVerify,
+	}, args)
+}
+
+// runTRCCreate creates an unsigned TRC from a template. The template is a TRC in JSON format. If
+// the creation or expiration time are not set, they are set to now and now plus the validity.
+func runTRCCreate(args []string) {
+	fs := newFlagSet("trc create", "-template FILE -out FILE [flags]")
+	template := fs.String("template", "", "TRC template in JSON format (Required)")
+	out := fs.String("out", "", "Output TRC file (Required)")
+	validity := fs.Duration("validity", Year, "Validity period, if not set in the template")
+	fs.Parse(args)
+	required(fs, *template, *out)
+	t := loadTRC(*template)
+	if t.CreationTime == 0 {
+		t.CreationTime = timestamp(time.Now())
+	}
+	if t.ExpirationTime == 0 {
+		t.ExpirationTime = t.CreationTime + uint64(validity.Seconds())
+	}
+	if t.ExpirationTime <= t.CreationTime {
+		fatal("TRC expires before it is created")
+	}
+	if len(t.CoreASes) == 0 {
+		fatal("TRC template contains no core ASes")
+	}
+	if t.QuorumTRC == 0 || int(t.QuorumTRC) > len(t.CoreASes) {
+		fatal("Invalid TRC quorum %d for %d core ASes", t.QuorumTRC, len(t.CoreASes))
+	}
+	t.Signatures = nil
+	writeTRC(*out, t)
+	fmt.Printf("Created %s, valid from %s to %s\n", t, util.TimeToString(t.CreationTime),
+		util.TimeToString(t.ExpirationTime))
+}
+
+// runTRCSign adds the signature of a core AS to a TRC. Core ASes of foreign ISDs cross-sign the
+// TRC, in which case the signing algorithm has to be given explicitly.
+func runTRCSign(args []string) {
+	fs := newFlagSet("trc sign", "-trc FILE -as ISD-AS -key FILE [flags]")
+	trcFile := fs.String("trc", "", "TRC file to sign (Required)")
+	iaStr := fs.String("as", "", "Signing core AS (Required)")
+	keyFile := fs.String("key", "", "Online root key file of the signing core AS (Required)")
+	passFile := fs.String("passfile", "", "Password file of an encrypted key file")
+	algo := fs.String("algo", "", "Signing algorithm (Default: online key algorithm in TRC)")
+	out := fs.String("out", "", "Output TRC file (Default: overwrite the TRC file)")
+	fs.Parse(args)
+	required(fs, *trcFile, *iaStr, *keyFile)
+	t := loadTRC(*trcFile)
+	ia := parseIA(*iaStr)
+	if *algo == "" {
+		coreAS, ok := t.CoreASes[*ia]
+		if !ok {
+			fatal("%s is not a core AS of %s, -algo is required to cross-sign", ia, t)
+		}
+		*algo = coreAS.OnlineKeyAlg
+	}
+	signer, err := trust.LoadSigner(*keyFile, loadPassword(*passFile))
+	if err != nil {
+		fatal("Unable to load key: %s", err)
+	}
+	if err = t.SignWith(ia.String(), signer, *algo); err != nil {
+		fatal("Unable to sign %s: %s", t, err)
+	}
+	if *out == "" {
+		*out = *trcFile
+	}
+	writeTRC(*out, t)
+	fmt.Printf("Signed %s as %s, %d signatures\n", t, ia, len(t.Signatures))
+}
+
+// runTRCVerify verifies a TRC against a trusted TRC, which is either its predecessor or the TRC
+// of a cross-signing ISD, and prints which core AS signatures are valid.
+func runTRCVerify(args []string) {
+	fs := newFlagSet("trc verify", "-trc FILE -prev FILE")
+	trcFile := fs.String("trc", "", "TRC file to verify (Required)")
+	prevFile := fs.String("prev", "", "Trusted predecessor or cross-signing TRC (Required)")
+	fs.Parse(args)
+	required(fs, *trcFile, *prevFile)
+	t, prev := loadTRC(*trcFile), loadTRC(*prevFile)
+	tvr, err := t.Verify(prev)
+	if tvr != nil {
+		printQuorumReport(tvr)
+	}
+	if err != nil {
+		fatal("Verification of %s against %s failed: %s", t, prev, err)
+	}
+	fmt.Printf("%s verified against %s\n", t, prev)
+}
+
+func printQuorumReport(tvr *trc.TRCVerResult) {
+	verified := append([]*addr.ISD_AS(nil), tvr.Verified...)
+	sortIAs(verified)
+	for _, ia := range verified {
+		fmt.Printf("  %-16s OK\n", ia)
+	}
+	failed := make([]*addr.ISD_AS, 0, len(tvr.Failed))
+	for ia := range tvr.Failed {
+		failed = append(failed, ia)
+	}
+	sortIAs(failed)
+	for _, ia := range failed {
+		fmt.Printf("  %-16s FAILED: %s\n", ia, tvr.Failed[ia])
+	}
+	result := "reached"
+	if !tvr.QuorumOk() {
+		result = "NOT reached"
+	}
+	fmt.Printf("Quorum %s: %d of %d required signatures valid\n", result,
+		len(tvr.Verified), tvr.Quorum)
+}
+
+func sortIAs(ias []*addr.ISD_AS) {
+	sort.Slice(ias, func(i, j int) bool { return ias[i].IAInt() < ias[j].IAInt() })
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tool to move trust material between the trust stores of infrastructure
+// elements, and to inspect quarantined trust objects.
+//
+// The trust store of an element is given by the same flags as for the
+// certificate server:
+//
+//	trustdb -id cs1-10-1 -confd gen/ISD1/AS10/cs1-10-1 -cached gen-cache export DIR
+//	trustdb -id cs1-11-1 -confd gen/ISD1/AS11/cs1-11-1 -cached gen-cache import DIR
+//	trustdb -id cs1-11-1 -confd gen/ISD1/AS11/cs1-11-1 -cached gen-cache quarantine
+//
+// Imported objects are verified against the trust store, unless -noverify is
+// given.
+//
+// Running elements (certificate servers, path servers and sciond) read their
+// trust store into memory at startup only. After an import, the element given
+// by -id must be restarted to use the imported objects; until then it neither
+// serves them nor verifies against them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/trust"
+)
+
+var (
+	id       = flag.String("id", "", "Element ID (Required. E.g. 'cs1-10-1')")
+	confDir  = flag.String("confd", "", "Configuration directory (Required)")
+	cacheDir = flag.String("cached", "gen-cache", "Caching directory")
+	noVerify = flag.Bool("noverify", false, "Import trust objects without verifying them")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] export DIR | import DIR | quarantine\n",
+		os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if *id == "" || *confDir == "" || !validArgs(args) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// validArgs returns whether args is one of the commands in the usage.
+func validArgs(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "export", "import":
+		return len(args) == 2
+	case "quarantine":
+		return len(args) == 1
+	}
+	return false
+}
+
+// run executes the command in args on the trust store. The store is closed before returning,
+// also on errors.
+func run(args []string) error {
+	store, err := trust.NewStore(filepath.Join(*confDir, "certs"), *cacheDir, *id)
+	if err != nil {
+		return common.NewBasicError("Unable to open trust store", err)
+	}
+	defer store.Close()
+	switch args[0] {
+	case "export":
+		n, err := store.Export(args[1])
+		if err != nil {
+			return common.NewBasicError("Export failed", err, "exported", n)
+		}
+		fmt.Printf("Exported %d trust objects to %s\n", n, args[1])
+	case "import":
+		n, err := store.Import(args[1], !*noVerify)
+		if err != nil {
+			return common.NewBasicError("Import failed", err, "imported", n)
+		}
+		fmt.Printf("Imported %d trust objects from %s\n", n, args[1])
+	case "quarantine":
+		q, err := store.GetQuarantined()
+		if err != nil {
+			return common.NewBasicError("Unable to list quarantined objects", err)
+		}
+		for _, obj := range q {
+			fmt.Println(obj)
+		}
+	}
+	return nil
+}